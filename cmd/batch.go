@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/batch"
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchInput string
+	batchJobs  int
+)
+
+// batchCmd downloads many playlists in one run.
+//
+// Unlike wrapping the root command in a shell loop, all jobs share one HTTP
+// connection pool and rate limit, and run in parallel.
+var batchCmd = &cobra.Command{
+	Use:   "batch [FILE]",
+	Short: "Download many playlists listed in a file",
+	Long: `Download every playlist listed in a file, or on stdin with -i -.
+
+Each line holds a URL, optionally followed by an output directory for that
+job. Relative output directories are resolved against --output. Jobs without
+one get their own directory in --output named after the playlist's host and
+path (e.g. example.com_show1_master). Jobs can't share an output directory or
+nest inside each other's. Blank lines and lines starting with '#' are ignored.
+
+All download flags apply to every job. Jobs share one connection pool and rate
+limit, and up to --jobs of them run at once. A summary with the status of each
+job is printed at the end, and the command fails if any job failed.`,
+	Example: `  # Download every stream listed in a file, three at a time
+  m3u8dl batch --jobs 3 -o ./mirror urls.txt
+
+  # Read the list from stdin and stay under 50 requests per second overall
+  cat urls.txt | m3u8dl batch -i - --rate-limit 50
+
+  # Example urls.txt
+  https://example.com/show1/master.m3u8 show1
+  https://example.com/show2/master.m3u8 /srv/media/show2`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE:         runBatch,
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	addDownloadFlags(batchCmd)
+	batchCmd.Flags().StringVarP(&batchInput, "input", "i", "", "File with one URL per line (- for stdin)")
+	batchCmd.Flags().IntVarP(&batchJobs, "jobs", "j", 2, "Number of jobs to run at once")
+}
+
+// runBatch is the main execution function for the batch command.
+func runBatch(cmd *cobra.Command, args []string) error {
+	input := batchInput
+	if len(args) > 0 {
+		if input != "" {
+			return fmt.Errorf("give the job list either as an argument or with --input, not both")
+		}
+		input = args[0]
+	}
+	if input == "" {
+		return fmt.Errorf("no job list given (use a file argument or -i - for stdin)")
+	}
+	if batchJobs < 1 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+
+	cfg, err := downloadConfig()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("cannot read job list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	jobs, err := batch.ParseJobs(r, cfg.OutputDir)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("job list is empty")
+	}
+
+	if verbose {
+		fmt.Printf("Starting %d jobs, %d at a time\n", len(jobs), batchJobs)
+		printConfig(cfg)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var finished atomic.Int32
+	events := json.NewEncoder(os.Stderr)
+	results := batch.Run(ctx, jobs, cfg, batchJobs, func(result batch.Result) {
+		switch cfg.Progress {
+		case downloader.ProgressNone:
+		case downloader.ProgressJSON:
+			event := downloader.ProgressEvent{
+				Event: "job",
+				Time:  time.Now().UTC(),
+				URL:   result.Job.URL,
+				Path:  result.Job.OutputDir,
+				Stats: &result.Stats,
+			}
+			if result.Err != nil {
+				event.Message = result.Err.Error()
+			}
+			events.Encode(event)
+		default:
+			status := "done"
+			if result.Err != nil {
+				status = "FAILED: " + result.Err.Error()
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s %s\n", finished.Add(1), len(jobs), result.Job.URL, status)
+		}
+	})
+
+	if manifest != "" {
+		var entries []downloader.ManifestEntry
+		for _, result := range results {
+			entries = append(entries, result.Manifest...)
+		}
+		if err := downloader.WriteManifest(manifest, entries); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case dryRun:
+		var plan []downloader.PlannedFile
+		for _, result := range results {
+			plan = append(plan, result.Plan...)
+		}
+		printPlan(plan)
+	case cfg.Progress == downloader.ProgressJSON:
+		total := batchTotals(results)
+		events.Encode(downloader.ProgressEvent{Event: "summary", Time: time.Now().UTC(), Stats: &total})
+	case cfg.Progress != downloader.ProgressNone:
+		printBatchSummary(results)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(results))
+	}
+	return nil
+}
+
+// batchTotals adds up the counters of all jobs. Elapsed is the longest job's.
+func batchTotals(results []batch.Result) downloader.Stats {
+	var total downloader.Stats
+	for _, result := range results {
+		stats := result.Stats
+		total.Files += stats.Files
+		total.Playlists += stats.Playlists
+		total.Segments += stats.Segments
+		total.Bytes += stats.Bytes
+		total.DedupedFiles += stats.DedupedFiles
+		total.DedupedBytes += stats.DedupedBytes
+		total.Elapsed = max(total.Elapsed, stats.Elapsed)
+	}
+	total.ElapsedMs = total.Elapsed.Milliseconds()
+	if total.Elapsed > 0 {
+		total.BytesPerSecond = float64(total.Bytes) / total.Elapsed.Seconds()
+	}
+	return total
+}
+
+// printBatchSummary prints a table with the status of every job and the
+// combined totals.
+func printBatchSummary(results []batch.Result) {
+	succeeded := 0
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tURL\tOUTPUT\tFILES\tSIZE\tTIME")
+	for _, result := range results {
+		status := "OK"
+		if result.Err != nil {
+			status = "FAILED"
+		} else {
+			succeeded++
+		}
+		stats := result.Stats
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", status, result.Job.URL, result.Job.OutputDir,
+			stats.Files, downloader.FormatBytes(stats.Bytes), downloader.FormatDuration(stats.Elapsed))
+	}
+	w.Flush()
+
+	total := batchTotals(results)
+	fmt.Printf("\n%d of %d jobs succeeded, %d files, %s\n", succeeded, len(results), total.Files, downloader.FormatBytes(total.Bytes))
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("  line %d: %s: %v\n", result.Job.Line, result.Job.URL, result.Err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/knpwrs/m3u8dl/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	configPath  string
+	profileName string
+)
+
+// envPrefix is the prefix of environment variables that set flags, e.g.
+// M3U8DL_CONCURRENCY for --concurrency.
+const envPrefix = "M3U8DL_"
+
+// addConfigFlags registers --config and --profile on cmd and loads the
+// configuration before it runs.
+func addConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&configPath, "config", "", "Config file (default ./"+config.FileName+", then the user config directory)")
+	cmd.Flags().StringVar(&profileName, "profile", "", "Config file profile to use")
+	cmd.PreRunE = applyConfig
+}
+
+// applyConfig fills in every flag that wasn't given on the command line from
+// the environment or the config file.
+//
+// The precedence is flag > environment variable > config profile > config
+// defaults > built-in default.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	// The config file and profile can themselves come from the environment
+	for _, name := range []string{"config", "profile"} {
+		if err := applyEnv(flags, flags.Lookup(name)); err != nil {
+			return err
+		}
+	}
+
+	path, err := config.Find(configPath)
+	if err != nil {
+		return err
+	}
+
+	settings := config.Settings{}
+	source := ""
+	if path != "" {
+		file, err := config.Load(path)
+		if err != nil {
+			return err
+		}
+		settings, err = file.Settings(profileName)
+		if err != nil {
+			return err
+		}
+		source = path
+	} else if profileName != "" {
+		return fmt.Errorf("--profile %s given but no config file found", profileName)
+	}
+
+	// Commands that only fetch playlists share the config file with the
+	// download command, so they skip the download settings they don't have
+	for name := range settings {
+		if name == "config" || name == "profile" || name == "help" || (flags.Lookup(name) == nil && rootCmd.Flags().Lookup(name) == nil) {
+			return fmt.Errorf("%s: unknown setting %q", source, name)
+		}
+	}
+
+	var applyErr error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if applyErr != nil || flag.Changed || flag.Name == "help" || flag.Name == "config" || flag.Name == "profile" {
+			return
+		}
+		if _, ok := os.LookupEnv(envName(flag.Name)); ok {
+			applyErr = applyEnv(flags, flag)
+			return
+		}
+		value, ok := settings[flag.Name]
+		if !ok {
+			return
+		}
+		values, err := config.Values(value)
+		if err != nil {
+			applyErr = fmt.Errorf("%s: invalid value for %s: %w", source, flag.Name, err)
+			return
+		}
+		if err := setFlag(flags, flag, values); err != nil {
+			applyErr = fmt.Errorf("%s: %w", source, err)
+		}
+	})
+	if applyErr != nil {
+		return applyErr
+	}
+
+	return checkExclusiveFlags(flags)
+}
+
+// checkExclusiveFlags rejects exclusiveFlags pairs that are both set,
+// whether on the command line, in the environment or in the config file.
+func checkExclusiveFlags(flags *pflag.FlagSet) error {
+	isSet := func(name string) bool {
+		flag := flags.Lookup(name)
+		return flag != nil && flag.Changed
+	}
+
+	for _, pair := range exclusiveFlags {
+		if isSet(pair[0]) && isSet(pair[1]) {
+			return fmt.Errorf("--%s and --%s cannot be used together (check the config file and %s* environment variables)", pair[0], pair[1], envPrefix)
+		}
+	}
+	return nil
+}
+
+// applyEnv sets a flag from its environment variable, unless it was given on
+// the command line.
+//
+// Multi-value flags like --header take one value per line.
+func applyEnv(flags *pflag.FlagSet, flag *pflag.Flag) error {
+	value, ok := os.LookupEnv(envName(flag.Name))
+	if flag.Changed || !ok {
+		return nil
+	}
+
+	values := []string{value}
+	if flag.Value.Type() == "stringArray" {
+		values = strings.Split(strings.TrimSpace(value), "\n")
+	}
+
+	if err := setFlag(flags, flag, values); err != nil {
+		return fmt.Errorf("%s: %w", envName(flag.Name), err)
+	}
+	return nil
+}
+
+// setFlag sets a flag to each of values in turn, which replaces the default
+// of list flags and then appends to it.
+//
+// A value that only restates the default (e.g. "absolutize: false") doesn't
+// count as set, so it can't conflict with an exclusive flag.
+func setFlag(flags *pflag.FlagSet, flag *pflag.Flag, values []string) error {
+	for _, value := range values {
+		if err := flags.Set(flag.Name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, flag.Name, err)
+		}
+	}
+	if flag.Value.String() == flag.DefValue {
+		flag.Changed = false
+	}
+	return nil
+}
+
+// envName returns the environment variable for a flag, e.g. M3U8DL_USER_AGENT
+// for --user-agent.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	config := `
+defaults:
+  concurrency: 8
+  user-agent: from-defaults
+  flatten: true
+profiles:
+  a:
+    user-agent: from-profile
+    exclude: [.vtt, .srt]
+    header:
+      Referer: https://example.com/
+`
+	if err := os.WriteFile("m3u8dl.yaml", []byte(config), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	t.Setenv("M3U8DL_PROFILE", "a")
+	t.Setenv("M3U8DL_USER_AGENT", "from-env")
+	t.Setenv("M3U8DL_CONCURRENCY", "4")
+
+	cmd := &cobra.Command{Use: "test", RunE: func(*cobra.Command, []string) error { return nil }}
+	addDownloadFlags(cmd)
+	cmd.SetArgs([]string{"--concurrency", "2"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if concurrency != 2 {
+		t.Errorf("Expected the flag to win, got concurrency %d", concurrency)
+	}
+	if userAgent != "from-env" {
+		t.Errorf("Expected the environment to win over the profile, got user agent %q", userAgent)
+	}
+	if len(exclude) != 2 || exclude[0] != ".vtt" || exclude[1] != ".srt" {
+		t.Errorf("Expected exclude from the profile, got %v", exclude)
+	}
+	if len(headers) != 1 || headers[0] != "Referer: https://example.com/" {
+		t.Errorf("Expected headers from the profile, got %v", headers)
+	}
+	if !flatten {
+		t.Error("Expected flatten from the defaults")
+	}
+	if outputDir != "." {
+		t.Errorf("Expected the built-in default output directory, got %q", outputDir)
+	}
+}
+
+func TestApplyConfigRejectsUnknownSettings(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	if err := os.WriteFile("m3u8dl.yaml", []byte("defaults:\n  concurrancy: 3\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cmd := &cobra.Command{Use: "test", RunE: func(*cobra.Command, []string) error { return nil }}
+	addDownloadFlags(cmd)
+	cmd.SetArgs([]string{})
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	if err := cmd.Execute(); err == nil {
+		t.Error("Expected an error for a misspelled setting")
+	}
+}
+
+func TestApplyConfigFetchCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	config := `
+profiles:
+  a:
+    header:
+      Referer: https://example.com/
+    proxy: http://proxy.internal:3128
+    output: /srv/media
+`
+	if err := os.WriteFile("m3u8dl.yaml", []byte(config), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// Download settings such as output are skipped, not rejected
+	cmd := &cobra.Command{Use: "test", RunE: func(*cobra.Command, []string) error { return nil }}
+	addFetchFlags(cmd)
+	cmd.SetArgs([]string{"--profile", "a", "--user-agent", "tester"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	cfg, err := fetchConfig()
+	if err != nil {
+		t.Fatalf("fetchConfig failed: %v", err)
+	}
+	if cfg.UserAgent != "tester" || cfg.Headers.Get("Referer") != "https://example.com/" {
+		t.Errorf("Expected the user agent and headers to apply, got %+v", cfg)
+	}
+	if cfg.Proxy == nil || cfg.Proxy.Host != "proxy.internal:3128" {
+		t.Errorf("Expected the profile's proxy, got %v", cfg.Proxy)
+	}
+}
+
+func TestApplyConfigExclusiveFlags(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	config := `
+profiles:
+  portable:
+    absolutize: true
+  explicit:
+    absolutize: false
+`
+	if err := os.WriteFile("m3u8dl.yaml", []byte(config), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		wantErr bool
+	}{
+		{"profile and flag", nil, []string{"--profile", "portable", "--rewrite-base", "https://cdn.example.com/"}, true},
+		{"environment and flag", map[string]string{"M3U8DL_QUIET": "true"}, []string{"--verbose"}, true},
+		{"profile and environment", map[string]string{"M3U8DL_REWRITE_BASE": "https://cdn.example.com/"}, []string{"--profile", "portable"}, true},
+		{"default value spelled out", nil, []string{"--profile", "explicit", "--rewrite-base", "https://cdn.example.com/"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cmd := &cobra.Command{Use: "test", RunE: func(*cobra.Command, []string) error { return nil }}
+			addDownloadFlags(cmd)
+			cmd.SetArgs(tt.args)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+			if err := cmd.Execute(); (err != nil) != tt.wantErr {
+				t.Errorf("Execute() error = %v; expected an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/knpwrs/m3u8dl/internal/inspect"
+	"github.com/spf13/cobra"
+)
+
+var inspectJSON bool
+
+// inspectCmd shows what a playlist contains without downloading segments.
+var inspectCmd = &cobra.Command{
+	Use:   "inspect URL",
+	Short: "Show the contents of a playlist without downloading it",
+	Long: `Fetch a master playlist and its child playlists (but no segments) and print
+a tree of what a download would contain.
+
+Variants are shown with their bandwidth, resolution, frame rate and codecs, and
+renditions with their type, language and group. Each media playlist is
+summarized with its segment count, duration and encryption methods. The
+estimated size of each variant is its bandwidth multiplied by its duration.`,
+	Example: `  # Show the variants and renditions of a stream
+  m3u8dl inspect https://example.com/video/master.m3u8
+
+  # Produce JSON for scripts
+  m3u8dl inspect --json https://example.com/video/master.m3u8
+
+  # Inspect an origin that needs headers, using a config profile
+  m3u8dl inspect --profile studio -H "Authorization: Bearer abc" https://example.com/video/master.m3u8`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runInspect,
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "Print the report as JSON")
+	addFetchFlags(inspectCmd)
+}
+
+// runInspect is the main execution function for the inspect command.
+func runInspect(cmd *cobra.Command, args []string) error {
+	f, err := newFetcher()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := inspect.Inspect(ctx, f, args[0])
+	if err != nil {
+		return err
+	}
+
+	if inspectJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+
+	inspect.WriteTree(os.Stdout, report)
+	return nil
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/lint"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lintJSON           bool
+	lintStrict         bool
+	lintNoRecurse      bool
+	lintReloads        int
+	lintReloadInterval time.Duration
+)
+
+// lintCmd checks playlists against the rules of RFC 8216.
+var lintCmd = &cobra.Command{
+	Use:   "lint URL|FILE",
+	Short: "Check a playlist against the HLS specification",
+	Long: `Validate a playlist, and the variant and rendition playlists of a master
+playlist, against the rules of RFC 8216.
+
+The checks cover the #EXTM3U header, attribute list syntax and required
+attributes, EXTINF durations against EXT-X-TARGETDURATION, the EXT-X-VERSION
+the features used require, missing CODECS or BANDWIDTH on variants, undefined
+rendition groups and duplicate URIs. With --reloads, live media playlists are
+reloaded to check that EXT-X-MEDIA-SEQUENCE never goes backwards and that
+EXT-X-DISCONTINUITY-SEQUENCE matches the discontinuities removed.
+
+Each issue is printed as a tab-separated line (severity, playlist:line, rule,
+message), or as a JSON report with --json. The command exits with a non-zero
+status if any error is found, or any warning with --strict.
+
+The same checks run before downloading with the --lint flag of m3u8dl.`,
+	Example: `  # Lint a stream and all of its child playlists
+  m3u8dl lint https://example.com/video/master.m3u8
+
+  # Lint a local playlist only
+  m3u8dl lint --no-recurse ./downloads/index.m3u8
+
+  # Watch a live playlist over five reloads
+  m3u8dl lint --reloads 5 https://example.com/live/index.m3u8
+
+  # Fail on warnings too, with a JSON report for CI
+  m3u8dl lint --strict --json ./downloads/master.m3u8`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         runLint,
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+
+	lintCmd.Flags().BoolVar(&lintJSON, "json", false, "Print the report as JSON")
+	lintCmd.Flags().BoolVar(&lintStrict, "strict", false, "Exit with a non-zero status on warnings too")
+	lintCmd.Flags().BoolVar(&lintNoRecurse, "no-recurse", false, "Don't lint the child playlists of a master playlist")
+	lintCmd.Flags().IntVar(&lintReloads, "reloads", 0, "Reload live media playlists this many times to check their sequence numbers")
+	lintCmd.Flags().DurationVar(&lintReloadInterval, "reload-interval", 0, "Time between reloads (default: the target duration)")
+	addFetchFlags(lintCmd)
+}
+
+// runLint is the main execution function for the lint command.
+func runLint(cmd *cobra.Command, args []string) error {
+	if lintReloads < 0 {
+		return fmt.Errorf("invalid --reloads %d: must not be negative", lintReloads)
+	}
+
+	f, err := newFetcher()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := lint.Run(ctx, f, args[0], lint.Options{
+		Recursive:      !lintNoRecurse,
+		Reloads:        lintReloads,
+		ReloadInterval: lintReloadInterval,
+	})
+	if err != nil {
+		return err
+	}
+
+	if lintJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else {
+		for _, issue := range report.Issues {
+			location := issue.Playlist
+			if issue.Line > 0 {
+				location += ":" + strconv.Itoa(issue.Line)
+			}
+			fields := []string{strings.ToUpper(string(issue.Severity)), location, issue.Rule, issue.Message}
+			fmt.Println(strings.Join(fields, "\t"))
+		}
+		fmt.Fprintf(os.Stderr, "Linted %d playlists: %d errors, %d warnings\n",
+			report.Playlists, report.Errors(), report.Warnings())
+	}
+
+	if report.Errors() > 0 || (lintStrict && report.Warnings() > 0) {
+		return fmt.Errorf("lint failed: %d errors, %d warnings", report.Errors(), report.Warnings())
+	}
+	return nil
+}
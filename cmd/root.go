@@ -3,22 +3,60 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/knpwrs/m3u8dl/internal/downloader"
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+	"github.com/knpwrs/m3u8dl/internal/filesystem"
 	"github.com/spf13/cobra"
 )
 
 var (
-	outputDir   string
-	noRewrite   bool
-	flatten     bool
-	include     []string
-	exclude     []string
-	concurrency int
-	userAgent   string
-	verbose     bool
+	outputDir    string
+	noRewrite    bool
+	flatten      bool
+	include      []string
+	exclude      []string
+	includeTypes []string
+	excludeTypes []string
+	noIFrames    bool
+	noImages     bool
+	includeRegex []string
+	excludeRegex []string
+	concurrency  int
+	userAgent    string
+	verbose      bool
+	overwrite    string
+	fsync        bool
+	dedupe       bool
+	rewriteBase  string
+	rewriteQuery string
+	filteredRefs string
+	absolutize   bool
+	dryRun       bool
+	dryRunSizes  bool
+	manifest     string
+	rateLimit    float64
+	headers      []string
+	proxy        string
+	clipStart    string
+	clipEnd      string
+	firstN       int
+	ads          string
+	progress     string
+	quiet        bool
+	redirects    string
+	pathway      string
+	lintFirst    bool
+	dashManifest bool
+	mergeSubs    bool
+	exportSRT    bool
 )
 
 // rootCmd represents the base command when called without any subcommands.
@@ -35,7 +73,8 @@ var rootCmd = &cobra.Command{
 
 It downloads the M3U8 file and all resources it references (segments, nested playlists,
 encryption keys, subtitles, etc.), and can optionally rewrite URLs to create a fully
-local copy that can be played without network access.`,
+local copy that can be played without network access. MPEG-DASH (.mpd) manifests are
+mirrored the same way.`,
 	Example: `  # Download M3U8 and all references to current directory
   m3u8dl https://example.com/playlist.m3u8
 
@@ -45,6 +84,9 @@ local copy that can be played without network access.`,
   # Download without rewriting URLs (keep original absolute URLs)
   m3u8dl --no-rewrite https://example.com/playlist.m3u8
 
+  # Keep playlists streaming from the origin, wherever they are stored
+  m3u8dl --no-rewrite --absolutize https://example.com/playlist.m3u8
+
   # Flatten directory structure
   m3u8dl --flatten -o ./downloads https://example.com/playlist.m3u8
 
@@ -52,7 +94,61 @@ local copy that can be played without network access.`,
   m3u8dl --include .m3u8,.ts https://example.com/playlist.m3u8
 
   # Download everything except subtitles
-  m3u8dl --exclude .vtt,.srt https://example.com/playlist.m3u8`,
+  m3u8dl --exclude .vtt,.srt https://example.com/playlist.m3u8
+
+  # Skip subtitles and trick-play tracks, and everything on the ad server
+  m3u8dl --exclude-type subtitle,iframe,image --exclude-regex '^https://ads\.' https://example.com/playlist.m3u8
+
+  # Mirror a stream without its trick-play tracks and thumbnails
+  m3u8dl --no-iframes --no-images https://example.com/playlist.m3u8
+
+  # Drop subtitles from the rewritten playlists instead of streaming them from the origin
+  m3u8dl --exclude .vtt --filtered-refs remove https://example.com/playlist.m3u8
+
+  # Rewrite URLs for re-hosting the mirror on another server
+  m3u8dl --rewrite-base https://media.example.net/show1/ https://example.com/playlist.m3u8
+
+  # Mirror the CDN-B copy of a content-steered stream
+  m3u8dl --pathway CDN-B https://example.com/master.m3u8
+
+  # Mirror an MPEG-DASH stream
+  m3u8dl https://example.com/video/manifest.mpd
+
+  # Also serve an fMP4 stream to DASH players from the same mirror
+  m3u8dl --dash-manifest https://example.com/cmaf/master.m3u8
+
+  # Merge each subtitle rendition into one WebVTT file and an SRT file
+  m3u8dl --merge-subtitles --srt https://example.com/master.m3u8
+
+  # Refuse to mirror playlists that break RFC 8216
+  m3u8dl --lint https://example.com/playlist.m3u8
+
+  # Store a playlist that redirects to a CDN edge under the edge's path
+  m3u8dl --redirect-paths final https://example.com/live/master.m3u8
+
+  # Resume an interrupted download without re-writing existing files
+  m3u8dl --overwrite never -o ./downloads https://example.com/playlist.m3u8
+
+  # Record the source, checksum and headers of every file for auditing
+  m3u8dl --manifest ./downloads/manifest.jsonl -o ./downloads https://example.com/playlist.m3u8
+
+  # Send extra headers through a proxy
+  m3u8dl -H "Referer: https://example.com/" --proxy http://proxy:3128 https://example.com/playlist.m3u8
+
+  # Use the settings of a config file profile
+  m3u8dl --profile cdn-a https://example.com/playlist.m3u8
+
+  # Download only a two minute clip of a long VOD
+  m3u8dl --start 00:45:00 --end 00:47:00 https://example.com/playlist.m3u8
+
+  # Mirror a stream without its ad breaks
+  m3u8dl --ads skip https://example.com/playlist.m3u8
+
+  # Report progress as JSON lines on stderr for a job runner
+  m3u8dl --progress json https://example.com/playlist.m3u8
+
+  # List what would be downloaded, and where, with sizes from HEAD requests
+  m3u8dl --dry-run --dry-run-sizes --exclude .vtt https://example.com/playlist.m3u8`,
 	Args: cobra.ExactArgs(1),
 	RunE: runDownload,
 }
@@ -69,14 +165,121 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&outputDir, "output", "o", ".", "Output directory for downloaded files")
-	rootCmd.Flags().BoolVar(&noRewrite, "no-rewrite", false, "Do not rewrite URLs in M3U8 files (keep original URLs)")
-	rootCmd.Flags().BoolVar(&flatten, "flatten", false, "Flatten directory structure instead of preserving URL paths")
-	rootCmd.Flags().StringSliceVar(&include, "include", []string{}, "File extensions to include (comma-separated, e.g., .m3u8,.ts)")
-	rootCmd.Flags().StringSliceVar(&exclude, "exclude", []string{}, "File extensions to exclude (comma-separated, e.g., .vtt,.srt)")
-	rootCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 5, "Number of concurrent downloads")
-	rootCmd.Flags().StringVar(&userAgent, "user-agent", "", "Custom User-Agent header")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose logging")
+	addDownloadFlags(rootCmd)
+}
+
+// addDownloadFlags registers the flags that configure a download on cmd.
+//
+// They are shared by the root command and batch, and bound to the same
+// variables, so downloadConfig works for both.
+func addDownloadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&outputDir, "output", "o", ".", "Output directory for downloaded files")
+	cmd.Flags().BoolVar(&noRewrite, "no-rewrite", false, "Do not rewrite URLs in M3U8 files (keep original URLs)")
+	cmd.Flags().BoolVar(&flatten, "flatten", false, "Flatten directory structure instead of preserving URL paths")
+	cmd.Flags().StringSliceVar(&include, "include", []string{}, "File extensions to include (comma-separated, e.g., .m3u8,.ts)")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", []string{}, "File extensions to exclude (comma-separated, e.g., .vtt,.srt)")
+	cmd.Flags().StringSliceVar(&includeTypes, "include-type", []string{}, "Resource types to include (comma-separated: playlist, segment, key, init-map, subtitle, iframe, image, session-data, steering)")
+	cmd.Flags().StringSliceVar(&excludeTypes, "exclude-type", []string{}, "Resource types to exclude (comma-separated, e.g., subtitle,iframe)")
+	cmd.Flags().BoolVar(&noIFrames, "no-iframes", false, "Don't download I-frame (trick-play) playlists and their segments (same as --exclude-type iframe)")
+	cmd.Flags().BoolVar(&noImages, "no-images", false, "Don't download image (thumbnail) playlists and their images (same as --exclude-type image)")
+	cmd.Flags().StringArrayVar(&includeRegex, "include-regex", nil, "Only download URLs matching this regular expression (repeatable)")
+	cmd.Flags().StringArrayVar(&excludeRegex, "exclude-regex", nil, "Don't download URLs matching this regular expression (repeatable)")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", 5, "Number of concurrent downloads")
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose logging")
+	cmd.Flags().StringVar(&progress, "progress", "auto", "Progress output (auto, text, plain, json, none); auto is text on a terminal and plain otherwise")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print nothing but errors (same as --progress none)")
+	cmd.Flags().StringVar(&overwrite, "overwrite", "always", "Overwrite policy for existing files (always, never, if-newer, if-size-differs)")
+	cmd.Flags().BoolVar(&fsync, "fsync", false, "Fsync files and directories after writing")
+	cmd.Flags().BoolVar(&absolutize, "absolutize", false, "Rewrite every URL to its absolute origin URL (implies --no-rewrite)")
+	cmd.Flags().StringVar(&pathway, "pathway", "", "Content steering pathway (PATHWAY-ID, or DASH BaseURL serviceLocation) to download (default: the steering manifest's first choice)")
+	cmd.Flags().BoolVar(&lintFirst, "lint", false, "Lint every playlist before downloading what it references, and stop on errors")
+	cmd.Flags().BoolVar(&mergeSubs, "merge-subtitles", false, "Also merge the segments of each subtitle rendition into one WebVTT file named after its LANGUAGE and NAME")
+	cmd.Flags().BoolVar(&exportSRT, "srt", false, "Also export each subtitle rendition as one SRT file named after its LANGUAGE and NAME")
+	cmd.Flags().BoolVar(&dashManifest, "dash-manifest", false, "Also write a DASH manifest.mpd describing the fMP4 variants and renditions next to the top-level playlist")
+	cmd.Flags().StringVar(&redirects, "redirect-paths", "requested", "Where to store redirected playlists and their references (requested: as if not redirected, final: under the URL redirected to)")
+	cmd.Flags().StringVar(&filteredRefs, "filtered-refs", "remote", "How rewritten playlists reference filtered-out files (remote: point at the origin URL, remove: drop them)")
+	cmd.Flags().BoolVar(&dedupe, "dedupe", false, "Store byte-identical files once, hardlinking duplicates with the same Last-Modified")
+	cmd.Flags().StringVar(&rewriteBase, "rewrite-base", "", "Rewrite URLs to absolute URLs under this base (for re-hosting the mirror)")
+	cmd.Flags().StringVar(&rewriteQuery, "rewrite-query", "", "Query string appended to every URL rewritten with --rewrite-base (e.g., a signed-URL token)")
+
+	cmd.Flags().StringVar(&clipStart, "start", "", "Only download from this point of each media playlist (HH:MM:SS, seconds, or an RFC 3339 date-time)")
+	cmd.Flags().StringVar(&clipEnd, "end", "", "Only download up to this point of each media playlist (HH:MM:SS, seconds, or an RFC 3339 date-time)")
+	cmd.Flags().IntVar(&firstN, "first-n-segments", 0, "Only download the first N segments of each media playlist (after --start)")
+	cmd.Flags().StringVar(&ads, "ads", "keep", "What to do with ad breaks marked by SCTE-35, CUE-OUT/CUE-IN or EXT-X-DATERANGE (keep, skip: remove them, only: keep nothing else)")
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the files that would be downloaded and their local paths without downloading segments or writing files")
+	cmd.Flags().BoolVar(&dryRunSizes, "dry-run-sizes", false, "Look up file sizes with HEAD requests in dry-run mode")
+	cmd.Flags().StringVar(&manifest, "manifest", "", "Write a JSON manifest of every downloaded file to this path (.jsonl for one entry per line)")
+
+	addFetchFlags(cmd)
+
+	for _, pair := range exclusiveFlags {
+		cmd.MarkFlagsMutuallyExclusive(pair[0], pair[1])
+	}
+}
+
+// exclusiveFlags are the pairs of download flags that can't be used
+// together.
+//
+// Cobra only checks them on the command line, so applyConfig checks them
+// again once the config file and environment have been applied.
+var exclusiveFlags = [][2]string{
+	{"absolutize", "rewrite-base"},
+	{"dry-run", "manifest"},
+	{"quiet", "verbose"},
+}
+
+// addFetchFlags registers the flags that configure how requests are made,
+// along with --config and --profile, on cmd.
+//
+// Every command that fetches playlists uses them, bound to the same
+// variables, so fetchConfig builds the same fetcher for all of them.
+func addFetchFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&userAgent, "user-agent", "", "Custom User-Agent header")
+	cmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "Extra request header as \"Name: value\" (repeatable)")
+	cmd.Flags().StringVar(&proxy, "proxy", "", "Proxy URL for all requests (default from HTTP_PROXY/HTTPS_PROXY)")
+	cmd.Flags().Float64Var(&rateLimit, "rate-limit", 0, "Maximum requests per second (0 means unlimited)")
+
+	addConfigFlags(cmd)
+}
+
+// fetchConfig validates the flags registered by addFetchFlags and builds the
+// request settings of a downloader configuration from them.
+func fetchConfig() (downloader.Config, error) {
+	requestHeaders := make(http.Header)
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return downloader.Config{}, fmt.Errorf("invalid header %q: expected \"Name: value\"", header)
+		}
+		requestHeaders.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	var proxyURL *url.URL
+	if proxy != "" {
+		var err error
+		proxyURL, err = url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return downloader.Config{}, fmt.Errorf("--proxy must be a URL such as http://host:port")
+		}
+	}
+
+	return downloader.Config{
+		UserAgent: userAgent,
+		RateLimit: rateLimit,
+		Headers:   requestHeaders,
+		Proxy:     proxyURL,
+	}, nil
+}
+
+// newFetcher builds the fetcher for commands that only fetch playlists, with
+// the same settings a download would use.
+func newFetcher() (*fetcher.Fetcher, error) {
+	cfg, err := fetchConfig()
+	if err != nil {
+		return nil, err
+	}
+	return downloader.NewFetcher(cfg), nil
 }
 
 // runDownload is the main execution function for the root command.
@@ -88,47 +291,333 @@ func runDownload(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("URL must start with http:// or https://")
 	}
 
+	cfg, err := downloadConfig()
+	if err != nil {
+		return err
+	}
+
+	// Create and run downloader
+	dl := downloader.New(cfg)
+	ctx := context.Background()
+
+	if verbose {
+		fmt.Printf("Starting download of %s\n", m3u8URL)
+		printConfig(cfg)
+	}
+
+	downloadErr := dl.Download(ctx, m3u8URL)
+
+	// Write the manifest even if the download failed, so there is a record
+	// of what was fetched
+	if manifest != "" {
+		if err := downloader.WriteManifest(manifest, dl.Manifest()); err != nil {
+			return err
+		}
+	}
+
+	if downloadErr != nil {
+		return fmt.Errorf("download failed: %w", downloadErr)
+	}
+
+	if dryRun {
+		printPlan(dl.Plan())
+		return nil
+	}
+
+	if cfg.Progress == downloader.ProgressText || cfg.Progress == downloader.ProgressPlain {
+		fmt.Println("Download completed successfully")
+	}
+	return nil
+}
+
+// downloadConfig validates the download flags and builds a downloader
+// configuration from them.
+func downloadConfig() (downloader.Config, error) {
+	overwritePolicy, err := filesystem.ParseOverwritePolicy(overwrite)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	filteredMode, err := downloader.ParseFilteredMode(filteredRefs)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	redirectMode, err := downloader.ParseRedirectMode(redirects)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	adMode, err := downloader.ParseAdMode(ads)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	var rewriteBaseURL *url.URL
+	if rewriteBase != "" {
+		if noRewrite {
+			return downloader.Config{}, fmt.Errorf("--rewrite-base cannot be used with --no-rewrite")
+		}
+		rewriteBaseURL, err = url.Parse(rewriteBase)
+		if err != nil || (rewriteBaseURL.Scheme != "http" && rewriteBaseURL.Scheme != "https") {
+			return downloader.Config{}, fmt.Errorf("--rewrite-base must be an http:// or https:// URL")
+		}
+	}
+	if rewriteQuery != "" && rewriteBase == "" {
+		return downloader.Config{}, fmt.Errorf("--rewrite-query requires --rewrite-base")
+	}
+
+	request, err := fetchConfig()
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	clip, err := clipConfig()
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	progressMode, err := progressConfig()
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
+	if rateLimit < 0 {
+		return downloader.Config{}, fmt.Errorf("--rate-limit must not be negative")
+	}
+
+	if dryRunSizes && !dryRun {
+		return downloader.Config{}, fmt.Errorf("--dry-run-sizes requires --dry-run")
+	}
+
 	// Normalize include/exclude extensions
 	include = normalizeExtensions(include)
 	exclude = normalizeExtensions(exclude)
 
+	includeTypeList, err := parseResourceTypes("--include-type", includeTypes)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+	excludeTypeList, err := parseResourceTypes("--exclude-type", excludeTypes)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+	if noIFrames {
+		excludeTypeList = append(excludeTypeList, downloader.ResourceIFrame)
+	}
+	if noImages {
+		excludeTypeList = append(excludeTypeList, downloader.ResourceImage)
+	}
+	includePatterns, err := compilePatterns("--include-regex", includeRegex)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+	excludePatterns, err := compilePatterns("--exclude-regex", excludeRegex)
+	if err != nil {
+		return downloader.Config{}, err
+	}
+
 	// Create downloader configuration
 	cfg := downloader.Config{
-		OutputDir:   outputDir,
-		Flatten:     flatten,
-		Concurrency: concurrency,
-		RewriteURLs: !noRewrite,
-		Include:     include,
-		Exclude:     exclude,
-		UserAgent:   userAgent,
-		Verbose:     verbose,
+		OutputDir:     outputDir,
+		Flatten:       flatten,
+		Concurrency:   concurrency,
+		RewriteURLs:   !noRewrite && !absolutize,
+		Include:       include,
+		Exclude:       exclude,
+		IncludeTypes:  includeTypeList,
+		ExcludeTypes:  excludeTypeList,
+		IncludeRegex:  includePatterns,
+		ExcludeRegex:  excludePatterns,
+		UserAgent:     request.UserAgent,
+		Verbose:       verbose,
+		Overwrite:     overwritePolicy,
+		Fsync:         fsync,
+		Dedupe:        dedupe,
+		RewriteBase:   rewriteBaseURL,
+		RewriteQuery:  rewriteQuery,
+		FilteredRefs:  filteredMode,
+		Absolutize:    absolutize,
+		DryRun:        dryRun,
+		DryRunSizes:   dryRunSizes,
+		Manifest:      manifest != "",
+		RateLimit:     request.RateLimit,
+		Headers:       request.Headers,
+		Proxy:         request.Proxy,
+		Clip:          clip,
+		Ads:           adMode,
+		Progress:      progressMode,
+		RedirectPaths: redirectMode,
+		Pathway:       pathway,
+		Lint:          lintFirst,
+		DASHManifest:  dashManifest,
+		Subtitles:     downloader.SubtitleExport{WebVTT: mergeSubs, SRT: exportSRT},
 	}
 
-	// Create and run downloader
-	dl := downloader.New(cfg)
-	ctx := context.Background()
+	return cfg, nil
+}
 
-	if verbose {
-		fmt.Printf("Starting download of %s\n", m3u8URL)
-		fmt.Printf("Output directory: %s\n", outputDir)
-		fmt.Printf("URL rewriting: %v\n", !noRewrite)
-		fmt.Printf("Flatten structure: %v\n", flatten)
-		fmt.Printf("Concurrency: %d\n", concurrency)
-		if len(include) > 0 {
-			fmt.Printf("Include extensions: %v\n", include)
+// parseResourceTypes parses the values of a resource type flag.
+func parseResourceTypes(flag string, values []string) ([]downloader.ResourceType, error) {
+	types := make([]downloader.ResourceType, 0, len(values))
+	for _, value := range values {
+		t, err := downloader.ParseResourceType(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", flag, err)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// compilePatterns compiles the values of a regular expression flag.
+func compilePatterns(flag string, values []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(values))
+	for _, value := range values {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", flag, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// progressConfig resolves the --progress and --quiet flags.
+func progressConfig() (downloader.ProgressMode, error) {
+	if quiet {
+		return downloader.ProgressNone, nil
+	}
+	if progress == "auto" {
+		// Carriage returns only make sense on a terminal; logs get plain lines
+		if isTerminal(os.Stdout) {
+			return downloader.ProgressText, nil
+		}
+		return downloader.ProgressPlain, nil
+	}
+	mode, err := downloader.ParseProgressMode(progress)
+	if err != nil {
+		return "", fmt.Errorf("invalid --progress %q: must be one of auto, text, plain, json, none", progress)
+	}
+	return mode, nil
+}
+
+// isTerminal reports whether f is a terminal (a character device).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// clipConfig validates the clipping flags.
+func clipConfig() (downloader.Clip, error) {
+	start, err := downloader.ParseClipPoint(clipStart)
+	if err != nil {
+		return downloader.Clip{}, fmt.Errorf("--start: %w", err)
+	}
+	end, err := downloader.ParseClipPoint(clipEnd)
+	if err != nil {
+		return downloader.Clip{}, fmt.Errorf("--end: %w", err)
+	}
+	if firstN < 0 {
+		return downloader.Clip{}, fmt.Errorf("--first-n-segments must not be negative")
+	}
+
+	// Only comparable when both are offsets or both are date-times
+	if !end.IsZero() && start.Time.IsZero() == end.Time.IsZero() {
+		if end.Offset <= start.Offset && end.Time.Compare(start.Time) <= 0 {
+			return downloader.Clip{}, fmt.Errorf("--end must be after --start")
 		}
-		if len(exclude) > 0 {
-			fmt.Printf("Exclude extensions: %v\n", exclude)
+	}
+
+	return downloader.Clip{Start: start, End: end, FirstN: firstN}, nil
+}
+
+// printConfig prints the settings of a download in verbose mode.
+func printConfig(cfg downloader.Config) {
+	fmt.Printf("Output directory: %s\n", cfg.OutputDir)
+	fmt.Printf("URL rewriting: %v\n", cfg.RewriteURLs)
+	fmt.Printf("Absolutize URLs: %v\n", cfg.Absolutize)
+	if cfg.RewriteBase != nil {
+		fmt.Printf("Rewrite base: %s\n", cfg.RewriteBase)
+	}
+	fmt.Printf("Flatten structure: %v\n", cfg.Flatten)
+	fmt.Printf("Redirected paths: %s\n", cfg.RedirectPaths)
+	if cfg.Pathway != "" {
+		fmt.Printf("Pathway: %s\n", cfg.Pathway)
+	}
+	fmt.Printf("Lint playlists: %v\n", cfg.Lint)
+	fmt.Printf("DASH manifest: %v\n", cfg.DASHManifest)
+	fmt.Printf("Merged subtitles: WebVTT %v, SRT %v\n", cfg.Subtitles.WebVTT, cfg.Subtitles.SRT)
+	fmt.Printf("Concurrency: %d\n", cfg.Concurrency)
+	if cfg.Proxy != nil {
+		fmt.Printf("Proxy: %s\n", cfg.Proxy.Redacted())
+	}
+	if len(cfg.Headers) > 0 {
+		// Only names, since values are often credentials
+		names := make([]string, 0, len(cfg.Headers))
+		for name := range cfg.Headers {
+			names = append(names, name)
 		}
-		fmt.Println()
+		sort.Strings(names)
+		fmt.Printf("Extra headers: %s\n", strings.Join(names, ", "))
+	}
+	if !cfg.Clip.IsZero() {
+		fmt.Printf("Clip: start %s, end %s, first %d segments\n", cfg.Clip.Start, cfg.Clip.End, cfg.Clip.FirstN)
+	}
+	if cfg.Ads != downloader.AdsKeep {
+		fmt.Printf("Ads: %s\n", cfg.Ads)
+	}
+	if cfg.RateLimit > 0 {
+		fmt.Printf("Rate limit: %g requests/s\n", cfg.RateLimit)
+	}
+	fmt.Printf("Overwrite policy: %s\n", cfg.Overwrite)
+	fmt.Printf("Deduplication: %v\n", cfg.Dedupe)
+	if len(cfg.Include) > 0 {
+		fmt.Printf("Include extensions: %v\n", cfg.Include)
+	}
+	if len(cfg.Exclude) > 0 {
+		fmt.Printf("Exclude extensions: %v\n", cfg.Exclude)
+	}
+	if len(cfg.IncludeTypes) > 0 {
+		fmt.Printf("Include types: %v\n", cfg.IncludeTypes)
 	}
+	if len(cfg.ExcludeTypes) > 0 {
+		fmt.Printf("Exclude types: %v\n", cfg.ExcludeTypes)
+	}
+	if len(cfg.IncludeRegex) > 0 {
+		fmt.Printf("Include regex: %v\n", cfg.IncludeRegex)
+	}
+	if len(cfg.ExcludeRegex) > 0 {
+		fmt.Printf("Exclude regex: %v\n", cfg.ExcludeRegex)
+	}
+	fmt.Println()
+}
+
+// printPlan prints the files a dry run would download, one per line as
+// tab-separated URL, local path and size, followed by a summary on stderr.
+func printPlan(plan []downloader.PlannedFile) {
+	playlists, unknown := 0, 0
+	total := int64(0)
 
-	if err := dl.Download(ctx, m3u8URL); err != nil {
-		return fmt.Errorf("download failed: %w", err)
+	for _, file := range plan {
+		size := "-"
+		if file.Size >= 0 {
+			size = strconv.FormatInt(file.Size, 10)
+			total += file.Size
+		} else {
+			unknown++
+		}
+		if file.Playlist {
+			playlists++
+		}
+		fmt.Printf("%s\t%s\t%s\n", file.URL, file.LocalPath, size)
 	}
 
-	fmt.Println("Download completed successfully")
-	return nil
+	summary := fmt.Sprintf("Dry run: %d files (%d playlists), %s", len(plan), playlists, downloader.FormatBytes(total))
+	if unknown > 0 {
+		summary += fmt.Sprintf(" plus %d files of unknown size", unknown)
+	}
+	fmt.Fprintln(os.Stderr, summary)
 }
 
 // normalizeExtensions ensures all extensions start with a dot.
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr       string
+	serveLiveWindow int
+)
+
+// serveCmd serves a mirrored download over HTTP.
+//
+// This makes it easy to check a mirror in a browser player right after
+// downloading it, without setting up a web server.
+var serveCmd = &cobra.Command{
+	Use:   "serve [DIR]",
+	Short: "Serve a mirrored download over HTTP",
+	Long: `Serve a directory of downloaded playlists and segments over HTTP.
+
+Files are served with the MIME types HLS players expect, CORS headers and
+byte-range support. The root URL lists every playlist found in the directory.
+
+With --live-window, VOD media playlists are served as a live stream with a
+sliding window of segments, which is useful for testing live playback.`,
+	Example: `  # Serve the current directory on port 8080
+  m3u8dl serve
+
+  # Serve a download directory on a specific address
+  m3u8dl serve ./downloads --addr :9000
+
+  # Simulate a live stream with a 6 segment window
+  m3u8dl serve ./downloads --live-window 6`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address to listen on")
+	serveCmd.Flags().IntVar(&serveLiveWindow, "live-window", 0, "Serve VOD playlists as a live stream with this many segments (0 disables)")
+}
+
+// runServe is the main execution function for the serve command.
+func runServe(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cannot serve %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot serve %s: not a directory", dir)
+	}
+	if serveLiveWindow < 0 {
+		return fmt.Errorf("--live-window must not be negative")
+	}
+
+	srv := &http.Server{
+		Addr: serveAddr,
+		Handler: server.New(server.Options{
+			Dir:        dir,
+			LiveWindow: serveLiveWindow,
+		}),
+	}
+
+	// Shut down cleanly on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Serving %s on %s\n", dir, serveAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+
+	return nil
+}
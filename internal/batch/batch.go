@@ -0,0 +1,209 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+)
+
+// Job is a single download in a batch.
+type Job struct {
+	// URL is the M3U8 playlist to download
+	URL string
+	// OutputDir is where the job's files are written
+	OutputDir string
+	// Line is the line of the job list the job came from
+	Line int
+}
+
+// Result is the outcome of a single job.
+type Result struct {
+	Job Job
+	// Stats are the job's download counters
+	Stats downloader.Stats
+	// Plan lists the files the job would download, in dry-run mode
+	Plan []downloader.PlannedFile
+	// Manifest lists the job's downloaded files, if manifests are enabled
+	Manifest []downloader.ManifestEntry
+	// Err is the reason the job failed, or nil if it succeeded
+	Err error
+}
+
+// ParseJobs reads a job list.
+//
+// Each non-empty line holds a URL, optionally followed by whitespace and an
+// output directory for that job. Relative output directories are resolved
+// against outputDir. Jobs without one get their own subdirectory of
+// outputDir named after the playlist's host and path (see jobDirName), since
+// streams on different hosts often use the same paths. Lines starting with
+// '#' are comments.
+//
+// Jobs run in parallel, so no two jobs may share an output directory or
+// write inside each other's; that is reported as an error.
+//
+// Parameters:
+//   - r: The job list
+//   - outputDir: The default output directory
+//
+// Returns the jobs in order, or an error for the first invalid line.
+//
+// See: https://context7.com/golang/go for Go documentation
+func ParseJobs(r io.Reader, outputDir string) ([]Job, error) {
+	jobs := make([]Job, 0)
+	lineNum := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected a URL and an optional output directory", lineNum)
+		}
+		if !strings.HasPrefix(fields[0], "http://") && !strings.HasPrefix(fields[0], "https://") {
+			return nil, fmt.Errorf("line %d: URL must start with http:// or https://", lineNum)
+		}
+
+		job := Job{URL: fields[0], Line: lineNum}
+		if len(fields) == 2 {
+			job.OutputDir = fields[1]
+		} else {
+			name, err := jobDirName(job.URL)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			job.OutputDir = name
+		}
+		if !filepath.IsAbs(job.OutputDir) {
+			job.OutputDir = filepath.Join(outputDir, job.OutputDir)
+		}
+
+		for _, other := range jobs {
+			if overlaps(job.OutputDir, other.OutputDir) {
+				return nil, fmt.Errorf("line %d: output directory %s overlaps %s of line %d", lineNum, job.OutputDir, other.OutputDir, other.Line)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read job list: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// jobDirName returns the default output directory name of a job: the
+// playlist URL's host and path without the extension, with everything but
+// letters, digits, dots and dashes replaced by underscores (e.g.
+// "example.com_show1_master" for https://example.com/show1/master.m3u8).
+func jobDirName(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %s", rawURL)
+	}
+
+	name := u.Host + strings.TrimSuffix(u.Path, path.Ext(u.Path))
+	name = strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	return strings.Trim(name, "_."), nil
+}
+
+// overlaps reports whether two output directories are the same or one is
+// inside the other.
+func overlaps(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		absA, absB = filepath.Clean(a), filepath.Clean(b)
+	}
+	return within(absA, absB) || within(absB, absA)
+}
+
+// within reports whether dir is root or inside it.
+func within(dir, root string) bool {
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Run downloads every job, running up to concurrency jobs at once.
+//
+// Every job uses cfg with its own output directory. If cfg has no Fetcher,
+// one is created and shared by all jobs so they share a connection pool and
+// rate limit. Progress output is disabled since jobs run in parallel; onDone,
+// if not nil, is called as each job finishes.
+//
+// Returns the results in the same order as jobs. A failed job doesn't stop
+// the others.
+func Run(ctx context.Context, jobs []Job, cfg downloader.Config, concurrency int, onDone func(Result)) []Result {
+	if cfg.Fetcher == nil {
+		cfg.Fetcher = downloader.NewFetcher(cfg)
+	}
+	cfg.Quiet = true
+	concurrency = max(concurrency, 1)
+
+	results := make([]Result, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	var doneLock sync.Mutex
+
+	for i := 0; i < min(concurrency, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = runJob(ctx, jobs[index], cfg)
+				if onDone != nil {
+					doneLock.Lock()
+					onDone(results[index])
+					doneLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// runJob downloads a single job.
+func runJob(ctx context.Context, job Job, cfg downloader.Config) Result {
+	cfg.OutputDir = job.OutputDir
+	d := downloader.New(cfg)
+
+	start := time.Now()
+	err := d.Download(ctx, job.URL)
+
+	result := Result{
+		Job:      job,
+		Stats:    d.Stats(),
+		Plan:     d.Plan(),
+		Manifest: d.Manifest(),
+		Err:      err,
+	}
+	result.Stats.Elapsed = time.Since(start)
+	return result
+}
@@ -0,0 +1,154 @@
+package batch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+)
+
+func TestParseJobs(t *testing.T) {
+	abs := filepath.Join(t.TempDir(), "c")
+	input := "# Nightly mirrors\n" +
+		"https://example.com/a/master.m3u8\n" +
+		"\n" +
+		"https://example.com/b/master.m3u8   b\n" +
+		"https://example.com/c/master.m3u8\t" + abs + "\n" +
+		"https://cdn.example.net:8443/a/master.m3u8?token=1\n"
+	jobs, err := ParseJobs(strings.NewReader(input), "out")
+	if err != nil {
+		t.Fatalf("ParseJobs failed: %v", err)
+	}
+
+	expected := []Job{
+		{URL: "https://example.com/a/master.m3u8", OutputDir: filepath.Join("out", "example.com_a_master"), Line: 2},
+		{URL: "https://example.com/b/master.m3u8", OutputDir: filepath.Join("out", "b"), Line: 4},
+		{URL: "https://example.com/c/master.m3u8", OutputDir: abs, Line: 5},
+		{URL: "https://cdn.example.net:8443/a/master.m3u8?token=1", OutputDir: filepath.Join("out", "cdn.example.net_8443_a_master"), Line: 6},
+	}
+	if len(jobs) != len(expected) {
+		t.Fatalf("Expected %d jobs, got %d: %+v", len(expected), len(jobs), jobs)
+	}
+	for i, want := range expected {
+		if jobs[i] != want {
+			t.Errorf("Job %d: expected %+v, got %+v", i, want, jobs[i])
+		}
+	}
+}
+
+func TestParseJobsErrors(t *testing.T) {
+	tests := map[string]string{
+		"not a URL":          "example.com/master.m3u8\n",
+		"extra fields":       "https://example.com/master.m3u8 out extra\n",
+		"same URL twice":     "https://example.com/master.m3u8\nhttps://example.com/master.m3u8?v=2\n",
+		"same directory":     "https://example.com/a.m3u8 show\nhttps://example.com/b.m3u8 show/\n",
+		"nested directories": "https://example.com/a.m3u8 .\nhttps://example.com/b.m3u8\n",
+	}
+	for name, input := range tests {
+		if _, err := ParseJobs(strings.NewReader(input), "."); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a/index.m3u8", "/b/index.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXTINF:10,\nseg.ts\n#EXT-X-ENDLIST\n"))
+		case "/a/seg.ts", "/b/seg.ts":
+			w.Write([]byte("segment"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	jobs := []Job{
+		{URL: srv.URL + "/a/index.m3u8", OutputDir: filepath.Join(dir, "a"), Line: 1},
+		{URL: srv.URL + "/missing.m3u8", OutputDir: filepath.Join(dir, "missing"), Line: 2},
+		{URL: srv.URL + "/b/index.m3u8", OutputDir: filepath.Join(dir, "b"), Line: 3},
+	}
+
+	done := 0
+	results := Run(context.Background(), jobs, downloader.Config{Concurrency: 2, RewriteURLs: true}, 2, func(Result) {
+		done++
+	})
+
+	if done != len(jobs) {
+		t.Errorf("Expected onDone to be called %d times, got %d", len(jobs), done)
+	}
+	if len(results) != len(jobs) {
+		t.Fatalf("Expected %d results, got %d", len(jobs), len(results))
+	}
+	for i, result := range results {
+		if result.Job != jobs[i] {
+			t.Errorf("Result %d is for job %+v, expected %+v", i, result.Job, jobs[i])
+		}
+	}
+
+	if results[1].Err == nil {
+		t.Error("Expected the missing playlist to fail")
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil {
+			t.Errorf("Job %d failed: %v", i, results[i].Err)
+		}
+		if results[i].Stats.Files != 2 || results[i].Stats.Bytes == 0 {
+			t.Errorf("Job %d: unexpected stats %+v", i, results[i].Stats)
+		}
+	}
+
+	for _, name := range []string{"a/a/seg.ts", "b/b/seg.ts"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		}
+	}
+}
+
+func TestRunSamePlaylistPaths(t *testing.T) {
+	// Two origins serving different streams under the same paths
+	newOrigin := func(content string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/live/index.m3u8":
+				w.Write([]byte("#EXTM3U\n#EXTINF:10,\nseg.ts\n#EXT-X-ENDLIST\n"))
+			case "/live/seg.ts":
+				w.Write([]byte(content))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+	a := newOrigin("from a")
+	defer a.Close()
+	b := newOrigin("from b")
+	defer b.Close()
+
+	dir := t.TempDir()
+	input := a.URL + "/live/index.m3u8\n" + b.URL + "/live/index.m3u8\n"
+	jobs, err := ParseJobs(strings.NewReader(input), dir)
+	if err != nil {
+		t.Fatalf("ParseJobs failed: %v", err)
+	}
+	if jobs[0].OutputDir == jobs[1].OutputDir {
+		t.Fatalf("Expected each job to get its own directory, both got %s", jobs[0].OutputDir)
+	}
+
+	results := Run(context.Background(), jobs, downloader.Config{Concurrency: 2, RewriteURLs: true}, 2, nil)
+	for i, expected := range []string{"from a", "from b"} {
+		if results[i].Err != nil {
+			t.Fatalf("Job %d failed: %v", i, results[i].Err)
+		}
+		content, err := os.ReadFile(filepath.Join(jobs[i].OutputDir, "live", "seg.ts"))
+		if err != nil || string(content) != expected {
+			t.Errorf("Job %d: expected %q, got %q (%v)", i, expected, content, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the configuration file looked for in the current
+// directory.
+const FileName = "m3u8dl.yaml"
+
+// Settings maps flag names (e.g. "concurrency" or "user-agent") to values.
+type Settings map[string]any
+
+// File is a parsed configuration file.
+//
+// A file holds default settings and named profiles, each of which may set
+// any download flag:
+//
+//	profile: cdn-a
+//	defaults:
+//	  concurrency: 8
+//	profiles:
+//	  cdn-a:
+//	    header:
+//	      Referer: https://example.com/
+//	    proxy: http://proxy.internal:3128
+//	    exclude: [.vtt]
+//	    flatten: true
+type File struct {
+	// Path is where the file was loaded from
+	Path string `yaml:"-"`
+	// Profile is the profile used when none is selected
+	Profile string `yaml:"profile"`
+	// Defaults apply to every profile
+	Defaults Settings `yaml:"defaults"`
+	// Profiles are named groups of settings, typically one per origin
+	Profiles map[string]Settings `yaml:"profiles"`
+}
+
+// Find returns the path of the configuration file to use.
+//
+// An explicit path must exist. Otherwise m3u8dl.yaml in the current
+// directory is used, then m3u8dl/config.yaml in the user's configuration
+// directory ($XDG_CONFIG_HOME or ~/.config on Linux).
+//
+// Returns an empty path if there is no configuration file.
+//
+// See: https://context7.com/golang/go for Go os documentation
+func Find(explicit string) (string, error) {
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return "", fmt.Errorf("cannot read config file: %w", err)
+		}
+		return explicit, nil
+	}
+
+	candidates := []string{FileName}
+	if dir, err := os.UserConfigDir(); err == nil {
+		candidates = append(candidates, filepath.Join(dir, "m3u8dl", "config.yaml"))
+	}
+
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("cannot read config file: %w", err)
+		}
+	}
+
+	return "", nil
+}
+
+// Load reads and parses a configuration file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	file := &File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	file.Path = path
+
+	return file, nil
+}
+
+// Settings returns the defaults merged with the named profile, whose values
+// take precedence.
+//
+// An empty name selects the file's default profile, if any. Naming a profile
+// that doesn't exist is an error.
+func (f *File) Settings(name string) (Settings, error) {
+	if name == "" {
+		name = f.Profile
+	}
+
+	settings := make(Settings, len(f.Defaults))
+	for key, value := range f.Defaults {
+		settings[key] = value
+	}
+
+	if name == "" {
+		return settings, nil
+	}
+
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in %s", name, f.Path)
+	}
+	for key, value := range profile {
+		settings[key] = value
+	}
+
+	return settings, nil
+}
+
+// Values converts a setting into the values to set its flag to, in order.
+//
+// Scalars become a single value and lists one value per element. Maps
+// become "key: value" pairs sorted by key, which is the form headers take.
+func Values(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case bool, int, int64, uint64, float64:
+		return []string{fmt.Sprint(v)}, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			itemValues, err := Values(item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	case Settings:
+		// Nested maps decode to the type of the enclosing map
+		return Values(map[string]any(v))
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := make([]string, 0, len(v))
+		for _, key := range keys {
+			switch v[key].(type) {
+			case map[string]any, Settings, []any:
+				return nil, fmt.Errorf("unexpected nested value under %q", key)
+			}
+			values = append(values, fmt.Sprintf("%s: %v", key, v[key]))
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", value)
+	}
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestSettings(t *testing.T) {
+	path := writeConfig(t, `
+profile: a
+defaults:
+  concurrency: 8
+  exclude: [.vtt]
+profiles:
+  a:
+    concurrency: 3
+    header:
+      Referer: https://example.com/
+      X-Token: abc
+  b:
+    flatten: true
+`)
+	file, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// The file's default profile overrides the defaults
+	settings, err := file.Settings("")
+	if err != nil {
+		t.Fatalf("Settings failed: %v", err)
+	}
+	if settings["concurrency"] != 3 || settings["exclude"] == nil {
+		t.Errorf("Unexpected settings for the default profile: %v", settings)
+	}
+	headers, err := Values(settings["header"])
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if want := []string{"Referer: https://example.com/", "X-Token: abc"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("Expected headers %v, got %v", want, headers)
+	}
+
+	settings, err = file.Settings("b")
+	if err != nil {
+		t.Fatalf("Settings failed: %v", err)
+	}
+	if settings["concurrency"] != 8 || settings["flatten"] != true {
+		t.Errorf("Unexpected settings for profile b: %v", settings)
+	}
+
+	if _, err := file.Settings("missing"); err == nil {
+		t.Error("Expected an error for a missing profile")
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := writeConfig(t, "profils:\n  a:\n    flatten: true\n")
+	if _, err := Load(path); err == nil {
+		t.Error("Expected an error for a misspelled top-level key")
+	}
+}
+
+func TestValues(t *testing.T) {
+	tests := []struct {
+		value any
+		want  []string
+	}{
+		{nil, nil},
+		{"x", []string{"x"}},
+		{true, []string{"true"}},
+		{5, []string{"5"}},
+		{2.5, []string{"2.5"}},
+		{[]any{".ts", ".m3u8"}, []string{".ts", ".m3u8"}},
+		{map[string]any{"B": "2", "A": 1}, []string{"A: 1", "B: 2"}},
+	}
+	for _, tt := range tests {
+		got, err := Values(tt.value)
+		if err != nil {
+			t.Errorf("Values(%v) failed: %v", tt.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Values(%v) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := Values(map[string]any{"A": map[string]any{"B": 1}}); err == nil {
+		t.Error("Expected an error for a nested map")
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+	t.Setenv("HOME", dir)
+
+	if path, err := Find(""); err != nil || path != "" {
+		t.Errorf("Expected no config file, got %q, %v", path, err)
+	}
+
+	if _, err := Find(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing explicit config file")
+	}
+
+	xdgPath := filepath.Join(dir, "xdg", "m3u8dl", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(xdgPath), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(xdgPath, nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if path, err := Find(""); err != nil || path != xdgPath {
+		t.Errorf("Expected %s, got %q, %v", xdgPath, path, err)
+	}
+
+	// The current directory takes precedence
+	if err := os.WriteFile(FileName, nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if path, err := Find(""); err != nil || path != FileName {
+		t.Errorf("Expected %s, got %q, %v", FileName, path, err)
+	}
+}
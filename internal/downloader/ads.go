@@ -0,0 +1,390 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdMode decides what happens to the segments inside ad breaks.
+type AdMode string
+
+const (
+	// AdsKeep downloads ad breaks like any other segments.
+	AdsKeep AdMode = "keep"
+	// AdsSkip removes the segments inside ad breaks from media playlists.
+	AdsSkip AdMode = "skip"
+	// AdsOnly removes every segment outside ad breaks from media playlists.
+	AdsOnly AdMode = "only"
+)
+
+// ParseAdMode converts a CLI value into an AdMode.
+func ParseAdMode(s string) (AdMode, error) {
+	switch m := AdMode(s); m {
+	case AdsKeep, AdsSkip, AdsOnly:
+		return m, nil
+	case "":
+		return AdsKeep, nil
+	default:
+		return "", fmt.Errorf("invalid ad mode %q (expected skip, keep or only)", s)
+	}
+}
+
+// AdCue is whether an ad marker starts or ends an ad break.
+type AdCue int
+
+const (
+	// CueNone marks neither the start nor the end of an ad break.
+	CueNone AdCue = iota
+	// CueOut starts an ad break.
+	CueOut
+	// CueOutCont is inside an ad break that started earlier, e.g. before
+	// the first segment of a live playlist.
+	CueOutCont
+	// CueIn ends an ad break.
+	CueIn
+)
+
+// AdMarker is an ad marker tag in front of a segment: #EXT-X-CUE-OUT,
+// #EXT-X-CUE-OUT-CONT, #EXT-X-CUE-IN, #EXT-OATCLS-SCTE35 or #EXT-X-SCTE35.
+type AdMarker struct {
+	// Tag is the tag name (e.g. "EXT-X-CUE-OUT")
+	Tag string
+	// Cue is whether the marker starts or ends an ad break
+	Cue AdCue
+	// Duration is the length of the whole break in seconds, or zero if not
+	// given
+	Duration float64
+	// Elapsed is how far into the break the segment is in seconds, for
+	// #EXT-X-CUE-OUT-CONT
+	Elapsed float64
+	// SCTE35 is the decoded SCTE-35 payload, if the marker carries one
+	SCTE35 *SpliceInfo
+}
+
+// adMarkerTags are the tags parseAdMarker understands. Like EXT-X-DATERANGE
+// they belong to the segment that follows them.
+var adMarkerTags = map[string]bool{
+	"EXT-X-CUE-OUT":      true,
+	"EXT-X-CUE-OUT-CONT": true,
+	"EXT-X-CUE-IN":       true,
+	"EXT-OATCLS-SCTE35":  true,
+	"EXT-X-SCTE35":       true,
+}
+
+// parseAdMarker parses an ad marker tag, given its name and value.
+//
+// The tags are not standardized, so the common forms are accepted:
+// #EXT-X-CUE-OUT:30, #EXT-X-CUE-OUT:DURATION=30, #EXT-X-CUE-OUT-CONT:10/30,
+// #EXT-X-CUE-OUT-CONT:ElapsedTime=10,Duration=30,SCTE35=..., and an SCTE-35
+// payload in #EXT-OATCLS-SCTE35 or the CUE attribute of #EXT-X-SCTE35.
+func parseAdMarker(name, value string) (AdMarker, bool) {
+	if !adMarkerTags[name] {
+		return AdMarker{}, false
+	}
+
+	marker := AdMarker{Tag: name}
+	attrs := parseAttributes(value)
+	var payload string
+	switch name {
+	case "EXT-X-CUE-OUT":
+		marker.Cue = CueOut
+		marker.Duration = parseSeconds(value, attrs, "DURATION")
+	case "EXT-X-CUE-OUT-CONT":
+		marker.Cue = CueOutCont
+		if elapsed, duration, ok := strings.Cut(value, "/"); ok && !strings.Contains(value, "=") {
+			marker.Elapsed, _ = strconv.ParseFloat(strings.TrimSpace(elapsed), 64)
+			marker.Duration, _ = strconv.ParseFloat(strings.TrimSpace(duration), 64)
+		} else {
+			marker.Elapsed = parseSeconds("", attrs, "ELAPSEDTIME")
+			marker.Duration = parseSeconds("", attrs, "DURATION")
+		}
+		payload = attrValue(attrs, "SCTE35")
+	case "EXT-X-CUE-IN":
+		marker.Cue = CueIn
+	case "EXT-OATCLS-SCTE35":
+		payload = value
+	case "EXT-X-SCTE35":
+		payload = attrValue(attrs, "CUE")
+	}
+
+	if payload != "" {
+		if info, err := DecodeSCTE35(payload); err == nil {
+			marker.SCTE35 = info
+			if marker.Cue == CueNone {
+				var duration time.Duration
+				marker.Cue, duration = info.AdCue()
+				marker.Duration = duration.Seconds()
+			}
+		}
+	}
+	return marker, true
+}
+
+// parseSeconds parses a duration in seconds from the named attribute or,
+// failing that, from value itself (e.g. "30" in #EXT-X-CUE-OUT:30).
+func parseSeconds(value string, attrs map[string]string, name string) float64 {
+	if v := attrValue(attrs, name); v != "" {
+		seconds, _ := strconv.ParseFloat(v, 64)
+		return seconds
+	}
+	seconds, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return seconds
+}
+
+// attrValue looks up an attribute case-insensitively, since ad marker tags
+// don't agree on the case of their attribute names.
+func attrValue(attrs map[string]string, name string) string {
+	for key, value := range attrs {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// newDateRange builds a DateRange from the attributes of an
+// #EXT-X-DATERANGE tag.
+//
+// A START-DATE or END-DATE that can't be parsed is left zero and reported
+// in the error, but the rest of the range is still filled in.
+func newDateRange(attrs map[string]string) (DateRange, error) {
+	r := DateRange{
+		ID:         attrs["ID"],
+		Class:      attrs["CLASS"],
+		EndOnNext:  attrs["END-ON-NEXT"] == "YES",
+		Attributes: attrs,
+	}
+	var errs []error
+	for _, date := range []struct {
+		name string
+		t    *time.Time
+	}{{"START-DATE", &r.StartDate}, {"END-DATE", &r.EndDate}} {
+		value, ok := attrs[date.name]
+		if !ok {
+			continue
+		}
+		t, err := parseDateTime(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", date.name, err))
+		}
+		*date.t = t
+	}
+	r.Duration, _ = strconv.ParseFloat(attrs["DURATION"], 64)
+	r.PlannedDuration, _ = strconv.ParseFloat(attrs["PLANNED-DURATION"], 64)
+	if cue := attrs["CUE"]; cue != "" {
+		r.Cue = strings.Split(cue, ",")
+	}
+	r.SCTE35Out, _ = decodeSCTE35Attr(attrs, "SCTE35-OUT")
+	r.SCTE35In, _ = decodeSCTE35Attr(attrs, "SCTE35-IN")
+	r.SCTE35Cmd, _ = decodeSCTE35Attr(attrs, "SCTE35-CMD")
+	return r, errors.Join(errs...)
+}
+
+// decodeSCTE35Attr decodes the SCTE-35 payload in an attribute, returning
+// nil if the attribute is missing or can't be decoded.
+func decodeSCTE35Attr(attrs map[string]string, name string) (*SpliceInfo, error) {
+	value, ok := attrs[name]
+	if !ok {
+		return nil, nil
+	}
+	return DecodeSCTE35(value)
+}
+
+// AdCue reports whether the date range starts or ends an ad break.
+//
+// An SCTE35-OUT attribute starts a break and SCTE35-IN ends one, whether
+// or not their payload can be decoded. Otherwise SCTE35-CMD decides.
+func (r DateRange) AdCue() AdCue {
+	_, out := r.Attributes["SCTE35-OUT"]
+	_, in := r.Attributes["SCTE35-IN"]
+	switch {
+	case out:
+		return CueOut
+	case in:
+		return CueIn
+	case r.SCTE35Cmd != nil:
+		cue, _ := r.SCTE35Cmd.AdCue()
+		return cue
+	}
+	return CueNone
+}
+
+// end returns when the date range ends, or zero if it doesn't say.
+func (r DateRange) end() time.Time {
+	switch {
+	case !r.EndDate.IsZero():
+		return r.EndDate
+	case r.Duration > 0:
+		return r.StartDate.Add(secondsDuration(r.Duration))
+	case r.PlannedDuration > 0:
+		return r.StartDate.Add(secondsDuration(r.PlannedDuration))
+	case r.SCTE35Cmd != nil:
+		if _, duration := r.SCTE35Cmd.AdCue(); duration > 0 {
+			return r.StartDate.Add(duration)
+		}
+	}
+	return time.Time{}
+}
+
+// secondsDuration converts a number of seconds into a Duration.
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// adBreak is the wall-clock span of an ad break from EXT-X-DATERANGE. A
+// zero end means the break lasts until the end of the playlist.
+type adBreak struct {
+	start, end time.Time
+}
+
+// dateRangeBreaks returns the ad breaks described by a playlist's date
+// ranges.
+//
+// Date ranges with the same ID describe the same range, so a break may be
+// started by one tag and given its end or duration by a later one. A break
+// without an end is ended by the next date range that ends a break.
+func dateRangeBreaks(ranges []DateRange) []adBreak {
+	merged := make(map[string]*DateRange)
+	var order []*DateRange
+	for _, r := range ranges {
+		existing, ok := merged[r.ID]
+		if !ok || r.ID == "" {
+			merged[r.ID] = &r
+			order = append(order, &r)
+			continue
+		}
+		// Later tags with the same ID add attributes
+		attrs := make(map[string]string, len(existing.Attributes)+len(r.Attributes))
+		for k, v := range existing.Attributes {
+			attrs[k] = v
+		}
+		for k, v := range r.Attributes {
+			attrs[k] = v
+		}
+		// Unparsable dates were already reported when the tags were parsed
+		*existing, _ = newDateRange(attrs)
+	}
+
+	var breaks []adBreak
+	for _, r := range order {
+		switch r.AdCue() {
+		case CueOut:
+			breaks = append(breaks, adBreak{start: r.StartDate, end: r.end()})
+		case CueIn:
+			for i := range breaks {
+				if breaks[i].end.IsZero() && breaks[i].start.Before(r.StartDate) {
+					breaks[i].end = r.StartDate
+				}
+			}
+		}
+	}
+	return breaks
+}
+
+// adSegments reports, for every segment of a media playlist, whether it is
+// inside an ad break.
+//
+// Breaks come from ad marker tags, which start a break that lasts until
+// #EXT-X-CUE-IN or for its duration, and from EXT-X-DATERANGE tags, which
+// cover the segments whose midpoint falls within them. Date ranges need
+// EXT-X-PROGRAM-DATE-TIME to be placed and are ignored without it.
+func adSegments(m3u8 *M3U8File) []bool {
+	ads := make([]bool, len(m3u8.Segments))
+
+	inBreak := false
+	remaining := 0.0 // Seconds left in the current break, or 0 if unknown
+	for i, segment := range m3u8.Segments {
+		for _, marker := range segment.AdMarkers {
+			switch marker.Cue {
+			case CueOut:
+				inBreak, remaining = true, marker.Duration
+			case CueOutCont:
+				if !inBreak {
+					inBreak, remaining = true, max(marker.Duration-marker.Elapsed, 0)
+				}
+			case CueIn:
+				inBreak = false
+			}
+		}
+		// A break with a duration ends once less than half a segment is
+		// left, since durations rarely add up exactly
+		if inBreak && remaining > 0 && remaining < segment.Duration/2 {
+			inBreak = false
+		}
+		ads[i] = inBreak
+		if inBreak && remaining > 0 {
+			remaining -= segment.Duration
+			inBreak = remaining > 0
+		}
+	}
+
+	breaks := dateRangeBreaks(m3u8.DateRanges)
+	if starts := segmentStartTimes(m3u8.Segments); starts != nil {
+		for i, segment := range m3u8.Segments {
+			midpoint := starts[i].Add(secondsDuration(segment.Duration) / 2)
+			for _, b := range breaks {
+				if !midpoint.Before(b.start) && (b.end.IsZero() || midpoint.Before(b.end)) {
+					ads[i] = true
+				}
+			}
+		}
+	}
+
+	return ads
+}
+
+// filterAds removes the segments inside ad breaks from a media playlist,
+// or, with AdsOnly, every segment outside them.
+//
+// Discontinuities stay correct: wherever segments were removed, the next
+// kept segment starts with a single EXT-X-DISCONTINUITY. With AdsSkip, the
+// ad markers of the removed breaks are dropped as well.
+//
+// Returns the playlist unchanged if it isn't a media playlist or mode is
+// AdsKeep.
+func filterAds(content []byte, m3u8 *M3U8File, mode AdMode) ([]byte, error) {
+	if mode == AdsKeep || mode == "" || m3u8.IsMaster() || len(m3u8.Segments) == 0 {
+		return content, nil
+	}
+
+	parts, err := splitPlaylist(content, m3u8)
+	if err != nil {
+		return nil, err
+	}
+
+	ads := adSegments(m3u8)
+	keep := make([]bool, len(ads))
+	for i, ad := range ads {
+		keep[i] = ad == (mode == AdsOnly)
+	}
+
+	if mode == AdsSkip {
+		for i, segment := range parts.segments {
+			parts.segments[i] = removeAdMarkers(segment)
+		}
+	}
+
+	return keepSegments(parts, m3u8, keep), nil
+}
+
+// removeAdMarkers removes the ad marker tags and the EXT-X-DATERANGE tags
+// that start or end ad breaks from the lines of a segment.
+func removeAdMarkers(lines []string) []string {
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		name := tagName(line)
+		if adMarkerTags[name] {
+			continue
+		}
+		if name == "EXT-X-DATERANGE" {
+			if r, _ := newDateRange(parseAttributes(tagValue(line))); r.AdCue() != CueNone {
+				continue
+			}
+		}
+		result = append(result, line)
+	}
+	return result
+}
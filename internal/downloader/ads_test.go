@@ -0,0 +1,242 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseAdMode(t *testing.T) {
+	for value, expected := range map[string]AdMode{"": AdsKeep, "keep": AdsKeep, "skip": AdsSkip, "only": AdsOnly} {
+		if got, err := ParseAdMode(value); err != nil || got != expected {
+			t.Errorf("ParseAdMode(%q) = %q, %v; expected %q", value, got, err, expected)
+		}
+	}
+	if _, err := ParseAdMode("strip"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestAdSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		expected []bool
+	}{
+		{
+			"cue out and in",
+			"#EXTINF:10,\nc0.ts\n#EXT-X-CUE-OUT:20\n#EXTINF:10,\nad0.ts\n#EXTINF:10,\nad1.ts\n#EXT-X-CUE-IN\n#EXTINF:10,\nc1.ts\n",
+			[]bool{false, true, true, false},
+		},
+		{
+			"cue out duration without cue in",
+			"#EXT-X-CUE-OUT:DURATION=19.9\n#EXTINF:10,\nad0.ts\n#EXTINF:10,\nad1.ts\n#EXTINF:10,\nc0.ts\n",
+			[]bool{true, true, false},
+		},
+		{
+			"break in progress",
+			"#EXT-X-CUE-OUT-CONT:ElapsedTime=10,Duration=20\n#EXTINF:10,\nad1.ts\n#EXTINF:10,\nc0.ts\n",
+			[]bool{true, false},
+		},
+		{
+			"cue out cont with elapsed/duration",
+			"#EXT-X-CUE-OUT-CONT:10/30\n#EXTINF:10,\nad1.ts\n#EXTINF:10,\nad2.ts\n#EXTINF:10,\nc0.ts\n",
+			[]bool{true, true, false},
+		},
+		{
+			"SCTE-35 splice_insert",
+			"#EXTINF:10,\nc0.ts\n#EXT-OATCLS-SCTE35:/DAvAAAAAAAA///wFAVIAACPf+/+c2nALv4AUsz1AAAAAAAKAAhDVUVJAAABNWLbowo=\n" +
+				strings.Repeat("#EXTINF:10,\nad.ts\n", 6) + "#EXTINF:10,\nc1.ts\n",
+			[]bool{false, true, true, true, true, true, true, false},
+		},
+		{
+			"date range with duration",
+			"#EXT-X-PROGRAM-DATE-TIME:2024-05-01T18:00:00Z\n" +
+				"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2024-05-01T18:00:10Z\",DURATION=20.0,SCTE35-OUT=0xFC302F000000000000FFFFF014054800008F7FEFFE7369C02EFE0052CCF500000000000A0008435545490000013562DBA30A\n" +
+				strings.Repeat("#EXTINF:10,\nseg.ts\n", 4),
+			[]bool{false, true, true, false},
+		},
+		{
+			"date range ended by a later tag with the same ID",
+			"#EXT-X-PROGRAM-DATE-TIME:2024-05-01T18:00:00Z\n" +
+				"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2024-05-01T18:00:00Z\",SCTE35-OUT=0xFC\n" +
+				strings.Repeat("#EXTINF:10,\nseg.ts\n", 2) +
+				"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2024-05-01T18:00:00Z\",END-DATE=\"2024-05-01T18:00:10Z\",SCTE35-IN=0xFC\n" +
+				strings.Repeat("#EXTINF:10,\nseg.ts\n", 2),
+			[]bool{true, false, false, false},
+		},
+		{
+			"date range with +hhmm offsets",
+			"#EXT-X-PROGRAM-DATE-TIME:2024-05-01T20:00:00.000+0200\n" +
+				"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2024-05-01T20:00:10.000+0200\",END-DATE=\"2024-05-01T18:00:30.000+0000\",SCTE35-OUT=0xFC\n" +
+				strings.Repeat("#EXTINF:10,\nseg.ts\n", 4),
+			[]bool{false, true, true, false},
+		},
+		{
+			"date range without date-times",
+			"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2024-05-01T18:00:00Z\",DURATION=10,SCTE35-OUT=0xFC\n#EXTINF:10,\nseg.ts\n",
+			[]bool{false},
+		},
+	}
+
+	baseURL, _ := url.Parse("https://example.com/index.m3u8")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m3u8, err := ParseM3U8([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n"+tt.playlist), baseURL)
+			if err != nil {
+				t.Fatalf("ParseM3U8 failed: %v", err)
+			}
+			if got := adSegments(m3u8); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("adSegments() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDateRangeWarnings(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/index.m3u8")
+	playlist := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n" +
+		"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"May 1st\",DURATION=10,SCTE35-OUT=0xFC\n" +
+		"#EXTINF:10,\nseg.ts\n"
+	m3u8, err := ParseM3U8([]byte(playlist), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	if len(m3u8.Warnings) != 1 || !strings.Contains(m3u8.Warnings[0], "line 3: EXT-X-DATERANGE: START-DATE") {
+		t.Errorf("Expected a warning about the START-DATE on line 3, got %q", m3u8.Warnings)
+	}
+}
+
+func TestFilterAds(t *testing.T) {
+	playlist := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-KEY:METHOD=AES-128,URI="content.key"
+#EXTINF:10,
+c0.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-CUE-OUT:20
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+ad0.ts
+#EXTINF:10,
+ad1.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-CUE-IN
+#EXT-X-KEY:METHOD=AES-128,URI="content.key"
+#EXTINF:10,
+c1.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-CUE-OUT:10
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+ad2.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-CUE-IN
+#EXTINF:10,
+c2.ts
+#EXT-X-ENDLIST
+`
+
+	tests := []struct {
+		mode     AdMode
+		expected string
+	}{
+		{AdsSkip, `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-KEY:METHOD=AES-128,URI="content.key"
+#EXTINF:10,
+c0.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=AES-128,URI="content.key"
+#EXTINF:10,
+c1.ts
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-DISCONTINUITY
+#EXTINF:10,
+c2.ts
+#EXT-X-ENDLIST
+`},
+		{AdsOnly, `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:101
+#EXT-X-DISCONTINUITY
+#EXT-X-CUE-OUT:20
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+ad0.ts
+#EXTINF:10,
+ad1.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-CUE-OUT:10
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10,
+ad2.ts
+#EXT-X-ENDLIST
+`},
+	}
+
+	baseURL, _ := url.Parse("https://example.com/index.m3u8")
+	m3u8, err := ParseM3U8([]byte(playlist), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			got, err := filterAds([]byte(playlist), m3u8, tt.mode)
+			if err != nil {
+				t.Fatalf("filterAds failed: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Unexpected playlist:\n%s\nexpected:\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDownloadSkipsAds(t *testing.T) {
+	files := map[string]string{
+		"/index.m3u8": "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nc0.ts\n" +
+			"#EXT-X-CUE-OUT:10\n#EXT-X-DISCONTINUITY\n#EXTINF:10,\nad0.ts\n" +
+			"#EXT-X-CUE-IN\n#EXT-X-DISCONTINUITY\n#EXTINF:10,\nc1.ts\n#EXT-X-ENDLIST\n",
+		"/c0.ts":  "content",
+		"/ad0.ts": "ad",
+		"/c1.ts":  "content",
+	}
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		w.Write([]byte(files[r.URL.Path]))
+	}))
+	defer srv.Close()
+
+	outputDir := t.TempDir()
+	d := New(Config{OutputDir: outputDir, Concurrency: 2, RewriteURLs: true, Ads: AdsSkip, Quiet: true})
+	if err := d.Download(context.Background(), srv.URL+"/index.m3u8"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if requested["/ad0.ts"] || !requested["/c0.ts"] || !requested["/c1.ts"] {
+		t.Errorf("Expected only the content segments to be fetched, got %v", requested)
+	}
+	content, err := os.ReadFile(filepath.Join(outputDir, "index.m3u8"))
+	if err != nil {
+		t.Fatalf("Failed to read playlist: %v", err)
+	}
+	expected := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:10,\nc0.ts\n" +
+		"#EXT-X-DISCONTINUITY\n#EXTINF:10,\nc1.ts\n#EXT-X-ENDLIST\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected playlist:\n%s", content)
+	}
+}
@@ -0,0 +1,438 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClipPoint is one end of a clip: either an offset from the start of the
+// playlist or a wall-clock time matched against EXT-X-PROGRAM-DATE-TIME.
+//
+// The zero value means the start of the playlist (or no end).
+type ClipPoint struct {
+	// Offset is the position from the start of the playlist, computed from
+	// #EXTINF durations
+	Offset time.Duration
+	// Time, if set, is matched against EXT-X-PROGRAM-DATE-TIME instead
+	Time time.Time
+}
+
+// IsZero reports whether the point is unset.
+func (p ClipPoint) IsZero() bool {
+	return p.Offset == 0 && p.Time.IsZero()
+}
+
+// String formats the point the way ParseClipPoint accepts it.
+func (p ClipPoint) String() string {
+	if !p.Time.IsZero() {
+		return p.Time.Format(time.RFC3339Nano)
+	}
+	return p.Offset.String()
+}
+
+// ParseClipPoint parses a clip boundary.
+//
+// It accepts an RFC 3339 date-time (matched against
+// EXT-X-PROGRAM-DATE-TIME), HH:MM:SS or MM:SS with optional fractional
+// seconds, plain seconds, or a Go duration such as "45m".
+func ParseClipPoint(s string) (ClipPoint, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ClipPoint{}, nil
+	}
+
+	if t, err := parseDateTime(s); err == nil {
+		return ClipPoint{Time: t}, nil
+	}
+
+	if strings.ContainsAny(s, "hms") {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return ClipPoint{}, fmt.Errorf("invalid time %q", s)
+		}
+		return ClipPoint{Offset: d}, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return ClipPoint{}, fmt.Errorf("invalid time %q (expected HH:MM:SS)", s)
+	}
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || (len(parts) > 1 && seconds >= 60) {
+		return ClipPoint{}, fmt.Errorf("invalid time %q (expected HH:MM:SS)", s)
+	}
+	for i, part := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i == len(parts)-2 && len(parts) == 3 && n >= 60) {
+			return ClipPoint{}, fmt.Errorf("invalid time %q (expected HH:MM:SS)", s)
+		}
+		seconds += float64(n) * pow60(len(parts)-1-i)
+	}
+
+	return ClipPoint{Offset: time.Duration(seconds * float64(time.Second))}, nil
+}
+
+// pow60 returns 60 to the power of n.
+func pow60(n int) float64 {
+	result := 1.0
+	for i := 0; i < n; i++ {
+		result *= 60
+	}
+	return result
+}
+
+// Clip selects part of every media playlist.
+//
+// Each media playlist is cut down to the smallest run of segments that
+// covers [Start, End), then to at most FirstN segments. Master playlists
+// are never clipped.
+type Clip struct {
+	Start  ClipPoint
+	End    ClipPoint
+	FirstN int
+}
+
+// IsZero reports whether the clip keeps every segment.
+func (c Clip) IsZero() bool {
+	return c.Start.IsZero() && c.End.IsZero() && c.FirstN == 0
+}
+
+// selectSegments returns the half-open range [first, end) of segments the
+// clip covers.
+func (c Clip) selectSegments(segments []Segment) (int, int, error) {
+	starts := segmentStartTimes(segments)
+	if starts == nil && (!c.Start.Time.IsZero() || !c.End.Time.IsZero()) {
+		return 0, 0, fmt.Errorf("cannot clip by date-time: playlist has no EXT-X-PROGRAM-DATE-TIME")
+	}
+	first, end := -1, -1
+	offset := time.Duration(0)
+	for i, segment := range segments {
+		duration := time.Duration(segment.Duration * float64(time.Second))
+		segmentStart, segmentEnd := offset, offset+duration
+		offset = segmentEnd
+
+		afterStart := true
+		switch {
+		case !c.Start.Time.IsZero():
+			afterStart = starts[i].Add(duration).After(c.Start.Time)
+		case c.Start.Offset > 0:
+			afterStart = segmentEnd > c.Start.Offset
+		}
+
+		beforeEnd := true
+		switch {
+		case !c.End.Time.IsZero():
+			beforeEnd = starts[i].Before(c.End.Time)
+		case c.End.Offset > 0:
+			beforeEnd = segmentStart < c.End.Offset
+		}
+
+		if afterStart && beforeEnd {
+			if first == -1 {
+				first = i
+			}
+			end = i + 1
+		}
+	}
+
+	if first == -1 {
+		return 0, 0, nil
+	}
+	if c.FirstN > 0 {
+		end = min(end, first+c.FirstN)
+	}
+	return first, end, nil
+}
+
+// segmentStartTimes returns the wall-clock start of every segment, or nil
+// if the playlist has no EXT-X-PROGRAM-DATE-TIME.
+//
+// Each date-time anchors the segments after it, and the first one also
+// anchors the segments before it.
+func segmentStartTimes(segments []Segment) []time.Time {
+	offsets := make([]time.Duration, len(segments))
+	var anchor time.Time // Wall-clock time at offset zero
+	offset := time.Duration(0)
+	for i, segment := range segments {
+		offsets[i] = offset
+		if anchor.IsZero() && !segment.ProgramDateTime.IsZero() {
+			anchor = segment.ProgramDateTime.Add(-offset)
+		}
+		offset += time.Duration(segment.Duration * float64(time.Second))
+	}
+	if anchor.IsZero() {
+		return nil
+	}
+
+	starts := make([]time.Time, len(segments))
+	for i, segment := range segments {
+		if !segment.ProgramDateTime.IsZero() {
+			anchor = segment.ProgramDateTime.Add(-offsets[i])
+		}
+		starts[i] = anchor.Add(offsets[i])
+	}
+	return starts
+}
+
+// clipPlaylist cuts a media playlist down to the segments the clip covers.
+//
+// The EXT-X-KEY and EXT-X-MAP in effect for the first kept segment are
+// carried over, MEDIA-SEQUENCE and DISCONTINUITY-SEQUENCE are advanced past
+// the removed segments, and the first kept segment gets an explicit
+// date-time and byte range offset if it relied on earlier segments for them.
+//
+// Returns the playlist unchanged if it isn't a media playlist.
+func clipPlaylist(content []byte, m3u8 *M3U8File, clip Clip) ([]byte, error) {
+	if clip.IsZero() || m3u8.IsMaster() || len(m3u8.Segments) == 0 {
+		return content, nil
+	}
+
+	first, end, err := clip.selectSegments(m3u8.Segments)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := splitPlaylist(content, m3u8)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make([]bool, len(m3u8.Segments))
+	for i := first; i < end; i++ {
+		keep[i] = true
+	}
+	return keepSegments(parts, m3u8, keep), nil
+}
+
+// LiveWindow turns a VOD media playlist into the playlist a live stream
+// would serve after elapsed time.
+//
+// The stream starts with the first windowSize segments available and then
+// publishes each following segment once its duration has passed. The window
+// is cut with keepSegments, so MEDIA-SEQUENCE and DISCONTINUITY-SEQUENCE
+// advance as segments slide out and the window's first segment carries the
+// key, map, date-time and byte range offset it inherited. Until every
+// segment has been published, EXT-X-PLAYLIST-TYPE and EXT-X-ENDLIST are left
+// out.
+//
+// Returns false if content isn't a VOD media playlist.
+func LiveWindow(content []byte, windowSize int, elapsed time.Duration) ([]byte, bool) {
+	m3u8, err := ParseM3U8(content, &url.URL{Path: "/"})
+	if err != nil || m3u8.IsMaster() || !m3u8.EndList || len(m3u8.Segments) == 0 {
+		return nil, false
+	}
+	parts, err := splitPlaylist(content, m3u8)
+	if err != nil {
+		return nil, false
+	}
+
+	// Work out how many segments have been published so far
+	segments := m3u8.Segments
+	published := min(windowSize, len(segments))
+	remaining := elapsed
+	for published < len(segments) && remaining >= secondsDuration(segments[published].Duration) {
+		remaining -= secondsDuration(segments[published].Duration)
+		published++
+	}
+
+	keep := make([]bool, len(segments))
+	for i := max(published-windowSize, 0); i < published; i++ {
+		keep[i] = true
+	}
+
+	// A live stream can't be VOD or EVENT, and only ends once everything
+	// has been published
+	parts.header = slices.DeleteFunc(parts.header, func(line string) bool {
+		return tagName(line) == "EXT-X-PLAYLIST-TYPE"
+	})
+	if published < len(segments) {
+		parts.trailer = slices.DeleteFunc(parts.trailer, func(line string) bool {
+			return tagName(line) == "EXT-X-ENDLIST"
+		})
+	}
+
+	return keepSegments(parts, m3u8, keep), true
+}
+
+// keepSegments writes a media playlist with only the segments keep selects.
+//
+// A kept segment that follows removed ones gets the EXT-X-KEY and EXT-X-MAP
+// the removed segments switched to, an explicit date-time and byte range
+// offset, and, unless it is the first segment, an EXT-X-DISCONTINUITY.
+// MEDIA-SEQUENCE and DISCONTINUITY-SEQUENCE are advanced past the segments
+// removed from the start.
+func keepSegments(parts *playlistParts, m3u8 *M3U8File, keep []bool) []byte {
+	first := slices.Index(keep, true)
+	if first == -1 {
+		first = 0
+	}
+
+	discontinuitySequence := parts.discontinuitySequence
+	for _, segment := range parts.segments[:first] {
+		if hasTagLine(segment, "EXT-X-DISCONTINUITY") {
+			discontinuitySequence++
+		}
+	}
+
+	var output bytes.Buffer
+	for _, line := range parts.header {
+		output.WriteString(line + "\n")
+	}
+	fmt.Fprintf(&output, "#EXT-X-MEDIA-SEQUENCE:%d\n", m3u8.MediaSequence+int64(first))
+	if discontinuitySequence > 0 {
+		fmt.Fprintf(&output, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", discontinuitySequence)
+	}
+
+	starts := segmentStartTimes(m3u8.Segments)
+	var key, mapTag string // Switched to by the removed segments since the last kept one
+	removed := false
+	for i, segment := range parts.segments {
+		if !keep[i] {
+			for _, line := range segment {
+				switch tagName(line) {
+				case "EXT-X-KEY":
+					key = line
+				case "EXT-X-MAP":
+					mapTag = line
+				}
+			}
+			removed = true
+			continue
+		}
+
+		if removed {
+			var start time.Time
+			if starts != nil {
+				start = starts[i]
+			}
+			segment = standaloneSegment(segment, m3u8.Segments[i], key, mapTag, start)
+			if i > first && !hasTagLine(segment, "EXT-X-DISCONTINUITY") {
+				segment = append([]string{"#EXT-X-DISCONTINUITY"}, segment...)
+			}
+			key, mapTag, removed = "", "", false
+		}
+		for _, line := range segment {
+			output.WriteString(line + "\n")
+		}
+	}
+
+	for _, line := range parts.trailer {
+		output.WriteString(line + "\n")
+	}
+
+	return output.Bytes()
+}
+
+// playlistParts is a media playlist split into its lines.
+type playlistParts struct {
+	// header holds the playlist tags before the first segment, except
+	// EXT-X-MEDIA-SEQUENCE and EXT-X-DISCONTINUITY-SEQUENCE
+	header []string
+	// segments holds the lines of each segment: its tags, then its URI
+	segments [][]string
+	// trailer holds the tags after the last segment (e.g. EXT-X-ENDLIST)
+	trailer []string
+	// discontinuitySequence is the EXT-X-DISCONTINUITY-SEQUENCE, if any
+	discontinuitySequence int64
+}
+
+// splitPlaylist splits a media playlist into its header, segments and
+// trailer, so segments can be removed along with the tags that belong to
+// them.
+func splitPlaylist(content []byte, m3u8 *M3U8File) (*playlistParts, error) {
+	parts := &playlistParts{}
+	var pending []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		name := tagName(line)
+		switch {
+		case !strings.HasPrefix(line, "#"):
+			parts.segments = append(parts.segments, append(pending, line))
+			pending = nil
+		case name == "EXT-X-MEDIA-SEQUENCE":
+			// Written by the caller with the adjusted value
+		case name == "EXT-X-DISCONTINUITY-SEQUENCE":
+			parts.discontinuitySequence, _ = strconv.ParseInt(tagValue(line), 10, 64)
+		case len(parts.segments) == 0 && len(pending) == 0 && !isClipSegmentTag(name):
+			parts.header = append(parts.header, line)
+		default:
+			pending = append(pending, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning M3U8 file: %w", err)
+	}
+
+	// Tags after the last segment (e.g. EXT-X-ENDLIST) stay at the end
+	for _, line := range pending {
+		if !isClipSegmentTag(tagName(line)) {
+			parts.trailer = append(parts.trailer, line)
+		}
+	}
+
+	if len(parts.segments) != len(m3u8.Segments) {
+		return nil, fmt.Errorf("found %d segments but parsed %d", len(parts.segments), len(m3u8.Segments))
+	}
+	return parts, nil
+}
+
+// standaloneSegment makes a segment that follows removed segments stand on
+// its own by adding the key, map, date-time and byte range offset it
+// inherited from them.
+//
+// start is the segment's wall-clock start, or zero if the playlist has no
+// date-times.
+func standaloneSegment(lines []string, segment Segment, key, mapTag string, start time.Time) []string {
+	result := make([]string, 0, len(lines)+3)
+	if key != "" && !hasTagLine(lines, "EXT-X-KEY") {
+		result = append(result, key)
+	}
+	if mapTag != "" && !hasTagLine(lines, "EXT-X-MAP") {
+		result = append(result, mapTag)
+	}
+	if !start.IsZero() && !hasTagLine(lines, "EXT-X-PROGRAM-DATE-TIME") {
+		result = append(result, "#EXT-X-PROGRAM-DATE-TIME:"+start.Format("2006-01-02T15:04:05.000Z07:00"))
+	}
+
+	for _, line := range lines {
+		if tagName(line) == "EXT-X-BYTERANGE" && !strings.Contains(line, "@") && segment.ByteRange != nil {
+			line = fmt.Sprintf("#EXT-X-BYTERANGE:%d@%d", segment.ByteRange.Length, segment.ByteRange.Offset)
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// isClipSegmentTag reports whether a tag belongs to a media segment rather
+// than the playlist header or trailer: the segmentTags that only apply to the
+// next URI, the tags whose effect carries on to later segments, and ad
+// markers.
+func isClipSegmentTag(name string) bool {
+	switch name {
+	case "EXT-X-DISCONTINUITY", "EXT-X-KEY", "EXT-X-MAP", "EXT-X-DATERANGE":
+		return true
+	}
+	return segmentTags[name] || adMarkerTags[name]
+}
+
+// hasTagLine reports whether any of lines is the given tag.
+func hasTagLine(lines []string, name string) bool {
+	for _, line := range lines {
+		if tagName(line) == name {
+			return true
+		}
+	}
+	return false
+}
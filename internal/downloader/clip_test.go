@@ -0,0 +1,263 @@
+package downloader
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseClipPoint(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ClipPoint
+	}{
+		{"", ClipPoint{}},
+		{"00:45:00", ClipPoint{Offset: 45 * time.Minute}},
+		{"1:02:03.5", ClipPoint{Offset: time.Hour + 2*time.Minute + 3500*time.Millisecond}},
+		{"90:00", ClipPoint{Offset: 90 * time.Minute}},
+		{"125", ClipPoint{Offset: 125 * time.Second}},
+		{"2m30s", ClipPoint{Offset: 150 * time.Second}},
+		{"2024-01-01T12:00:00Z", ClipPoint{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		got, err := ParseClipPoint(tt.input)
+		if err != nil {
+			t.Errorf("ParseClipPoint(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got.Offset != tt.want.Offset || !got.Time.Equal(tt.want.Time) {
+			t.Errorf("ParseClipPoint(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"1:2:3:4", "00:61:00", "00:00:60", "abc", "-5", "1x"} {
+		if _, err := ParseClipPoint(input); err == nil {
+			t.Errorf("ParseClipPoint(%q): expected an error", input)
+		}
+	}
+}
+
+// clipTestPlaylist has six 10 second segments with a key rotation, a map,
+// a discontinuity and byte ranges without offsets.
+const clipTestPlaylist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin"
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T12:00:00.000Z
+#EXTINF:10,
+seg0.m4s
+#EXTINF:10,
+seg1.m4s
+#EXT-X-DISCONTINUITY
+#EXT-X-KEY:METHOD=AES-128,URI="key2.bin"
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000@0
+all.m4s
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000
+all.m4s
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000
+all.m4s
+#EXTINF:10,
+seg5.m4s
+#EXT-X-ENDLIST
+`
+
+func clip(t *testing.T, content string, c Clip) string {
+	t.Helper()
+	baseURL, _ := url.Parse("https://example.com/video/index.m3u8")
+	m3u8, err := ParseM3U8([]byte(content), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	clipped, err := clipPlaylist([]byte(content), m3u8, c)
+	if err != nil {
+		t.Fatalf("clipPlaylist failed: %v", err)
+	}
+	return string(clipped)
+}
+
+func TestClipPlaylistByOffset(t *testing.T) {
+	// 35s-45s is covered by the segments at 30s and 40s
+	got := clip(t, clipTestPlaylist, Clip{
+		Start: ClipPoint{Offset: 35 * time.Second},
+		End:   ClipPoint{Offset: 45 * time.Second},
+	})
+
+	want := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MEDIA-SEQUENCE:103
+#EXT-X-DISCONTINUITY-SEQUENCE:1
+#EXT-X-KEY:METHOD=AES-128,URI="key2.bin"
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T12:00:30.000Z
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000@1000
+all.m4s
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000
+all.m4s
+#EXT-X-ENDLIST
+`
+	if got != want {
+		t.Errorf("Unexpected clip:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestClipPlaylistFirstN(t *testing.T) {
+	got := clip(t, clipTestPlaylist, Clip{FirstN: 2})
+
+	if !strings.Contains(got, "#EXT-X-MEDIA-SEQUENCE:100\n") {
+		t.Errorf("Expected the media sequence to be unchanged:\n%s", got)
+	}
+	if !strings.Contains(got, "seg0.m4s\n#EXTINF:10,\nseg1.m4s\n#EXT-X-ENDLIST\n") {
+		t.Errorf("Expected only the first two segments:\n%s", got)
+	}
+	if strings.Contains(got, "key2.bin") || strings.Contains(got, "all.m4s") {
+		t.Errorf("Expected later segments and their key to be removed:\n%s", got)
+	}
+
+	// FirstN counts from the start of the time range
+	got = clip(t, clipTestPlaylist, Clip{Start: ClipPoint{Offset: 50 * time.Second}, FirstN: 3})
+	if !strings.Contains(got, "#EXT-X-MEDIA-SEQUENCE:105\n") || strings.Count(got, "#EXTINF") != 1 {
+		t.Errorf("Expected only the last segment:\n%s", got)
+	}
+}
+
+func TestClipPlaylistByDateTime(t *testing.T) {
+	got := clip(t, clipTestPlaylist, Clip{
+		Start: ClipPoint{Time: time.Date(2024, 1, 1, 12, 0, 15, 0, time.UTC)},
+		End:   ClipPoint{Time: time.Date(2024, 1, 1, 12, 0, 20, 0, time.UTC)},
+	})
+
+	if !strings.Contains(got, "#EXT-X-MEDIA-SEQUENCE:101\n") || strings.Count(got, "#EXTINF") != 1 || !strings.Contains(got, "seg1.m4s") {
+		t.Errorf("Expected only the segment at 10s:\n%s", got)
+	}
+
+	// Date-times can't be matched without EXT-X-PROGRAM-DATE-TIME
+	noDateTime := strings.Replace(clipTestPlaylist, "#EXT-X-PROGRAM-DATE-TIME:2024-01-01T12:00:00.000Z\n", "", 1)
+	baseURL, _ := url.Parse("https://example.com/video/index.m3u8")
+	m3u8, err := ParseM3U8([]byte(noDateTime), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	_, err = clipPlaylist([]byte(noDateTime), m3u8, Clip{Start: ClipPoint{Time: time.Now()}})
+	if err == nil {
+		t.Error("Expected an error when clipping by date-time without EXT-X-PROGRAM-DATE-TIME")
+	}
+}
+
+func TestClipPlaylistLeavesMasterAlone(t *testing.T) {
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nlow.m3u8\n"
+	if got := clip(t, master, Clip{FirstN: 1}); got != master {
+		t.Errorf("Expected the master playlist to be unchanged, got:\n%s", got)
+	}
+}
+
+func TestLiveWindow(t *testing.T) {
+	vod := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.0,
+seg0.m4s
+#EXTINF:10.0,
+seg1.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:10.0,
+seg2.m4s
+#EXTINF:10.0,
+seg3.m4s
+#EXT-X-ENDLIST
+`
+
+	// At the start, only the first window is available
+	window, ok := LiveWindow([]byte(vod), 2, 0)
+	if !ok {
+		t.Fatal("Expected VOD playlist to be converted")
+	}
+	expected := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.0,
+seg0.m4s
+#EXTINF:10.0,
+seg1.m4s
+`
+	if string(window) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, window)
+	}
+
+	// After two segments' worth of time the window has slid forward and
+	// the map is carried along
+	window, _ = LiveWindow([]byte(vod), 2, 25*time.Second)
+	expected = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:2
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-DISCONTINUITY
+#EXTINF:10.0,
+seg2.m4s
+#EXTINF:10.0,
+seg3.m4s
+#EXT-X-ENDLIST
+`
+	if string(window) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, window)
+	}
+
+	// Once the discontinuity slides out, DISCONTINUITY-SEQUENCE is bumped
+	window, _ = LiveWindow([]byte(vod), 1, 35*time.Second)
+	if !strings.Contains(string(window), "#EXT-X-DISCONTINUITY-SEQUENCE:1\n") {
+		t.Errorf("Expected DISCONTINUITY-SEQUENCE to advance, got:\n%s", window)
+	}
+
+	// Master and live playlists are served unchanged
+	if _, ok := LiveWindow([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n"), 2, 0); ok {
+		t.Error("Master playlists should not be converted")
+	}
+	if _, ok := LiveWindow([]byte("#EXTM3U\n#EXTINF:10,\nseg0.ts\n"), 2, 0); ok {
+		t.Error("Live playlists should not be converted")
+	}
+}
+
+func TestLiveWindowByteRanges(t *testing.T) {
+	vod := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000@0
+all.ts
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000
+all.ts
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000
+all.ts
+#EXT-X-ENDLIST
+`
+
+	// The window's first segment can't rely on the segment before it for
+	// its offset
+	window, _ := LiveWindow([]byte(vod), 1, 10*time.Second)
+	expected := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:1
+#EXTINF:10,
+#EXT-X-BYTERANGE:1000@1000
+all.ts
+`
+	if string(window) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, window)
+	}
+}
@@ -0,0 +1,366 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+	"github.com/knpwrs/m3u8dl/internal/filesystem"
+)
+
+// processMPD parses a fetched MPEG-DASH manifest, downloads the segments of
+// its representations, and writes it.
+//
+// This is the DASH counterpart of processM3U8: the same filters, content
+// steering pathway (as BaseURL serviceLocation), redirect handling,
+// rewriting and manifest recording apply.
+func (d *Downloader) processMPD(ctx context.Context, mpdURL string, ref resourceRef, resp *fetcher.Response, elapsed time.Duration) error {
+	content := bytes.TrimPrefix(resp.Body, utf8BOM)
+
+	baseURL := mpdURL
+	if resp.URL != "" && resp.URL != mpdURL {
+		baseURL = resp.URL
+		d.progress.PrintVerbose("Redirected: %s -> %s", mpdURL, baseURL)
+	}
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse MPD URL: %w", err)
+	}
+
+	mpd, err := ParseMPD(content, parsedURL, d.pathway)
+	if err != nil {
+		return fmt.Errorf("failed to parse MPD content: %w", err)
+	}
+	if !d.clip.IsZero() || (d.ads != AdsKeep && d.ads != "") {
+		d.progress.PrintWarning("clipping and ad filtering are not supported for DASH, downloading all of %s", mpdURL)
+	}
+	if mpd.Dynamic {
+		d.progress.PrintVerbose("Live MPD: downloading the segments it currently lists")
+	}
+
+	d.progress.PrintVerbose("Found %d URLs in MPD", len(mpd.URLs))
+
+	if err := d.mapRedirect(mpdURL, baseURL, mpd.References, func(base *url.URL) ([]string, error) {
+		mapped, err := ParseMPD(content, base, d.pathway)
+		if err != nil {
+			return nil, err
+		}
+		return mapped.References, nil
+	}); err != nil {
+		return err
+	}
+
+	refs := classifyMPDReferences(mpd, mpdURL)
+	if err := d.downloadURLs(ctx, mpd.URLs, nil, refs); err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		return d.planPlaylist(mpdURL, content)
+	}
+
+	if d.rewriteURLs || d.rewriteOpts.Absolutize {
+		d.progress.PrintVerbose("Rewriting URLs in MPD file")
+		opts := d.rewriteOpts
+		opts.Keep = func(absoluteURL string) bool {
+			ref, ok := refs[absoluteURL]
+			return ok && d.shouldDownload(absoluteURL, ref)
+		}
+		rewrittenContent, err := RewriteMPDURLs(mpd, mpdURL, d.fs, opts)
+		if err != nil {
+			d.progress.PrintWarning("failed to rewrite URLs in %s: %v", mpdURL, err)
+		} else {
+			content = rewrittenContent
+		}
+	}
+
+	return d.writePlaylist(mpdURL, ref, content, resp, elapsed)
+}
+
+// classifyMPDReferences works out the ResourceType of every URL in an MPD:
+// initialization segments are maps, and index and media segments get the
+// type of their representation.
+func classifyMPDReferences(mpd *MPDFile, parentURL string) map[string]resourceRef {
+	refs := make(map[string]resourceRef, len(mpd.URLs))
+	for _, period := range mpd.Periods {
+		for _, set := range period.AdaptationSets {
+			for _, rep := range set.Representations {
+				for _, resource := range rep.resources() {
+					if _, ok := refs[resource.URL]; ok {
+						continue
+					}
+					ref := resourceRef{Parent: parentURL, Type: rep.Type}
+					if rep.Init != nil && resource.URL == rep.Init.URL {
+						ref.Type = ResourceMap
+					}
+					refs[resource.URL] = ref
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// RewriteMPDURLs rewrites an MPD so every segment is loaded from where it was
+// stored locally, modifying mpd's document.
+//
+// Every BaseURL is removed and each Representation gets its own. When the
+// local layout mirrors the origin's, the templates and segment lists are left
+// alone and the new BaseURL points at the local directory. Otherwise (e.g.
+// with a flattened layout or a rewrite query), the segments of every
+// Representation of the Period are listed explicitly in a SegmentList with a
+// SegmentTimeline. Representations with references rejected by opts.Keep
+// stream from the origin, or are removed with FilteredRemove.
+//
+// Parameters:
+//   - mpd: The parsed MPD, from ParseMPD
+//   - sourceURL: The URL where the MPD was downloaded from
+//   - fs: The filesystem handler that manages path mappings
+//   - opts: How references should be rewritten (ResolveBase is ignored, as
+//     mpd's references are already resolved)
+//
+// Returns the rewritten MPD content.
+func RewriteMPDURLs(mpd *MPDFile, sourceURL string, fs *filesystem.FileSystem, opts RewriteOptions) ([]byte, error) {
+	baseURL, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MPD URL %s: %w", sourceURL, err)
+	}
+	rw := &rewriter{sourceURL: sourceURL, baseURL: baseURL, fs: fs, opts: opts}
+
+	removeElements(mpd.mpd, "BaseURL")
+	for _, period := range mpd.Periods {
+		removeElements(period.node, "BaseURL")
+		rewritePeriod(rw, period)
+	}
+	return mpd.root.bytes(), nil
+}
+
+// rewritePeriod rewrites the representations of a period.
+func rewritePeriod(rw *rewriter, period *MPDPeriod) {
+	type planned struct {
+		rep       *Representation
+		rewritten []string // Rewritten references of rep.resources()
+		base      string   // Common base of the rewritten references
+	}
+	var plans []planned
+	explicit := false
+
+	for _, set := range period.AdaptationSets {
+		removeElements(set.node, "BaseURL")
+		kept := 0
+		for _, rep := range set.Representations {
+			removeElements(rep.node, "BaseURL")
+
+			resources := rep.resources()
+			rewritten := make([]string, len(resources))
+			removed := false
+			for i, resource := range resources {
+				if rewritten[i], removed = rw.rewriteReference(resource.URL); removed {
+					break
+				}
+			}
+			if removed {
+				set.node.remove(rep.node)
+				continue
+			}
+			kept++
+
+			if rep.Addressing == AddressingBase {
+				rewriteSingleFile(rep, rewritten)
+				continue
+			}
+			base, ok := commonBase(resources, rewritten)
+			explicit = explicit || !ok
+			plans = append(plans, planned{rep: rep, rewritten: rewritten, base: base})
+		}
+		if kept == 0 {
+			period.node.remove(set.node)
+		}
+	}
+
+	if !explicit {
+		for _, plan := range plans {
+			setBaseURL(plan.rep, plan.base)
+		}
+		return
+	}
+
+	// Segment addressing is inherited, so once one representation needs an
+	// explicit list, every representation of the period gets one
+	removeElements(period.node, "SegmentTemplate", "SegmentList")
+	for _, set := range period.AdaptationSets {
+		removeElements(set.node, "SegmentTemplate", "SegmentList")
+	}
+	for _, plan := range plans {
+		removeElements(plan.rep.node, "SegmentTemplate", "SegmentList")
+		plan.rep.node.insertBefore(segmentList(plan.rep, plan.rewritten), "SubRepresentation")
+	}
+}
+
+// rewriteSingleFile points a representation whose media is a single file at
+// its rewritten location. rewritten are the rewritten references of
+// rep.resources().
+func rewriteSingleFile(rep *Representation, rewritten []string) {
+	media := rewritten[len(rewritten)-1]
+	setBaseURL(rep, media)
+
+	// Separate initialization and index files are relative to the media file
+	i := 0
+	for _, name := range []string{"Initialization", "RepresentationIndex"} {
+		segment := rep.Init
+		if name == "RepresentationIndex" {
+			segment = rep.Index
+		}
+		if segment == nil {
+			continue
+		}
+		if node := rep.node.element("SegmentBase").element(name); node != nil {
+			node.setAttr("sourceURL", relativeTo(media, rewritten[i]))
+		}
+		i++
+	}
+}
+
+// commonBase works out the base URL that makes every reference of a
+// representation, as written, resolve to its rewritten form.
+//
+// Returns false if there is none, e.g. because the local layout differs from
+// the origin's or a query string was appended.
+func commonBase(resources []MPDSegment, rewritten []string) (string, bool) {
+	base := ""
+	for i, resource := range resources {
+		ref := resource.Ref
+		if ref == "" || strings.ContainsAny(ref, "?#") || strings.HasPrefix(ref, "/") || strings.Contains(ref, "://") {
+			return "", false
+		}
+		dir, ok := strings.CutSuffix(rewritten[i], ref)
+		if !ok || (dir != "" && !strings.HasSuffix(dir, "/")) {
+			return "", false
+		}
+		if i == 0 {
+			base = dir
+		} else if dir != base {
+			return "", false
+		}
+	}
+	return base, true
+}
+
+// setBaseURL gives a representation its own BaseURL (none if base is empty,
+// so references are relative to the MPD).
+func setBaseURL(rep *Representation, base string) {
+	if base == "" {
+		return
+	}
+	node := &xmlNode{Name: siblingName(rep.node, "BaseURL")}
+	node.Children = []*xmlNode{{Token: xml.CharData(base)}}
+	rep.node.insertBefore(node, "SegmentBase", "SegmentList", "SegmentTemplate", "SubRepresentation")
+}
+
+// segmentList builds a SegmentList that lists the rewritten references of a
+// representation explicitly, with a SegmentTimeline keeping their timing.
+func segmentList(rep *Representation, rewritten []string) *xmlNode {
+	list := &xmlNode{Name: siblingName(rep.node, "SegmentList")}
+	list.setAttr("timescale", strconv.FormatUint(rep.Timescale, 10))
+	if rep.PresentationTimeOffset != 0 {
+		list.setAttr("presentationTimeOffset", strconv.FormatUint(rep.PresentationTimeOffset, 10))
+	}
+
+	i := 0
+	for _, name := range []string{"Initialization", "RepresentationIndex"} {
+		segment := rep.Init
+		if name == "RepresentationIndex" {
+			segment = rep.Index
+		}
+		if segment == nil {
+			continue
+		}
+		node := &xmlNode{Name: siblingName(rep.node, name)}
+		node.setAttr("sourceURL", rewritten[i])
+		if segment.Range != "" {
+			node.setAttr("range", segment.Range)
+		}
+		list.Children = append(list.Children, node)
+		i++
+	}
+
+	if timeline := segmentTimeline(rep); timeline != nil {
+		list.Children = append(list.Children, timeline)
+	}
+	for j, segment := range rep.Segments {
+		node := &xmlNode{Name: siblingName(rep.node, "SegmentURL")}
+		node.setAttr("media", rewritten[i+j])
+		if segment.Range != "" {
+			node.setAttr("mediaRange", segment.Range)
+		}
+		list.Children = append(list.Children, node)
+	}
+	return list
+}
+
+// segmentTimeline builds a SegmentTimeline for a representation's segments,
+// merging runs of equal, contiguous segments with S@r. Returns nil if the
+// segments have no timing.
+func segmentTimeline(rep *Representation) *xmlNode {
+	if len(rep.Segments) == 0 || rep.Segments[0].Duration == 0 {
+		return nil
+	}
+
+	timeline := &xmlNode{Name: siblingName(rep.node, "SegmentTimeline")}
+	var last *xmlNode
+	var lastEnd, lastDuration uint64
+	repeat := 0
+	for _, segment := range rep.Segments {
+		if last != nil && segment.Time == lastEnd && segment.Duration == lastDuration {
+			repeat++
+			last.setAttr("r", strconv.Itoa(repeat))
+		} else {
+			last = &xmlNode{Name: siblingName(rep.node, "S")}
+			last.setAttr("t", strconv.FormatUint(segment.Time, 10))
+			last.setAttr("d", strconv.FormatUint(segment.Duration, 10))
+			timeline.Children = append(timeline.Children, last)
+			repeat = 0
+		}
+		lastEnd, lastDuration = segment.Time+segment.Duration, segment.Duration
+	}
+	return timeline
+}
+
+// removeElements removes every child element of node with one of the given
+// local names.
+func removeElements(node *xmlNode, names ...string) {
+	for _, name := range names {
+		for _, element := range node.elements(name) {
+			node.remove(element)
+		}
+	}
+}
+
+// siblingName returns name with the namespace prefix of node, so new
+// elements match the document's prefix (usually none).
+func siblingName(node *xmlNode, name string) string {
+	if i := strings.IndexByte(node.Name, ':'); i != -1 {
+		return node.Name[:i+1] + name
+	}
+	return name
+}
+
+// relativeTo rewrites target, which like base is relative to the MPD, to be
+// relative to base instead. Absolute URLs are returned as they are.
+func relativeTo(base, target string) string {
+	if strings.Contains(base, "://") || strings.Contains(target, "://") {
+		return target
+	}
+	rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(base)), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testMPD is a manifest with a templated video representation, a timeline
+// audio representation and a subtitle segment list.
+const testMPD = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT8S">
+  <Period>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <Representation id="v" bandwidth="1000000">
+        <SegmentTemplate timescale="1" duration="4" startNumber="1" initialization="video/init.mp4" media="video/$Number$.m4s"/>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4">
+      <Representation id="a" bandwidth="128000">
+        <SegmentTemplate timescale="1" initialization="audio/init.mp4" media="audio/$Time$.m4s">
+          <SegmentTimeline><S t="0" d="4" r="1"/></SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="text" mimeType="application/mp4">
+      <Representation id="s" bandwidth="1000">
+        <SegmentList timescale="1" duration="8">
+          <SegmentURL media="subs/0.m4s"/>
+        </SegmentList>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+func TestDownloadMPD(t *testing.T) {
+	segments := []string{"/dash/video/init.mp4", "/dash/video/1.m4s", "/dash/video/2.m4s", "/dash/audio/init.mp4", "/dash/audio/0.m4s", "/dash/audio/4.m4s"}
+
+	tests := []struct {
+		name     string
+		config   Config
+		files    []string // Files expected in the output directory
+		expected []string // Expected in the rewritten manifest
+		skipped  []string // Paths that should not be fetched
+	}{
+		{
+			name:     "templates kept",
+			config:   Config{},
+			files:    []string{"dash/manifest.mpd", "dash/video/1.m4s", "dash/audio/4.m4s", "dash/subs/0.m4s"},
+			expected: []string{`media="video/$Number$.m4s"`, `media="audio/$Time$.m4s"`, `<SegmentURL media="subs/0.m4s"/>`},
+		},
+		{
+			name:     "flattened",
+			config:   Config{Flatten: true},
+			files:    []string{"manifest.mpd", "1.m4s", "4.m4s"},
+			expected: []string{`<SegmentURL media="1.m4s"/>`, `<SegmentURL media="4.m4s"/>`, `<S t="0" d="4" r="1"/>`},
+		},
+		{
+			name:     "subtitles excluded",
+			config:   Config{ExcludeTypes: []ResourceType{ResourceSubtitle}, FilteredRefs: FilteredRemove},
+			files:    []string{"dash/manifest.mpd", "dash/video/1.m4s"},
+			skipped:  []string{"/dash/subs/0.m4s"},
+			expected: []string{`media="video/$Number$.m4s"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requested := make(map[string]bool)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requested[r.URL.Path] = true
+				mu.Unlock()
+				if r.URL.Path == "/dash/manifest.mpd" {
+					w.Header().Set("Content-Type", mpdContentType)
+					w.Write([]byte(testMPD))
+					return
+				}
+				w.Write([]byte("media " + r.URL.Path))
+			}))
+			defer srv.Close()
+
+			outputDir := t.TempDir()
+			config := tt.config
+			config.OutputDir = outputDir
+			config.Concurrency = 2
+			config.RewriteURLs = true
+			config.Quiet = true
+			if err := New(config).Download(context.Background(), srv.URL+"/dash/manifest.mpd"); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			for _, p := range segments {
+				if !requested[p] {
+					t.Errorf("Expected %s to be fetched", p)
+				}
+			}
+			for _, p := range tt.skipped {
+				if requested[p] {
+					t.Errorf("Expected %s to be skipped", p)
+				}
+			}
+			for _, p := range tt.files {
+				if _, err := os.Stat(filepath.Join(outputDir, p)); err != nil {
+					t.Errorf("Expected %s to be written: %v", p, err)
+				}
+			}
+
+			manifestPath := filepath.Join(outputDir, "dash", "manifest.mpd")
+			if tt.config.Flatten {
+				manifestPath = filepath.Join(outputDir, "manifest.mpd")
+			}
+			manifest, err := os.ReadFile(manifestPath)
+			if err != nil {
+				t.Fatalf("Failed to read manifest: %v", err)
+			}
+			if strings.Contains(string(manifest), srv.URL) {
+				t.Errorf("Expected no remote URLs in the rewritten manifest:\n%s", manifest)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(string(manifest), expected) {
+					t.Errorf("Expected %s in the rewritten manifest:\n%s", expected, manifest)
+				}
+			}
+			for _, p := range tt.skipped {
+				if strings.Contains(string(manifest), strings.TrimPrefix(p, "/dash/")) {
+					t.Errorf("Expected %s to be removed from the rewritten manifest:\n%s", p, manifest)
+				}
+			}
+			local, _ := url.Parse("file://" + filepath.ToSlash(manifestPath))
+			if _, err := ParseMPD(manifest, local, ""); err != nil {
+				t.Errorf("Rewritten manifest doesn't parse: %v", err)
+			}
+		})
+	}
+}
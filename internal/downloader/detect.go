@@ -0,0 +1,142 @@
+package downloader
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+)
+
+// playlistExtensions are the file extensions that name M3U8 playlists.
+var playlistExtensions = map[string]bool{
+	".m3u8": true,
+	".m3u":  true,
+}
+
+// playlistContentTypes are the MIME types servers send with M3U8 playlists.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8216#section-4
+var playlistContentTypes = map[string]bool{
+	"application/vnd.apple.mpegurl": true,
+	"application/x-mpegurl":         true,
+	"audio/mpegurl":                 true,
+	"audio/x-mpegurl":               true,
+}
+
+// mpdExtension is the file extension of MPEG-DASH manifests, and
+// mpdContentType the MIME type servers send with them.
+const (
+	mpdExtension   = ".mpd"
+	mpdContentType = "application/dash+xml"
+)
+
+// mediaExtensions are the file extensions of segments and other media that
+// can be told apart from playlists by name alone. A dry run fetches URIs
+// without one of these to see whether they are playlists.
+var mediaExtensions = map[string]bool{
+	".ts":   true,
+	".m2ts": true,
+	".mts":  true,
+	".aac":  true,
+	".ac3":  true,
+	".ec3":  true,
+	".mp3":  true,
+	".mp4":  true,
+	".m4s":  true,
+	".m4a":  true,
+	".m4v":  true,
+	".cmfv": true,
+	".cmfa": true,
+	".cmft": true,
+	".webm": true,
+	".vtt":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".key":  true,
+}
+
+// playlistSignature is the first line of every M3U8 playlist.
+var playlistSignature = []byte("#EXTM3U")
+
+// utf8BOM is the UTF-8 byte order mark some servers put before #EXTM3U.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// IsPlaylistContent reports whether content starts like an M3U8 playlist,
+// i.e. with #EXTM3U after an optional byte order mark and whitespace.
+func IsPlaylistContent(content []byte) bool {
+	content = bytes.TrimPrefix(content, utf8BOM)
+	return bytes.HasPrefix(bytes.TrimLeft(content, " \t\r\n"), playlistSignature)
+}
+
+// IsPlaylistFile reports whether the local file at p is an M3U8 playlist,
+// based on its content rather than its name. Unreadable files are not
+// playlists.
+func IsPlaylistFile(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 16)
+	n, _ := io.ReadFull(f, header)
+	return IsPlaylistContent(header[:n])
+}
+
+// isPlaylistURL reports whether a URL's path has a playlist extension.
+//
+// This is only a guess for URIs that appear without any tag saying what they
+// are; playlists served as e.g. /manifest(format=m3u8-aapl) or /playlist?id=1
+// are recognized by isPlaylistResponse once fetched.
+func isPlaylistURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+	return playlistExtensions[strings.ToLower(path.Ext(u.Path))]
+}
+
+// isPlaylistContentType reports whether a Content-Type header value is one of
+// the M3U8 MIME types.
+func isPlaylistContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && playlistContentTypes[mediaType]
+}
+
+// isPlaylistResponse reports whether a fetched resource is an M3U8 playlist,
+// based on its Content-Type header or, failing that, its content.
+func isPlaylistResponse(resp *fetcher.Response) bool {
+	return isPlaylistContentType(resp.Header.Get("Content-Type")) || IsPlaylistContent(resp.Body)
+}
+
+// IsMPDContent reports whether content looks like an MPEG-DASH manifest: an
+// XML document whose root element is MPD.
+func IsMPDContent(content []byte) bool {
+	content = bytes.TrimLeft(bytes.TrimPrefix(content, utf8BOM), " \t\r\n")
+	if !bytes.HasPrefix(content, []byte("<")) {
+		return false
+	}
+	// The root element comes after an optional declaration and comments
+	header := content[:min(len(content), 4096)]
+	return bytes.Contains(header, []byte("<MPD")) || bytes.Contains(header, []byte(":MPD"))
+}
+
+// isMPDResponse reports whether a fetched resource is an MPEG-DASH manifest,
+// based on its Content-Type header, its extension or, failing that, its
+// content.
+func isMPDResponse(urlStr string, resp *fetcher.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == mpdContentType {
+		return true
+	}
+	if urlExtension(urlStr) == mpdExtension && !IsPlaylistContent(resp.Body) {
+		return true
+	}
+	return IsMPDContent(resp.Body)
+}
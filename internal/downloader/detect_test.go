@@ -0,0 +1,182 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestIsPlaylistContent(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected bool
+	}{
+		{"#EXTM3U\n#EXTINF:10,\ns0.ts\n", true},
+		{"\xef\xbb\xbf#EXTM3U\n", true},
+		{"\r\n  #EXTM3U\n", true},
+		{"WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n", false},
+		{"\x47\x40\x00\x10", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPlaylistContent([]byte(tt.content)); got != tt.expected {
+			t.Errorf("IsPlaylistContent(%q) = %v, expected %v", tt.content, got, tt.expected)
+		}
+	}
+}
+
+func TestIsPlaylistFile(t *testing.T) {
+	dir := t.TempDir()
+	playlist := filepath.Join(dir, "manifest")
+	segment := filepath.Join(dir, "segment")
+	os.WriteFile(playlist, []byte("#EXTM3U\n#EXT-X-ENDLIST\n"), 0o644)
+	os.WriteFile(segment, []byte("\x47\x40\x00\x10"), 0o644)
+
+	if !IsPlaylistFile(playlist) {
+		t.Error("Expected a file starting with #EXTM3U to be a playlist")
+	}
+	if IsPlaylistFile(segment) {
+		t.Error("Expected a segment not to be a playlist")
+	}
+	if IsPlaylistFile(filepath.Join(dir, "missing")) {
+		t.Error("Expected a missing file not to be a playlist")
+	}
+}
+
+func TestIsPlaylistURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://example.com/index.m3u8", true},
+		{"https://example.com/INDEX.M3U8", true},
+		{"https://example.com/list.m3u", true},
+		{"https://example.com/index.m3u8?token=abc.ts", true},
+		{"https://example.com/segment.ts?next=index.m3u8", false},
+		{"https://example.com/manifest(format=m3u8-aapl)", false},
+		{"https://example.com/playlist?id=1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPlaylistURL(tt.url); got != tt.expected {
+			t.Errorf("isPlaylistURL(%q) = %v, expected %v", tt.url, got, tt.expected)
+		}
+	}
+}
+
+func TestIsPlaylistContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"application/vnd.apple.mpegurl", true},
+		{"application/x-mpegURL", true},
+		{"audio/mpegurl; charset=utf-8", true},
+		{"video/mp2t", false},
+		{"text/plain", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPlaylistContentType(tt.contentType); got != tt.expected {
+			t.Errorf("isPlaylistContentType(%q) = %v, expected %v", tt.contentType, got, tt.expected)
+		}
+	}
+}
+
+func TestParseM3U8MarksPlaylistsByTag(t *testing.T) {
+	content := []byte(`#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="en",URI="audio/playlist?id=1"
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100,URI="iframes"
+#EXT-X-SESSION-KEY:METHOD=AES-128,URI="key.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO="aud"
+video/manifest(format=m3u8-aapl)
+`)
+	baseURL, _ := url.Parse("https://example.com/master")
+	m3u8, err := ParseM3U8(content, baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+
+	for _, u := range []string{
+		"https://example.com/audio/playlist?id=1",
+		"https://example.com/iframes",
+		"https://example.com/video/manifest(format=m3u8-aapl)",
+	} {
+		if !m3u8.IsM3U8[u] {
+			t.Errorf("Expected %s to be marked as a playlist", u)
+		}
+	}
+}
+
+func TestDownloadDetectsPlaylistsByContent(t *testing.T) {
+	type resource struct {
+		contentType string
+		body        string
+	}
+	files := map[string]resource{
+		"/master": {"", "#EXTM3U\n" +
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"en\",URI=\"audio/playlist?id=1\"\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO=\"aud\"\nvideo/manifest(format=m3u8-aapl)\n"},
+		"/video/manifest(format=m3u8-aapl)": {"", "#EXTM3U\n#EXTINF:10,\ns0.ts\n#EXTINF:10,\nmore\n#EXT-X-ENDLIST\n"},
+		"/audio/playlist":                   {"", "#EXTM3U\n#EXTINF:10,\na0.aac\n#EXT-X-ENDLIST\n"},
+		"/video/s0.ts":                      {"video/mp2t", "segment"},
+		// Recognized by content only
+		"/video/more":   {"application/octet-stream", "\xef\xbb\xbf#EXTM3U\n#EXTINF:10,\ns1.ts\n"},
+		"/video/s1.ts":  {"video/mp2t", "segment"},
+		"/audio/a0.aac": {"audio/aac", "audio"},
+	}
+
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if file.contentType != "" {
+			w.Header().Set("Content-Type", file.contentType)
+		}
+		w.Write([]byte(file.body))
+	}))
+	defer srv.Close()
+
+	d := New(Config{
+		OutputDir:   t.TempDir(),
+		Concurrency: 2,
+		RewriteURLs: true,
+		Manifest:    true,
+		Quiet:       true,
+	})
+	if err := d.Download(context.Background(), srv.URL+"/master"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	for p := range files {
+		if !requested[p] {
+			t.Errorf("Expected %s to be downloaded", p)
+		}
+	}
+
+	types := make(map[string]ResourceType)
+	for _, entry := range d.Manifest() {
+		types[entry.URL] = entry.Type
+	}
+	if types[srv.URL+"/video/more"] != ResourcePlaylist {
+		t.Errorf("Expected the sniffed playlist to be recorded as a playlist, got %q", types[srv.URL+"/video/more"])
+	}
+	if stats := d.Stats(); stats.Playlists != 4 {
+		t.Errorf("Expected 4 playlists, got %d", stats.Playlists)
+	}
+}
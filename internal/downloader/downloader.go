@@ -1,12 +1,13 @@
 package downloader
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"net/url"
-	"path/filepath"
-	"strings"
+	"regexp"
 	"sync"
 	"time"
 
@@ -25,50 +26,174 @@ import (
 //
 // See: https://context7.com/golang/go for Go concurrency documentation
 type Downloader struct {
-	fetcher     *fetcher.Fetcher
-	fs          *filesystem.FileSystem
-	visited     map[string]bool
-	visitedLock sync.Mutex
-	concurrency int
-	rewriteURLs bool
-	include     []string // File extensions to include
-	exclude     []string // File extensions to exclude
-	verbose     bool
-	progress    *ProgressTracker
+	fetcher       *fetcher.Fetcher
+	fs            *filesystem.FileSystem
+	visited       map[string]bool
+	visitedLock   sync.Mutex
+	concurrency   int
+	rewriteURLs   bool
+	rewriteOpts   RewriteOptions
+	filter        Filter // Which referenced resources to download
+	overwrite     filesystem.OverwritePolicy
+	verbose       bool
+	progress      *ProgressTracker
+	dryRun        bool           // Plan the download without fetching segments or writing files
+	dryRunSizes   bool           // Look up file sizes with HEAD requests in dry-run mode
+	clip          Clip           // Part of every media playlist to download
+	ads           AdMode         // What to do with the segments inside ad breaks
+	redirectPaths RedirectMode   // Where redirected playlists and their references are stored
+	pathway       string         // Content steering pathway to download (empty lets the steering manifest decide)
+	lint          bool           // Lint every playlist before downloading what it references
+	dashManifest  bool           // Write a DASH manifest next to the top-level playlist
+	subtitles     SubtitleExport // Merged subtitle files to write next to the top-level playlist
+	plan          []PlannedFile  // Files that would be downloaded in dry-run mode
+	planLock      sync.Mutex
+
+	manifestEnabled bool            // Record a ManifestEntry for every resource
+	manifest        []ManifestEntry // Resources downloaded so far
+	manifestLock    sync.Mutex
+
+	media     map[string]mediaSource // Processed media playlists, for what is generated from them afterwards
+	mediaLock sync.Mutex
+
+	prefetched     map[string]prefetchedResponse // Resources fetched before their turn to be downloaded
+	prefetchedLock sync.Mutex
+}
+
+// prefetchedResponse is a resource that was fetched to make a decision
+// (e.g. a steering manifest to choose a pathway), kept so downloading it
+// doesn't fetch it again.
+type prefetchedResponse struct {
+	resp    *fetcher.Response
+	elapsed time.Duration
 }
 
 // Config holds configuration for the Downloader.
 type Config struct {
-	OutputDir   string
-	Flatten     bool
-	Concurrency int
-	RewriteURLs bool
-	Include     []string
-	Exclude     []string
-	UserAgent   string
-	Verbose     bool
+	OutputDir     string
+	Flatten       bool
+	Concurrency   int
+	RewriteURLs   bool
+	Include       []string         // File extensions to include
+	Exclude       []string         // File extensions to exclude
+	IncludeTypes  []ResourceType   // Resource types to include
+	ExcludeTypes  []ResourceType   // Resource types to exclude
+	IncludeRegex  []*regexp.Regexp // Only download URLs matching one of these
+	ExcludeRegex  []*regexp.Regexp // Don't download URLs matching any of these
+	UserAgent     string
+	Verbose       bool
+	Overwrite     filesystem.OverwritePolicy // What to do with files that already exist
+	Fsync         bool                       // Fsync files and directories after writing
+	Dedupe        bool                       // Store byte-identical files only once
+	RewriteBase   *url.URL                   // Rewrite to absolute URLs under this base instead of local paths
+	RewriteQuery  string                     // Query string appended to every rewritten URL
+	FilteredRefs  FilteredMode               // How rewriting handles references that were filtered out
+	Absolutize    bool                       // Rewrite every URL to its absolute origin URL
+	DryRun        bool                       // Plan the download without fetching segments or writing files
+	DryRunSizes   bool                       // Look up file sizes with HEAD requests in dry-run mode
+	Manifest      bool                       // Record where every resource came from (see Manifest)
+	Quiet         bool                       // Don't print progress, verbose output or the summary (overrides Progress)
+	Progress      ProgressMode               // How progress is reported (empty means ProgressText)
+	ProgressOut   io.Writer                  // Where progress goes (nil picks stdout or, for ProgressJSON, stderr)
+	RateLimit     float64                    // Maximum requests per second (0 means unlimited)
+	Headers       http.Header                // Extra headers sent with every request
+	Proxy         *url.URL                   // Proxy for all requests (nil uses the environment)
+	Clip          Clip                       // Part of every media playlist to download (zero keeps everything)
+	Ads           AdMode                     // What to do with the segments inside ad breaks (empty means AdsKeep)
+	RedirectPaths RedirectMode               // Where redirected playlists are stored (empty means RedirectRequested)
+	Pathway       string                     // Content steering pathway to download (empty lets the steering manifest decide)
+	Lint          bool                       // Lint every playlist before downloading what it references, stopping on errors
+	DASHManifest  bool                       // Also describe fMP4 streams in a DASH manifest.mpd next to the top-level playlist
+	Subtitles     SubtitleExport             // Merge each subtitle rendition into single WebVTT and/or SRT files
+	Fetcher       *fetcher.Fetcher           // Shared fetcher to use instead of creating one (see NewFetcher)
 }
 
 // New creates a new Downloader with the given configuration.
 //
 // See: https://context7.com/golang/go for Go documentation
 func New(cfg Config) *Downloader {
-	fetcherOpts := fetcher.DefaultOptions()
-	if cfg.UserAgent != "" {
-		fetcherOpts.UserAgent = cfg.UserAgent
+	f := cfg.Fetcher
+	if f == nil {
+		f = NewFetcher(cfg)
 	}
 
-	return &Downloader{
-		fetcher:     fetcher.New(fetcherOpts),
-		fs:          filesystem.New(cfg.OutputDir, cfg.Flatten),
+	fs := filesystem.NewWithOptions(filesystem.Options{
+		OutputDir: cfg.OutputDir,
+		Flatten:   cfg.Flatten,
+		Sync:      cfg.Fsync,
+		Overwrite: cfg.Overwrite,
+		Dedupe:    cfg.Dedupe,
+	})
+
+	d := &Downloader{
+		fetcher:     f,
+		fs:          fs,
 		visited:     make(map[string]bool),
 		concurrency: cfg.Concurrency,
 		rewriteURLs: cfg.RewriteURLs,
-		include:     cfg.Include,
-		exclude:     cfg.Exclude,
-		verbose:     cfg.Verbose,
-		progress:    NewProgressTracker(true, cfg.Verbose),
+		filter: Filter{
+			IncludeExtensions: cfg.Include,
+			ExcludeExtensions: cfg.Exclude,
+			IncludeTypes:      cfg.IncludeTypes,
+			ExcludeTypes:      cfg.ExcludeTypes,
+			IncludeRegex:      cfg.IncludeRegex,
+			ExcludeRegex:      cfg.ExcludeRegex,
+		},
+		overwrite:     cfg.Overwrite,
+		verbose:       cfg.Verbose,
+		progress:      newProgressTracker(cfg),
+		dryRun:        cfg.DryRun,
+		dryRunSizes:   cfg.DryRunSizes,
+		clip:          cfg.Clip,
+		ads:           cfg.Ads,
+		redirectPaths: cfg.RedirectPaths,
+		pathway:       cfg.Pathway,
+		lint:          cfg.Lint,
+		dashManifest:  cfg.DASHManifest,
+		subtitles:     cfg.Subtitles,
+
+		manifestEnabled: cfg.Manifest,
+		media:           make(map[string]mediaSource),
+	}
+
+	d.rewriteOpts = RewriteOptions{
+		BaseURL:    cfg.RewriteBase,
+		Query:      cfg.RewriteQuery,
+		Filtered:   cfg.FilteredRefs,
+		Absolutize: cfg.Absolutize,
 	}
+
+	return d
+}
+
+// newProgressTracker creates the ProgressTracker for the given configuration.
+func newProgressTracker(cfg Config) *ProgressTracker {
+	mode := cfg.Progress
+	if cfg.Quiet {
+		mode = ProgressNone
+	}
+	return NewProgressTrackerWithMode(mode, cfg.Verbose, cfg.ProgressOut)
+}
+
+// NewFetcher creates the Fetcher a Downloader with the given configuration
+// would use.
+//
+// Several Downloaders can share one Fetcher through Config.Fetcher, so they
+// share its connection pool and rate limit.
+func NewFetcher(cfg Config) *fetcher.Fetcher {
+	opts := fetcher.DefaultOptions()
+	if cfg.UserAgent != "" {
+		opts.UserAgent = cfg.UserAgent
+	}
+	opts.RateLimit = cfg.RateLimit
+	opts.Headers = cfg.Headers
+	opts.Proxy = cfg.Proxy
+	return fetcher.New(opts)
+}
+
+// Stats returns a snapshot of the download's counters.
+func (d *Downloader) Stats() Stats {
+	return d.progress.Stats()
 }
 
 // Download starts the recursive download process from the given M3U8 URL.
@@ -80,6 +205,9 @@ func New(cfg Config) *Downloader {
 // 4. Recursively processes any nested M3U8 playlists
 // 5. Optionally rewrites URLs in M3U8 files to local paths
 //
+// In dry-run mode only playlists are fetched, nothing is written, and the
+// files that would be downloaded are available from Plan afterwards.
+//
 // Parameters:
 //   - ctx: Context for cancellation and timeouts
 //   - m3u8URL: The URL of the M3U8 playlist to download
@@ -88,15 +216,21 @@ func New(cfg Config) *Downloader {
 //
 // See: https://context7.com/golang/go for Go context documentation
 func (d *Downloader) Download(ctx context.Context, m3u8URL string) error {
+	d.progress.Start(m3u8URL)
 	d.progress.PrintVerbose("Starting download of %s", m3u8URL)
 
+	if d.dryRun {
+		if err := d.downloadM3U8(ctx, m3u8URL, resourceRef{Type: ResourcePlaylist}); err != nil {
+			return fmt.Errorf("failed to download M3U8: %w", err)
+		}
+		return nil
+	}
+
 	// Start periodic progress updates
 	ticker := time.NewTicker(500 * time.Millisecond)
 	done := make(chan bool)
-	defer ticker.Stop()
-	defer close(done)
-
-	go func() {
+	var updates sync.WaitGroup
+	updates.Go(func() {
 		for {
 			select {
 			case <-ticker.C:
@@ -105,20 +239,38 @@ func (d *Downloader) Download(ctx context.Context, m3u8URL string) error {
 				return
 			}
 		}
-	}()
+	})
 
 	// Download the initial M3U8 file
-	if err := d.downloadM3U8(ctx, m3u8URL); err != nil {
-		return fmt.Errorf("failed to download M3U8: %w", err)
+	err := d.downloadM3U8(ctx, m3u8URL, resourceRef{Type: ResourcePlaylist})
+
+	// Stop the updates so none is printed after the summary
+	ticker.Stop()
+	close(done)
+	updates.Wait()
+
+	if err != nil {
+		err = fmt.Errorf("failed to download M3U8: %w", err)
+		d.progress.PrintError(err)
+		return err
+	}
+
+	// Temp files left behind by interrupted runs are removed from the
+	// directories written to along the way
+	if removed := d.fs.StaleTempFilesRemoved(); removed > 0 {
+		d.progress.PrintVerbose("Removed %d stale temp files", removed)
 	}
 
 	// Print final summary
+	d.progress.SetDedupeStats(d.fs.DedupeStats())
 	d.progress.PrintSummary()
 	return nil
 }
 
 // downloadM3U8 downloads an M3U8 file and all its references.
-func (d *Downloader) downloadM3U8(ctx context.Context, m3u8URL string) error {
+//
+// ref describes where the playlist was referenced from, for the manifest.
+func (d *Downloader) downloadM3U8(ctx context.Context, m3u8URL string, ref resourceRef) error {
 	// Check if already visited
 	if d.isVisited(m3u8URL) {
 		d.progress.PrintVerbose("Skipping already visited URL: %s", m3u8URL)
@@ -126,15 +278,52 @@ func (d *Downloader) downloadM3U8(ctx context.Context, m3u8URL string) error {
 	}
 	d.markVisited(m3u8URL)
 
+	return d.fetchM3U8(ctx, m3u8URL, ref)
+}
+
+// fetchM3U8 fetches and processes an M3U8 file that is already marked as
+// visited.
+func (d *Downloader) fetchM3U8(ctx context.Context, m3u8URL string, ref resourceRef) error {
 	// Fetch the M3U8 file
 	d.progress.PrintVerbose("Fetching M3U8: %s", m3u8URL)
-	content, err := d.fetcher.Fetch(ctx, m3u8URL)
+	start := time.Now()
+	resp, err := d.fetcher.FetchResponse(ctx, m3u8URL)
 	if err != nil {
 		return err
 	}
 
+	return d.processM3U8(ctx, m3u8URL, ref, resp, time.Since(start))
+}
+
+// processM3U8 parses a fetched M3U8 file, downloads all its references, and
+// writes it.
+//
+// elapsed is how long fetching resp took, for the manifest.
+func (d *Downloader) processM3U8(ctx context.Context, m3u8URL string, ref resourceRef, resp *fetcher.Response, elapsed time.Duration) error {
+	// DASH manifests go through the same pipeline, but are parsed differently
+	if isMPDResponse(m3u8URL, resp) {
+		return d.processMPD(ctx, m3u8URL, ref, resp, elapsed)
+	}
+
+	// A byte order mark would end up in front of #EXTM3U when rewriting
+	content := bytes.TrimPrefix(resp.Body, utf8BOM)
+
+	if d.lint {
+		if err := d.lintPlaylist(m3u8URL, content); err != nil {
+			return err
+		}
+	}
+
+	// Relative references are relative to where the playlist actually came
+	// from, which isn't m3u8URL if the request was redirected
+	baseURL := m3u8URL
+	if resp.URL != "" && resp.URL != m3u8URL {
+		baseURL = resp.URL
+		d.progress.PrintVerbose("Redirected: %s -> %s", m3u8URL, baseURL)
+	}
+
 	// Parse the M3U8 file
-	parsedURL, err := url.Parse(m3u8URL)
+	parsedURL, err := url.Parse(baseURL)
 	if err != nil {
 		return fmt.Errorf("failed to parse M3U8 URL: %w", err)
 	}
@@ -143,44 +332,218 @@ func (d *Downloader) downloadM3U8(ctx context.Context, m3u8URL string) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse M3U8 content: %w", err)
 	}
+	for _, warning := range m3u8File.Warnings {
+		d.progress.PrintWarning("%s: %s", m3u8URL, warning)
+	}
+
+	// Remove or isolate ad breaks, then cut media playlists down to the
+	// requested clip, before anything else looks at them, so only the
+	// remaining segments are downloaded
+	if d.ads != AdsKeep && d.ads != "" && !m3u8File.IsMaster() && len(m3u8File.Segments) > 0 {
+		content, err = filterAds(content, m3u8File, d.ads)
+		if err != nil {
+			return fmt.Errorf("failed to filter ads in %s: %w", m3u8URL, err)
+		}
+		m3u8File, err = ParseM3U8(content, parsedURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse M3U8 content without ads: %w", err)
+		}
+		if d.ads == AdsOnly && len(m3u8File.Segments) == 0 {
+			d.progress.PrintWarning("no ad breaks found in %s", m3u8URL)
+		}
+	}
+	if !d.clip.IsZero() && !m3u8File.IsMaster() && len(m3u8File.Segments) > 0 {
+		content, err = clipPlaylist(content, m3u8File, d.clip)
+		if err != nil {
+			return fmt.Errorf("failed to clip %s: %w", m3u8URL, err)
+		}
+		m3u8File, err = ParseM3U8(content, parsedURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse clipped M3U8 content: %w", err)
+		}
+		if len(m3u8File.Segments) == 0 {
+			d.progress.PrintWarning("the clip covers no segments of %s", m3u8URL)
+		}
+	}
 
 	d.progress.PrintVerbose("Found %d URLs in M3U8", len(m3u8File.URLs))
 
+	if err := d.mapRedirect(m3u8URL, baseURL, referenceURLs(m3u8File), func(base *url.URL) ([]string, error) {
+		mapped, err := ParseM3U8(content, base)
+		if err != nil {
+			return nil, err
+		}
+		return referenceURLs(mapped), nil
+	}); err != nil {
+		return err
+	}
+
 	// Download all referenced files concurrently
-	if err := d.downloadURLs(ctx, m3u8File.URLs, m3u8File.IsM3U8); err != nil {
+	refs := classifyReferences(m3u8File, m3u8URL, ref.Segments)
+	if err := d.selectPathway(ctx, m3u8File, refs); err != nil {
 		return err
 	}
+	if err := d.downloadURLs(ctx, m3u8File.URLs, m3u8File.IsM3U8, refs); err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		return d.planPlaylist(m3u8URL, content)
+	}
+
+	// Apply the same filter as downloadURLs, so every reference that wasn't
+	// downloaded is handled as filtered out
+	keep := func(absoluteURL string) bool {
+		ref, ok := refs[absoluteURL]
+		return ok && d.shouldDownload(absoluteURL, ref)
+	}
+	if (d.dashManifest || d.subtitles.enabled()) && !m3u8File.IsMaster() {
+		d.recordMedia(m3u8URL, m3u8File, keep)
+	}
 
 	// Rewrite URLs if enabled
-	if d.rewriteURLs {
+	if d.rewriteURLs || d.rewriteOpts.Absolutize {
 		d.progress.PrintVerbose("Rewriting URLs in M3U8 file")
-		rewrittenContent, err := RewriteM3U8URLs(content, m3u8URL, d.fs)
+		opts := d.rewriteOpts
+		opts.Keep = keep
+		opts.ResolveBase = parsedURL
+		rewrittenContent, err := RewriteM3U8URLs(content, m3u8URL, d.fs, opts)
 		if err != nil {
-			log.Printf("Warning: failed to rewrite URLs in %s: %v", m3u8URL, err)
+			d.progress.PrintWarning("failed to rewrite URLs in %s: %v", m3u8URL, err)
 			// Continue with original content
 			rewrittenContent = content
 		}
 		content = rewrittenContent
 	}
 
-	// Write the M3U8 file
+	if err := d.writePlaylist(m3u8URL, ref, content, resp, elapsed); err != nil {
+		return err
+	}
+
+	// Every child playlist has been processed by now
+	if ref.Parent != "" {
+		return nil
+	}
+	if d.dashManifest {
+		if err := d.writeDASHManifest(m3u8URL, m3u8File, keep); err != nil {
+			return err
+		}
+	}
+	if d.subtitles.enabled() && m3u8File.IsMaster() {
+		return d.writeSubtitles(m3u8URL, m3u8File, keep)
+	}
+	return nil
+}
+
+// mediaSource is a processed media playlist, with the filter that decided
+// which of its references were downloaded.
+type mediaSource struct {
+	playlist *M3U8File
+	keep     func(absoluteURL string) bool
+}
+
+// recordMedia remembers a processed media playlist, for what is generated
+// from the whole stream once it is mirrored (the DASH manifest and merged
+// subtitles).
+func (d *Downloader) recordMedia(m3u8URL string, playlist *M3U8File, keep func(string) bool) {
+	d.mediaLock.Lock()
+	defer d.mediaLock.Unlock()
+	d.media[m3u8URL] = mediaSource{playlist: playlist, keep: keep}
+}
+
+// recordedMedia returns a media playlist recorded with recordMedia.
+func (d *Downloader) recordedMedia(m3u8URL string) (mediaSource, bool) {
+	d.mediaLock.Lock()
+	defer d.mediaLock.Unlock()
+	source, ok := d.media[m3u8URL]
+	return source, ok
+}
+
+// planPlaylist adds a playlist to the plan in dry-run mode.
+func (d *Downloader) planPlaylist(m3u8URL string, content []byte) error {
+	localPath, err := d.fs.GetLocalPath(m3u8URL)
+	if err != nil {
+		return err
+	}
+	d.addToPlan(PlannedFile{
+		URL:       m3u8URL,
+		LocalPath: localPath,
+		Playlist:  true,
+		Size:      int64(len(content)),
+	})
+	return nil
+}
+
+// writePlaylist writes a (possibly rewritten) playlist or MPD, and records
+// it in the manifest and progress.
+func (d *Downloader) writePlaylist(m3u8URL string, ref resourceRef, content []byte, resp *fetcher.Response, elapsed time.Duration) error {
 	localPath, err := d.fs.WriteFile(m3u8URL, content)
 	if err != nil {
 		return fmt.Errorf("failed to write M3U8 file: %w", err)
 	}
 
+	d.recordManifest(m3u8URL, localPath, ref, content, resp, elapsed)
+
 	// Track progress
 	d.progress.IncrementM3U8()
 	d.progress.AddBytes(int64(len(content)))
+	d.progress.FileWritten(m3u8URL, localPath, ref.Type, int64(len(content)))
 	d.progress.PrintVerbose("Wrote M3U8 to %s", localPath)
 
 	return nil
 }
 
+// mapRedirect decides where a playlist fetched as m3u8URL, with references
+// relative to baseURL, and the resources it references are stored.
+//
+// With RedirectFinal, the playlist is stored at the local path of baseURL, and
+// its references at their own paths. With RedirectRequested, the playlist
+// keeps the local path of m3u8URL (or of whatever it was mapped to), and each
+// reference is stored where it would be if it were relative to that, so the
+// layout is the same whether or not the origin redirects.
+//
+// references are the playlist's resolved references, and resolve returns them
+// resolved against another base instead, in the same order.
+func (d *Downloader) mapRedirect(m3u8URL, baseURL string, references []string, resolve func(base *url.URL) ([]string, error)) error {
+	if d.redirectPaths == RedirectFinal {
+		d.fs.Alias(m3u8URL, baseURL)
+		return nil
+	}
+
+	mappedURL := d.fs.MappedURL(m3u8URL)
+	if mappedURL == baseURL {
+		return nil
+	}
+	mappedBase, err := url.Parse(mappedURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse M3U8 URL: %w", err)
+	}
+	mapped, err := resolve(mappedBase)
+	if err != nil {
+		return fmt.Errorf("failed to parse M3U8 content: %w", err)
+	}
+
+	// Parsing the same content yields the same references in the same order
+	for i, reference := range references {
+		d.fs.Alias(reference, mapped[i])
+	}
+	return nil
+}
+
+// referenceURLs returns the resolved URLs of a playlist's references, in
+// order.
+func referenceURLs(m3u8File *M3U8File) []string {
+	urls := make([]string, len(m3u8File.References))
+	for i, reference := range m3u8File.References {
+		urls[i] = reference.URL
+	}
+	return urls
+}
+
 // downloadURLs downloads multiple URLs concurrently using a worker pool.
-func (d *Downloader) downloadURLs(ctx context.Context, urls []string, isM3U8 map[string]bool) error {
+func (d *Downloader) downloadURLs(ctx context.Context, urls []string, isM3U8 map[string]bool, refs map[string]resourceRef) error {
 	// Filter URLs
-	filteredURLs := d.filterURLs(urls)
+	filteredURLs := d.filterURLs(urls, refs)
 	if len(filteredURLs) == 0 {
 		return nil
 	}
@@ -196,7 +559,7 @@ func (d *Downloader) downloadURLs(ctx context.Context, urls []string, isM3U8 map
 		go func() {
 			defer wg.Done()
 			for urlStr := range urlChan {
-				if err := d.downloadURL(ctx, urlStr, isM3U8[urlStr]); err != nil {
+				if err := d.downloadURL(ctx, urlStr, isM3U8[urlStr], refs[urlStr]); err != nil {
 					errChan <- fmt.Errorf("failed to download %s: %w", urlStr, err)
 					return
 				}
@@ -225,11 +588,11 @@ func (d *Downloader) downloadURLs(ctx context.Context, urls []string, isM3U8 map
 }
 
 // downloadURL downloads a single URL.
-func (d *Downloader) downloadURL(ctx context.Context, urlStr string, isM3U8 bool) error {
+func (d *Downloader) downloadURL(ctx context.Context, urlStr string, isM3U8 bool, ref resourceRef) error {
 	// If it's an M3U8 file, download recursively
 	// (downloadM3U8 will handle the visited check)
 	if isM3U8 {
-		return d.downloadM3U8(ctx, urlStr)
+		return d.downloadM3U8(ctx, urlStr, ref)
 	}
 
 	// Check if already visited (for non-M3U8 files)
@@ -238,67 +601,130 @@ func (d *Downloader) downloadURL(ctx context.Context, urlStr string, isM3U8 bool
 	}
 	d.markVisited(urlStr)
 
+	if d.dryRun {
+		return d.planURL(ctx, urlStr, ref)
+	}
+
+	// Don't bother fetching files we would never overwrite. A playlist that
+	// was only recognized by its content must still be fetched so its
+	// references are downloaded.
+	if d.overwrite == filesystem.OverwriteNever {
+		exists, err := d.fs.FileExists(urlStr)
+		if err != nil {
+			return err
+		}
+		if exists && d.isLocalPlaylist(urlStr) {
+			exists = false
+		}
+		if exists {
+			d.progress.PrintVerbose("Skipping existing file: %s", urlStr)
+			localPath, err := d.fs.GetLocalPath(urlStr)
+			if err != nil {
+				return err
+			}
+			d.addToManifest(ManifestEntry{
+				URL:       urlStr,
+				LocalPath: localPath,
+				Type:      ref.Type,
+				Parent:    ref.Parent,
+				Skipped:   true,
+			})
+			d.progress.FileSkipped(urlStr, localPath, ref.Type)
+			return nil
+		}
+	}
+
 	// Download as regular file
 	d.progress.PrintVerbose("Downloading: %s", urlStr)
-	content, err := d.fetcher.Fetch(ctx, urlStr)
+	resp, elapsed, err := d.fetchResponse(ctx, urlStr)
 	if err != nil {
 		return err
 	}
 
-	localPath, err := d.fs.WriteFile(urlStr, content)
+	// Servers don't always name playlists .m3u8, so look at what came back
+	if isPlaylistResponse(resp) || isMPDResponse(urlStr, resp) {
+		d.progress.PrintVerbose("Detected playlist: %s", urlStr)
+		ref.Type = ResourcePlaylist
+		return d.processM3U8(ctx, urlStr, ref, resp, elapsed)
+	}
+
+	localPath, err := d.fs.WriteFileModTime(urlStr, resp.Body, resp.LastModified())
 	if err != nil {
 		return err
 	}
 
+	d.recordManifest(urlStr, localPath, ref, resp.Body, resp, elapsed)
+
 	// Track progress
-	d.progress.IncrementSegment(int64(len(content)))
+	d.progress.IncrementSegment(int64(len(resp.Body)))
+	d.progress.FileWritten(urlStr, localPath, ref.Type, int64(len(resp.Body)))
 	d.progress.PrintVerbose("Wrote to %s", localPath)
 
 	return nil
 }
 
-// filterURLs filters URLs based on include/exclude patterns.
-func (d *Downloader) filterURLs(urls []string) []string {
-	filtered := make([]string, 0, len(urls))
-
-	for _, urlStr := range urls {
-		if d.shouldDownload(urlStr) {
-			filtered = append(filtered, urlStr)
-		}
+// fetchResponse fetches a resource, or takes it from the prefetched
+// responses if it was already fetched, returning how long the fetch took.
+func (d *Downloader) fetchResponse(ctx context.Context, urlStr string) (*fetcher.Response, time.Duration, error) {
+	d.prefetchedLock.Lock()
+	prefetched, ok := d.prefetched[urlStr]
+	delete(d.prefetched, urlStr)
+	d.prefetchedLock.Unlock()
+	if ok {
+		return prefetched.resp, prefetched.elapsed, nil
 	}
 
-	return filtered
+	start := time.Now()
+	resp, err := d.fetcher.FetchResponse(ctx, urlStr)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp, time.Since(start), nil
 }
 
-// shouldDownload checks if a URL should be downloaded based on filters.
-func (d *Downloader) shouldDownload(urlStr string) bool {
-	ext := strings.ToLower(filepath.Ext(urlStr))
-
-	// Remove query parameters from extension
-	if idx := strings.Index(ext, "?"); idx != -1 {
-		ext = ext[:idx]
+// prefetch fetches a resource ahead of its download and keeps the response
+// for fetchResponse.
+func (d *Downloader) prefetch(ctx context.Context, urlStr string) (*fetcher.Response, error) {
+	start := time.Now()
+	resp, err := d.fetcher.FetchResponse(ctx, urlStr)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check exclude list first
-	for _, excludeExt := range d.exclude {
-		if ext == excludeExt || ext == "."+excludeExt {
-			return false
-		}
+	d.prefetchedLock.Lock()
+	defer d.prefetchedLock.Unlock()
+	if d.prefetched == nil {
+		d.prefetched = make(map[string]prefetchedResponse)
 	}
+	d.prefetched[urlStr] = prefetchedResponse{resp: resp, elapsed: time.Since(start)}
+	return resp, nil
+}
 
-	// If include list is empty, download everything (except excluded)
-	if len(d.include) == 0 {
-		return true
-	}
+// isLocalPlaylist reports whether the file already stored for a URL is an
+// M3U8 playlist.
+func (d *Downloader) isLocalPlaylist(urlStr string) bool {
+	localPath, err := d.fs.GetLocalPath(urlStr)
+	return err == nil && IsPlaylistFile(localPath)
+}
+
+// filterURLs filters URLs based on the include/exclude rules, using the
+// resource types in refs.
+func (d *Downloader) filterURLs(urls []string, refs map[string]resourceRef) []string {
+	filtered := make([]string, 0, len(urls))
 
-	// Check include list
-	for _, includeExt := range d.include {
-		if ext == includeExt || ext == "."+includeExt {
-			return true
+	for _, urlStr := range urls {
+		if d.shouldDownload(urlStr, refs[urlStr]) {
+			filtered = append(filtered, urlStr)
 		}
 	}
 
-	return false
+	return filtered
+}
+
+// shouldDownload checks if a resource should be downloaded based on filters
+// and the selected content steering pathway.
+func (d *Downloader) shouldDownload(urlStr string, ref resourceRef) bool {
+	return !ref.Unselected && d.filter.Match(urlStr, ref.Type)
 }
 
 // isVisited checks if a URL has already been visited.
@@ -314,4 +740,3 @@ func (d *Downloader) markVisited(urlStr string) {
 	defer d.visitedLock.Unlock()
 	d.visited[urlStr] = true
 }
-
@@ -0,0 +1,88 @@
+package downloader
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Filter decides which referenced resources are downloaded.
+//
+// A resource is excluded if it matches any exclude rule. Otherwise every kind
+// of include rule that is set (extensions, types, regular expressions) must
+// match it. The zero value downloads everything.
+//
+// The top-level playlist is always downloaded. Filtering out a playlist also
+// filters out everything it references, so include rules usually need to
+// include playlists.
+type Filter struct {
+	// IncludeExtensions and ExcludeExtensions match the lowercase extension
+	// of the URL's path (e.g. ".ts"), ignoring the query string
+	IncludeExtensions []string
+	ExcludeExtensions []string
+	// IncludeTypes and ExcludeTypes match how the resource was referenced
+	IncludeTypes []ResourceType
+	ExcludeTypes []ResourceType
+	// IncludeRegex and ExcludeRegex match the resolved absolute URL
+	IncludeRegex []*regexp.Regexp
+	ExcludeRegex []*regexp.Regexp
+}
+
+// Match reports whether the resource at urlStr, referenced as resourceType,
+// should be downloaded.
+func (f Filter) Match(urlStr string, resourceType ResourceType) bool {
+	ext := urlExtension(urlStr)
+
+	// Check exclude rules first
+	if matchExtension(f.ExcludeExtensions, ext) ||
+		slices.Contains(f.ExcludeTypes, resourceType) ||
+		matchRegex(f.ExcludeRegex, urlStr) {
+		return false
+	}
+
+	// Every kind of include rule that is set must match
+	if len(f.IncludeExtensions) > 0 && !matchExtension(f.IncludeExtensions, ext) {
+		return false
+	}
+	if len(f.IncludeTypes) > 0 && !slices.Contains(f.IncludeTypes, resourceType) {
+		return false
+	}
+	if len(f.IncludeRegex) > 0 && !matchRegex(f.IncludeRegex, urlStr) {
+		return false
+	}
+
+	return true
+}
+
+// matchExtension reports whether ext is one of extensions, which may be
+// given with or without the leading dot.
+func matchExtension(extensions []string, ext string) bool {
+	for _, candidate := range extensions {
+		if ext == candidate || ext == "."+candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRegex reports whether any of patterns matches s.
+func matchRegex(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlExtension returns the lowercase file extension of a URL's path, ignoring
+// any query string or fragment.
+func urlExtension(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(path.Ext(u.Path))
+}
@@ -0,0 +1,210 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       Filter
+		url          string
+		resourceType ResourceType
+		expected     bool
+	}{
+		{"zero value", Filter{}, "https://example.com/a.ts", ResourceSegment, true},
+		{"extension ignores query", Filter{ExcludeExtensions: []string{".ts"}}, "https://example.com/a.ts?token=1.m3u8", ResourceSegment, false},
+		{"extension without dot", Filter{IncludeExtensions: []string{"ts"}}, "https://example.com/a.ts", ResourceSegment, true},
+		{"extensionless URL", Filter{IncludeExtensions: []string{".ts"}}, "https://example.com/segment?id=1", ResourceSegment, false},
+		{"excluded type", Filter{ExcludeTypes: []ResourceType{ResourceSubtitle}}, "https://example.com/en.vtt", ResourceSubtitle, false},
+		{"included type", Filter{IncludeTypes: []ResourceType{ResourcePlaylist, ResourceKey}}, "https://example.com/key", ResourceKey, true},
+		{"not included type", Filter{IncludeTypes: []ResourceType{ResourcePlaylist}}, "https://example.com/a.ts", ResourceSegment, false},
+		{"excluded regex", Filter{ExcludeRegex: []*regexp.Regexp{regexp.MustCompile(`^https://ads\.`)}}, "https://ads.example.com/a.ts", ResourceSegment, false},
+		{"included regex", Filter{IncludeRegex: []*regexp.Regexp{regexp.MustCompile(`/1080p/`)}}, "https://example.com/1080p/a.ts", ResourceSegment, true},
+		{"not included regex", Filter{IncludeRegex: []*regexp.Regexp{regexp.MustCompile(`/1080p/`)}}, "https://example.com/720p/a.ts", ResourceSegment, false},
+		{
+			"exclude wins over include",
+			Filter{IncludeTypes: []ResourceType{ResourceSegment}, ExcludeRegex: []*regexp.Regexp{regexp.MustCompile(`ad`)}},
+			"https://example.com/ad1.ts", ResourceSegment, false,
+		},
+		{
+			"all include kinds must match",
+			Filter{IncludeTypes: []ResourceType{ResourceSegment}, IncludeExtensions: []string{".m4s"}},
+			"https://example.com/a.ts", ResourceSegment, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.url, tt.resourceType); got != tt.expected {
+				t.Errorf("Match(%q, %q) = %v, expected %v", tt.url, tt.resourceType, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseResourceType(t *testing.T) {
+	tests := map[string]ResourceType{
+		"playlist":     ResourcePlaylist,
+		"Segment":      ResourceSegment,
+		"init-map":     ResourceMap,
+		"map":          ResourceMap,
+		"iframe":       ResourceIFrame,
+		"image":        ResourceImage,
+		"session-data": ResourceSessionData,
+	}
+	for value, expected := range tests {
+		if got, err := ParseResourceType(value); err != nil || got != expected {
+			t.Errorf("ParseResourceType(%q) = %q, %v; expected %q", value, got, err, expected)
+		}
+	}
+	if _, err := ParseResourceType("thumbnail"); err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
+
+func TestFilterAppliesToRewriting(t *testing.T) {
+	files := map[string]string{
+		"/master.m3u8": "#EXTM3U\n" +
+			"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"en\",URI=\"subs/en.m3u8\"\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000,SUBTITLES=\"subs\"\nv1/index.m3u8\n",
+		"/v1/index.m3u8": "#EXTM3U\n#EXTINF:10,\ns0.ts\n#EXTINF:10,\nhttps://ads.example.com/ad0.ts\n#EXT-X-ENDLIST\n",
+		"/v1/s0.ts":      "segment",
+		"/subs/en.m3u8":  "#EXTM3U\n#EXTINF:10,\nen0.vtt\n#EXT-X-ENDLIST\n",
+	}
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	outputDir := t.TempDir()
+	d := New(Config{
+		OutputDir:    outputDir,
+		Concurrency:  2,
+		RewriteURLs:  true,
+		FilteredRefs: FilteredRemove,
+		ExcludeTypes: []ResourceType{ResourceSubtitle},
+		ExcludeRegex: []*regexp.Regexp{regexp.MustCompile(`^https://ads\.`)},
+		Quiet:        true,
+	})
+	if err := d.Download(context.Background(), srv.URL+"/master.m3u8"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	// The subtitle playlist is a playlist, but its segments are subtitles
+	if !requested["/subs/en.m3u8"] || requested["/subs/en0.vtt"] {
+		t.Errorf("Expected the subtitle playlist but not its segments to be fetched, got %v", requested)
+	}
+
+	subs, err := os.ReadFile(filepath.Join(outputDir, "subs", "en.m3u8"))
+	if err != nil {
+		t.Fatalf("Failed to read subtitle playlist: %v", err)
+	}
+	if strings.Contains(string(subs), "en0.vtt") {
+		t.Errorf("Expected the filtered subtitle segment to be removed:\n%s", subs)
+	}
+
+	media, err := os.ReadFile(filepath.Join(outputDir, "v1", "index.m3u8"))
+	if err != nil {
+		t.Fatalf("Failed to read media playlist: %v", err)
+	}
+	expected := "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:0\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n"
+	if string(media) != expected {
+		t.Errorf("Expected the ad segment to be removed, got:\n%s", media)
+	}
+}
+
+func TestDownloadTrickPlay(t *testing.T) {
+	files := map[string]string{
+		"/master.m3u8": "#EXTM3U\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000\nv1/index.m3u8\n" +
+			"#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100,URI=\"v1/iframes\"\n" +
+			"#EXT-X-IMAGE-STREAM-INF:BANDWIDTH=10,RESOLUTION=320x180,URI=\"thumbs/index\"\n",
+		"/v1/index.m3u8": "#EXTM3U\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n",
+		"/v1/iframes": "#EXTM3U\n#EXT-X-I-FRAMES-ONLY\n" +
+			"#EXTINF:5,\n#EXT-X-BYTERANGE:188@0\ns0.ts\n#EXTINF:5,\n#EXT-X-BYTERANGE:188@376\ns0.ts\n#EXT-X-ENDLIST\n",
+		"/v1/s0.ts": strings.Repeat("s", 564),
+		"/thumbs/index": "#EXTM3U\n#EXT-X-IMAGES-ONLY\n#EXT-X-TILES:RESOLUTION=320x180,LAYOUT=2x1,DURATION=5\n" +
+			"#EXTINF:10,\nt0.jpg\n#EXT-X-ENDLIST\n",
+		"/thumbs/t0.jpg": "jpeg",
+	}
+
+	tests := []struct {
+		name         string
+		excludeTypes []ResourceType
+		skipped      []string
+	}{
+		{"everything", nil, nil},
+		{"no images", []ResourceType{ResourceImage}, []string{"/thumbs/index", "/thumbs/t0.jpg"}},
+		{"no iframes", []ResourceType{ResourceIFrame}, []string{"/v1/iframes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requested := make(map[string]int)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requested[r.URL.Path]++
+				mu.Unlock()
+				content, ok := files[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(content))
+			}))
+			defer srv.Close()
+
+			d := New(Config{
+				OutputDir:    t.TempDir(),
+				Concurrency:  2,
+				RewriteURLs:  true,
+				Manifest:     true,
+				ExcludeTypes: tt.excludeTypes,
+				Quiet:        true,
+			})
+			if err := d.Download(context.Background(), srv.URL+"/master.m3u8"); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			for p := range files {
+				skipped := slices.Contains(tt.skipped, p)
+				if skipped && requested[p] > 0 {
+					t.Errorf("Expected %s to be skipped", p)
+				}
+				// Byte-ranged segments are downloaded whole and only once
+				if !skipped && requested[p] != 1 {
+					t.Errorf("Expected %s to be fetched once, got %d", p, requested[p])
+				}
+			}
+
+			types := make(map[string]ResourceType)
+			for _, entry := range d.Manifest() {
+				types[strings.TrimPrefix(entry.URL, srv.URL)] = entry.Type
+			}
+			if len(tt.skipped) == 0 && (types["/v1/iframes"] != ResourceIFrame || types["/thumbs/index"] != ResourceImage || types["/thumbs/t0.jpg"] != ResourceImage) {
+				t.Errorf("Unexpected manifest types: %v", types)
+			}
+		})
+	}
+}
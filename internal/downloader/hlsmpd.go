@@ -0,0 +1,477 @@
+package downloader
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// generatedMPDName is the name of the DASH manifest written next to a
+// mirrored master playlist.
+const generatedMPDName = "manifest.mpd"
+
+// generatedTimescale is the timescale of the segment timelines of a
+// generated DASH manifest (milliseconds).
+const generatedTimescale = 1000
+
+// Codec families by the media they carry, matched by the sample entry
+// prefix of a CODECS entry (e.g. "avc1" in "avc1.4d401f").
+var (
+	videoCodecs = []string{"avc1", "avc3", "hvc1", "hev1", "dvh1", "dvhe", "av01", "vp08", "vp09"}
+	audioCodecs = []string{"mp4a", "ac-3", "ec-3", "ac-4", "opus", "Opus", "flac", "fLaC", "mhm1", "mha1", "dtsc"}
+	textCodecs  = []string{"wvtt", "stpp"}
+)
+
+// writeDASHManifest writes a DASH manifest next to a mirrored top-level
+// playlist, describing the same fMP4 segments as its variants and
+// renditions, so one mirror serves both HLS and DASH players.
+//
+// Every media playlist must have been processed (and recorded with
+// recordMedia) already. Media playlists a DASH manifest can't describe
+// (MPEG-TS segments, encryption, changing init segments, live playlists) are
+// left out with a warning; if none is left, no manifest is written.
+//
+// See: https://dashif.org/docs/DASH-IF-IOP-v4.3.pdf
+func (d *Downloader) writeDASHManifest(m3u8URL string, playlist *M3U8File, keep func(string) bool) error {
+	master := playlist
+	if !playlist.IsMaster() {
+		// A media playlist is a stream of one variant
+		master = &M3U8File{Variants: []Variant{{URL: m3u8URL}}}
+		keep = nil
+	}
+
+	baseURL, err := url.Parse(d.fs.MappedURL(m3u8URL))
+	if err != nil {
+		return fmt.Errorf("failed to parse M3U8 URL: %w", err)
+	}
+	mpdURL := resolveURL(baseURL, generatedMPDName)
+
+	g := &mpdGenerator{d: d, mpdURL: mpdURL, master: master, keep: keep}
+	content, err := g.build()
+	if err != nil {
+		d.progress.PrintWarning("not writing a DASH manifest for %s: %v", m3u8URL, err)
+		return nil
+	}
+
+	localPath, err := d.fs.WriteFile(mpdURL, content)
+	if err != nil {
+		return fmt.Errorf("failed to write DASH manifest: %w", err)
+	}
+	d.progress.PrintVerbose("Wrote DASH manifest to %s", localPath)
+	return nil
+}
+
+// mpdGenerator builds a DASH manifest from a mirrored master playlist and
+// its recorded media playlists.
+type mpdGenerator struct {
+	d      *Downloader
+	mpdURL string
+	master *M3U8File
+	keep   func(string) bool // Which references of the master were downloaded (nil for all)
+
+	mpd      *xmlNode
+	period   *xmlNode
+	duration float64 // Longest representation, in seconds
+	longest  float64 // Longest segment, in seconds
+	sets     int     // Adaptation sets so far, for their IDs
+	reps     int     // Representations so far, for their IDs
+}
+
+// build returns the generated manifest, or an error if no media playlist of
+// the stream can be described.
+func (g *mpdGenerator) build() ([]byte, error) {
+	g.mpd = &xmlNode{Name: "MPD"}
+	g.mpd.setAttr("xmlns", "urn:mpeg:dash:schema:mpd:2011")
+	g.mpd.setAttr("profiles", "urn:mpeg:dash:profile:isoff-main:2011")
+	g.mpd.setAttr("type", "static")
+	g.period = &xmlNode{Name: "Period"}
+	g.period.setAttr("id", "0")
+	g.period.setAttr("start", "PT0S")
+
+	// The CODECS of a variant include those of its renditions, keyed here by
+	// rendition type and group
+	groupCodecs := make(map[string]string)
+	for _, variant := range g.master.Variants {
+		for _, group := range []string{"AUDIO:" + variant.Audio, "SUBTITLES:" + variant.Subtitles} {
+			if !strings.HasSuffix(group, ":") && groupCodecs[group] == "" {
+				groupCodecs[group] = variant.Codecs
+			}
+		}
+	}
+
+	var video, iframes []Variant
+	for _, variant := range g.master.Variants {
+		switch {
+		case variant.Image:
+			// Thumbnails have no DASH equivalent in the same segments
+		case variant.IFrame:
+			iframes = append(iframes, variant)
+		default:
+			video = append(video, variant)
+		}
+	}
+
+	videoSet := g.variantSet(video, false, "")
+	if videoSet != "" {
+		g.variantSet(iframes, true, videoSet)
+	}
+	g.renditionSets("AUDIO", "audio", audioCodecs, groupCodecs)
+	g.renditionSets("SUBTITLES", "text", textCodecs, groupCodecs)
+
+	if len(g.period.elements("")) == 0 {
+		return nil, errors.New("no fMP4 media playlists to describe")
+	}
+
+	g.mpd.setAttr("mediaPresentationDuration", formatISODuration(g.duration))
+	g.mpd.setAttr("minBufferTime", formatISODuration(g.longest))
+	g.mpd.Children = append(g.mpd.Children, g.period)
+	g.mpd.indent("\n")
+
+	root := &xmlNode{Children: []*xmlNode{
+		{Token: xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)}},
+		{Token: xml.CharData("\n")},
+		g.mpd,
+		{Token: xml.CharData("\n")},
+	}}
+	return root.bytes(), nil
+}
+
+// variantSet adds an adaptation set for video variants (or, with trickMode,
+// I-frame variants of the set with ID main). Returns the ID of the set, or
+// empty if no variant could be described.
+func (g *mpdGenerator) variantSet(variants []Variant, trickMode bool, main string) string {
+	set := g.newSet("video", "video/mp4")
+	if trickMode {
+		property := &xmlNode{Name: "EssentialProperty"}
+		property.setAttr("schemeIdUri", trickModeScheme)
+		property.setAttr("value", main)
+		set.Children = append(set.Children, property)
+	}
+
+	seen := make(map[string]bool)
+	for _, variant := range variants {
+		if seen[variant.URL] || (g.keep != nil && !g.keep(variant.URL)) {
+			continue
+		}
+		seen[variant.URL] = true
+
+		rep, ok := g.representation(variant.URL)
+		if !ok {
+			continue
+		}
+		rep.setAttr("bandwidth", strconv.FormatInt(variant.Bandwidth, 10))
+		if width, height, ok := strings.Cut(variant.Resolution, "x"); ok {
+			rep.setAttr("width", width)
+			rep.setAttr("height", height)
+		}
+		if variant.FrameRate > 0 {
+			rep.setAttr("frameRate", formatFrameRate(variant.FrameRate))
+		}
+		codecs := variant.Codecs
+		if variant.Audio != "" {
+			// The audio is in the rendition, not in the variant's segments
+			codecs = filterCodecs(codecs, videoCodecs)
+		}
+		if codecs != "" {
+			rep.setAttr("codecs", codecs)
+		}
+		set.Children = append(set.Children, rep)
+	}
+
+	return g.addSet(set)
+}
+
+// renditionSets adds an adaptation set for each language and name of the
+// renditions of the given type, with each matching rendition as a
+// representation.
+func (g *mpdGenerator) renditionSets(renditionType, contentType string, codecFamily []string, groupCodecs map[string]string) {
+	type key struct{ language, name string }
+	sets := make(map[key]*xmlNode)
+	var order []key
+	seen := make(map[string]bool)
+
+	for _, rendition := range g.master.Renditions {
+		if rendition.Type != renditionType || rendition.URL == "" || seen[rendition.URL] {
+			continue
+		}
+		if g.keep != nil && !g.keep(rendition.URL) {
+			continue
+		}
+		seen[rendition.URL] = true
+
+		rep, ok := g.representation(rendition.URL)
+		if !ok {
+			continue
+		}
+		if bandwidth := g.renditionBandwidth(rendition); bandwidth > 0 {
+			rep.setAttr("bandwidth", strconv.FormatInt(bandwidth, 10))
+		}
+		if codecs := filterCodecs(groupCodecs[renditionType+":"+rendition.GroupID], codecFamily); codecs != "" {
+			rep.setAttr("codecs", codecs)
+		}
+		if channels, _, _ := strings.Cut(rendition.Attributes["CHANNELS"], "/"); channels != "" {
+			configuration := &xmlNode{Name: "AudioChannelConfiguration"}
+			configuration.setAttr("schemeIdUri", "urn:mpeg:dash:23003:3:audio_channel_configuration:2011")
+			configuration.setAttr("value", channels)
+			rep.Children = append([]*xmlNode{configuration}, rep.Children...)
+		}
+
+		k := key{rendition.Language, rendition.Name}
+		set, ok := sets[k]
+		if !ok {
+			mimeType := "audio/mp4"
+			if contentType == "text" {
+				mimeType = "application/mp4"
+			}
+			set = g.newSet(contentType, mimeType)
+			if rendition.Language != "" {
+				set.setAttr("lang", rendition.Language)
+			}
+			if rendition.Name != "" {
+				label := &xmlNode{Name: "Label", Children: []*xmlNode{{Token: xml.CharData(rendition.Name)}}}
+				set.Children = append(set.Children, label)
+			}
+			if contentType == "text" || rendition.Default {
+				role := &xmlNode{Name: "Role"}
+				role.setAttr("schemeIdUri", "urn:mpeg:dash:role:2011")
+				role.setAttr("value", "main")
+				if contentType == "text" {
+					role.setAttr("value", "subtitle")
+				}
+				set.Children = append(set.Children, role)
+			}
+			sets[k] = set
+			order = append(order, k)
+		}
+		set.Children = append(set.Children, rep)
+	}
+
+	for _, k := range order {
+		g.addSet(sets[k])
+	}
+}
+
+// newSet creates an AdaptationSet element.
+func (g *mpdGenerator) newSet(contentType, mimeType string) *xmlNode {
+	set := &xmlNode{Name: "AdaptationSet"}
+	set.setAttr("contentType", contentType)
+	set.setAttr("mimeType", mimeType)
+	set.setAttr("segmentAlignment", "true")
+	return set
+}
+
+// addSet adds an adaptation set to the period if it has representations,
+// and returns its ID (empty if it has none).
+func (g *mpdGenerator) addSet(set *xmlNode) string {
+	if len(set.elements("Representation")) == 0 {
+		return ""
+	}
+	id := strconv.Itoa(g.sets)
+	g.sets++
+	set.Attrs = append([]xml.Attr{{Name: xml.Name{Local: "id"}, Value: id}}, set.Attrs...)
+	g.period.Children = append(g.period.Children, set)
+	return id
+}
+
+// representation creates a Representation element listing the segments of
+// a recorded media playlist. Returns false, after warning why, if the
+// playlist wasn't recorded or can't be described.
+func (g *mpdGenerator) representation(m3u8URL string) (*xmlNode, bool) {
+	source, ok := g.d.recordedMedia(m3u8URL)
+	if !ok {
+		return nil, false
+	}
+
+	rep, err := hlsRepresentation(source.playlist)
+	if err == nil {
+		rep.node = &xmlNode{Name: "Representation"}
+		var rewritten []string
+		rewritten, err = g.references(rep, source.keep)
+		if err == nil {
+			rep.node.Children = append(rep.node.Children, segmentList(rep, rewritten))
+		}
+	}
+	if err != nil {
+		g.d.progress.PrintWarning("leaving %s out of the DASH manifest: %v", m3u8URL, err)
+		return nil, false
+	}
+
+	for _, segment := range rep.Segments {
+		g.duration = max(g.duration, float64(segment.Time+segment.Duration)/generatedTimescale)
+		g.longest = max(g.longest, float64(segment.Duration)/generatedTimescale)
+	}
+	rep.node.setAttr("id", strconv.Itoa(g.reps))
+	g.reps++
+	return rep.node, true
+}
+
+// references returns the references of a representation's resources as
+// they appear in the generated manifest: relative to it, or rewritten the
+// way the playlists were.
+func (g *mpdGenerator) references(rep *Representation, keep func(string) bool) ([]string, error) {
+	d := g.d
+	if !d.rewriteURLs && !d.rewriteOpts.Absolutize {
+		references := make([]string, 0, len(rep.Segments)+1)
+		for _, resource := range rep.resources() {
+			references = append(references, resource.URL)
+		}
+		return references, nil
+	}
+
+	opts := d.rewriteOpts
+	opts.Keep = keep
+	baseURL, _ := url.Parse(g.mpdURL)
+	rw := &rewriter{sourceURL: g.mpdURL, baseURL: baseURL, fs: d.fs, opts: opts}
+
+	references := make([]string, 0, len(rep.Segments)+1)
+	for _, resource := range rep.resources() {
+		reference, removed := rw.rewriteReference(resource.URL)
+		if removed {
+			return nil, fmt.Errorf("%s was filtered out", resource.URL)
+		}
+		references = append(references, reference)
+	}
+	return references, nil
+}
+
+// renditionBandwidth returns the BANDWIDTH of a rendition or, failing that,
+// an estimate from the sizes of its downloaded segments (zero if unknown).
+func (g *mpdGenerator) renditionBandwidth(rendition Rendition) int64 {
+	if bandwidth, err := strconv.ParseInt(rendition.Attributes["BANDWIDTH"], 10, 64); err == nil {
+		return bandwidth
+	}
+
+	source, ok := g.d.recordedMedia(rendition.URL)
+	if !ok {
+		return 0
+	}
+
+	var bytes int64
+	var duration float64
+	for _, segment := range source.playlist.Segments {
+		duration += segment.Duration
+		if segment.ByteRange != nil {
+			bytes += segment.ByteRange.Length
+			continue
+		}
+		localPath, err := g.d.fs.GetLocalPath(segment.URL)
+		if err != nil {
+			return 0
+		}
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return 0
+		}
+		bytes += info.Size()
+	}
+	if duration == 0 {
+		return 0
+	}
+	return int64(math.Ceil(float64(bytes) * 8 / duration))
+}
+
+// hlsRepresentation describes the segments of an fMP4 media playlist as a
+// Representation with a millisecond timeline, or returns an error if DASH
+// can't describe them.
+func hlsRepresentation(playlist *M3U8File) (*Representation, error) {
+	if !playlist.EndList {
+		return nil, errors.New("live playlists are not supported")
+	}
+	if len(playlist.Segments) == 0 {
+		return nil, errors.New("no segments")
+	}
+
+	first := playlist.Segments[0]
+	if first.MapURL == "" {
+		return nil, errors.New("no EXT-X-MAP, so not fMP4")
+	}
+	rep := &Representation{Timescale: generatedTimescale, Init: &MPDSegment{URL: first.MapURL, Range: formatRange(first.MapByteRange)}}
+
+	elapsed := 0.0
+	for _, segment := range playlist.Segments {
+		if segment.KeyMethod != "" {
+			return nil, fmt.Errorf("%s encryption is not supported", segment.KeyMethod)
+		}
+		if segment.MapURL != first.MapURL || formatRange(segment.MapByteRange) != rep.Init.Range {
+			return nil, errors.New("the EXT-X-MAP changes")
+		}
+
+		// Round the running total rather than each duration, so rounding
+		// errors don't add up
+		start := uint64(math.Round(elapsed * generatedTimescale))
+		elapsed += segment.Duration
+		end := uint64(math.Round(elapsed * generatedTimescale))
+		rep.Segments = append(rep.Segments, MPDSegment{
+			URL:      segment.URL,
+			Range:    formatRange(segment.ByteRange),
+			Number:   uint64(len(rep.Segments) + 1),
+			Time:     start,
+			Duration: end - start,
+		})
+	}
+	return rep, nil
+}
+
+// formatRange formats a byte range as a DASH range ("first-last"), or
+// returns empty for nil.
+func formatRange(byteRange *ByteRange) string {
+	if byteRange == nil {
+		return ""
+	}
+	offset := max(byteRange.Offset, 0)
+	return fmt.Sprintf("%d-%d", offset, offset+byteRange.Length-1)
+}
+
+// filterCodecs keeps the entries of a CODECS list that belong to a codec
+// family.
+func filterCodecs(codecs string, family []string) string {
+	var kept []string
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+		sampleEntry, _, _ := strings.Cut(codec, ".")
+		for _, prefix := range family {
+			if sampleEntry == prefix {
+				kept = append(kept, codec)
+				break
+			}
+		}
+	}
+	return strings.Join(kept, ",")
+}
+
+// formatFrameRate formats a frame rate as a DASH FrameRateType, which only
+// allows integers and fractions (e.g. 29.97 is "30000/1001").
+func formatFrameRate(rate float64) string {
+	if rate == math.Trunc(rate) {
+		return strconv.FormatFloat(rate, 'f', 0, 64)
+	}
+	if ntsc := math.Round(rate * 1.001); math.Abs(ntsc/1.001-rate) < 0.01 {
+		return fmt.Sprintf("%d/1001", int64(ntsc*1000))
+	}
+	return fmt.Sprintf("%d/1000", int64(math.Round(rate*1000)))
+}
+
+// formatISODuration formats seconds as an ISO 8601 duration (e.g. "PT1M4.5S").
+func formatISODuration(seconds float64) string {
+	d := time.Duration(math.Round(seconds*1000)) * time.Millisecond
+	var b strings.Builder
+	b.WriteString("PT")
+	if hours := d / time.Hour; hours > 0 {
+		fmt.Fprintf(&b, "%dH", hours)
+		d -= hours * time.Hour
+	}
+	if minutes := d / time.Minute; minutes > 0 {
+		fmt.Fprintf(&b, "%dM", minutes)
+		d -= minutes * time.Minute
+	}
+	if d > 0 || b.Len() == 2 {
+		b.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S")
+	}
+	return b.String()
+}
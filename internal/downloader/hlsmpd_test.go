@@ -0,0 +1,235 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHLSRepresentation(t *testing.T) {
+	base, _ := url.Parse("https://example.com/video/index.m3u8")
+
+	tests := []struct {
+		name     string
+		content  string
+		times    [][2]uint64 // Time and Duration of each segment
+		ranges   []string
+		initRef  string
+		errorMsg string
+	}{
+		{
+			name:    "rounded running total",
+			content: "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:3.3333,\ns0.m4s\n#EXTINF:3.3333,\ns1.m4s\n#EXTINF:3.3334,\ns2.m4s\n#EXT-X-ENDLIST\n",
+			times:   [][2]uint64{{0, 3333}, {3333, 3334}, {6667, 3333}},
+			ranges:  []string{"", "", ""},
+			initRef: "https://example.com/video/init.mp4",
+		},
+		{
+			name:    "byte ranges",
+			content: "#EXTM3U\n#EXT-X-MAP:URI=\"main.mp4\",BYTERANGE=\"800@0\"\n#EXTINF:4,\n#EXT-X-BYTERANGE:1000@800\nmain.mp4\n#EXTINF:4,\n#EXT-X-BYTERANGE:1200\nmain.mp4\n#EXT-X-ENDLIST\n",
+			times:   [][2]uint64{{0, 4000}, {4000, 4000}},
+			ranges:  []string{"800-1799", "1800-2999"},
+			initRef: "https://example.com/video/main.mp4",
+		},
+		{
+			name:     "MPEG-TS",
+			content:  "#EXTM3U\n#EXTINF:4,\ns0.ts\n#EXT-X-ENDLIST\n",
+			errorMsg: "not fMP4",
+		},
+		{
+			name:     "live",
+			content:  "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\ns0.m4s\n",
+			errorMsg: "live",
+		},
+		{
+			name:     "encrypted",
+			content:  "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\ns0.m4s\n#EXT-X-ENDLIST\n",
+			errorMsg: "SAMPLE-AES",
+		},
+		{
+			name:     "changing init segment",
+			content:  "#EXTM3U\n#EXT-X-MAP:URI=\"a.mp4\"\n#EXTINF:4,\ns0.m4s\n#EXT-X-DISCONTINUITY\n#EXT-X-MAP:URI=\"b.mp4\"\n#EXTINF:4,\ns1.m4s\n#EXT-X-ENDLIST\n",
+			errorMsg: "EXT-X-MAP changes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist, err := ParseM3U8([]byte(tt.content), base)
+			if err != nil {
+				t.Fatalf("ParseM3U8 failed: %v", err)
+			}
+			rep, err := hlsRepresentation(playlist)
+			if tt.errorMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Fatalf("Expected an error containing %q, got %v", tt.errorMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("hlsRepresentation failed: %v", err)
+			}
+			if rep.Init.URL != tt.initRef {
+				t.Errorf("Init = %s; expected %s", rep.Init.URL, tt.initRef)
+			}
+			var times [][2]uint64
+			var ranges []string
+			for _, segment := range rep.Segments {
+				times = append(times, [2]uint64{segment.Time, segment.Duration})
+				ranges = append(ranges, segment.Range)
+			}
+			if !reflect.DeepEqual(times, tt.times) || !reflect.DeepEqual(ranges, tt.ranges) {
+				t.Errorf("Segments = %v %q; expected %v %q", times, ranges, tt.times, tt.ranges)
+			}
+		})
+	}
+}
+
+func TestGeneratedMPDFormatting(t *testing.T) {
+	frameRates := map[float64]string{25: "25", 29.97: "30000/1001", 59.94: "60000/1001", 12.5: "12500/1000"}
+	for rate, expected := range frameRates {
+		if got := formatFrameRate(rate); got != expected {
+			t.Errorf("formatFrameRate(%v) = %s; expected %s", rate, got, expected)
+		}
+	}
+
+	durations := map[float64]string{0: "PT0S", 6: "PT6S", 64.5: "PT1M4.5S", 3600: "PT1H", 3723.25: "PT1H2M3.25S"}
+	for seconds, expected := range durations {
+		if got := formatISODuration(seconds); got != expected {
+			t.Errorf("formatISODuration(%v) = %s; expected %s", seconds, got, expected)
+		}
+	}
+
+	if got := filterCodecs("avc1.64001f, mp4a.40.2,wvtt", videoCodecs); got != "avc1.64001f" {
+		t.Errorf("filterCodecs() = %q; expected video only", got)
+	}
+	if got := filterCodecs("avc1.64001f,mp4a.40.2,ec-3", audioCodecs); got != "mp4a.40.2,ec-3" {
+		t.Errorf("filterCodecs() = %q; expected audio only", got)
+	}
+}
+
+func TestDownloadDASHManifest(t *testing.T) {
+	files := map[string]string{
+		"/hls/master.m3u8": "#EXTM3U\n" +
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"English\",LANGUAGE=\"en\",DEFAULT=YES,CHANNELS=\"2\",URI=\"audio/en.m3u8\"\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720,FRAME-RATE=29.970,CODECS=\"avc1.64001f,mp4a.40.2\",AUDIO=\"aud\"\nvideo/720p.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=500000,CODECS=\"avc1.4d401e,mp4a.40.2\"\nts/index.m3u8\n" +
+			"#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,CODECS=\"avc1.64001f\",URI=\"video/iframes.m3u8\"\n",
+		"/hls/audio/en.m3u8":      "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\n0.m4s\n#EXTINF:4,\n1.m4s\n#EXT-X-ENDLIST\n",
+		"/hls/video/720p.m3u8":    "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\n0.m4s\n#EXTINF:4,\n1.m4s\n#EXT-X-ENDLIST\n",
+		"/hls/video/iframes.m3u8": "#EXTM3U\n#EXT-X-I-FRAMES-ONLY\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:4,\n#EXT-X-BYTERANGE:100@0\n0.m4s\n#EXTINF:4,\n#EXT-X-BYTERANGE:100@0\n1.m4s\n#EXT-X-ENDLIST\n",
+		"/hls/ts/index.m3u8":      "#EXTM3U\n#EXTINF:4,\n0.ts\n#EXT-X-ENDLIST\n",
+		"/hls/audio/init.mp4":     "init",
+		"/hls/audio/0.m4s":        "0123456789",
+		"/hls/audio/1.m4s":        "0123456789",
+		"/hls/video/init.mp4":     "init",
+		"/hls/video/0.m4s":        "video",
+		"/hls/video/1.m4s":        "video",
+		"/hls/ts/0.ts":            "video",
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		mpdPath  string
+		expected []string
+	}{
+		{
+			name:    "local paths",
+			config:  Config{},
+			mpdPath: "hls/manifest.mpd",
+			expected: []string{
+				`<AdaptationSet id="0" contentType="video" mimeType="video/mp4" segmentAlignment="true">`,
+				`<Representation id="0" bandwidth="2000000" width="1280" height="720" frameRate="30000/1001" codecs="avc1.64001f">`,
+				`<Initialization sourceURL="video/init.mp4"/>`,
+				`<SegmentURL media="video/0.m4s"/>`,
+				`<S t="0" d="4000" r="1"/>`,
+				`<EssentialProperty schemeIdUri="http://dashif.org/guidelines/trickmode" value="0"/>`,
+				`<SegmentURL media="video/0.m4s" mediaRange="0-99"/>`,
+				`<AdaptationSet id="2" contentType="audio" mimeType="audio/mp4" segmentAlignment="true" lang="en">`,
+				`<Label>English</Label>`,
+				`<Role schemeIdUri="urn:mpeg:dash:role:2011" value="main"/>`,
+				`bandwidth="20" codecs="mp4a.40.2"`,
+				`<AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="2"/>`,
+				`<SegmentURL media="audio/1.m4s"/>`,
+				`mediaPresentationDuration="PT8S"`,
+			},
+		},
+		{
+			name:     "rebased",
+			config:   Config{RewriteBase: &url.URL{Scheme: "https", Host: "cdn.example.net", Path: "/show/"}},
+			mpdPath:  "hls/manifest.mpd",
+			expected: []string{`<SegmentURL media="https://cdn.example.net/show/hls/video/0.m4s"/>`},
+		},
+		{
+			name:     "flattened",
+			config:   Config{Flatten: true},
+			mpdPath:  "manifest.mpd",
+			expected: []string{`<Initialization sourceURL="init.mp4"/>`, `<SegmentURL media="0.m4s"/>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content, ok := files[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(content))
+			}))
+			defer srv.Close()
+
+			outputDir := t.TempDir()
+			config := tt.config
+			config.OutputDir = outputDir
+			config.Concurrency = 2
+			config.RewriteURLs = true
+			config.DASHManifest = true
+			config.Quiet = true
+			if err := New(config).Download(context.Background(), srv.URL+"/hls/master.m3u8"); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			mpdPath := filepath.Join(outputDir, filepath.FromSlash(tt.mpdPath))
+			content, err := os.ReadFile(mpdPath)
+			if err != nil {
+				t.Fatalf("Failed to read the DASH manifest: %v", err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(string(content), expected) {
+					t.Errorf("Expected %s in the DASH manifest:\n%s", expected, content)
+				}
+			}
+			if strings.Contains(string(content), "ts/") {
+				t.Errorf("Expected the MPEG-TS variant to be left out:\n%s", content)
+			}
+
+			// The generated manifest describes the files that were written
+			local, _ := url.Parse("file://" + filepath.ToSlash(mpdPath))
+			mpd, err := ParseMPD(content, local, "")
+			if err != nil {
+				t.Fatalf("Generated manifest doesn't parse: %v", err)
+			}
+			if len(mpd.Periods) != 1 || len(mpd.Periods[0].AdaptationSets) != 3 {
+				t.Fatalf("Expected video, trick mode and audio adaptation sets, got %+v", mpd.Periods)
+			}
+			if tt.config.RewriteBase != nil {
+				return
+			}
+			for _, u := range mpd.URLs {
+				parsed, _ := url.Parse(u)
+				if _, err := os.Stat(filepath.FromSlash(parsed.Path)); err != nil {
+					t.Errorf("Expected %s to exist: %v", u, err)
+				}
+			}
+		})
+	}
+}
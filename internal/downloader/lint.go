@@ -0,0 +1,27 @@
+package downloader
+
+import (
+	"fmt"
+
+	"github.com/knpwrs/m3u8dl/internal/lint"
+)
+
+// lintPlaylist checks a playlist with lint.Lint before anything it references
+// is downloaded, printing every issue as a warning.
+//
+// Returns an error if the playlist has lint errors, so a broken stream is
+// noticed before its segments are fetched.
+func (d *Downloader) lintPlaylist(m3u8URL string, content []byte) error {
+	failed := 0
+	for _, issue := range lint.Lint(content) {
+		issue.Playlist = m3u8URL
+		d.progress.PrintWarning("%s", issue)
+		if issue.Severity == lint.SeverityError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%s failed lint with %d errors", m3u8URL, failed)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDownloadLint(t *testing.T) {
+	tests := []struct {
+		name    string
+		media   string
+		wantErr bool
+	}{
+		{"valid", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n", false},
+		{"warnings only", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\ns0.ts\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n", false},
+		{"segment longer than the target duration", "#EXTM3U\n#EXT-X-TARGETDURATION:5\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requested := make(map[string]bool)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requested[r.URL.Path] = true
+				mu.Unlock()
+				switch r.URL.Path {
+				case "/master.m3u8":
+					w.Write([]byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=\"avc1.4d401f\"\nvideo.m3u8\n"))
+				case "/video.m3u8":
+					w.Write([]byte(tt.media))
+				default:
+					w.Write([]byte("segment"))
+				}
+			}))
+			defer srv.Close()
+
+			d := New(Config{OutputDir: t.TempDir(), Concurrency: 2, RewriteURLs: true, Lint: true, Quiet: true})
+			err := d.Download(context.Background(), srv.URL+"/master.m3u8")
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "failed lint") {
+					t.Fatalf("Expected a lint error, got %v", err)
+				}
+				if requested["/s0.ts"] {
+					t.Error("Segments of a playlist with lint errors should not be fetched")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			if !requested["/s0.ts"] {
+				t.Error("Expected the segment to be fetched")
+			}
+		})
+	}
+}
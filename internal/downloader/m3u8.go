@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // M3U8File represents a parsed M3U8 playlist file.
@@ -17,10 +19,77 @@ import (
 //
 // See: https://context7.com/golang/go for Go documentation
 type M3U8File struct {
-	Content  []byte
-	BaseURL  *url.URL
-	URLs     []string
-	IsM3U8   map[string]bool // Track which URLs are M3U8 files
+	Content    []byte
+	BaseURL    *url.URL
+	URLs       []string
+	IsM3U8     map[string]bool // Track which URLs are M3U8 files
+	References []Reference     // Every reference in order, with its context
+
+	// Master playlist contents
+	Variants        []Variant
+	Renditions      []Rendition
+	ContentSteering *ContentSteering // From EXT-X-CONTENT-STEERING, if any
+
+	// Media playlist contents
+	Segments       []Segment
+	DateRanges     []DateRange
+	TargetDuration float64
+	MediaSequence  int64
+	EndList        bool
+
+	// Warnings describe tags that couldn't be understood but don't stop the
+	// playlist from being used (e.g. an unparsable date-time), each prefixed
+	// with its line number
+	Warnings []string
+}
+
+// dateTimeLayouts are the ISO 8601 forms date-times are accepted in: RFC
+// 3339 as the specification asks, and with the +hhmm or +hh offset many
+// packagers write instead.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8216#section-4.3.2.6
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999Z07",
+}
+
+// parseDateTime parses an EXT-X-PROGRAM-DATE-TIME or EXT-X-DATERANGE date.
+func parseDateTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date-time %q", value)
+}
+
+// Reference is a single URI referenced by a playlist, along with the context
+// it appeared in.
+//
+// The same URL may appear in several references (e.g. byte-ranged segments
+// of one file).
+type Reference struct {
+	// URL is the resolved absolute URL
+	URL string
+	// Tag is the tag that carried the URI (e.g. "EXT-X-KEY"), or empty for
+	// a plain URI line
+	Tag string
+	// Line is the 1-based line number of the reference
+	Line int
+	// ByteRange is the sub-range of the resource in use, if any
+	ByteRange *ByteRange
+	// KeyMethod is the EXT-X-KEY METHOD in effect for segments and maps
+	// (empty if unencrypted)
+	KeyMethod string
+}
+
+// ByteRange is a sub-range of a resource, from EXT-X-BYTERANGE or the
+// BYTERANGE attribute of EXT-X-MAP.
+type ByteRange struct {
+	Offset int64
+	Length int64
 }
 
 // ParseM3U8 parses an M3U8 file and extracts all referenced URLs.
@@ -42,42 +111,163 @@ type M3U8File struct {
 // See: https://context7.com/golang/go for Go documentation
 func ParseM3U8(content []byte, baseURL *url.URL) (*M3U8File, error) {
 	m3u8 := &M3U8File{
-		Content:  content,
-		BaseURL:  baseURL,
-		URLs:     make([]string, 0),
-		IsM3U8:   make(map[string]bool),
+		Content:    content,
+		BaseURL:    baseURL,
+		URLs:       make([]string, 0),
+		IsM3U8:     make(map[string]bool),
+		References: make([]Reference, 0),
+		Variants:   make([]Variant, 0),
+		Renditions: make([]Rendition, 0),
+		Segments:   make([]Segment, 0),
 	}
 
-	scanner := bufio.NewScanner(bytes.NewReader(content))
+	var segment Segment      // Segment being built from tags before its URI
+	var variant *Variant     // Pending EXT-X-STREAM-INF waiting for its URI
+	var lastRange *ByteRange // Range of the previous segment
+	lastRangeURL := ""       // URL of the previous segment
+	var key Segment          // KeyMethod and KeyURL currently in effect
+	var mapRef Segment       // MapURL and MapByteRange currently in effect
+	lineNum := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(content, utf8BOM)))
 	for scanner.Scan() {
+		lineNum++
 		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines and comments that don't contain URLs
-		if line == "" || (strings.HasPrefix(line, "#") && !containsURL(line)) {
+		if line == "" {
 			continue
 		}
 
-		// Extract URLs from tag lines
 		if strings.HasPrefix(line, "#") {
+			name := tagName(line)
+			value := tagValue(line)
+			switch name {
+			case "EXTINF":
+				durationStr, title, _ := strings.Cut(value, ",")
+				segment.Duration, _ = strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+				segment.Title = strings.TrimSpace(title)
+			case "EXT-X-BYTERANGE":
+				segment.ByteRange = parseByteRange(value)
+			case "EXT-X-DISCONTINUITY":
+				segment.Discontinuity = true
+			case "EXT-X-PROGRAM-DATE-TIME":
+				t, err := parseDateTime(value)
+				if err != nil {
+					m3u8.Warnings = append(m3u8.Warnings, fmt.Sprintf("line %d: EXT-X-PROGRAM-DATE-TIME: %v", lineNum, err))
+				}
+				segment.ProgramDateTime = t
+			case "EXT-X-TARGETDURATION":
+				m3u8.TargetDuration, _ = strconv.ParseFloat(value, 64)
+			case "EXT-X-MEDIA-SEQUENCE":
+				m3u8.MediaSequence, _ = strconv.ParseInt(value, 10, 64)
+			case "EXT-X-ENDLIST":
+				m3u8.EndList = true
+			case "EXT-X-KEY":
+				attrs := parseAttributes(value)
+				key = Segment{KeyMethod: attrs["METHOD"]}
+				if key.KeyMethod == "NONE" {
+					key = Segment{}
+				} else if uri, ok := attrs["URI"]; ok {
+					key.KeyURL = resolveURL(baseURL, uri)
+				}
+			case "EXT-X-MAP":
+				attrs := parseAttributes(value)
+				mapRef = Segment{MapURL: resolveURL(baseURL, attrs["URI"])}
+				if byteRange, ok := attrs["BYTERANGE"]; ok {
+					mapRef.MapByteRange = parseByteRange(byteRange)
+					if mapRef.MapByteRange != nil && mapRef.MapByteRange.Offset < 0 {
+						mapRef.MapByteRange.Offset = 0
+					}
+				}
+			case "EXT-X-STREAM-INF":
+				v := newVariant(parseAttributes(value), false)
+				variant = &v
+			case "EXT-X-I-FRAME-STREAM-INF", "EXT-X-IMAGE-STREAM-INF":
+				v := newVariant(parseAttributes(value), name == "EXT-X-I-FRAME-STREAM-INF")
+				v.Image = name == "EXT-X-IMAGE-STREAM-INF"
+				v.URL = resolveURL(baseURL, v.Attributes["URI"])
+				m3u8.Variants = append(m3u8.Variants, v)
+			case "EXT-X-MEDIA":
+				m3u8.Renditions = append(m3u8.Renditions, newRendition(parseAttributes(value), baseURL))
+			case "EXT-X-DATERANGE":
+				r, err := newDateRange(parseAttributes(value))
+				if err != nil {
+					m3u8.Warnings = append(m3u8.Warnings, fmt.Sprintf("line %d: EXT-X-DATERANGE: %v", lineNum, err))
+				}
+				m3u8.DateRanges = append(m3u8.DateRanges, r)
+			case "EXT-X-CONTENT-STEERING":
+				attrs := parseAttributes(value)
+				m3u8.ContentSteering = &ContentSteering{
+					URL:       resolveURL(baseURL, attrs["SERVER-URI"]),
+					PathwayID: attrs["PATHWAY-ID"],
+				}
+			default:
+				if marker, ok := parseAdMarker(name, value); ok {
+					segment.AdMarkers = append(segment.AdMarkers, marker)
+				}
+			}
+
+			// Skip comments that don't contain URLs
+			if !containsURL(line) {
+				continue
+			}
+
+			// Extract URLs from tag lines
 			urls := extractURLsFromTag(line)
 			for _, u := range urls {
 				resolved := resolveURL(baseURL, u)
 				m3u8.URLs = append(m3u8.URLs, resolved)
-				// Mark encryption keys and other resources
-				if !strings.HasSuffix(u, ".m3u8") {
-					m3u8.IsM3U8[resolved] = false
+				// Renditions and trick-play streams are playlists whatever
+				// they are named; keys and maps never are
+				m3u8.IsM3U8[resolved] = playlistTags[name]
+
+				ref := Reference{URL: resolved, Tag: name, Line: lineNum}
+				if name == "EXT-X-MAP" {
+					ref.KeyMethod = key.KeyMethod
+					ref.ByteRange = mapRef.MapByteRange
 				}
+				m3u8.References = append(m3u8.References, ref)
 			}
 			continue
 		}
 
 		// Non-comment lines are either segment URLs or playlist URLs
-		if !strings.HasPrefix(line, "#") {
-			resolved := resolveURL(baseURL, line)
-			m3u8.URLs = append(m3u8.URLs, resolved)
-			// Check if it's likely an M3U8 file
-			m3u8.IsM3U8[resolved] = strings.HasSuffix(line, ".m3u8") || strings.Contains(line, ".m3u8?")
+		resolved := resolveURL(baseURL, line)
+		m3u8.URLs = append(m3u8.URLs, resolved)
+		// Variant streams are playlists whatever they are named. Other URIs
+		// are only guessed from their extension here; the downloader
+		// recognizes the rest by their content.
+		m3u8.IsM3U8[resolved] = variant != nil || isPlaylistURL(resolved)
+
+		if variant != nil {
+			variant.URL = resolved
+			m3u8.Variants = append(m3u8.Variants, *variant)
+			variant = nil
+			m3u8.References = append(m3u8.References, Reference{URL: resolved, Line: lineNum})
+			continue
+		}
+
+		if r := segment.ByteRange; r != nil && r.Offset < 0 {
+			// Without an offset, a sub-range continues where the previous
+			// segment's sub-range of the same resource ended
+			r.Offset = 0
+			if lastRange != nil && lastRangeURL == resolved {
+				r.Offset = lastRange.Offset + lastRange.Length
+			}
 		}
+		lastRange, lastRangeURL = segment.ByteRange, resolved
+
+		segment.URL = resolved
+		segment.Line = lineNum
+		segment.KeyMethod, segment.KeyURL = key.KeyMethod, key.KeyURL
+		segment.MapURL, segment.MapByteRange = mapRef.MapURL, mapRef.MapByteRange
+		m3u8.Segments = append(m3u8.Segments, segment)
+		m3u8.References = append(m3u8.References, Reference{
+			URL:       resolved,
+			Line:      lineNum,
+			ByteRange: segment.ByteRange,
+			KeyMethod: segment.KeyMethod,
+		})
+		segment = Segment{}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -87,9 +277,19 @@ func ParseM3U8(content []byte, baseURL *url.URL) (*M3U8File, error) {
 	return m3u8, nil
 }
 
+// playlistTags are the tags whose URI attribute is always a media playlist.
+var playlistTags = map[string]bool{
+	"EXT-X-MEDIA":              true,
+	"EXT-X-I-FRAME-STREAM-INF": true,
+	"EXT-X-IMAGE-STREAM-INF":   true,
+}
+
 // containsURL checks if a tag line contains a URL.
 func containsURL(line string) bool {
-	urlTags := []string{"EXT-X-KEY", "EXT-X-MEDIA", "EXT-X-MAP", "EXT-X-I-FRAME-STREAM-INF"}
+	urlTags := []string{
+		"EXT-X-KEY", "EXT-X-MEDIA", "EXT-X-MAP", "EXT-X-I-FRAME-STREAM-INF", "EXT-X-IMAGE-STREAM-INF",
+		"EXT-X-SESSION-DATA", "EXT-X-SESSION-KEY", "EXT-X-CONTENT-STEERING",
+	}
 	for _, tag := range urlTags {
 		if strings.Contains(line, tag) {
 			return true
@@ -98,6 +298,88 @@ func containsURL(line string) bool {
 	return false
 }
 
+// tagName returns the name of a tag line without the leading '#' and any
+// attributes (e.g. "EXT-X-KEY" for "#EXT-X-KEY:METHOD=NONE").
+func tagName(line string) string {
+	name := strings.TrimPrefix(strings.TrimSpace(line), "#")
+	if idx := strings.Index(name, ":"); idx != -1 {
+		name = name[:idx]
+	}
+	return name
+}
+
+// tagValue returns everything after the first ':' of a tag line.
+func tagValue(line string) string {
+	if idx := strings.Index(line, ":"); idx != -1 {
+		return strings.TrimSpace(line[idx+1:])
+	}
+	return ""
+}
+
+// parseAttributes parses an attribute list such as
+// `METHOD=AES-128,URI="key.bin",IV=0x1234` into a map.
+//
+// Quoted values may contain commas. Quotes are removed from the values.
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+
+	for len(list) > 0 {
+		eq := strings.Index(list, "=")
+		if eq == -1 {
+			break
+		}
+		name := strings.TrimSpace(list[:eq])
+		list = list[eq+1:]
+
+		var value string
+		if strings.HasPrefix(list, "\"") {
+			end := strings.Index(list[1:], "\"")
+			if end == -1 {
+				value, list = list[1:], ""
+			} else {
+				value, list = list[1:end+1], list[end+2:]
+			}
+			// Skip to the next attribute
+			if comma := strings.Index(list, ","); comma != -1 {
+				list = list[comma+1:]
+			} else {
+				list = ""
+			}
+		} else if comma := strings.Index(list, ","); comma != -1 {
+			value, list = list[:comma], list[comma+1:]
+		} else {
+			value, list = list, ""
+		}
+
+		attrs[name] = strings.TrimSpace(value)
+	}
+
+	return attrs
+}
+
+// parseByteRange parses a byte range of the form "<length>[@<offset>]".
+//
+// A missing offset is returned as -1 so the caller can fill it in from the
+// previous segment. Returns nil if the value is malformed.
+func parseByteRange(value string) *ByteRange {
+	lengthStr, offsetStr, hasOffset := strings.Cut(strings.TrimSpace(value), "@")
+
+	length, err := strconv.ParseInt(lengthStr, 10, 64)
+	if err != nil || length < 0 {
+		return nil
+	}
+
+	offset := int64(-1)
+	if hasOffset {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			return nil
+		}
+	}
+
+	return &ByteRange{Offset: offset, Length: length}
+}
+
 // extractURLsFromTag extracts URLs from M3U8 tag lines.
 //
 // Handles various M3U8 tags that reference URLs:
@@ -105,26 +387,97 @@ func containsURL(line string) bool {
 // - #EXT-X-MEDIA:URI="url" - Alternative audio/subtitle tracks
 // - #EXT-X-MAP:URI="url" - Initialization segments
 // - #EXT-X-I-FRAME-STREAM-INF:URI="url" - I-frame playlists
+// - #EXT-X-IMAGE-STREAM-INF:URI="url" - Image (thumbnail) playlists
+// - #EXT-X-SESSION-DATA:URI="url" - Session data JSON documents
+// - #EXT-X-SESSION-KEY:URI="url" - Encryption keys, announced up front
+// - #EXT-X-CONTENT-STEERING:SERVER-URI="url" - Steering manifests
 func extractURLsFromTag(line string) []string {
 	urls := make([]string, 0)
+	for _, span := range uriAttributeSpans(line) {
+		urls = append(urls, line[span.valueStart:span.valueEnd])
+	}
+	return urls
+}
+
+// uriAttributes are the attributes whose values are references to other
+// resources. Other attributes that merely end in "URI" (e.g. a client
+// defined X-FOO-URI) are left alone.
+var uriAttributes = map[string]bool{
+	"URI":        true,
+	"SERVER-URI": true,
+}
+
+// attributeSpan is the position of one attribute in a tag line.
+type attributeSpan struct {
+	name       string
+	start, end int // The whole NAME=VALUE, including any quotes
+	// The value, without quotes
+	valueStart, valueEnd int
+	quoted               bool
+}
 
-	// Extract URI attribute values
-	uriPrefix := "URI=\""
-	for {
-		idx := strings.Index(line, uriPrefix)
-		if idx == -1 {
+// attributeSpans returns the positions of the attributes in a tag line's
+// attribute list, in order.
+//
+// The attribute list is parsed the same way as parseAttributes, so quoted
+// values containing commas or '=' don't confuse it.
+func attributeSpans(line string) []attributeSpan {
+	colon := strings.Index(line, ":")
+	if colon == -1 {
+		return nil
+	}
+
+	var spans []attributeSpan
+	pos := colon + 1
+	for pos < len(line) {
+		eq := strings.Index(line[pos:], "=")
+		if eq == -1 {
 			break
 		}
-		line = line[idx+len(uriPrefix):]
-		endIdx := strings.Index(line, "\"")
-		if endIdx == -1 {
-			break
+		name := strings.TrimLeft(line[pos:pos+eq], " ")
+		span := attributeSpan{
+			name:  strings.TrimSpace(name),
+			start: pos + eq - len(name),
 		}
-		urls = append(urls, line[:endIdx])
-		line = line[endIdx+1:]
+		pos += eq + 1
+
+		if strings.HasPrefix(line[pos:], "\"") {
+			end := strings.Index(line[pos+1:], "\"")
+			if end == -1 {
+				break
+			}
+			span.valueStart, span.valueEnd, span.quoted = pos+1, pos+1+end, true
+			pos += end + 2
+			span.end = pos
+		}
+
+		// Skip to the next attribute
+		comma := strings.Index(line[pos:], ",")
+		if comma == -1 {
+			comma = len(line) - pos
+		}
+		if !span.quoted {
+			span.valueStart = pos
+			span.valueEnd = pos + len(strings.TrimRight(line[pos:pos+comma], " "))
+			span.end = span.valueEnd
+		}
+		spans = append(spans, span)
+		pos += comma + 1
 	}
 
-	return urls
+	return spans
+}
+
+// uriAttributeSpans returns the positions of the quoted uriAttributes in a
+// tag line, in order.
+func uriAttributeSpans(line string) []attributeSpan {
+	var spans []attributeSpan
+	for _, span := range attributeSpans(line) {
+		if span.quoted && uriAttributes[span.name] {
+			spans = append(spans, span)
+		}
+	}
+	return spans
 }
 
 // resolveURL resolves a potentially relative URL against a base URL.
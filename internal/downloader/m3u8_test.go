@@ -2,7 +2,13 @@ package downloader
 
 import (
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/filesystem"
 )
 
 func TestParseM3U8(t *testing.T) {
@@ -136,3 +142,223 @@ medium.m3u8
 		}
 	}
 }
+
+func TestHostilePlaylistStaysInOutputDir(t *testing.T) {
+	content := []byte(`#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-KEY:METHOD=AES-128,URI="..%2F..%2F..%2Fkey.bin"
+#EXT-X-MAP:URI="/../../../../init.mp4"
+#EXTINF:10.0,
+../../../../../../etc/cron.d/evil.ts
+#EXTINF:10.0,
+%2E%2E/%2E%2E/escape.ts
+#EXTINF:10.0,
+C:%5CWindows%5Cevil.ts
+#EXTINF:10.0,
+seg%00ment.ts
+`)
+
+	baseURL, _ := url.Parse("https://example.com/live/stream/playlist.m3u8")
+	m3u8, err := ParseM3U8(content, baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "out")
+	fs := filesystem.New(outputDir, false)
+
+	for _, u := range m3u8.URLs {
+		localPath, err := fs.WriteFile(u, []byte("data"))
+		if err != nil {
+			t.Errorf("WriteFile(%s) failed: %v", u, err)
+			continue
+		}
+
+		rel, err := filepath.Rel(outputDir, localPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			t.Errorf("URL %s was written outside the output directory: %s", u, localPath)
+		}
+	}
+
+	// Nothing may have been created next to the output directory
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the output directory in %s, found %d entries", tmpDir, len(entries))
+	}
+}
+
+func TestParseM3U8References(t *testing.T) {
+	content := []byte(`#EXTM3U
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x1
+#EXT-X-BYTERANGE:1000@720
+#EXTINF:10.0,
+media.mp4
+#EXT-X-BYTERANGE:500
+#EXTINF:10.0,
+media.mp4
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:10.0,
+clear.mp4
+`)
+
+	baseURL, _ := url.Parse("https://example.com/video/index.m3u8")
+	m3u8, err := ParseM3U8(content, baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+
+	expected := []Reference{
+		{URL: "https://example.com/video/init.mp4", Tag: "EXT-X-MAP", Line: 2, ByteRange: &ByteRange{Offset: 0, Length: 720}},
+		{URL: "https://example.com/video/key.bin", Tag: "EXT-X-KEY", Line: 3},
+		{URL: "https://example.com/video/media.mp4", Line: 6, ByteRange: &ByteRange{Offset: 720, Length: 1000}, KeyMethod: "AES-128"},
+		{URL: "https://example.com/video/media.mp4", Line: 9, ByteRange: &ByteRange{Offset: 1720, Length: 500}, KeyMethod: "AES-128"},
+		{URL: "https://example.com/video/clear.mp4", Line: 12},
+	}
+
+	if len(m3u8.References) != len(expected) {
+		t.Fatalf("Expected %d references, got %d", len(expected), len(m3u8.References))
+	}
+	for i, want := range expected {
+		got := m3u8.References[i]
+		if got.URL != want.URL || got.Tag != want.Tag || got.Line != want.Line || got.KeyMethod != want.KeyMethod {
+			t.Errorf("Reference %d: expected %+v, got %+v", i, want, got)
+		}
+		if (got.ByteRange == nil) != (want.ByteRange == nil) || (got.ByteRange != nil && *got.ByteRange != *want.ByteRange) {
+			t.Errorf("Reference %d: expected range %+v, got %+v", i, want.ByteRange, got.ByteRange)
+		}
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	attrs := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,NAME="a=b"`)
+
+	expected := map[string]string{
+		"BANDWIDTH":  "1280000",
+		"CODECS":     "avc1.4d401f,mp4a.40.2",
+		"RESOLUTION": "1280x720",
+		"NAME":       "a=b",
+	}
+	for name, value := range expected {
+		if attrs[name] != value {
+			t.Errorf("%s: expected %q, got %q", name, value, attrs[name])
+		}
+	}
+}
+
+func TestParseM3U8Structure(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/video/index.m3u8")
+
+	master := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",LANGUAGE="en",NAME="English",DEFAULT=YES,AUTOSELECT=YES,URI="audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AVERAGE-BANDWIDTH=1000000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=1280x720,FRAME-RATE=29.970,AUDIO="aud"
+720p/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,URI="720p/iframes.m3u8"
+#EXT-X-IMAGE-STREAM-INF:BANDWIDTH=12000,RESOLUTION=320x180,CODECS="jpeg",URI="thumbs/index.m3u8"
+`
+	m3u8, err := ParseM3U8([]byte(master), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	if !m3u8.IsMaster() {
+		t.Error("Expected a master playlist")
+	}
+	if len(m3u8.Variants) != 3 || len(m3u8.Renditions) != 1 || len(m3u8.Segments) != 0 {
+		t.Fatalf("Expected 3 variants, 1 rendition and no segments, got %d, %d and %d",
+			len(m3u8.Variants), len(m3u8.Renditions), len(m3u8.Segments))
+	}
+
+	v := m3u8.Variants[0]
+	if v.URL != "https://example.com/video/720p/index.m3u8" || v.Bandwidth != 1280000 || v.AverageBandwidth != 1000000 ||
+		v.Resolution != "1280x720" || v.FrameRate != 29.97 || v.Codecs != "avc1.4d401f,mp4a.40.2" || v.Audio != "aud" || v.IFrame {
+		t.Errorf("Unexpected variant: %+v", v)
+	}
+	if iframe := m3u8.Variants[1]; !iframe.IFrame || iframe.URL != "https://example.com/video/720p/iframes.m3u8" {
+		t.Errorf("Unexpected I-frame variant: %+v", iframe)
+	}
+	if image := m3u8.Variants[2]; !image.Image || image.IFrame || image.Resolution != "320x180" ||
+		image.URL != "https://example.com/video/thumbs/index.m3u8" || !m3u8.IsM3U8[image.URL] {
+		t.Errorf("Unexpected image variant: %+v", image)
+	}
+
+	r := m3u8.Renditions[0]
+	if r.URL != "https://example.com/video/audio/en.m3u8" || r.Type != "AUDIO" || r.GroupID != "aud" ||
+		r.Language != "en" || r.Name != "English" || !r.Default || !r.Autoselect {
+		t.Errorf("Unexpected rendition: %+v", r)
+	}
+
+	media := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin"
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:00Z
+#EXTINF:9.5,first
+seg1.m4s
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-DISCONTINUITY
+#EXTINF:4,
+seg2.m4s
+#EXT-X-ENDLIST
+`
+	m3u8, err = ParseM3U8([]byte(media), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	if m3u8.IsMaster() {
+		t.Error("Expected a media playlist")
+	}
+	if m3u8.TargetDuration != 10 || m3u8.MediaSequence != 7 || !m3u8.EndList || m3u8.Duration() != 13.5 {
+		t.Errorf("Unexpected header: target %v, sequence %d, endlist %v, duration %v",
+			m3u8.TargetDuration, m3u8.MediaSequence, m3u8.EndList, m3u8.Duration())
+	}
+	if len(m3u8.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(m3u8.Segments))
+	}
+
+	first := m3u8.Segments[0]
+	if first.Duration != 9.5 || first.Title != "first" || first.KeyMethod != "SAMPLE-AES" ||
+		first.KeyURL != "https://example.com/video/key.bin" || first.MapURL != "https://example.com/video/init.mp4" ||
+		first.ProgramDateTime.IsZero() || first.Discontinuity || first.Line != 8 {
+		t.Errorf("Unexpected first segment: %+v", first)
+	}
+	second := m3u8.Segments[1]
+	if second.KeyMethod != "" || !second.Discontinuity || second.MapURL == "" {
+		t.Errorf("Unexpected second segment: %+v", second)
+	}
+}
+
+func TestParseM3U8ProgramDateTime(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/video/index.m3u8")
+	media := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T01:00:00.000+0100
+#EXTINF:10,
+s0.ts
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:10Z
+#EXTINF:10,
+s1.ts
+#EXT-X-PROGRAM-DATE-TIME:yesterday
+#EXTINF:10,
+s2.ts
+#EXT-X-ENDLIST
+`
+	m3u8, err := ParseM3U8([]byte(media), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, expected := range []time.Time{start, start.Add(10 * time.Second), {}} {
+		if got := m3u8.Segments[i].ProgramDateTime; !got.Equal(expected) {
+			t.Errorf("Segment %d: date-time %v; expected %v", i, got, expected)
+		}
+	}
+	if len(m3u8.Warnings) != 1 || !strings.Contains(m3u8.Warnings[0], "line 9") {
+		t.Errorf("Expected a warning about line 9, got %q", m3u8.Warnings)
+	}
+}
@@ -0,0 +1,262 @@
+package downloader
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+)
+
+// ResourceType classifies a downloaded resource by how it was referenced.
+type ResourceType string
+
+const (
+	// ResourcePlaylist is an M3U8 playlist.
+	ResourcePlaylist ResourceType = "playlist"
+	// ResourceSegment is a media segment.
+	ResourceSegment ResourceType = "segment"
+	// ResourceKey is an encryption key from EXT-X-KEY or EXT-X-SESSION-KEY.
+	ResourceKey ResourceType = "key"
+	// ResourceMap is a media initialization section from EXT-X-MAP.
+	ResourceMap ResourceType = "map"
+	// ResourceSubtitle is a subtitle segment.
+	ResourceSubtitle ResourceType = "subtitle"
+	// ResourceIFrame is an I-frame playlist from EXT-X-I-FRAME-STREAM-INF,
+	// or one of its segments.
+	ResourceIFrame ResourceType = "iframe"
+	// ResourceImage is an image (trick-play thumbnail) playlist from
+	// EXT-X-IMAGE-STREAM-INF, or one of its segments.
+	ResourceImage ResourceType = "image"
+	// ResourceSessionData is a JSON document from EXT-X-SESSION-DATA.
+	ResourceSessionData ResourceType = "session-data"
+	// ResourceSteering is a content steering manifest from
+	// EXT-X-CONTENT-STEERING.
+	ResourceSteering ResourceType = "steering"
+)
+
+// resourceTypeNames maps the names accepted by ParseResourceType to types.
+var resourceTypeNames = map[string]ResourceType{
+	"playlist":     ResourcePlaylist,
+	"segment":      ResourceSegment,
+	"key":          ResourceKey,
+	"map":          ResourceMap,
+	"init-map":     ResourceMap,
+	"subtitle":     ResourceSubtitle,
+	"iframe":       ResourceIFrame,
+	"image":        ResourceImage,
+	"session-data": ResourceSessionData,
+	"steering":     ResourceSteering,
+}
+
+// ParseResourceType converts a CLI value into a ResourceType.
+func ParseResourceType(s string) (ResourceType, error) {
+	if t, ok := resourceTypeNames[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid resource type %q (expected playlist, segment, key, init-map, subtitle, iframe, image, session-data or steering)", s)
+}
+
+// subtitleExtensions are file extensions that are always subtitles,
+// wherever they are referenced from.
+var subtitleExtensions = map[string]bool{
+	".vtt":    true,
+	".webvtt": true,
+	".srt":    true,
+	".ttml":   true,
+	".dfxp":   true,
+}
+
+// ManifestEntry records where a single downloaded resource came from.
+type ManifestEntry struct {
+	// URL is the source URL
+	URL string `json:"url"`
+	// LocalPath is where the resource was written
+	LocalPath string `json:"localPath"`
+	// Type is how the resource was referenced
+	Type ResourceType `json:"type"`
+	// Size is the number of bytes written
+	Size int64 `json:"size"`
+	// SHA256 is the hex SHA-256 of the bytes written (after rewriting, for
+	// playlists)
+	SHA256 string `json:"sha256,omitempty"`
+	// Status is the HTTP status code of the response
+	Status int `json:"status,omitempty"`
+	// ETag and LastModified are the validators the server sent, if any
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// DurationMs is how long the request took, including retries
+	DurationMs int64 `json:"durationMs"`
+	// Retries is how many times the request was retried
+	Retries int `json:"retries"`
+	// FinalURL is the URL the resource came from if the request was
+	// redirected, and Redirects is the chain of URLs it was redirected to
+	FinalURL  string   `json:"finalUrl,omitempty"`
+	Redirects []string `json:"redirects,omitempty"`
+	// Parent is the URL of the playlist that referenced the resource (empty
+	// for the top-level playlist)
+	Parent string `json:"parent,omitempty"`
+	// Skipped is true if an existing file was kept without fetching it
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// resourceRef describes how a resource was referenced.
+type resourceRef struct {
+	Parent string       // URL of the playlist that referenced the resource
+	Type   ResourceType // How the resource was referenced
+	// Segments is the type of the segments of a subtitle, I-frame or image
+	// playlist, and empty for any other resource
+	Segments ResourceType
+	// Unselected is true for the variants and renditions of a content
+	// steering pathway other than the one being downloaded
+	Unselected bool
+}
+
+// classifyReferences works out the ResourceType of every URL in a playlist.
+//
+// segments is the Segments type of the playlist itself: if set, all of its
+// segments get that type.
+func classifyReferences(m3u8 *M3U8File, parentURL string, segments ResourceType) map[string]resourceRef {
+	subtitleRenditions := make(map[string]bool)
+	for _, rendition := range m3u8.Renditions {
+		if rendition.Type == "SUBTITLES" && rendition.URL != "" {
+			subtitleRenditions[rendition.URL] = true
+		}
+	}
+
+	refs := make(map[string]resourceRef, len(m3u8.References))
+	for _, reference := range m3u8.References {
+		if _, ok := refs[reference.URL]; ok {
+			continue
+		}
+
+		ref := resourceRef{Parent: parentURL, Type: ResourceSegment}
+		switch {
+		case reference.Tag == "EXT-X-KEY" || reference.Tag == "EXT-X-SESSION-KEY":
+			ref.Type = ResourceKey
+		case reference.Tag == "EXT-X-MAP":
+			ref.Type = ResourceMap
+		case reference.Tag == "EXT-X-SESSION-DATA":
+			ref.Type = ResourceSessionData
+		case reference.Tag == "EXT-X-CONTENT-STEERING":
+			ref.Type = ResourceSteering
+		case reference.Tag == "EXT-X-MEDIA":
+			ref.Type = ResourcePlaylist
+			if subtitleRenditions[reference.URL] {
+				ref.Segments = ResourceSubtitle
+			}
+		case reference.Tag == "EXT-X-I-FRAME-STREAM-INF":
+			ref.Type, ref.Segments = ResourceIFrame, ResourceIFrame
+		case reference.Tag == "EXT-X-IMAGE-STREAM-INF":
+			ref.Type, ref.Segments = ResourceImage, ResourceImage
+		case m3u8.IsM3U8[reference.URL]:
+			ref.Type = ResourcePlaylist
+		case segments != "":
+			ref.Type = segments
+		case subtitleExtensions[urlExtension(reference.URL)]:
+			ref.Type = ResourceSubtitle
+		}
+		refs[reference.URL] = ref
+	}
+
+	return refs
+}
+
+// Manifest returns the manifest entries recorded during the download, sorted
+// by local path.
+func (d *Downloader) Manifest() []ManifestEntry {
+	d.manifestLock.Lock()
+	defer d.manifestLock.Unlock()
+
+	entries := make([]ManifestEntry, len(d.manifest))
+	copy(entries, d.manifest)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LocalPath < entries[j].LocalPath
+	})
+	return entries
+}
+
+// recordManifest adds an entry for a fetched resource to the manifest, if
+// enabled.
+func (d *Downloader) recordManifest(urlStr, localPath string, ref resourceRef, content []byte, resp *fetcher.Response, elapsed time.Duration) {
+	if !d.manifestEnabled {
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	entry := ManifestEntry{
+		URL:          urlStr,
+		LocalPath:    localPath,
+		Type:         ref.Type,
+		Size:         int64(len(content)),
+		SHA256:       hex.EncodeToString(sum[:]),
+		Status:       resp.StatusCode,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		DurationMs:   elapsed.Milliseconds(),
+		Retries:      resp.Retries,
+		Parent:       ref.Parent,
+		Redirects:    resp.Redirects,
+	}
+	if resp.URL != urlStr {
+		entry.FinalURL = resp.URL
+	}
+	d.addToManifest(entry)
+}
+
+// addToManifest appends an entry to the manifest, if enabled.
+func (d *Downloader) addToManifest(entry ManifestEntry) {
+	if !d.manifestEnabled {
+		return
+	}
+	d.manifestLock.Lock()
+	defer d.manifestLock.Unlock()
+	d.manifest = append(d.manifest, entry)
+}
+
+// WriteManifest writes manifest entries to a file.
+//
+// Files ending in .jsonl or .ndjson get one JSON object per line; anything
+// else gets a single indented JSON array.
+func WriteManifest(path string, entries []ManifestEntry) error {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for manifest: %w", err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create manifest: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return fmt.Errorf("failed to write manifest: %w", err)
+			}
+		}
+	default:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return f.Close()
+}
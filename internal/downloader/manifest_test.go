@@ -0,0 +1,132 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClassifyReferences(t *testing.T) {
+	baseURL, _ := url.Parse("https://example.com/video/master.m3u8")
+	content := `#EXTM3U
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",URI="session.json"
+#EXT-X-SESSION-KEY:METHOD=AES-128,URI="keys/session.bin"
+#EXT-X-CONTENT-STEERING:SERVER-URI="steering.json",PATHWAY-ID="CDN-A"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",URI="subs/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="English",URI="audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO="aud",SUBTITLES="subs"
+v1/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100,URI="v1/iframes.m3u8"
+#EXT-X-IMAGE-STREAM-INF:BANDWIDTH=10,URI="thumbs"
+`
+	m3u8, err := ParseM3U8([]byte(content), baseURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+
+	refs := classifyReferences(m3u8, baseURL.String(), "")
+	expected := map[string]resourceRef{
+		"https://example.com/video/subs/en.m3u8":     {Type: ResourcePlaylist, Segments: ResourceSubtitle},
+		"https://example.com/video/audio/en.m3u8":    {Type: ResourcePlaylist},
+		"https://example.com/video/v1/index.m3u8":    {Type: ResourcePlaylist},
+		"https://example.com/video/v1/iframes.m3u8":  {Type: ResourceIFrame, Segments: ResourceIFrame},
+		"https://example.com/video/thumbs":           {Type: ResourceImage, Segments: ResourceImage},
+		"https://example.com/video/session.json":     {Type: ResourceSessionData},
+		"https://example.com/video/keys/session.bin": {Type: ResourceKey},
+		"https://example.com/video/steering.json":    {Type: ResourceSteering},
+	}
+	for u, want := range expected {
+		want.Parent = baseURL.String()
+		if got := refs[u]; got != want {
+			t.Errorf("%s: expected %+v, got %+v", u, want, got)
+		}
+	}
+
+	mediaURL, _ := url.Parse("https://example.com/video/subs/en.m3u8")
+	media := `#EXTM3U
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10,
+seg1.m4s
+#EXTINF:10,
+seg2.vtt
+#EXT-X-ENDLIST
+`
+	m3u8, err = ParseM3U8([]byte(media), mediaURL)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+
+	// Segments of a subtitle rendition are subtitles whatever their extension
+	refs = classifyReferences(m3u8, mediaURL.String(), ResourceSubtitle)
+	if got := refs["https://example.com/video/subs/init.mp4"].Type; got != ResourceMap {
+		t.Errorf("init.mp4: expected %s, got %s", ResourceMap, got)
+	}
+	if got := refs["https://example.com/video/subs/key.bin"].Type; got != ResourceKey {
+		t.Errorf("key.bin: expected %s, got %s", ResourceKey, got)
+	}
+	if got := refs["https://example.com/video/subs/seg1.m4s"].Type; got != ResourceSubtitle {
+		t.Errorf("seg1.m4s: expected %s, got %s", ResourceSubtitle, got)
+	}
+
+	refs = classifyReferences(m3u8, mediaURL.String(), "")
+	if got := refs["https://example.com/video/subs/seg1.m4s"].Type; got != ResourceSegment {
+		t.Errorf("seg1.m4s: expected %s, got %s", ResourceSegment, got)
+	}
+	if got := refs["https://example.com/video/subs/seg2.vtt"].Type; got != ResourceSubtitle {
+		t.Errorf("seg2.vtt: expected %s, got %s", ResourceSubtitle, got)
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	entries := []ManifestEntry{
+		{URL: "https://example.com/a.m3u8", LocalPath: "a.m3u8", Type: ResourcePlaylist, Size: 10},
+		{URL: "https://example.com/a.ts", LocalPath: "a.ts", Type: ResourceSegment, Size: 20, Parent: "https://example.com/a.m3u8"},
+	}
+	dir := t.TempDir()
+
+	jsonPath := filepath.Join(dir, "manifest.json")
+	if err := WriteManifest(jsonPath, entries); err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var decoded []ManifestEntry
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Manifest is not a JSON array: %v", err)
+	}
+	if len(decoded) != 2 || !reflect.DeepEqual(decoded[1], entries[1]) {
+		t.Errorf("Expected %+v, got %+v", entries, decoded)
+	}
+
+	jsonlPath := filepath.Join(dir, "nested", "manifest.jsonl")
+	if err := WriteManifest(jsonlPath, entries); err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	f, err := os.Open(jsonlPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Line %d is not a JSON object: %v", lines+1, err)
+		}
+		if !reflect.DeepEqual(entry, entries[lines]) {
+			t.Errorf("Line %d: expected %+v, got %+v", lines+1, entries[lines], entry)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Expected 2 lines, got %d", lines)
+	}
+}
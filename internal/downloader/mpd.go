@@ -0,0 +1,759 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment addressing schemes of a Representation.
+const (
+	// AddressingTemplate builds segment URLs from a SegmentTemplate.
+	AddressingTemplate = "template"
+	// AddressingList lists segment URLs in a SegmentList.
+	AddressingList = "list"
+	// AddressingBase has the whole representation in a single file (its
+	// BaseURL), with an optional SegmentBase describing its index.
+	AddressingBase = "base"
+)
+
+// trickModeScheme marks an AdaptationSet as a trick-play (I-frame) track.
+const trickModeScheme = "http://dashif.org/guidelines/trickmode"
+
+// mpdNow returns the current time, against which the segments a live
+// manifest currently lists are worked out. Tests replace it.
+var mpdNow = time.Now
+
+// maxMPDSegments limits how many segments a single Representation can
+// expand to, so a bogus SegmentTimeline can't exhaust memory.
+const maxMPDSegments = 1 << 20
+
+// MPDFile is a parsed MPEG-DASH manifest.
+//
+// Every segment of every Representation is expanded into a resolved URL, so
+// the manifest can be downloaded exactly like an M3U8 playlist.
+type MPDFile struct {
+	// Dynamic is true for live (type="dynamic") manifests
+	Dynamic bool
+	// Periods are the periods of the presentation, in order
+	Periods []*MPDPeriod
+	// References are the resolved URLs of every initialization, index and
+	// media segment, in document order, including duplicates
+	References []string
+	// URLs lists each of References once, in the order first seen
+	URLs []string
+
+	root *xmlNode // The whole document, for rewriting
+	mpd  *xmlNode // The MPD element
+}
+
+// MPDPeriod is a Period of an MPD.
+type MPDPeriod struct {
+	ID string
+	// Start is when the period starts, and Duration how long it lasts (zero
+	// if unknown, as in live manifests)
+	Start    time.Duration
+	Duration time.Duration
+	// AdaptationSets are the adaptation sets of the period
+	AdaptationSets []*AdaptationSet
+
+	node *xmlNode
+	live *liveEdge // Set in live manifests that say when they started
+}
+
+// liveEdge is what it takes to work out which segments of a live
+// SegmentTemplate without a SegmentTimeline are currently available.
+type liveEdge struct {
+	// availabilityStart is the MPD@availabilityStartTime, which period
+	// starts are relative to
+	availabilityStart time.Time
+	// timeShiftBufferDepth is how long segments stay available after they
+	// were published, or zero if forever
+	timeShiftBufferDepth time.Duration
+	// now is the time the manifest was parsed
+	now time.Time
+}
+
+// AdaptationSet is an AdaptationSet of an MPD Period.
+type AdaptationSet struct {
+	ID          string
+	ContentType string
+	Lang        string
+	// Representations are the interchangeable encodings of the set
+	Representations []*Representation
+
+	node *xmlNode
+}
+
+// Representation is a Representation of an AdaptationSet, with its segments
+// expanded.
+type Representation struct {
+	ID        string
+	Bandwidth int64
+	Width     int
+	Height    int
+	Codecs    string
+	MimeType  string
+	// Type is the ResourceType of the representation's media segments
+	// (ResourceSegment, ResourceSubtitle, ResourceIFrame or ResourceImage)
+	Type ResourceType
+	// BaseURL is the resolved base URL of the representation
+	BaseURL *url.URL
+	// Addressing is how segments are addressed (e.g. AddressingTemplate)
+	Addressing string
+	// Timescale is the number of time units per second of segment times
+	Timescale uint64
+	// PresentationTimeOffset is the media time of the period start
+	PresentationTimeOffset uint64
+	// Init and Index are the initialization and index segments, if they are
+	// separate resources
+	Init  *MPDSegment
+	Index *MPDSegment
+	// Segments are the media segments, in order
+	Segments []MPDSegment
+
+	node *xmlNode
+}
+
+// MPDSegment is an initialization, index or media segment of a
+// Representation.
+type MPDSegment struct {
+	// URL is the resolved URL of the segment
+	URL string
+	// Ref is the reference as written (with template identifiers
+	// substituted), relative to the representation's BaseURL
+	Ref string
+	// Range is the byte range within URL ("first-last"), if any
+	Range string
+	// Number, Time and Duration are the segment's number and its start and
+	// duration in Timescale units (zero for initialization and index segments)
+	Number   uint64
+	Time     uint64
+	Duration uint64
+}
+
+// resources returns the initialization, index and media segments of a
+// representation, in that order.
+func (r *Representation) resources() []MPDSegment {
+	resources := make([]MPDSegment, 0, len(r.Segments)+2)
+	if r.Init != nil {
+		resources = append(resources, *r.Init)
+	}
+	if r.Index != nil {
+		resources = append(resources, *r.Index)
+	}
+	return append(resources, r.Segments...)
+}
+
+// ParseMPD parses an MPEG-DASH manifest and expands the segments of every
+// Representation.
+//
+// BaseURL elements are resolved level by level (MPD, Period, AdaptationSet,
+// Representation) starting from baseURL. Where a level has several BaseURLs
+// (redundant CDNs), the one whose serviceLocation is pathway is used, or else
+// the first. Segments are addressed by SegmentTemplate ($Number$ or $Time$,
+// with or without a SegmentTimeline), SegmentList or SegmentBase, with
+// attributes inherited from higher levels.
+//
+// Parameters:
+//   - content: The raw MPD content
+//   - baseURL: The URL the MPD was fetched from
+//   - pathway: The preferred BaseURL serviceLocation (may be empty)
+//
+// Returns the parsed manifest, or an error if it is not a valid MPD or a
+// representation's segments can't be worked out.
+//
+// See: https://dashif.org/docs/DASH-IF-IOP-v4.3.pdf
+func ParseMPD(content []byte, baseURL *url.URL, pathway string) (*MPDFile, error) {
+	root, err := parseXMLTree(content)
+	if err != nil {
+		return nil, err
+	}
+	mpdNode := root.element("MPD")
+	if mpdNode == nil {
+		return nil, errors.New("not an MPD: missing MPD element")
+	}
+
+	mpdType, _ := mpdNode.attr("type")
+	mpd := &MPDFile{Dynamic: mpdType == "dynamic", root: root, mpd: mpdNode}
+	presentationDuration, err := durationAttr(mpdNode, "mediaPresentationDuration")
+	if err != nil {
+		return nil, err
+	}
+	mpdBase := selectBaseURL(mpdNode, baseURL, pathway)
+
+	periodNodes := mpdNode.elements("Period")
+	for i, node := range periodNodes {
+		period := &MPDPeriod{node: node}
+		period.ID, _ = node.attr("id")
+		if period.Start, err = durationAttr(node, "start"); err != nil {
+			return nil, err
+		}
+		if _, ok := node.attr("start"); !ok && i > 0 {
+			previous := mpd.Periods[i-1]
+			period.Start = previous.Start + previous.Duration
+		}
+		if period.Duration, err = durationAttr(node, "duration"); err != nil {
+			return nil, err
+		}
+		mpd.Periods = append(mpd.Periods, period)
+	}
+	if mpd.Dynamic {
+		if err := setLiveEdge(mpd, mpdNode); err != nil {
+			return nil, err
+		}
+	}
+	// A period without a duration lasts until the next one starts, or until
+	// the end of the presentation
+	for i, period := range mpd.Periods {
+		if period.Duration != 0 {
+			continue
+		}
+		if i+1 < len(mpd.Periods) {
+			if next, err := durationAttr(periodNodes[i+1], "start"); err == nil && next > period.Start {
+				period.Duration = next - period.Start
+			}
+		} else if presentationDuration > period.Start {
+			period.Duration = presentationDuration - period.Start
+		}
+	}
+
+	for _, period := range mpd.Periods {
+		periodBase := selectBaseURL(period.node, mpdBase, pathway)
+		for _, asNode := range period.node.elements("AdaptationSet") {
+			set := &AdaptationSet{node: asNode}
+			set.ID, _ = asNode.attr("id")
+			set.ContentType, _ = asNode.attr("contentType")
+			set.Lang, _ = asNode.attr("lang")
+			setBase := selectBaseURL(asNode, periodBase, pathway)
+
+			for _, repNode := range asNode.elements("Representation") {
+				rep, err := parseRepresentation(repNode, asNode, period, selectBaseURL(repNode, setBase, pathway))
+				if err != nil {
+					return nil, err
+				}
+				set.Representations = append(set.Representations, rep)
+				for _, resource := range rep.resources() {
+					mpd.References = append(mpd.References, resource.URL)
+				}
+			}
+			period.AdaptationSets = append(period.AdaptationSets, set)
+		}
+	}
+
+	seen := make(map[string]bool, len(mpd.References))
+	for _, reference := range mpd.References {
+		if !seen[reference] {
+			seen[reference] = true
+			mpd.URLs = append(mpd.URLs, reference)
+		}
+	}
+	return mpd, nil
+}
+
+// setLiveEdge gives the periods of a live manifest what they need to work
+// out which segments are currently available, if the manifest says when it
+// started.
+func setLiveEdge(mpd *MPDFile, mpdNode *xmlNode) error {
+	value, ok := mpdNode.attr("availabilityStartTime")
+	if !ok {
+		return nil
+	}
+	start, err := parseXSDateTime(value)
+	if err != nil {
+		return fmt.Errorf("invalid availabilityStartTime %q", value)
+	}
+	depth, err := durationAttr(mpdNode, "timeShiftBufferDepth")
+	if err != nil {
+		return err
+	}
+	edge := &liveEdge{availabilityStart: start, timeShiftBufferDepth: depth, now: mpdNow()}
+	for _, period := range mpd.Periods {
+		period.live = edge
+	}
+	return nil
+}
+
+// parseXSDateTime parses an xs:dateTime, which may leave out the time zone
+// (taken to be UTC).
+func parseXSDateTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02T15:04:05.999999999", value)
+}
+
+// parseRepresentation parses a Representation and expands its segments.
+func parseRepresentation(node, set *xmlNode, period *MPDPeriod, base *url.URL) (*Representation, error) {
+	rep := &Representation{node: node, BaseURL: base}
+	rep.ID, _ = node.attr("id")
+	rep.Bandwidth, _ = strconv.ParseInt(inheritedAttr("bandwidth", node), 10, 64)
+	rep.Width, _ = strconv.Atoi(inheritedAttr("width", node, set))
+	rep.Height, _ = strconv.Atoi(inheritedAttr("height", node, set))
+	rep.Codecs = inheritedAttr("codecs", node, set)
+	rep.MimeType = inheritedAttr("mimeType", node, set)
+	rep.Type = representationType(set, rep)
+
+	// The lowest level that addresses segments decides how they are addressed
+	levels := []*xmlNode{node, set, period.node}
+	for _, level := range levels {
+		switch {
+		case level.element("SegmentTemplate") != nil:
+			rep.Addressing = AddressingTemplate
+		case level.element("SegmentList") != nil:
+			rep.Addressing = AddressingList
+		case level.element("SegmentBase") != nil:
+			rep.Addressing = AddressingBase
+		default:
+			continue
+		}
+		break
+	}
+
+	var err error
+	switch rep.Addressing {
+	case AddressingTemplate:
+		err = expandTemplate(rep, segmentElements(levels, "SegmentTemplate"), period)
+	case AddressingList:
+		err = expandList(rep, segmentElements(levels, "SegmentList"))
+	default:
+		rep.Addressing = AddressingBase
+		expandBase(rep, segmentElements(levels, "SegmentBase"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("representation %q: %w", rep.ID, err)
+	}
+	return rep, nil
+}
+
+// segmentElements returns the named child of each level that has one, from
+// the lowest level up, for attribute inheritance.
+func segmentElements(levels []*xmlNode, name string) []*xmlNode {
+	var elements []*xmlNode
+	for _, level := range levels {
+		if element := level.element(name); element != nil {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// inheritedAttr returns the value of an attribute from the first of nodes
+// that has it, or "".
+func inheritedAttr(name string, nodes ...*xmlNode) string {
+	for _, node := range nodes {
+		if value, ok := node.attr(name); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// inheritedChild returns the named child of the first of nodes that has
+// one, or nil.
+func inheritedChild(name string, nodes ...*xmlNode) *xmlNode {
+	for _, node := range nodes {
+		if child := node.element(name); child != nil {
+			return child
+		}
+	}
+	return nil
+}
+
+// representationType works out the ResourceType of a representation's media
+// segments from its AdaptationSet.
+func representationType(set *xmlNode, rep *Representation) ResourceType {
+	for _, name := range []string{"EssentialProperty", "SupplementalProperty"} {
+		for _, property := range set.elements(name) {
+			if scheme, _ := property.attr("schemeIdUri"); scheme == trickModeScheme {
+				return ResourceIFrame
+			}
+		}
+	}
+
+	contentType, _ := set.attr("contentType")
+	switch {
+	case contentType == "text" || strings.HasPrefix(rep.MimeType, "text/") ||
+		rep.MimeType == "application/ttml+xml" ||
+		strings.HasPrefix(rep.Codecs, "stpp") || strings.HasPrefix(rep.Codecs, "wvtt"):
+		return ResourceSubtitle
+	case contentType == "image" || strings.HasPrefix(rep.MimeType, "image/"):
+		return ResourceImage
+	default:
+		return ResourceSegment
+	}
+}
+
+// expandTemplate expands the segments of a SegmentTemplate. templates are
+// the SegmentTemplates of each level, lowest first.
+func expandTemplate(rep *Representation, templates []*xmlNode, period *MPDPeriod) error {
+	var err error
+	startNumber := uint64(1)
+	if value := inheritedAttr("startNumber", templates...); value != "" {
+		if startNumber, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("invalid startNumber %q", value)
+		}
+	}
+	if err := parseTiming(rep, templates); err != nil {
+		return err
+	}
+
+	if initTemplate := inheritedAttr("initialization", templates...); initTemplate != "" {
+		rep.Init = rep.segment(substitute(initTemplate, rep, 0, 0), "")
+	} else if init := inheritedChild("Initialization", templates...); init != nil {
+		rep.Init = rep.sourceSegment(init, "range")
+	}
+	if indexTemplate := inheritedAttr("index", templates...); indexTemplate != "" {
+		rep.Index = rep.segment(substitute(indexTemplate, rep, 0, 0), "")
+	}
+
+	media := inheritedAttr("media", templates...)
+	if media == "" {
+		return errors.New("SegmentTemplate without a media attribute")
+	}
+
+	times, err := segmentTimes(rep, templates, period, -1)
+	if err != nil {
+		return err
+	}
+	for _, t := range times {
+		number := startNumber + t.Index
+		segment := rep.segment(substitute(media, rep, number, t.Time), "")
+		segment.Number, segment.Time, segment.Duration = number, t.Time, t.Duration
+		rep.Segments = append(rep.Segments, *segment)
+	}
+	return nil
+}
+
+// expandList expands the segments of a SegmentList. lists are the
+// SegmentLists of each level, lowest first.
+func expandList(rep *Representation, lists []*xmlNode) error {
+	if err := parseTiming(rep, lists); err != nil {
+		return err
+	}
+	if init := inheritedChild("Initialization", lists...); init != nil {
+		rep.Init = rep.sourceSegment(init, "range")
+	}
+	if index := inheritedChild("RepresentationIndex", lists...); index != nil {
+		rep.Index = rep.sourceSegment(index, "range")
+	}
+
+	var segmentURLs []*xmlNode
+	for _, list := range lists {
+		if segmentURLs = list.elements("SegmentURL"); len(segmentURLs) > 0 {
+			break
+		}
+	}
+	times, err := segmentTimes(rep, lists, nil, len(segmentURLs))
+	if err != nil {
+		return err
+	}
+	for i, node := range segmentURLs {
+		media, _ := node.attr("media")
+		mediaRange, _ := node.attr("mediaRange")
+		segment := rep.segment(media, mediaRange)
+		segment.Number = uint64(i + 1)
+		if i < len(times) {
+			segment.Time, segment.Duration = times[i].Time, times[i].Duration
+		}
+		rep.Segments = append(rep.Segments, *segment)
+	}
+	return nil
+}
+
+// expandBase sets up a representation whose media is its BaseURL.
+func expandBase(rep *Representation, bases []*xmlNode) {
+	if init := inheritedChild("Initialization", bases...); init != nil {
+		if _, ok := init.attr("sourceURL"); ok {
+			rep.Init = rep.sourceSegment(init, "range")
+		}
+	}
+	if index := inheritedChild("RepresentationIndex", bases...); index != nil {
+		if _, ok := index.attr("sourceURL"); ok {
+			rep.Index = rep.sourceSegment(index, "range")
+		}
+	}
+	rep.Timescale = 1
+	rep.Segments = []MPDSegment{*rep.segment("", "")}
+}
+
+// parseTiming reads the timescale and presentationTimeOffset of a
+// representation from its segment elements, lowest level first.
+func parseTiming(rep *Representation, elements []*xmlNode) error {
+	rep.Timescale = 1
+	if value := inheritedAttr("timescale", elements...); value != "" {
+		timescale, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || timescale == 0 {
+			return fmt.Errorf("invalid timescale %q", value)
+		}
+		rep.Timescale = timescale
+	}
+	if value := inheritedAttr("presentationTimeOffset", elements...); value != "" {
+		offset, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid presentationTimeOffset %q", value)
+		}
+		rep.PresentationTimeOffset = offset
+	}
+	return nil
+}
+
+// segmentTime is the start and duration of a segment in timescale units.
+type segmentTime struct {
+	Time, Duration uint64
+	// Index is the position of the segment from the start of the
+	// representation (a live window need not start at zero)
+	Index uint64
+}
+
+// segmentTimes works out the start and duration of each segment from a
+// SegmentTimeline or a fixed duration.
+//
+// count is the number of segments if already known (from a SegmentList), or
+// -1 to work it out from the timeline, endNumber or the period's duration.
+// A live period without a duration gets the segments available right now,
+// from its availabilityStartTime and timeShiftBufferDepth.
+func segmentTimes(rep *Representation, elements []*xmlNode, period *MPDPeriod, count int) ([]segmentTime, error) {
+	if timeline := inheritedChild("SegmentTimeline", elements...); timeline != nil {
+		return timelineTimes(rep, timeline, period)
+	}
+
+	value := inheritedAttr("duration", elements...)
+	if value == "" {
+		if count >= 0 {
+			return nil, nil
+		}
+		return nil, errors.New("SegmentTemplate needs a duration or a SegmentTimeline")
+	}
+	duration, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || duration == 0 {
+		return nil, fmt.Errorf("invalid segment duration %q", value)
+	}
+
+	first := uint64(0)
+	if count < 0 {
+		if endNumber := inheritedAttr("endNumber", elements...); endNumber != "" {
+			end, err := strconv.ParseUint(endNumber, 10, 64)
+			startNumber := uint64(1)
+			if value := inheritedAttr("startNumber", elements...); value != "" {
+				startNumber, _ = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil || end < startNumber {
+				return nil, fmt.Errorf("invalid endNumber %q", endNumber)
+			}
+			count = int(end - startNumber + 1)
+		} else if period != nil && period.Duration > 0 {
+			units := period.Duration.Seconds() * float64(rep.Timescale)
+			count = int(math.Ceil(units/float64(duration) - 1e-9))
+		} else if period != nil && period.live != nil {
+			first, count = period.live.segmentRange(period.Start, secondsDuration(float64(duration)/float64(rep.Timescale)))
+		} else {
+			return nil, errors.New("can't tell how many segments there are: the period has no duration and the MPD no availabilityStartTime")
+		}
+	}
+	if count > maxMPDSegments {
+		return nil, fmt.Errorf("too many segments (%d)", count)
+	}
+
+	times := make([]segmentTime, count)
+	for i := range times {
+		index := first + uint64(i)
+		times[i] = segmentTime{Time: rep.PresentationTimeOffset + index*duration, Duration: duration, Index: index}
+	}
+	return times, nil
+}
+
+// segmentRange returns the index of the first segment of a period that is
+// still available and how many are available, for segments of a fixed
+// duration.
+//
+// A segment can be fetched once it has been published, at the end of its
+// time since the period started, until timeShiftBufferDepth after that.
+//
+// See: https://dashif.org/docs/DASH-IF-IOP-v4.3.pdf (section 4.3.2.2)
+func (e *liveEdge) segmentRange(periodStart, duration time.Duration) (uint64, int) {
+	elapsed := e.now.Sub(e.availabilityStart) - periodStart
+	if duration <= 0 {
+		return 0, 0
+	}
+	published := int64(elapsed / duration)
+	if published <= 0 {
+		return 0, 0
+	}
+	first := int64(0)
+	if e.timeShiftBufferDepth > 0 && elapsed > e.timeShiftBufferDepth {
+		// Segment k is gone once (k+1)*duration+depth has passed
+		first = max(int64((elapsed-e.timeShiftBufferDepth+duration-1)/duration)-1, 0)
+	}
+	return uint64(first), int(max(published-first, 0))
+}
+
+// timelineTimes expands the S elements of a SegmentTimeline.
+//
+// A negative repeat count repeats the segment until the next S element's
+// start or, for the last one, the end of the period.
+func timelineTimes(rep *Representation, timeline *xmlNode, period *MPDPeriod) ([]segmentTime, error) {
+	var times []segmentTime
+	entries := timeline.elements("S")
+	next := uint64(0)
+	for i, entry := range entries {
+		if value, ok := entry.attr("t"); ok {
+			t, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid S@t %q", value)
+			}
+			next = t
+		}
+		value, _ := entry.attr("d")
+		duration, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || duration == 0 {
+			return nil, fmt.Errorf("invalid S@d %q", value)
+		}
+
+		repeat := int64(0)
+		if value, ok := entry.attr("r"); ok {
+			if repeat, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid S@r %q", value)
+			}
+		}
+		if repeat < 0 {
+			end := uint64(0)
+			if i+1 < len(entries) {
+				if value, ok := entries[i+1].attr("t"); ok {
+					end, _ = strconv.ParseUint(value, 10, 64)
+				}
+			} else if period != nil && period.Duration > 0 {
+				end = rep.PresentationTimeOffset + uint64(math.Round(period.Duration.Seconds()*float64(rep.Timescale)))
+			}
+			repeat = 0
+			if end > next {
+				repeat = int64((end-next+duration-1)/duration) - 1
+			}
+		}
+
+		if len(times)+int(repeat)+1 > maxMPDSegments {
+			return nil, fmt.Errorf("too many segments in SegmentTimeline")
+		}
+		for j := int64(0); j <= repeat; j++ {
+			times = append(times, segmentTime{Time: next, Duration: duration, Index: uint64(len(times))})
+			next += duration
+		}
+	}
+	return times, nil
+}
+
+// segment creates a segment for a reference relative to the
+// representation's BaseURL. An empty reference is the BaseURL itself.
+func (r *Representation) segment(ref, byteRange string) *MPDSegment {
+	segment := &MPDSegment{Ref: ref, Range: byteRange, URL: r.BaseURL.String()}
+	if ref != "" {
+		segment.URL = resolveURL(r.BaseURL, ref)
+	}
+	return segment
+}
+
+// sourceSegment creates a segment from an Initialization or
+// RepresentationIndex element's sourceURL and range attributes.
+func (r *Representation) sourceSegment(node *xmlNode, rangeAttr string) *MPDSegment {
+	source, _ := node.attr("sourceURL")
+	byteRange, _ := node.attr(rangeAttr)
+	return r.segment(source, byteRange)
+}
+
+// templateIdentifier matches a SegmentTemplate identifier such as $Number$,
+// $Number%05d$ or $$.
+var templateIdentifier = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time|SubNumber)?(?:%0(\d+)d)?\$`)
+
+// substitute replaces the identifiers of a SegmentTemplate attribute.
+//
+// See: https://dashif.org/docs/DASH-IF-IOP-v4.3.pdf (SegmentTemplate)
+func substitute(template string, rep *Representation, number, t uint64) string {
+	return templateIdentifier.ReplaceAllStringFunc(template, func(match string) string {
+		parts := templateIdentifier.FindStringSubmatch(match)
+		var value uint64
+		switch parts[1] {
+		case "":
+			return "$"
+		case "RepresentationID":
+			return rep.ID
+		case "Number", "SubNumber":
+			value = number
+		case "Bandwidth":
+			value = uint64(rep.Bandwidth)
+		case "Time":
+			value = t
+		}
+		width, _ := strconv.Atoi(parts[2])
+		return fmt.Sprintf("%0*d", width, value)
+	})
+}
+
+// selectBaseURL resolves the BaseURL of an element against its parent's
+// base. With several BaseURLs, the one whose serviceLocation is pathway wins,
+// or else the first. Without any, the parent's base is returned.
+func selectBaseURL(node *xmlNode, parent *url.URL, pathway string) *url.URL {
+	bases := node.elements("BaseURL")
+	if len(bases) == 0 {
+		return parent
+	}
+	chosen := bases[0]
+	if pathway != "" {
+		for _, base := range bases {
+			if location, _ := base.attr("serviceLocation"); location == pathway {
+				chosen = base
+				break
+			}
+		}
+	}
+
+	ref, err := url.Parse(chosen.text())
+	if err != nil {
+		return parent
+	}
+	return parent.ResolveReference(ref)
+}
+
+// isoDuration matches an xs:duration such as PT1H2M3.5S or P1DT12H.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)Y)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration parses an xs:duration. Years and months count as 365 and
+// 30 days, which is good enough for the durations found in MPDs.
+func parseISODuration(s string) (time.Duration, error) {
+	parts := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if parts == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total float64
+	for i, unit := range units {
+		if parts[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(parts[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += value * float64(unit)
+	}
+	return time.Duration(math.Round(total)), nil
+}
+
+// durationAttr parses an optional xs:duration attribute, returning zero if
+// it isn't present.
+func durationAttr(node *xmlNode, name string) (time.Duration, error) {
+	value, ok := node.attr(name)
+	if !ok {
+		return 0, nil
+	}
+	d, err := parseISODuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,270 @@
+package downloader
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// segmentRefs returns the references of a representation's media segments.
+func segmentRefs(rep *Representation) []string {
+	refs := make([]string, len(rep.Segments))
+	for i, segment := range rep.Segments {
+		refs[i] = segment.Ref
+	}
+	return refs
+}
+
+func TestParseMPD(t *testing.T) {
+	base, _ := url.Parse("https://example.com/video/manifest.mpd")
+
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT20S">
+  <BaseURL serviceLocation="cdn-a">https://a.example.com/</BaseURL>
+  <BaseURL serviceLocation="cdn-b">https://b.example.com/</BaseURL>
+  <Period id="p0">
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <SegmentTemplate timescale="1000" duration="4000" startNumber="1" initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%05d$.m4s"/>
+      <Representation id="720p" bandwidth="3000000" width="1280" height="720" codecs="avc1.64001f"/>
+      <Representation id="1080p" bandwidth="6000000" width="1920" height="1080">
+        <BaseURL>hd/</BaseURL>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" lang="en" mimeType="audio/mp4">
+      <Representation id="audio" bandwidth="128000">
+        <SegmentTemplate timescale="48000" initialization="a/init.mp4" media="a/$Time$.m4s">
+          <SegmentTimeline>
+            <S t="0" d="96000" r="2"/>
+            <S d="48000" r="-1"/>
+          </SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="text" mimeType="application/mp4" lang="en">
+      <Representation id="subs" bandwidth="1000">
+        <SegmentList duration="10" timescale="1">
+          <Initialization sourceURL="subs/init.mp4"/>
+          <SegmentURL media="subs/0.m4s"/>
+          <SegmentURL media="subs/1.m4s"/>
+        </SegmentList>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <EssentialProperty schemeIdUri="http://dashif.org/guidelines/trickmode" value="1"/>
+      <Representation id="trick" bandwidth="100000">
+        <BaseURL>trick.mp4</BaseURL>
+        <SegmentBase indexRange="800-1199">
+          <Initialization range="0-799"/>
+        </SegmentBase>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+	mpd, err := ParseMPD([]byte(content), base, "cdn-b")
+	if err != nil {
+		t.Fatalf("ParseMPD failed: %v", err)
+	}
+	if mpd.Dynamic {
+		t.Error("Expected a static manifest")
+	}
+	if len(mpd.Periods) != 1 || mpd.Periods[0].Duration != 20*time.Second {
+		t.Fatalf("Expected one 20s period, got %+v", mpd.Periods)
+	}
+	sets := mpd.Periods[0].AdaptationSets
+	if len(sets) != 4 {
+		t.Fatalf("Expected 4 adaptation sets, got %d", len(sets))
+	}
+
+	// Template with a duration, inherited from the adaptation set
+	sd := sets[0].Representations[0]
+	if sd.Addressing != AddressingTemplate || sd.Type != ResourceSegment || sd.Width != 1280 || sd.Codecs != "avc1.64001f" {
+		t.Errorf("Unexpected representation: %+v", sd)
+	}
+	if sd.Init == nil || sd.Init.URL != "https://b.example.com/720p/init.mp4" {
+		t.Errorf("Unexpected initialization segment: %+v", sd.Init)
+	}
+	expected := []string{"720p/seg-00001.m4s", "720p/seg-00002.m4s", "720p/seg-00003.m4s", "720p/seg-00004.m4s", "720p/seg-00005.m4s"}
+	if got := segmentRefs(sd); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Segments = %v; expected %v", got, expected)
+	}
+	hd := sets[0].Representations[1]
+	if hd.Segments[0].URL != "https://b.example.com/hd/1080p/seg-00001.m4s" {
+		t.Errorf("Expected the representation's BaseURL to apply, got %s", hd.Segments[0].URL)
+	}
+
+	// Template with a timeline, the last S repeated to the end of the period
+	audio := sets[1].Representations[0]
+	expected = []string{"a/0.m4s", "a/96000.m4s", "a/192000.m4s", "a/288000.m4s", "a/336000.m4s", "a/384000.m4s", "a/432000.m4s", "a/480000.m4s", "a/528000.m4s", "a/576000.m4s", "a/624000.m4s", "a/672000.m4s", "a/720000.m4s", "a/768000.m4s", "a/816000.m4s", "a/864000.m4s", "a/912000.m4s"}
+	if got := segmentRefs(audio); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Segments = %v; expected %v", got, expected)
+	}
+	if sets[1].Lang != "en" || sets[1].ContentType != "audio" {
+		t.Errorf("Unexpected adaptation set: %+v", sets[1])
+	}
+
+	// Segment list
+	subs := sets[2].Representations[0]
+	if subs.Addressing != AddressingList || subs.Type != ResourceSubtitle {
+		t.Errorf("Expected a subtitle segment list, got %s %s", subs.Addressing, subs.Type)
+	}
+	if subs.Init == nil || subs.Init.Ref != "subs/init.mp4" || !reflect.DeepEqual(segmentRefs(subs), []string{"subs/0.m4s", "subs/1.m4s"}) {
+		t.Errorf("Unexpected segments: %+v %v", subs.Init, segmentRefs(subs))
+	}
+	if subs.Segments[1].Time != 10 || subs.Segments[1].Duration != 10 {
+		t.Errorf("Unexpected timing: %+v", subs.Segments[1])
+	}
+
+	// Segment base, in a trick mode adaptation set
+	trick := sets[3].Representations[0]
+	if trick.Addressing != AddressingBase || trick.Type != ResourceIFrame {
+		t.Errorf("Expected a trick mode single file, got %s %s", trick.Addressing, trick.Type)
+	}
+	if trick.Init != nil || trick.Index != nil {
+		t.Errorf("Expected byte ranges of the media file not to be separate resources: %+v %+v", trick.Init, trick.Index)
+	}
+	if len(trick.Segments) != 1 || trick.Segments[0].URL != "https://b.example.com/trick.mp4" {
+		t.Errorf("Unexpected segments: %+v", trick.Segments)
+	}
+	if len(mpd.URLs) != len(mpd.References) || mpd.URLs[0] != sd.Init.URL {
+		t.Errorf("Expected every reference once, in document order: %v", mpd.URLs)
+	}
+}
+
+func TestParseMPDBaseURLPathway(t *testing.T) {
+	base, _ := url.Parse("https://example.com/manifest.mpd")
+	content := `<MPD type="static" mediaPresentationDuration="PT4S">
+  <BaseURL serviceLocation="cdn-a">https://a.example.com/</BaseURL>
+  <BaseURL serviceLocation="cdn-b">https://b.example.com/</BaseURL>
+  <Period><AdaptationSet><Representation id="v" bandwidth="1">
+    <SegmentList duration="4"><SegmentURL media="s.m4s"/></SegmentList>
+  </Representation></AdaptationSet></Period>
+</MPD>`
+
+	tests := []struct {
+		pathway  string
+		expected string
+	}{
+		{"", "https://a.example.com/s.m4s"},
+		{"cdn-b", "https://b.example.com/s.m4s"},
+		{"cdn-x", "https://a.example.com/s.m4s"},
+	}
+	for _, tt := range tests {
+		mpd, err := ParseMPD([]byte(content), base, tt.pathway)
+		if err != nil {
+			t.Fatalf("ParseMPD failed: %v", err)
+		}
+		if !reflect.DeepEqual(mpd.URLs, []string{tt.expected}) {
+			t.Errorf("Pathway %q: URLs = %v; expected [%s]", tt.pathway, mpd.URLs, tt.expected)
+		}
+	}
+}
+
+func TestParseMPDLiveTemplate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(now func() time.Time) { mpdNow = now }(mpdNow)
+	mpdNow = func() time.Time { return start.Add(71 * time.Second) }
+
+	content := `<MPD type="dynamic" availabilityStartTime="2024-01-01T00:00:00Z" timeShiftBufferDepth="PT20S">
+  <Period start="PT10S"><AdaptationSet><Representation id="v">
+    <SegmentTemplate timescale="1000" duration="4000" startNumber="10" media="$Number$.m4s"/>
+  </Representation></AdaptationSet></Period>
+</MPD>`
+	base, _ := url.Parse("https://example.com/live/manifest.mpd")
+	mpd, err := ParseMPD([]byte(content), base, "")
+	if err != nil {
+		t.Fatalf("ParseMPD failed: %v", err)
+	}
+
+	// 61s into the period, segments 0-14 have been published and 0-9 have
+	// left the 20s time shift buffer
+	rep := mpd.Periods[0].AdaptationSets[0].Representations[0]
+	expected := []string{"20.m4s", "21.m4s", "22.m4s", "23.m4s", "24.m4s"}
+	if refs := segmentRefs(rep); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Segments = %v; expected %v", refs, expected)
+	}
+	if rep.Segments[0].Time != 40000 {
+		t.Errorf("First segment time = %d; expected 40000", rep.Segments[0].Time)
+	}
+}
+
+func TestParseMPDErrors(t *testing.T) {
+	base, _ := url.Parse("https://example.com/manifest.mpd")
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"not XML", "#EXTM3U\n"},
+		{"not an MPD", "<Playlist/>"},
+		{"unknown period duration", `<MPD type="dynamic"><Period><AdaptationSet><Representation id="v">
+  <SegmentTemplate duration="4" media="$Number$.m4s"/></Representation></AdaptationSet></Period></MPD>`},
+		{"invalid duration", `<MPD mediaPresentationDuration="20 seconds"><Period/></MPD>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseMPD([]byte(tt.content), base, ""); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	rep := &Representation{ID: "video-1", Bandwidth: 500000}
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"$RepresentationID$/$Number$.m4s", "video-1/7.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00007.m4s"},
+		{"$Bandwidth$/$Time$.m4s", "500000/90000.m4s"},
+		{"cost$$.m4s", "cost$.m4s"},
+	}
+	for _, tt := range tests {
+		if got := substitute(tt.template, rep, 7, 90000); got != tt.expected {
+			t.Errorf("substitute(%q) = %q; expected %q", tt.template, got, tt.expected)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"PT20S", 20 * time.Second, false},
+		{"PT1H2M3.5S", time.Hour + 2*time.Minute + 3500*time.Millisecond, false},
+		{"P1DT1S", 24*time.Hour + time.Second, false},
+		{"PT0S", 0, false},
+		{"20", 0, true},
+		{"PT", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("parseISODuration(%q) = %v, %v; expected %v", tt.input, got, err, tt.expected)
+		}
+	}
+}
+
+func TestIsMPDContent(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected bool
+	}{
+		{`<?xml version="1.0"?>` + "\n<MPD/>", true},
+		{"\ufeff  <MPD type=\"static\">", true},
+		{`<dash:MPD xmlns:dash="urn:mpeg:dash:schema:mpd:2011"/>`, true},
+		{"#EXTM3U\n", false},
+		{"<html></html>", false},
+		{strings.Repeat(" ", 10) + "text", false},
+	}
+	for _, tt := range tests {
+		if got := IsMPDContent([]byte(tt.content)); got != tt.expected {
+			t.Errorf("IsMPDContent(%q) = %v; expected %v", tt.content, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// PlannedFile is a file a dry run found that a real download would write.
+type PlannedFile struct {
+	// URL is the URL the file would be downloaded from
+	URL string `json:"url"`
+	// LocalPath is where the file would be written
+	LocalPath string `json:"localPath"`
+	// Playlist is true for M3U8 playlists
+	Playlist bool `json:"playlist,omitempty"`
+	// Size is the file size in bytes, or -1 if unknown. Playlists and files
+	// that had to be fetched to tell whether they are playlists have a known
+	// size; other files only have a size if it was looked up with a HEAD
+	// request.
+	Size int64 `json:"size"`
+}
+
+// Plan returns the files found by a dry run, sorted by local path.
+func (d *Downloader) Plan() []PlannedFile {
+	d.planLock.Lock()
+	defer d.planLock.Unlock()
+
+	plan := make([]PlannedFile, len(d.plan))
+	copy(plan, d.plan)
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].LocalPath < plan[j].LocalPath
+	})
+	return plan
+}
+
+// planURL records a non-playlist file in the dry-run plan, looking up its
+// size if enabled.
+//
+// A plain URI line whose extension doesn't say it is media may be a playlist
+// served under any name, so it is fetched and sniffed exactly like a real
+// download would; playlists found this way are planned with their contents.
+// Other files are only looked up with a HEAD request, and a failed HEAD only
+// leaves the size unknown, since many servers don't support HEAD for segments
+// they happily serve with GET.
+func (d *Downloader) planURL(ctx context.Context, urlStr string, ref resourceRef) error {
+	localPath, err := d.fs.GetLocalPath(urlStr)
+	if err != nil {
+		return err
+	}
+	file := PlannedFile{
+		URL:       urlStr,
+		LocalPath: localPath,
+		Size:      -1,
+	}
+
+	if ref.Type == ResourceSegment && !mediaExtensions[urlExtension(urlStr)] {
+		start := time.Now()
+		resp, err := d.fetcher.FetchResponse(ctx, urlStr)
+		if err != nil {
+			return err
+		}
+		if isPlaylistResponse(resp) || isMPDResponse(urlStr, resp) {
+			d.progress.PrintVerbose("Detected playlist: %s", urlStr)
+			ref.Type = ResourcePlaylist
+			return d.processM3U8(ctx, urlStr, ref, resp, time.Since(start))
+		}
+		file.Size = int64(len(resp.Body))
+	} else if d.dryRunSizes {
+		resp, err := d.fetcher.Head(ctx, urlStr)
+		if err != nil {
+			d.progress.PrintVerbose("Could not get size of %s: %v", urlStr, err)
+		} else {
+			file.Size = resp.ContentLength
+		}
+	}
+
+	d.addToPlan(file)
+	return nil
+}
+
+// addToPlan appends a file to the dry-run plan.
+func (d *Downloader) addToPlan(file PlannedFile) {
+	d.planLock.Lock()
+	defer d.planLock.Unlock()
+	d.plan = append(d.plan, file)
+}
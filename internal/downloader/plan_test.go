@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDryRunPlansWithoutWriting(t *testing.T) {
+	files := map[string]string{
+		"/master.m3u8": "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nv1/index.m3u8\n",
+		"/v1/index.m3u8": "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n" +
+			"#EXTINF:10,\ns0.ts\n#EXTINF:10,\ns1.vtt\n#EXT-X-ENDLIST\n",
+		"/v1/key.bin": "0123456789abcdef",
+		"/v1/s0.ts":   "segment",
+	}
+	var gets atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && filepath.Ext(r.URL.Path) != ".m3u8" {
+			gets.Add(1)
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	d := New(Config{
+		OutputDir:   outputDir,
+		Concurrency: 2,
+		RewriteURLs: true,
+		Exclude:     []string{".vtt"},
+		DryRun:      true,
+		DryRunSizes: true,
+	})
+	if err := d.Download(context.Background(), srv.URL+"/master.m3u8"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if gets.Load() != 0 {
+		t.Errorf("Expected no segments to be fetched, got %d GET requests", gets.Load())
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be written, but %s exists", outputDir)
+	}
+
+	expected := []PlannedFile{
+		{URL: srv.URL + "/master.m3u8", LocalPath: filepath.Join(outputDir, "master.m3u8"), Playlist: true, Size: int64(len(files["/master.m3u8"]))},
+		{URL: srv.URL + "/v1/index.m3u8", LocalPath: filepath.Join(outputDir, "v1", "index.m3u8"), Playlist: true, Size: int64(len(files["/v1/index.m3u8"]))},
+		{URL: srv.URL + "/v1/key.bin", LocalPath: filepath.Join(outputDir, "v1", "key.bin"), Size: 16},
+		{URL: srv.URL + "/v1/s0.ts", LocalPath: filepath.Join(outputDir, "v1", "s0.ts"), Size: 7},
+	}
+	plan := d.Plan()
+	if len(plan) != len(expected) {
+		t.Fatalf("Expected %d planned files, got %d: %+v", len(expected), len(plan), plan)
+	}
+	for i, want := range expected {
+		if plan[i] != want {
+			t.Errorf("Planned file %d: expected %+v, got %+v", i, want, plan[i])
+		}
+	}
+}
+
+func TestDryRunSniffsExtensionlessPlaylists(t *testing.T) {
+	files := map[string]string{
+		"/master.m3u8":    "#EXTM3U\n#EXTINF:10,\nstream/variant\n#EXT-X-ENDLIST\n",
+		"/stream/variant": "#EXTM3U\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n",
+		"/stream/s0.ts":   "segment",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	d := New(Config{
+		OutputDir:   outputDir,
+		Concurrency: 2,
+		DryRun:      true,
+	})
+	if err := d.Download(context.Background(), srv.URL+"/master.m3u8"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	expected := []PlannedFile{
+		{URL: srv.URL + "/master.m3u8", LocalPath: filepath.Join(outputDir, "master.m3u8"), Playlist: true, Size: int64(len(files["/master.m3u8"]))},
+		{URL: srv.URL + "/stream/s0.ts", LocalPath: filepath.Join(outputDir, "stream", "s0.ts"), Size: -1},
+		{URL: srv.URL + "/stream/variant", LocalPath: filepath.Join(outputDir, "stream", "variant"), Playlist: true, Size: int64(len(files["/stream/variant"]))},
+	}
+	plan := d.Plan()
+	if len(plan) != len(expected) {
+		t.Fatalf("Expected %d planned files, got %d: %+v", len(expected), len(plan), plan)
+	}
+	for i, want := range expected {
+		if plan[i] != want {
+			t.Errorf("Planned file %d: expected %+v, got %+v", i, want, plan[i])
+		}
+	}
+}
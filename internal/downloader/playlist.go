@@ -0,0 +1,170 @@
+package downloader
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Variant is a variant stream of a master playlist, from #EXT-X-STREAM-INF,
+// #EXT-X-I-FRAME-STREAM-INF or #EXT-X-IMAGE-STREAM-INF.
+type Variant struct {
+	// URL is the resolved URL of the variant's media playlist
+	URL string
+	// Bandwidth is the peak bit rate in bits per second
+	Bandwidth int64
+	// AverageBandwidth is the average bit rate in bits per second, if given
+	AverageBandwidth int64
+	// Codecs is the CODECS attribute (e.g. "avc1.4d401f,mp4a.40.2")
+	Codecs string
+	// Resolution is the RESOLUTION attribute (e.g. "1920x1080")
+	Resolution string
+	// FrameRate is the maximum frame rate, if given
+	FrameRate float64
+	// Audio, Video, Subtitles and ClosedCaptions are rendition group IDs
+	Audio          string
+	Video          string
+	Subtitles      string
+	ClosedCaptions string
+	// IFrame is true for #EXT-X-I-FRAME-STREAM-INF variants
+	IFrame bool
+	// Image is true for #EXT-X-IMAGE-STREAM-INF variants, whose media
+	// playlists list thumbnail images (often tiled, see #EXT-X-TILES)
+	Image bool
+	// PathwayID is the content steering pathway the variant belongs to
+	// (empty means the default pathway, ".")
+	PathwayID string
+	// Attributes holds every attribute of the tag
+	Attributes map[string]string
+}
+
+// ContentSteering is the #EXT-X-CONTENT-STEERING tag of a master playlist.
+type ContentSteering struct {
+	// URL is the resolved SERVER-URI of the steering manifest
+	URL string
+	// PathwayID is the pathway to use until the steering manifest has been
+	// loaded, if given
+	PathwayID string
+}
+
+// DateRange is an #EXT-X-DATERANGE tag of a media playlist.
+type DateRange struct {
+	ID    string
+	Class string
+	// StartDate and EndDate are when the range starts and, if given, ends
+	StartDate time.Time
+	EndDate   time.Time
+	// Duration and PlannedDuration are in seconds, or zero if not given
+	Duration        float64
+	PlannedDuration float64
+	// EndOnNext is true if the range ends where the next range of its
+	// class starts
+	EndOnNext bool
+	// Cue is the CUE attribute of an interstitial (e.g. ["PRE", "ONCE"])
+	Cue []string
+	// SCTE35Out, SCTE35In and SCTE35Cmd are the decoded SCTE-35 attributes,
+	// or nil if absent or undecodable
+	SCTE35Out *SpliceInfo
+	SCTE35In  *SpliceInfo
+	SCTE35Cmd *SpliceInfo
+	// Attributes holds every attribute of the tag
+	Attributes map[string]string
+}
+
+// Rendition is an alternative rendition from #EXT-X-MEDIA.
+type Rendition struct {
+	// URL is the resolved URL of the rendition's media playlist, or empty
+	// if the rendition is muxed into the variants
+	URL string
+	// Type is AUDIO, VIDEO, SUBTITLES or CLOSED-CAPTIONS
+	Type string
+	// GroupID is the group the rendition belongs to
+	GroupID string
+	// Language is the primary language (e.g. "en"), if given
+	Language string
+	// Name is the human-readable name
+	Name string
+	// Default and Autoselect are the DEFAULT and AUTOSELECT attributes
+	Default    bool
+	Autoselect bool
+	// Attributes holds every attribute of the tag
+	Attributes map[string]string
+}
+
+// Segment is a media segment of a media playlist.
+type Segment struct {
+	// URL is the resolved URL of the segment
+	URL string
+	// Duration is the #EXTINF duration in seconds
+	Duration float64
+	// Title is the optional #EXTINF title
+	Title string
+	// ByteRange is the sub-range of the resource, if any
+	ByteRange *ByteRange
+	// KeyMethod and KeyURL describe the EXT-X-KEY in effect (empty if
+	// unencrypted)
+	KeyMethod string
+	KeyURL    string
+	// MapURL and MapByteRange describe the EXT-X-MAP in effect, if any
+	MapURL       string
+	MapByteRange *ByteRange
+	// Discontinuity is true if the segment follows an EXT-X-DISCONTINUITY
+	Discontinuity bool
+	// ProgramDateTime is the EXT-X-PROGRAM-DATE-TIME of the segment, if given
+	ProgramDateTime time.Time
+	// AdMarkers are the ad marker tags in front of the segment (e.g.
+	// #EXT-X-CUE-OUT)
+	AdMarkers []AdMarker
+	// Line is the 1-based line number of the segment's URI
+	Line int
+}
+
+// IsMaster reports whether the playlist is a master playlist.
+func (m *M3U8File) IsMaster() bool {
+	return len(m.Variants) > 0 || (len(m.Renditions) > 0 && len(m.Segments) == 0)
+}
+
+// Duration returns the total duration of all segments in seconds.
+func (m *M3U8File) Duration() float64 {
+	total := 0.0
+	for _, segment := range m.Segments {
+		total += segment.Duration
+	}
+	return total
+}
+
+// newVariant builds a Variant from the attributes of a stream tag.
+func newVariant(attrs map[string]string, iframe bool) Variant {
+	v := Variant{
+		Codecs:         attrs["CODECS"],
+		Resolution:     attrs["RESOLUTION"],
+		Audio:          attrs["AUDIO"],
+		Video:          attrs["VIDEO"],
+		Subtitles:      attrs["SUBTITLES"],
+		ClosedCaptions: attrs["CLOSED-CAPTIONS"],
+		PathwayID:      attrs["PATHWAY-ID"],
+		IFrame:         iframe,
+		Attributes:     attrs,
+	}
+	v.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+	v.AverageBandwidth, _ = strconv.ParseInt(attrs["AVERAGE-BANDWIDTH"], 10, 64)
+	v.FrameRate, _ = strconv.ParseFloat(attrs["FRAME-RATE"], 64)
+	return v
+}
+
+// newRendition builds a Rendition from the attributes of an #EXT-X-MEDIA tag.
+func newRendition(attrs map[string]string, baseURL *url.URL) Rendition {
+	r := Rendition{
+		Type:       attrs["TYPE"],
+		GroupID:    attrs["GROUP-ID"],
+		Language:   attrs["LANGUAGE"],
+		Name:       attrs["NAME"],
+		Default:    attrs["DEFAULT"] == "YES",
+		Autoselect: attrs["AUTOSELECT"] == "YES",
+		Attributes: attrs,
+	}
+	if uri, ok := attrs["URI"]; ok {
+		r.URL = resolveURL(baseURL, uri)
+	}
+	return r
+}
@@ -1,11 +1,70 @@
 package downloader
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"os"
 	"sync"
 	"time"
 )
 
+// ProgressMode selects how a ProgressTracker reports progress.
+type ProgressMode string
+
+const (
+	// ProgressText redraws a single status line with carriage returns and
+	// ends with a summary box. It is meant for terminals.
+	ProgressText ProgressMode = "text"
+	// ProgressPlain prints a new status line every few seconds and a
+	// one-line summary, without control characters. It is meant for logs.
+	ProgressPlain ProgressMode = "plain"
+	// ProgressJSON writes newline-delimited ProgressEvent records.
+	ProgressJSON ProgressMode = "json"
+	// ProgressNone prints nothing.
+	ProgressNone ProgressMode = "none"
+)
+
+// ParseProgressMode parses a --progress flag value.
+func ParseProgressMode(s string) (ProgressMode, error) {
+	switch mode := ProgressMode(s); mode {
+	case ProgressText, ProgressPlain, ProgressJSON, ProgressNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid progress mode %q: must be one of text, plain, json, none", s)
+}
+
+// progressIntervals is the minimum time between status updates in each mode.
+var progressIntervals = map[ProgressMode]time.Duration{
+	ProgressPlain: 5 * time.Second,
+	ProgressJSON:  time.Second,
+}
+
+// ProgressEvent is one record of ProgressJSON output.
+//
+// Event is one of:
+//   - "start": the download of URL started
+//   - "file": a file was written (URL, Path, Type, Size)
+//   - "skip": an existing file was kept (URL, Path, Type)
+//   - "progress": a periodic snapshot of the counters (Stats)
+//   - "log": a verbose message (Message)
+//   - "warning": a problem that did not stop the download (Message)
+//   - "error": the download failed (Message, Stats)
+//   - "summary": the download finished (Stats)
+//   - "job": a batch job finished (URL, Path of its output directory,
+//     Message if it failed, Stats)
+type ProgressEvent struct {
+	Event   string       `json:"event"`
+	Time    time.Time    `json:"time"`
+	URL     string       `json:"url,omitempty"`
+	Path    string       `json:"path,omitempty"`
+	Type    ResourceType `json:"type,omitempty"`
+	Size    int64        `json:"size,omitempty"`
+	Message string       `json:"message,omitempty"`
+	*Stats
+}
+
 // ProgressTracker tracks download progress and provides formatted output.
 //
 // This structure maintains statistics about the download process including
@@ -24,28 +83,77 @@ type ProgressTracker struct {
 	// Byte counts
 	downloadedBytes int64
 
+	// Deduplication
+	dedupedFiles int
+	dedupedBytes int64
+
 	// Timing
 	startTime time.Time
 
-	// Display
-	enabled bool
-	verbose bool
+	// Display (counters are kept even when display is disabled)
+	enabled   bool
+	verbose   bool
+	mode      ProgressMode
+	out       io.Writer
+	lastPrint time.Time
 }
 
-// NewProgressTracker creates a new progress tracker.
+// Stats is a snapshot of a download's counters.
+type Stats struct {
+	// Files is the number of files written
+	Files int `json:"files"`
+	// Playlists and Segments break Files down into playlists and other files
+	Playlists int `json:"playlists"`
+	Segments  int `json:"segments"`
+	// Bytes is the number of bytes downloaded
+	Bytes int64 `json:"bytes"`
+	// DedupedFiles and DedupedBytes describe files stored as hardlinks
+	DedupedFiles int   `json:"dedupedFiles,omitempty"`
+	DedupedBytes int64 `json:"dedupedBytes,omitempty"`
+	// Elapsed is the time since the download started
+	Elapsed time.Duration `json:"-"`
+	// ElapsedMs is Elapsed in milliseconds
+	ElapsedMs int64 `json:"elapsedMs"`
+	// BytesPerSecond is the average download speed
+	BytesPerSecond float64 `json:"bytesPerSecond"`
+}
+
+// NewProgressTracker creates a new progress tracker that draws a status line
+// on stdout, or prints nothing if enabled is false.
 func NewProgressTracker(enabled, verbose bool) *ProgressTracker {
+	mode := ProgressText
+	if !enabled {
+		mode = ProgressNone
+	}
+	return NewProgressTrackerWithMode(mode, verbose, nil)
+}
+
+// NewProgressTrackerWithMode creates a new progress tracker that reports in
+// the given mode.
+//
+// Output goes to out, or if out is nil to stderr in ProgressJSON mode (so the
+// records don't mix with other output) and to stdout otherwise.
+func NewProgressTrackerWithMode(mode ProgressMode, verbose bool, out io.Writer) *ProgressTracker {
+	if mode == "" {
+		mode = ProgressText
+	}
+	if out == nil {
+		out = os.Stdout
+		if mode == ProgressJSON {
+			out = os.Stderr
+		}
+	}
 	return &ProgressTracker{
-		enabled:   enabled,
+		enabled:   mode != ProgressNone,
 		verbose:   verbose,
+		mode:      mode,
+		out:       out,
 		startTime: time.Now(),
 	}
 }
 
 // SetTotalFiles sets the total number of files to download.
 func (p *ProgressTracker) SetTotalFiles(total int) {
-	if !p.enabled {
-		return
-	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.totalFiles = total
@@ -53,9 +161,6 @@ func (p *ProgressTracker) SetTotalFiles(total int) {
 
 // IncrementM3U8 increments the M3U8 file counter.
 func (p *ProgressTracker) IncrementM3U8() {
-	if !p.enabled {
-		return
-	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.m3u8Files++
@@ -64,9 +169,6 @@ func (p *ProgressTracker) IncrementM3U8() {
 
 // IncrementSegment increments the segment file counter.
 func (p *ProgressTracker) IncrementSegment(bytes int64) {
-	if !p.enabled {
-		return
-	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.segmentFiles++
@@ -76,15 +178,123 @@ func (p *ProgressTracker) IncrementSegment(bytes int64) {
 
 // AddBytes adds to the downloaded bytes counter.
 func (p *ProgressTracker) AddBytes(bytes int64) {
-	if !p.enabled {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downloadedBytes += bytes
+}
+
+// SetDedupeStats records how many files were deduplicated and the bytes saved.
+func (p *ProgressTracker) SetDedupeStats(files int, savedBytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dedupedFiles = files
+	p.dedupedBytes = savedBytes
+}
+
+// Stats returns a snapshot of the counters.
+func (p *ProgressTracker) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats()
+}
+
+// stats returns a snapshot of the counters. The caller must hold p.mu.
+func (p *ProgressTracker) stats() Stats {
+	elapsed := time.Since(p.startTime)
+	stats := Stats{
+		Files:        p.downloadedFiles,
+		Playlists:    p.m3u8Files,
+		Segments:     p.segmentFiles,
+		Bytes:        p.downloadedBytes,
+		DedupedFiles: p.dedupedFiles,
+		DedupedBytes: p.dedupedBytes,
+		Elapsed:      elapsed,
+		ElapsedMs:    elapsed.Milliseconds(),
+	}
+	if elapsed > 0 {
+		stats.BytesPerSecond = float64(p.downloadedBytes) / elapsed.Seconds()
+	}
+	return stats
+}
+
+// emit writes a ProgressEvent record. The caller must hold p.mu.
+func (p *ProgressTracker) emit(event ProgressEvent) {
+	event.Time = time.Now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	p.out.Write(append(data, '\n'))
+}
+
+// Start reports that the download of url started.
+func (p *ProgressTracker) Start(url string) {
+	if p.mode != ProgressJSON {
 		return
 	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.downloadedBytes += bytes
+	p.emit(ProgressEvent{Event: "start", URL: url})
+}
+
+// FileWritten reports that the resource at url was written to path.
+//
+// It only produces output in ProgressJSON mode; the counters are updated
+// through IncrementM3U8 and IncrementSegment.
+func (p *ProgressTracker) FileWritten(url, path string, resourceType ResourceType, size int64) {
+	if p.mode != ProgressJSON {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(ProgressEvent{Event: "file", URL: url, Path: path, Type: resourceType, Size: size})
+}
+
+// FileSkipped reports that the existing file at path was kept.
+func (p *ProgressTracker) FileSkipped(url, path string, resourceType ResourceType) {
+	if p.mode != ProgressJSON {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.emit(ProgressEvent{Event: "skip", URL: url, Path: path, Type: resourceType})
+}
+
+// PrintWarning reports a problem that did not stop the download.
+//
+// Warnings are logged to stderr, except in ProgressNone mode, which prints
+// nothing but errors, and in ProgressJSON mode, where they become "warning"
+// records.
+func (p *ProgressTracker) PrintWarning(format string, args ...any) {
+	switch p.mode {
+	case ProgressNone:
+	case ProgressJSON:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.emit(ProgressEvent{Event: "warning", Message: fmt.Sprintf(format, args...)})
+	default:
+		log.Printf("Warning: "+format, args...)
+	}
+}
+
+// PrintError reports that the download failed.
+//
+// It only produces output in ProgressJSON mode, since otherwise the caller
+// reports the error itself.
+func (p *ProgressTracker) PrintError(err error) {
+	if p.mode != ProgressJSON {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats()
+	p.emit(ProgressEvent{Event: "error", Message: err.Error(), Stats: &stats})
 }
 
 // PrintProgress prints a formatted progress update.
+//
+// Updates closer together than the mode's interval are skipped, so this can
+// be called from a fast ticker.
 func (p *ProgressTracker) PrintProgress() {
 	if !p.enabled {
 		return
@@ -94,8 +304,18 @@ func (p *ProgressTracker) PrintProgress() {
 	defer p.mu.Unlock()
 
 	now := time.Now()
+	if now.Sub(p.lastPrint) < progressIntervals[p.mode] {
+		return
+	}
+	p.lastPrint = now
 	elapsed := now.Sub(p.startTime)
 
+	if p.mode == ProgressJSON {
+		stats := p.stats()
+		p.emit(ProgressEvent{Event: "progress", Stats: &stats})
+		return
+	}
+
 	// Calculate download speed
 	var speed float64
 	if elapsed.Seconds() > 0 {
@@ -103,21 +323,25 @@ func (p *ProgressTracker) PrintProgress() {
 	}
 
 	// Format bytes
-	downloadedStr := formatBytes(p.downloadedBytes)
-	speedStr := formatBytes(int64(speed)) + "/s"
+	downloadedStr := FormatBytes(p.downloadedBytes)
+	speedStr := FormatBytes(int64(speed)) + "/s"
 
 	// Build progress message
 	var msg string
 	if p.totalFiles > 0 {
 		percentage := float64(p.downloadedFiles) / float64(p.totalFiles) * 100
 		msg = fmt.Sprintf("Progress: %d/%d files (%.1f%%) | %s downloaded | %s | Elapsed: %s",
-			p.downloadedFiles, p.totalFiles, percentage, downloadedStr, speedStr, formatDuration(elapsed))
+			p.downloadedFiles, p.totalFiles, percentage, downloadedStr, speedStr, FormatDuration(elapsed))
 	} else {
 		msg = fmt.Sprintf("Progress: %d files | %s downloaded | %s | Elapsed: %s",
-			p.downloadedFiles, downloadedStr, speedStr, formatDuration(elapsed))
+			p.downloadedFiles, downloadedStr, speedStr, FormatDuration(elapsed))
 	}
 
-	fmt.Printf("\r%-120s", msg)
+	if p.mode == ProgressPlain {
+		fmt.Fprintln(p.out, msg)
+		return
+	}
+	fmt.Fprintf(p.out, "\r%-120s", msg)
 }
 
 // PrintSummary prints a final summary of the download.
@@ -129,23 +353,43 @@ func (p *ProgressTracker) PrintSummary() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	fmt.Println() // New line after progress bar
-	fmt.Println("\n" + "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println("                              Download Complete")
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	switch p.mode {
+	case ProgressJSON:
+		stats := p.stats()
+		p.emit(ProgressEvent{Event: "summary", Stats: &stats})
+		return
+	case ProgressPlain:
+		stats := p.stats()
+		msg := fmt.Sprintf("Download complete: %d files (%d playlists, %d segments) | %s | %s/s | Elapsed: %s",
+			stats.Files, stats.Playlists, stats.Segments, FormatBytes(stats.Bytes),
+			FormatBytes(int64(stats.BytesPerSecond)), FormatDuration(stats.Elapsed))
+		if stats.DedupedFiles > 0 {
+			msg += fmt.Sprintf(" | Deduplicated: %d files (%s saved)", stats.DedupedFiles, FormatBytes(stats.DedupedBytes))
+		}
+		fmt.Fprintln(p.out, msg)
+		return
+	}
+
+	fmt.Fprintln(p.out) // New line after progress bar
+	fmt.Fprintln(p.out, "\n"+"━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(p.out, "                              Download Complete")
+	fmt.Fprintln(p.out, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
 	elapsed := time.Since(p.startTime)
 	avgSpeed := float64(p.downloadedBytes) / elapsed.Seconds()
 
-	fmt.Printf("  Total Files Downloaded: %d\n", p.downloadedFiles)
-	fmt.Printf("    • M3U8 Playlists:      %d\n", p.m3u8Files)
-	fmt.Printf("    • Media Segments:      %d\n", p.segmentFiles)
-	fmt.Printf("\n")
-	fmt.Printf("  Total Data:             %s\n", formatBytes(p.downloadedBytes))
-	fmt.Printf("  Average Speed:          %s/s\n", formatBytes(int64(avgSpeed)))
-	fmt.Printf("  Time Elapsed:           %s\n", formatDuration(elapsed))
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println()
+	fmt.Fprintf(p.out, "  Total Files Downloaded: %d\n", p.downloadedFiles)
+	fmt.Fprintf(p.out, "    • M3U8 Playlists:      %d\n", p.m3u8Files)
+	fmt.Fprintf(p.out, "    • Media Segments:      %d\n", p.segmentFiles)
+	fmt.Fprintf(p.out, "\n")
+	fmt.Fprintf(p.out, "  Total Data:             %s\n", FormatBytes(p.downloadedBytes))
+	if p.dedupedFiles > 0 {
+		fmt.Fprintf(p.out, "  Deduplicated:           %d files (%s saved)\n", p.dedupedFiles, FormatBytes(p.dedupedBytes))
+	}
+	fmt.Fprintf(p.out, "  Average Speed:          %s/s\n", FormatBytes(int64(avgSpeed)))
+	fmt.Fprintf(p.out, "  Time Elapsed:           %s\n", FormatDuration(elapsed))
+	fmt.Fprintln(p.out, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(p.out)
 }
 
 // PrintVerbose prints a verbose message if verbose mode is enabled.
@@ -153,13 +397,21 @@ func (p *ProgressTracker) PrintVerbose(format string, args ...any) {
 	if !p.enabled || !p.verbose {
 		return
 	}
-	// Clear the progress line before printing verbose output
-	fmt.Printf("\r%-120s\r", "")
-	fmt.Printf(format+"\n", args...)
+	switch p.mode {
+	case ProgressJSON:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.emit(ProgressEvent{Event: "log", Message: fmt.Sprintf(format, args...)})
+		return
+	case ProgressText:
+		// Clear the progress line before printing verbose output
+		fmt.Fprintf(p.out, "\r%-120s\r", "")
+	}
+	fmt.Fprintf(p.out, format+"\n", args...)
 }
 
-// formatBytes formats bytes into a human-readable string.
-func formatBytes(bytes int64) string {
+// FormatBytes formats bytes into a human-readable string.
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -173,8 +425,8 @@ func formatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), units[exp])
 }
 
-// formatDuration formats a duration into a human-readable string.
-func formatDuration(d time.Duration) string {
+// FormatDuration formats a duration into a human-readable string.
+func FormatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
 	h := d / time.Hour
 	d -= h * time.Hour
@@ -0,0 +1,151 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseProgressMode(t *testing.T) {
+	for _, valid := range []string{"text", "plain", "json", "none"} {
+		if mode, err := ParseProgressMode(valid); err != nil || string(mode) != valid {
+			t.Errorf("ParseProgressMode(%q) = %q, %v", valid, mode, err)
+		}
+	}
+	if _, err := ParseProgressMode("fancy"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	files := map[string]string{
+		"/index.m3u8": "#EXTM3U\n#EXTINF:10,\ns0.ts\n#EXTINF:10,\ns1.ts\n#EXT-X-ENDLIST\n",
+		"/s0.ts":      "segment0",
+		"/s1.ts":      "segment1",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	d := New(Config{
+		OutputDir:   t.TempDir(),
+		Concurrency: 2,
+		RewriteURLs: true,
+		Progress:    ProgressJSON,
+		ProgressOut: &out,
+	})
+	if err := d.Download(context.Background(), srv.URL+"/index.m3u8"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if !strings.Contains(out.String(), `"bytes":`) {
+		t.Errorf("Expected the summary to include the byte count: %s", out.String())
+	}
+
+	var events []ProgressEvent
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var event ProgressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		if event.Time.IsZero() {
+			t.Errorf("Event %q has no time", event.Event)
+		}
+		events = append(events, event)
+	}
+
+	if len(events) < 5 {
+		t.Fatalf("Expected at least 5 events, got %d: %s", len(events), out.String())
+	}
+	if events[0].Event != "start" || events[0].URL != srv.URL+"/index.m3u8" {
+		t.Errorf("Expected a start event first, got %+v", events[0])
+	}
+
+	written := make(map[string]ProgressEvent)
+	for _, event := range events {
+		if event.Event == "file" {
+			written[event.URL] = event
+		}
+	}
+	if len(written) != 3 {
+		t.Errorf("Expected 3 file events, got %d", len(written))
+	}
+	if event := written[srv.URL+"/s0.ts"]; event.Type != ResourceSegment || event.Size != 8 || event.Path == "" {
+		t.Errorf("Unexpected segment event: %+v", event)
+	}
+	if event := written[srv.URL+"/index.m3u8"]; event.Type != ResourcePlaylist {
+		t.Errorf("Unexpected playlist event: %+v", event)
+	}
+
+	summary := events[len(events)-1]
+	if summary.Event != "summary" || summary.Stats == nil {
+		t.Fatalf("Expected a summary event last, got %+v", summary)
+	}
+	if summary.Files != 3 || summary.Playlists != 1 || summary.Segments != 2 || summary.Stats.Bytes == 0 {
+		t.Errorf("Unexpected summary counts: %+v", *summary.Stats)
+	}
+}
+
+func TestProgressPlain(t *testing.T) {
+	var out bytes.Buffer
+	p := NewProgressTrackerWithMode(ProgressPlain, true, &out)
+	p.IncrementSegment(2048)
+	p.PrintProgress()
+	p.PrintProgress() // Too soon, skipped
+	p.PrintVerbose("hello %s", "world")
+	p.PrintSummary()
+
+	if strings.ContainsAny(out.String(), "\r\x1b") {
+		t.Errorf("Expected no control characters, got %q", out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %q", len(lines), out.String())
+	}
+	if !strings.HasPrefix(lines[0], "Progress: 1 files | 2.0 KB downloaded") {
+		t.Errorf("Unexpected progress line: %q", lines[0])
+	}
+	if lines[1] != "hello world" {
+		t.Errorf("Unexpected verbose line: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "Download complete: 1 files (0 playlists, 1 segments) | 2.0 KB") {
+		t.Errorf("Unexpected summary line: %q", lines[2])
+	}
+}
+
+func TestProgressNone(t *testing.T) {
+	// Warnings go through the standard logger in the other modes
+	var logged bytes.Buffer
+	defer func(w io.Writer) { log.SetOutput(w) }(log.Writer())
+	log.SetOutput(&logged)
+
+	var out bytes.Buffer
+	p := NewProgressTrackerWithMode(ProgressNone, true, &out)
+	p.IncrementM3U8()
+	p.PrintProgress()
+	p.PrintVerbose("hidden")
+	p.PrintWarning("hidden")
+	p.PrintSummary()
+
+	if out.Len() != 0 || logged.Len() != 0 {
+		t.Errorf("Expected no output, got %q and %q", out.String(), logged.String())
+	}
+	if stats := p.Stats(); stats.Files != 1 {
+		t.Errorf("Expected counters to be kept, got %+v", stats)
+	}
+}
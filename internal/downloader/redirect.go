@@ -0,0 +1,29 @@
+package downloader
+
+import "fmt"
+
+// RedirectMode decides where a playlist that was redirected, and the
+// resources it references, are stored.
+type RedirectMode string
+
+const (
+	// RedirectRequested stores a redirected playlist at the local path of
+	// the URL that was requested, and its references relative to that, as if
+	// there had been no redirect.
+	RedirectRequested RedirectMode = "requested"
+	// RedirectFinal stores a redirected playlist at the local path of the
+	// URL it was redirected to, and its references at their own paths.
+	RedirectFinal RedirectMode = "final"
+)
+
+// ParseRedirectMode converts a CLI value into a RedirectMode.
+func ParseRedirectMode(s string) (RedirectMode, error) {
+	switch m := RedirectMode(s); m {
+	case RedirectRequested, RedirectFinal:
+		return m, nil
+	case "":
+		return RedirectRequested, nil
+	default:
+		return "", fmt.Errorf("invalid redirect mode %q (expected requested or final)", s)
+	}
+}
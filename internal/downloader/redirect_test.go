@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRedirectMode(t *testing.T) {
+	for value, expected := range map[string]RedirectMode{"": RedirectRequested, "requested": RedirectRequested, "final": RedirectFinal} {
+		if got, err := ParseRedirectMode(value); err != nil || got != expected {
+			t.Errorf("ParseRedirectMode(%q) = %q, %v; expected %q", value, got, err, expected)
+		}
+	}
+	if _, err := ParseRedirectMode("origin"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestDownloadFollowsRedirects(t *testing.T) {
+	edgeFiles := map[string]string{
+		"/abc/master.m3u8":   "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nv1/index.m3u8\n",
+		"/abc/v1/index.m3u8": "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"../key.bin\"\n#EXTINF:10,\ns0.ts\n#EXT-X-ENDLIST\n",
+		"/abc/key.bin":       "0123456789abcdef",
+		"/abc/v1/s0.ts":      "segment",
+	}
+	edge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := edgeFiles[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer edge.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/live/master.m3u8" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, edge.URL+"/abc/master.m3u8", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	tests := []struct {
+		mode     RedirectMode
+		expected []string
+	}{
+		{RedirectRequested, []string{"live/master.m3u8", "live/v1/index.m3u8", "live/key.bin", "live/v1/s0.ts"}},
+		{RedirectFinal, []string{"abc/master.m3u8", "abc/v1/index.m3u8", "abc/key.bin", "abc/v1/s0.ts"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			outputDir := t.TempDir()
+			d := New(Config{
+				OutputDir:     outputDir,
+				Concurrency:   2,
+				RewriteURLs:   true,
+				Manifest:      true,
+				Quiet:         true,
+				RedirectPaths: tt.mode,
+			})
+			if err := d.Download(context.Background(), origin.URL+"/live/master.m3u8"); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			for _, p := range tt.expected {
+				if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(p))); err != nil {
+					t.Errorf("Expected %s to be written: %v", p, err)
+				}
+			}
+
+			master, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(tt.expected[0])))
+			if err != nil {
+				t.Fatalf("Failed to read master playlist: %v", err)
+			}
+			if expected := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nv1/index.m3u8\n"; string(master) != expected {
+				t.Errorf("Unexpected rewritten master playlist:\n%s", master)
+			}
+
+			var root ManifestEntry
+			for _, entry := range d.Manifest() {
+				if entry.URL == origin.URL+"/live/master.m3u8" {
+					root = entry
+				}
+			}
+			if root.FinalURL != edge.URL+"/abc/master.m3u8" || len(root.Redirects) != 1 {
+				t.Errorf("Expected the redirect in the manifest, got %+v", root)
+			}
+		})
+	}
+}
@@ -10,132 +10,412 @@ import (
 	"github.com/knpwrs/m3u8dl/internal/filesystem"
 )
 
+// FilteredMode decides what happens to references that were filtered out
+// and therefore never downloaded.
+type FilteredMode string
+
+const (
+	// FilteredRemote rewrites filtered references to their absolute origin
+	// URL, producing a hybrid local/remote playlist.
+	FilteredRemote FilteredMode = "remote"
+	// FilteredRemove drops filtered references along with the tags that
+	// depend on them.
+	FilteredRemove FilteredMode = "remove"
+)
+
+// ParseFilteredMode converts a CLI value into a FilteredMode.
+func ParseFilteredMode(s string) (FilteredMode, error) {
+	switch m := FilteredMode(s); m {
+	case FilteredRemote, FilteredRemove:
+		return m, nil
+	case "":
+		return FilteredRemote, nil
+	default:
+		return "", fmt.Errorf("invalid filtered reference mode %q (expected remote or remove)", s)
+	}
+}
+
+// RewriteOptions controls how RewriteM3U8URLs rewrites references.
+//
+// The zero value rewrites every reference to a local relative path.
+type RewriteOptions struct {
+	// BaseURL, if set, rewrites references to absolute URLs under this base
+	// instead of relative paths. The part below the base is the file's
+	// location inside the output directory, so the output can be uploaded
+	// as-is and served from the base URL.
+	BaseURL *url.URL
+	// Query is appended to every reference rewritten under BaseURL (e.g.
+	// "token=abc" or a signed-URL suffix). It is ignored without BaseURL,
+	// since local files can't take a query.
+	Query string
+	// Keep reports whether a resolved URL was downloaded. References it
+	// rejects are handled according to Filtered. A nil Keep treats every
+	// reference as downloaded.
+	Keep func(absoluteURL string) bool
+	// Filtered decides what happens to references rejected by Keep.
+	Filtered FilteredMode
+	// ResolveBase, if set, is the URL relative references are resolved
+	// against instead of the playlist's source URL (e.g. the URL the
+	// playlist was redirected to). The playlist is still stored at the local
+	// path of its source URL.
+	ResolveBase *url.URL
+	// Absolutize rewrites every reference to its fully resolved origin URL,
+	// producing a portable playlist that streams from the origin no matter
+	// where it is stored. All other options are ignored.
+	Absolutize bool
+}
+
+// segmentTags are tags that only apply to the URI line that follows them.
+//
+// When that URI is removed, these tags must be removed with it.
+var segmentTags = map[string]bool{
+	"EXTINF":                  true,
+	"EXT-X-BYTERANGE":         true,
+	"EXT-X-PROGRAM-DATE-TIME": true,
+	"EXT-X-STREAM-INF":        true,
+	"EXT-X-GAP":               true,
+	"EXT-X-BITRATE":           true,
+}
+
 // RewriteM3U8URLs rewrites all URLs in an M3U8 file to local relative paths.
 //
 // This function processes an M3U8 file and converts all absolute URLs to
 // relative paths that reference the locally downloaded files. This allows
 // the downloaded M3U8 playlist to be played locally without network access.
+// With opts.BaseURL set, references become absolute URLs under that base
+// instead, for re-hosting the mirror on another server.
+//
+// References rejected by opts.Keep are never pointed at local paths, so the
+// output never references files that weren't downloaded.
 //
 // Parameters:
 //   - content: The original M3U8 file content
 //   - sourceURL: The URL where this M3U8 was downloaded from
 //   - fs: The filesystem handler that manages path mappings
+//   - opts: How references should be rewritten
 //
 // Returns the rewritten M3U8 content with local relative paths.
 //
 // See: https://context7.com/golang/go for Go documentation
-func RewriteM3U8URLs(content []byte, sourceURL string, fs *filesystem.FileSystem) ([]byte, error) {
-	var output bytes.Buffer
-	scanner := bufio.NewScanner(bytes.NewReader(content))
+func RewriteM3U8URLs(content []byte, sourceURL string, fs *filesystem.FileSystem, opts RewriteOptions) ([]byte, error) {
+	baseURL, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse M3U8 URL %s: %w", sourceURL, err)
+	}
+	if opts.ResolveBase != nil {
+		baseURL = opts.ResolveBase
+	}
+
+	if opts.Filtered == FilteredRemove && opts.Keep != nil && !opts.Absolutize {
+		content, err = removeFilteredSegments(content, baseURL, opts.Keep)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	rw := &rewriter{
+		sourceURL: sourceURL,
+		baseURL:   baseURL,
+		fs:        fs,
+		opts:      opts,
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 	for scanner.Scan() {
 		line := scanner.Text()
-		rewrittenLine := line
 
 		// Check if line contains URLs that need rewriting
 		if strings.HasPrefix(line, "#") {
-			// Handle tag lines with URI attributes
-			if containsURI(line) {
-				var err error
-				rewrittenLine, err = rewriteTagLine(line, sourceURL, fs)
-				if err != nil {
-					// On error, keep original line
-					rewrittenLine = line
-				}
-			}
-		} else if line != "" && !strings.HasPrefix(line, "#") {
+			rw.handleTagLine(line)
+		} else if strings.TrimSpace(line) != "" {
 			// Non-comment, non-empty lines are segment or playlist URLs
-			rewrittenLine = rewriteSegmentLine(line, sourceURL, fs)
+			rw.handleURILine(line)
+		} else {
+			rw.pending = append(rw.pending, line)
 		}
-
-		output.WriteString(rewrittenLine)
-		output.WriteString("\n")
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error scanning M3U8 file: %w", err)
 	}
 
+	rw.output = append(rw.output, rw.pending...)
+	rw.dropRemovedGroups()
+
+	var output bytes.Buffer
+	for _, line := range rw.output {
+		output.WriteString(line)
+		output.WriteString("\n")
+	}
+
 	return output.Bytes(), nil
 }
 
+// rewriter holds the state needed to rewrite the references in one playlist.
+type rewriter struct {
+	sourceURL string
+	baseURL   *url.URL
+	fs        *filesystem.FileSystem
+	opts      RewriteOptions
+
+	output  []string // Lines that have been finalized
+	pending []string // Lines waiting for the next URI line
+
+	// Set when a removed key or map makes the following segments unusable
+	skipKey bool
+	skipMap bool
+
+	// Rendition groups ("TYPE/GROUP-ID") to whether any of their
+	// EXT-X-MEDIA tags was kept
+	groups map[string]bool
+}
+
+// groupAttributes are the EXT-X-STREAM-INF and EXT-X-I-FRAME-STREAM-INF
+// attributes that name a rendition group, which are also the TYPE of the
+// group's EXT-X-MEDIA tags.
+var groupAttributes = map[string]bool{
+	"AUDIO":           true,
+	"VIDEO":           true,
+	"SUBTITLES":       true,
+	"CLOSED-CAPTIONS": true,
+}
+
 // containsURI checks if a line contains URI attributes that need rewriting.
 func containsURI(line string) bool {
-	return strings.Contains(line, "URI=\"")
+	return len(uriAttributeSpans(line)) > 0
 }
 
-// rewriteTagLine rewrites URLs in M3U8 tag lines (e.g., #EXT-X-KEY, #EXT-X-MEDIA).
-func rewriteTagLine(line, sourceURL string, fs *filesystem.FileSystem) (string, error) {
-	result := line
-
-	// Find and replace all URI="..." patterns
-	for {
-		uriStart := strings.Index(result, "URI=\"")
-		if uriStart == -1 {
-			break
+// handleTagLine rewrites a tag line and queues it until the next URI line.
+func (rw *rewriter) handleTagLine(line string) {
+	name := tagName(line)
+	if !containsURI(line) {
+		switch name {
+		case "EXT-X-KEY":
+			// A key without a URI (METHOD=NONE) ends any removed key's scope
+			rw.skipKey = false
+		case "EXT-X-MEDIA":
+			rw.recordGroup(line, true)
+		}
+		rw.pending = append(rw.pending, line)
+		return
+	}
+
+	rewritten, removed := rw.rewriteTagLine(line)
+	switch name {
+	case "EXT-X-KEY":
+		rw.skipKey = removed
+	case "EXT-X-MAP":
+		rw.skipMap = removed
+	case "EXT-X-MEDIA":
+		rw.recordGroup(line, !removed)
+	}
+
+	if !removed {
+		rw.pending = append(rw.pending, rewritten)
+	}
+}
+
+// handleURILine rewrites a segment or playlist line, or removes it together
+// with the tags that only apply to it.
+func (rw *rewriter) handleURILine(line string) {
+	rewritten, removed := rw.rewriteReference(strings.TrimSpace(line))
+	if rw.opts.Filtered == FilteredRemove && !rw.opts.Absolutize && (rw.skipKey || rw.skipMap) {
+		removed = true
+	}
+
+	if removed {
+		for _, pendingLine := range rw.pending {
+			if !segmentTags[tagName(pendingLine)] {
+				rw.output = append(rw.output, pendingLine)
+			}
 		}
+		rw.pending = rw.pending[:0]
+		return
+	}
 
-		// Find the end quote
-		uriValueStart := uriStart + len("URI=\"")
-		uriEnd := strings.Index(result[uriValueStart:], "\"")
-		if uriEnd == -1 {
-			break
+	rw.output = append(rw.output, rw.pending...)
+	rw.output = append(rw.output, rewritten)
+	rw.pending = rw.pending[:0]
+}
+
+// removeFilteredSegments drops the segments of a media playlist whose URI,
+// key or map keep rejects.
+//
+// The segments are cut with keepSegments, like a clip, so the kept segments
+// keep their sequence numbers and a gap left in the middle of the playlist
+// is marked with an EXT-X-DISCONTINUITY. Master playlists, and media
+// playlists that lose no segments, are returned unchanged.
+func removeFilteredSegments(content []byte, baseURL *url.URL, keep func(string) bool) ([]byte, error) {
+	m3u8, err := ParseM3U8(content, baseURL)
+	if err != nil || m3u8.IsMaster() || len(m3u8.Segments) == 0 {
+		// Left to the line-by-line rewrite
+		return content, nil
+	}
+
+	kept := make([]bool, len(m3u8.Segments))
+	removed := false
+	for i, segment := range m3u8.Segments {
+		kept[i] = keep(segment.URL) &&
+			(segment.KeyURL == "" || keep(segment.KeyURL)) &&
+			(segment.MapURL == "" || keep(segment.MapURL))
+		removed = removed || !kept[i]
+	}
+	if !removed {
+		return content, nil
+	}
+
+	parts, err := splitPlaylist(content, m3u8)
+	if err != nil {
+		return nil, err
+	}
+	return keepSegments(parts, m3u8, kept), nil
+}
+
+// rewriteTagLine rewrites URLs in M3U8 tag lines (e.g., #EXT-X-KEY, #EXT-X-MEDIA).
+//
+// Every URI (or SERVER-URI) attribute on the line is rewritten. Returns the
+// rewritten line and whether the whole tag should be removed because one of
+// its references was filtered out.
+func (rw *rewriter) rewriteTagLine(line string) (string, bool) {
+	var result strings.Builder
+	last := 0
+	removeTag := false
+
+	for _, span := range uriAttributeSpans(line) {
+		rewritten, removed := rw.rewriteReference(line[span.valueStart:span.valueEnd])
+		if removed {
+			removeTag = true
 		}
 
-		// Extract the URL
-		absoluteURL := result[uriValueStart : uriValueStart+uriEnd]
+		result.WriteString(line[last:span.valueStart])
+		result.WriteString(rewritten)
+		last = span.valueEnd
+	}
+
+	result.WriteString(line[last:])
+	return result.String(), removeTag
+}
+
+// rewriteReference rewrites a single (possibly relative) reference.
+//
+// Returns the rewritten reference and whether it should be removed because
+// it was filtered out. References that can't be mapped to a local path are
+// left untouched.
+func (rw *rewriter) rewriteReference(ref string) (string, bool) {
+	// The reference may be relative to the playlist, so resolve it first
+	absoluteURL := resolveURL(rw.baseURL, ref)
+
+	if rw.opts.Absolutize {
+		return absoluteURL, false
+	}
 
-		// Resolve URL (in case it's relative in the original M3U8)
-		m3u8File, err := ParseM3U8([]byte{}, mustParseURL(sourceURL))
-		if err == nil {
-			absoluteURL = resolveURL(m3u8File.BaseURL, absoluteURL)
+	if rw.opts.Keep != nil && !rw.opts.Keep(absoluteURL) {
+		if rw.opts.Filtered == FilteredRemove {
+			return "", true
 		}
+		// Not downloaded, so keep streaming it from the origin
+		return absoluteURL, false
+	}
 
-		// Get relative path
-		relativePath, err := fs.GetRelativePath(sourceURL, absoluteURL)
+	if rw.opts.BaseURL != nil {
+		localPath, err := rw.fs.GetOutputRelativePath(absoluteURL)
 		if err != nil {
-			// If we can't get relative path, skip this URL
-			result = result[uriValueStart+uriEnd:]
-			continue
+			return ref, false
 		}
+		return appendQuery(rebaseURL(rw.opts.BaseURL, localPath), rw.opts.Query), false
+	}
 
-		// Replace the URL with relative path
-		before := result[:uriValueStart]
-		after := result[uriValueStart+uriEnd:]
-
-		// Move past this replacement to find next URI
-		result = before + relativePath + after
-		break // Process one URI at a time to avoid infinite loops
+	relativePath, err := rw.fs.GetRelativePath(rw.sourceURL, absoluteURL)
+	if err != nil {
+		return ref, false
 	}
+	// Local names may contain characters such as '#', '%' or '?' that have a
+	// meaning in URIs, so the path must be percent-encoded to resolve back to
+	// the file
+	return (&url.URL{Path: relativePath}).EscapedPath(), false
+}
 
-	return result, nil
+// recordGroup records whether an EXT-X-MEDIA tag of a rendition group was
+// kept.
+func (rw *rewriter) recordGroup(line string, kept bool) {
+	attrs := parseAttributes(tagValue(line))
+	key := attrs["TYPE"] + "/" + attrs["GROUP-ID"]
+	if rw.groups == nil {
+		rw.groups = make(map[string]bool)
+	}
+	rw.groups[key] = rw.groups[key] || kept
 }
 
-// rewriteSegmentLine rewrites URLs in segment/playlist lines.
-func rewriteSegmentLine(line, sourceURL string, fs *filesystem.FileSystem) string {
-	// The line is a URL (absolute or relative)
-	// First resolve it to absolute
-	m3u8File, err := ParseM3U8([]byte{}, mustParseURL(sourceURL))
-	if err != nil {
-		return line
+// dropRemovedGroups removes references to rendition groups whose EXT-X-MEDIA
+// tags were all removed from the variant streams, since a variant must not
+// name a group that doesn't exist.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8216#section-4.3.4.2
+func (rw *rewriter) dropRemovedGroups() {
+	if len(rw.groups) == 0 {
+		return
 	}
 
-	absoluteURL := resolveURL(m3u8File.BaseURL, line)
+	for i, line := range rw.output {
+		switch tagName(line) {
+		case "EXT-X-STREAM-INF", "EXT-X-I-FRAME-STREAM-INF":
+		default:
+			continue
+		}
 
-	// Get relative path
-	relativePath, err := fs.GetRelativePath(sourceURL, absoluteURL)
-	if err != nil {
-		return line
+		var removed []attributeSpan
+		for _, span := range attributeSpans(line) {
+			if !groupAttributes[span.name] {
+				continue
+			}
+			kept, defined := rw.groups[span.name+"/"+line[span.valueStart:span.valueEnd]]
+			if defined && !kept {
+				removed = append(removed, span)
+			}
+		}
+		rw.output[i] = removeAttributes(line, removed)
 	}
+}
 
-	return relativePath
+// removeAttributes removes attributes, found with attributeSpans, from a tag
+// line along with their separating commas.
+func removeAttributes(line string, spans []attributeSpan) string {
+	// Remove from the end so the earlier positions stay valid
+	for i := len(spans) - 1; i >= 0; i-- {
+		start, end := spans[i].start, spans[i].end
+		if comma := strings.Index(line[end:], ","); comma != -1 {
+			end += comma + 1
+		} else if comma := strings.LastIndex(line[:start], ","); comma != -1 {
+			start = comma
+		}
+		line = line[:start] + line[end:]
+	}
+	return line
 }
 
-// mustParseURL parses a URL and panics on error (helper for internal use).
-func mustParseURL(urlStr string) *url.URL {
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		panic(fmt.Sprintf("failed to parse URL %s: %v", urlStr, err))
+// rebaseURL returns the absolute URL of a slash-separated local path below base.
+func rebaseURL(base *url.URL, localPath string) string {
+	dir := *base
+	if !strings.HasSuffix(dir.Path, "/") {
+		// Treat the base as a directory, not a file to be replaced
+		dir.Path += "/"
+		if dir.RawPath != "" {
+			dir.RawPath += "/"
+		}
+	}
+
+	ref := &url.URL{Path: localPath}
+	return dir.ResolveReference(ref).String()
+}
+
+// appendQuery adds a query string to a URL or path, keeping any existing one.
+func appendQuery(ref, query string) string {
+	query = strings.TrimPrefix(query, "?")
+	if query == "" {
+		return ref
+	}
+	if strings.Contains(ref, "?") {
+		return ref + "&" + query
 	}
-	return u
+	return ref + "?" + query
 }
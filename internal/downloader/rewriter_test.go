@@ -0,0 +1,304 @@
+package downloader
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/knpwrs/m3u8dl/internal/filesystem"
+)
+
+const rewriteTestPlaylist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-KEY:METHOD=AES-128,URI="keys/key.bin"
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.0,
+segment1.m4s
+#EXTINF:10.0,
+https://cdn.example.com/other/segment2.m4s
+`
+
+func TestRewriteM3U8URLsLocal(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+
+	rewritten, err := RewriteM3U8URLs([]byte(rewriteTestPlaylist), "https://example.com/video/playlist.m3u8", fs, RewriteOptions{})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	expected := []string{
+		`#EXT-X-KEY:METHOD=AES-128,URI="keys/key.bin"`,
+		`#EXT-X-MAP:URI="init.mp4"`,
+		"segment1.m4s",
+		"../other/segment2.m4s",
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(rewritten), line+"\n") {
+			t.Errorf("Expected rewritten playlist to contain %q, got:\n%s", line, rewritten)
+		}
+	}
+}
+
+func TestRewriteM3U8URLsEscapesLocalPaths(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	playlistURL := "https://example.com/video/playlist.m3u8"
+	segments := []string{"a%231.ts", "50%25.ts", "what%3F.ts", "two%20words.ts"}
+
+	content := "#EXTM3U\n"
+	for _, segment := range segments {
+		content += "#EXTINF:10.0,\n" + segment + "\n"
+	}
+	rewritten, err := RewriteM3U8URLs([]byte(content), playlistURL, fs, RewriteOptions{})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	playlistPath, _ := fs.GetLocalPath(playlistURL)
+	local, _ := url.Parse("file://" + filepath.ToSlash(playlistPath))
+	playlist, err := ParseM3U8(rewritten, local)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	if len(playlist.Segments) != len(segments) {
+		t.Fatalf("Expected %d segments, got:\n%s", len(segments), rewritten)
+	}
+
+	// Every rewritten reference must resolve to the file the segment was
+	// stored at
+	for i, segment := range playlist.Segments {
+		expected, _ := fs.GetLocalPath("https://example.com/video/" + segments[i])
+		resolved, _ := url.Parse(segment.URL)
+		if filepath.FromSlash(resolved.Path) != expected {
+			t.Errorf("%s resolves to %s; expected %s", segments[i], resolved.Path, expected)
+		}
+	}
+}
+
+func TestRewriteM3U8URLsBase(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	base, _ := url.Parse("https://media.ourcdn.com/show1")
+
+	rewritten, err := RewriteM3U8URLs([]byte(rewriteTestPlaylist), "https://example.com/video/playlist.m3u8", fs, RewriteOptions{
+		BaseURL: base,
+		Query:   "token=abc",
+	})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	expected := []string{
+		`#EXT-X-KEY:METHOD=AES-128,URI="https://media.ourcdn.com/show1/video/keys/key.bin?token=abc"`,
+		`#EXT-X-MAP:URI="https://media.ourcdn.com/show1/video/init.mp4?token=abc"`,
+		"https://media.ourcdn.com/show1/video/segment1.m4s?token=abc",
+		"https://media.ourcdn.com/show1/other/segment2.m4s?token=abc",
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(rewritten), line+"\n") {
+			t.Errorf("Expected rewritten playlist to contain %q, got:\n%s", line, rewritten)
+		}
+	}
+}
+
+func TestRewriteTagLineURIAttributes(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	base, _ := url.Parse("https://media.ourcdn.com/")
+	content := `#EXT-X-SESSION-DATA:DATA-ID="com.example",X-NOTE="not a URI=x",URI="a.json",X-FOO-URI="b.json"` + "\n" +
+		`#EXT-X-CONTENT-STEERING:SERVER-URI="steer.json",PATHWAY-ID="cdn-a"` + "\n"
+
+	rewritten, err := RewriteM3U8URLs([]byte(content), "https://example.com/x/master.m3u8", fs, RewriteOptions{BaseURL: base, Query: "v=1"})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	expected := `#EXT-X-SESSION-DATA:DATA-ID="com.example",X-NOTE="not a URI=x",URI="https://media.ourcdn.com/x/a.json?v=1",X-FOO-URI="b.json"` + "\n" +
+		`#EXT-X-CONTENT-STEERING:SERVER-URI="https://media.ourcdn.com/x/steer.json?v=1",PATHWAY-ID="cdn-a"` + "\n"
+	if string(rewritten) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rewritten)
+	}
+
+	// Local files can't take a query
+	rewritten, err = RewriteM3U8URLs([]byte(content), "https://example.com/x/master.m3u8", fs, RewriteOptions{Query: "v=1"})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+	if strings.Contains(string(rewritten), "v=1") {
+		t.Errorf("Expected no query on local paths, got:\n%s", rewritten)
+	}
+}
+
+func TestRewriteM3U8URLsFilteredRemote(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	keep := func(u string) bool { return !strings.HasSuffix(u, ".key") }
+
+	content := `#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="enc.key"
+#EXTINF:10.0,
+segment1.ts
+`
+	rewritten, err := RewriteM3U8URLs([]byte(content), "https://example.com/video/playlist.m3u8", fs, RewriteOptions{Keep: keep})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	expected := `#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/video/enc.key"
+#EXTINF:10.0,
+segment1.ts
+`
+	if string(rewritten) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rewritten)
+	}
+}
+
+func TestRewriteM3U8URLsFilteredRemove(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	keep := func(u string) bool { return !strings.Contains(u, "/ad") && !strings.HasSuffix(u, ".vtt") }
+
+	content := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:5
+#EXT-X-MAP:URI="ad-init.mp4"
+#EXTINF:10.0,
+ad1.m4s
+#EXT-X-BYTERANGE:100@0
+#EXTINF:10.0,
+ad2.m4s
+#EXT-X-DISCONTINUITY
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.0,
+main1.m4s
+#EXTINF:10.0,
+subs.vtt
+#EXTINF:10.0,
+main2.m4s
+#EXT-X-ENDLIST
+`
+	rewritten, err := RewriteM3U8URLs([]byte(content), "https://example.com/video/playlist.m3u8", fs, RewriteOptions{
+		Keep:     keep,
+		Filtered: FilteredRemove,
+	})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	expected := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-DISCONTINUITY
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.0,
+main1.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:10.0,
+main2.m4s
+#EXT-X-ENDLIST
+`
+	if string(rewritten) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rewritten)
+	}
+}
+
+func TestRewriteM3U8URLsFilteredRemoveMiddleSegment(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	keep := func(u string) bool { return !strings.HasSuffix(u, "/s1.ts") }
+
+	content := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:00Z
+#EXTINF:10.0,
+s0.ts
+#EXTINF:10.0,
+s1.ts
+#EXTINF:10.0,
+s2.ts
+#EXT-X-ENDLIST
+`
+	rewritten, err := RewriteM3U8URLs([]byte(content), "https://example.com/video/playlist.m3u8", fs, RewriteOptions{
+		Keep:     keep,
+		Filtered: FilteredRemove,
+	})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	// The gap is marked and s2 keeps its place on the timeline
+	expected := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:00Z
+#EXTINF:10.0,
+s0.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2024-01-01T00:00:20.000Z
+#EXTINF:10.0,
+s2.ts
+#EXT-X-ENDLIST
+`
+	if string(rewritten) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rewritten)
+	}
+}
+
+func TestRewriteM3U8URLsFilteredRemoveMaster(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), false)
+	keep := func(u string) bool { return !strings.Contains(u, "subs") && !strings.Contains(u, "/fr.m3u8") }
+
+	content := `#EXTM3U
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",URI="subs/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="English",URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="French",URI="audio/fr.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="CC1",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,SUBTITLES="subs",AUDIO="aud",CLOSED-CAPTIONS="cc"
+high.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=640000,AUDIO="aud",SUBTITLES="subs"
+low.m3u8
+`
+	rewritten, err := RewriteM3U8URLs([]byte(content), "https://example.com/master.m3u8", fs, RewriteOptions{
+		Keep:     keep,
+		Filtered: FilteredRemove,
+	})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	// The subtitle group is gone, so the variants must not reference it
+	expected := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="English",URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="CC1",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aud",CLOSED-CAPTIONS="cc"
+high.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=640000,AUDIO="aud"
+low.m3u8
+`
+	if string(rewritten) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rewritten)
+	}
+}
+
+func TestRewriteM3U8URLsAbsolutize(t *testing.T) {
+	fs := filesystem.New(t.TempDir(), true)
+
+	rewritten, err := RewriteM3U8URLs([]byte(rewriteTestPlaylist), "https://example.com/video/playlist.m3u8", fs, RewriteOptions{
+		Absolutize: true,
+		Keep:       func(string) bool { return false },
+		Filtered:   FilteredRemove,
+	})
+	if err != nil {
+		t.Fatalf("RewriteM3U8URLs failed: %v", err)
+	}
+
+	expected := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/video/keys/key.bin"
+#EXT-X-MAP:URI="https://example.com/video/init.mp4"
+#EXTINF:10.0,
+https://example.com/video/segment1.m4s
+#EXTINF:10.0,
+https://cdn.example.com/other/segment2.m4s
+`
+	if string(rewritten) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rewritten)
+	}
+}
@@ -0,0 +1,349 @@
+package downloader
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SCTE-35 splice command types.
+//
+// See: https://www.scte.org/standards/library/catalog/scte-35-digital-program-insertion-cueing-message/
+const (
+	SpliceNull          = 0x00
+	SpliceSchedule      = 0x04
+	SpliceInsertCommand = 0x05
+	TimeSignal          = 0x06
+	BandwidthReserve    = 0x07
+	PrivateCommand      = 0xff
+)
+
+// segmentationDescriptorTag is the splice_descriptor_tag of a
+// segmentation_descriptor.
+const segmentationDescriptorTag = 0x02
+
+// segmentationStarts and segmentationEnds are the segmentation_type_ids that
+// start and end an ad break: break, provider and distributor advertisement,
+// and provider and distributor placement opportunity.
+var (
+	segmentationStarts = map[uint8]bool{0x22: true, 0x30: true, 0x32: true, 0x34: true, 0x36: true}
+	segmentationEnds   = map[uint8]bool{0x23: true, 0x31: true, 0x33: true, 0x35: true, 0x37: true}
+)
+
+// ptsRate is the frequency of the 90 kHz clock SCTE-35 times are given in.
+const ptsRate = 90000
+
+// SpliceInfo is a decoded SCTE-35 splice_info_section.
+type SpliceInfo struct {
+	// ProtocolVersion is the protocol_version (0 for every published version)
+	ProtocolVersion uint8
+	// PTSAdjustment is added to every PTS in the section, in 90 kHz ticks
+	PTSAdjustment uint64
+	// Tier is the authorization tier (0xFFF if unused)
+	Tier uint16
+	// CommandType is the splice_command_type (e.g. SpliceInsertCommand)
+	CommandType uint8
+	// SpliceInsert is the splice_insert command, if CommandType is
+	// SpliceInsertCommand
+	SpliceInsert *SpliceInsert
+	// SpliceTime is the PTS of a time_signal command, or of a splice_insert
+	// of the whole program, in 90 kHz ticks (nil if immediate or absent)
+	SpliceTime *uint64
+	// Segmentations are the segmentation descriptors of the section
+	Segmentations []SegmentationDescriptor
+}
+
+// SpliceInsert is a splice_insert command.
+type SpliceInsert struct {
+	EventID uint32
+	// Cancel is true if the command cancels an earlier event with EventID
+	Cancel bool
+	// OutOfNetwork is true when splicing out to an ad, false when returning
+	OutOfNetwork bool
+	// Immediate is true if the splice happens as soon as possible
+	Immediate bool
+	// BreakDuration is the length of the break, or zero if not given
+	BreakDuration time.Duration
+	// AutoReturn is true if the splicer returns after BreakDuration without
+	// a splice_insert to return
+	AutoReturn      bool
+	UniqueProgramID uint16
+	AvailNum        uint8
+	AvailsExpected  uint8
+}
+
+// SegmentationDescriptor is a segmentation_descriptor.
+type SegmentationDescriptor struct {
+	EventID uint32
+	// Cancel is true if the descriptor cancels an earlier event with EventID
+	Cancel bool
+	// TypeID is the segmentation_type_id (e.g. 0x34 for a provider placement
+	// opportunity start)
+	TypeID uint8
+	// Duration is the segmentation_duration, or zero if not given
+	Duration time.Duration
+	// UPIDType and UPID identify the segmented content
+	UPIDType         uint8
+	UPID             []byte
+	SegmentNum       uint8
+	SegmentsExpected uint8
+}
+
+// DecodeSCTE35 decodes an SCTE-35 splice_info_section given either as hex
+// (with or without a 0x prefix, as in EXT-X-DATERANGE) or as base64 (as in
+// EXT-OATCLS-SCTE35).
+func DecodeSCTE35(s string) (*SpliceInfo, error) {
+	s = strings.TrimSpace(s)
+	var data []byte
+	var err error
+	if hexValue, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		data, err = hex.DecodeString(hexValue)
+	} else {
+		data, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			data, err = hex.DecodeString(s)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCTE-35 encoding: %w", err)
+	}
+	return ParseSpliceInfo(data)
+}
+
+// ParseSpliceInfo parses a binary SCTE-35 splice_info_section, checking its
+// CRC.
+//
+// Only the splice_insert and time_signal commands and segmentation
+// descriptors are decoded; other commands and descriptors are skipped.
+// Encrypted sections are rejected.
+func ParseSpliceInfo(data []byte) (*SpliceInfo, error) {
+	if len(data) < 3 || data[0] != 0xfc {
+		return nil, errors.New("not an SCTE-35 splice_info_section")
+	}
+	sectionLength := int(binary.BigEndian.Uint16(data[1:3]) & 0x0fff)
+	if len(data) < 3+sectionLength || sectionLength < 15 {
+		return nil, fmt.Errorf("truncated SCTE-35 section (%d of %d bytes)", len(data), 3+sectionLength)
+	}
+	data = data[:3+sectionLength]
+	if crc32MPEG2(data) != 0 {
+		return nil, errors.New("SCTE-35 CRC mismatch")
+	}
+
+	r := &bitReader{data: data[3 : len(data)-4]}
+	info := &SpliceInfo{ProtocolVersion: uint8(r.read(8))}
+	if r.flag() {
+		return nil, errors.New("encrypted SCTE-35 sections are not supported")
+	}
+	r.skip(6) // encryption_algorithm
+	info.PTSAdjustment = r.read(33)
+	r.skip(8) // cw_index
+	info.Tier = uint16(r.read(12))
+	commandLength := int(r.read(12))
+	info.CommandType = uint8(r.read(8))
+
+	commandStart := r.pos
+	switch info.CommandType {
+	case SpliceInsertCommand:
+		info.SpliceInsert, info.SpliceTime = parseSpliceInsert(r)
+	case TimeSignal:
+		info.SpliceTime = parseSpliceTime(r)
+	default:
+		if commandLength == 0xfff {
+			return nil, fmt.Errorf("unsupported SCTE-35 command 0x%02x of unknown length", info.CommandType)
+		}
+	}
+	// 0xFFF is a legacy "unknown" length; otherwise trust the length over
+	// what was parsed
+	if commandLength != 0xfff {
+		r.pos = commandStart + commandLength*8
+	}
+
+	loopLength := int(r.read(16))
+	descriptorsEnd := r.pos/8 + loopLength
+	for r.err == nil && r.pos/8+2 <= descriptorsEnd {
+		tag, length := uint8(r.read(8)), int(r.read(8))
+		end := r.pos/8 + length
+		if tag == segmentationDescriptorTag && length >= 4 && r.read(32) == 0x43554549 { // "CUEI"
+			info.Segmentations = append(info.Segmentations, parseSegmentation(r, end))
+		}
+		r.pos = end * 8
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid SCTE-35 section: %w", r.err)
+	}
+	return info, nil
+}
+
+// parseSpliceInsert parses a splice_insert command, also returning its
+// splice time if it splices the whole program.
+func parseSpliceInsert(r *bitReader) (*SpliceInsert, *uint64) {
+	insert := &SpliceInsert{EventID: uint32(r.read(32)), Cancel: r.flag()}
+	r.skip(7)
+	if insert.Cancel {
+		return insert, nil
+	}
+
+	insert.OutOfNetwork = r.flag()
+	programSplice := r.flag()
+	hasDuration := r.flag()
+	insert.Immediate = r.flag()
+	r.skip(4)
+
+	var spliceTime *uint64
+	if programSplice && !insert.Immediate {
+		spliceTime = parseSpliceTime(r)
+	}
+	if !programSplice {
+		components := int(r.read(8))
+		for i := 0; i < components; i++ {
+			r.skip(8) // component_tag
+			if !insert.Immediate {
+				parseSpliceTime(r)
+			}
+		}
+	}
+	if hasDuration {
+		insert.AutoReturn = r.flag()
+		r.skip(6)
+		insert.BreakDuration = ptsDuration(r.read(33))
+	}
+	insert.UniqueProgramID = uint16(r.read(16))
+	insert.AvailNum = uint8(r.read(8))
+	insert.AvailsExpected = uint8(r.read(8))
+	return insert, spliceTime
+}
+
+// parseSpliceTime parses a splice_time, returning nil if no time is given.
+func parseSpliceTime(r *bitReader) *uint64 {
+	if !r.flag() {
+		r.skip(7)
+		return nil
+	}
+	r.skip(6)
+	pts := r.read(33)
+	return &pts
+}
+
+// parseSegmentation parses the rest of a segmentation_descriptor after its
+// identifier, ending at byte end.
+func parseSegmentation(r *bitReader, end int) SegmentationDescriptor {
+	d := SegmentationDescriptor{EventID: uint32(r.read(32)), Cancel: r.flag()}
+	r.skip(7)
+	if d.Cancel {
+		return d
+	}
+
+	programSegmentation := r.flag()
+	hasDuration := r.flag()
+	r.skip(6) // delivery restrictions
+	if !programSegmentation {
+		components := int(r.read(8))
+		r.skip(components * 48) // component_tag, reserved and pts_offset
+	}
+	if hasDuration {
+		d.Duration = ptsDuration(r.read(40))
+	}
+	d.UPIDType = uint8(r.read(8))
+	d.UPID = r.bytes(int(r.read(8)))
+	d.TypeID = uint8(r.read(8))
+	if r.pos/8+2 <= end {
+		d.SegmentNum = uint8(r.read(8))
+		d.SegmentsExpected = uint8(r.read(8))
+	}
+	return d
+}
+
+// AdCue reports whether the section starts an ad break (CueOut), ends one
+// (CueIn) or neither, along with the break duration if it is known.
+func (s *SpliceInfo) AdCue() (AdCue, time.Duration) {
+	if insert := s.SpliceInsert; insert != nil && !insert.Cancel {
+		if insert.OutOfNetwork {
+			return CueOut, insert.BreakDuration
+		}
+		return CueIn, 0
+	}
+	for _, d := range s.Segmentations {
+		switch {
+		case d.Cancel:
+		case segmentationStarts[d.TypeID]:
+			return CueOut, d.Duration
+		case segmentationEnds[d.TypeID]:
+			return CueIn, 0
+		}
+	}
+	return CueNone, 0
+}
+
+// ptsDuration converts a number of 90 kHz ticks into a Duration.
+func ptsDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks) * time.Second / ptsRate
+}
+
+// crc32MPEG2 computes the CRC-32/MPEG-2 of data. Over a whole section,
+// including its trailing CRC_32 field, the result is zero.
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// bitReader reads big-endian bit fields. Reading past the end sets err and
+// returns zeros.
+type bitReader struct {
+	data []byte
+	pos  int // Position in bits
+	err  error
+}
+
+// read reads an n-bit unsigned field (n <= 64).
+func (r *bitReader) read(n int) uint64 {
+	if r.pos+n > len(r.data)*8 {
+		r.err = errors.New("unexpected end of section")
+		r.pos = len(r.data) * 8
+		return 0
+	}
+	var v uint64
+	for i := 0; i < n; i++ {
+		bit := r.data[(r.pos+i)/8] >> (7 - (r.pos+i)%8) & 1
+		v = v<<1 | uint64(bit)
+	}
+	r.pos += n
+	return v
+}
+
+// flag reads a one-bit field.
+func (r *bitReader) flag() bool {
+	return r.read(1) == 1
+}
+
+// skip skips n bits.
+func (r *bitReader) skip(n int) {
+	for n > 64 {
+		r.read(64)
+		n -= 64
+	}
+	r.read(n)
+}
+
+// bytes reads n whole bytes.
+func (r *bitReader) bytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.read(8))
+	}
+	return b
+}
@@ -0,0 +1,107 @@
+package downloader
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// withCRC appends the CRC_32 of a splice_info_section.
+func withCRC(section []byte) []byte {
+	return binary.BigEndian.AppendUint32(section, crc32MPEG2(section))
+}
+
+func TestDecodeSCTE35SpliceInsert(t *testing.T) {
+	// The splice_insert example of SCTE 35, as base64 and as hex
+	for _, payload := range []string{
+		"/DAvAAAAAAAA///wFAVIAACPf+/+c2nALv4AUsz1AAAAAAAKAAhDVUVJAAABNWLbowo=",
+		"0xFC302F000000000000FFFFF014054800008F7FEFFE7369C02EFE0052CCF500000000000A0008435545490000013562DBA30A",
+	} {
+		info, err := DecodeSCTE35(payload)
+		if err != nil {
+			t.Fatalf("DecodeSCTE35 failed: %v", err)
+		}
+		if info.CommandType != SpliceInsertCommand || info.Tier != 0xfff {
+			t.Errorf("Unexpected section: %+v", info)
+		}
+		insert := info.SpliceInsert
+		if insert == nil || insert.EventID != 0x4800008f || !insert.OutOfNetwork || !insert.AutoReturn || insert.Immediate {
+			t.Fatalf("Unexpected splice_insert: %+v", insert)
+		}
+		if info.SpliceTime == nil || *info.SpliceTime != 0x07369c02e {
+			t.Errorf("Unexpected splice time: %v", info.SpliceTime)
+		}
+		cue, duration := info.AdCue()
+		if cue != CueOut || duration.Round(time.Millisecond) != 60294*time.Millisecond {
+			t.Errorf("AdCue() = %v, %v; expected a 60.294s cue out", cue, duration)
+		}
+	}
+}
+
+func TestDecodeSCTE35TimeSignal(t *testing.T) {
+	// The time_signal placement opportunity start example of SCTE 35
+	info, err := DecodeSCTE35("/DA0AAAAAAAA///wBQb+cr0AUAAeAhxDVUVJSAAAjn/PAAGlmbAICAAAAAAsoKGKNAIAmsnRfg==")
+	if err != nil {
+		t.Fatalf("DecodeSCTE35 failed: %v", err)
+	}
+	if info.CommandType != TimeSignal || info.SpliceTime == nil || *info.SpliceTime != 0x072bd0050 {
+		t.Errorf("Unexpected time_signal: %+v", info)
+	}
+	if len(info.Segmentations) != 1 {
+		t.Fatalf("Expected 1 segmentation descriptor, got %d", len(info.Segmentations))
+	}
+	d := info.Segmentations[0]
+	if d.EventID != 0x4800008e || d.TypeID != 0x34 || d.Duration != 307*time.Second ||
+		d.UPIDType != 0x08 || len(d.UPID) != 8 || d.SegmentNum != 2 {
+		t.Errorf("Unexpected segmentation descriptor: %+v", d)
+	}
+	if cue, duration := info.AdCue(); cue != CueOut || duration != 307*time.Second {
+		t.Errorf("AdCue() = %v, %v; expected a 307s cue out", cue, duration)
+	}
+}
+
+func TestDecodeSCTE35CueIn(t *testing.T) {
+	// An immediate splice_insert returning to the network
+	section := withCRC([]byte{
+		0xfc, 0x30, 0x1b, // table_id, section_length
+		0x00,                         // protocol_version
+		0x00, 0x00, 0x00, 0x00, 0x00, // not encrypted, pts_adjustment
+		0x00,             // cw_index
+		0xff, 0xf0, 0x0a, // tier, splice_command_length
+		0x05,                   // splice_insert
+		0x00, 0x00, 0x00, 0x01, // splice_event_id
+		0x7f,       // not cancelled
+		0x5f,       // in, program splice, no duration, immediate
+		0x00, 0x00, // unique_program_id
+		0x00, 0x00, // avail_num, avails_expected
+		0x00, 0x00, // descriptor_loop_length
+	})
+
+	info, err := DecodeSCTE35(base64.StdEncoding.EncodeToString(section))
+	if err != nil {
+		t.Fatalf("DecodeSCTE35 failed: %v", err)
+	}
+	if info.SpliceInsert == nil || info.SpliceInsert.OutOfNetwork || !info.SpliceInsert.Immediate || info.SpliceTime != nil {
+		t.Errorf("Unexpected splice_insert: %+v", info.SpliceInsert)
+	}
+	if cue, _ := info.AdCue(); cue != CueIn {
+		t.Errorf("AdCue() = %v, expected CueIn", cue)
+	}
+}
+
+func TestDecodeSCTE35Errors(t *testing.T) {
+	corrupt, _ := base64.StdEncoding.DecodeString("/DAvAAAAAAAA///wFAVIAACPf+/+c2nALv4AUsz1AAAAAAAKAAhDVUVJAAABNWLbowo=")
+	corrupt[20] ^= 0xff
+
+	for name, payload := range map[string]string{
+		"not base64 or hex": "not a payload!",
+		"not SCTE-35":       "0x474011",
+		"truncated":         "0xFC302F0000",
+		"CRC mismatch":      base64.StdEncoding.EncodeToString(corrupt),
+	} {
+		if _, err := DecodeSCTE35(payload); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// defaultPathway is the pathway of variants without a PATHWAY-ID attribute.
+const defaultPathway = "."
+
+// SteeringManifest is a content steering manifest, the JSON document the
+// SERVER-URI of an #EXT-X-CONTENT-STEERING tag points at.
+//
+// See: https://datatracker.ietf.org/doc/html/draft-pantos-hls-rfc8216bis#section-7.2
+type SteeringManifest struct {
+	// Version is the VERSION of the manifest format
+	Version int `json:"VERSION"`
+	// TTL is how many seconds a player may use the manifest before reloading
+	TTL int `json:"TTL"`
+	// ReloadURI is where to reload the manifest from, if not SERVER-URI
+	ReloadURI string `json:"RELOAD-URI,omitempty"`
+	// PathwayPriority lists the pathways in order of preference
+	PathwayPriority []string `json:"PATHWAY-PRIORITY"`
+}
+
+// ParseSteeringManifest parses a content steering manifest.
+func ParseSteeringManifest(content []byte) (*SteeringManifest, error) {
+	var manifest SteeringManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid steering manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// variantPathway returns the pathway a variant belongs to.
+func variantPathway(v Variant) string {
+	if v.PathwayID == "" {
+		return defaultPathway
+	}
+	return v.PathwayID
+}
+
+// pathways returns the distinct pathways of a master playlist's variants, in
+// the order they first appear.
+func pathways(m3u8 *M3U8File) []string {
+	var result []string
+	for _, v := range m3u8.Variants {
+		if p := variantPathway(v); !slices.Contains(result, p) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// choosePathway picks the pathway to download out of available.
+//
+// An explicitly preferred pathway wins and must exist. Otherwise the first
+// available pathway in the steering manifest's priority list is used, then
+// the PATHWAY-ID of the steering tag, then the first pathway of the playlist.
+func choosePathway(available []string, preferred string, manifest *SteeringManifest, steering *ContentSteering) (string, error) {
+	if preferred != "" {
+		if !slices.Contains(available, preferred) {
+			return "", fmt.Errorf("pathway %q not found (available: %s)", preferred, strings.Join(available, ", "))
+		}
+		return preferred, nil
+	}
+	if manifest != nil {
+		for _, p := range manifest.PathwayPriority {
+			if slices.Contains(available, p) {
+				return p, nil
+			}
+		}
+	}
+	if steering != nil && slices.Contains(available, steering.PathwayID) {
+		return steering.PathwayID, nil
+	}
+	return available[0], nil
+}
+
+// selectPathway marks the variants and renditions of every pathway but one
+// as Unselected in refs, so only one copy of a content-steered stream is
+// downloaded.
+//
+// The pathway is the configured one or, failing that, the one the steering
+// manifest prefers. Renditions are selected through the rendition groups
+// the chosen variants use; renditions no variant uses are kept.
+func (d *Downloader) selectPathway(ctx context.Context, m3u8File *M3U8File, refs map[string]resourceRef) error {
+	available := pathways(m3u8File)
+	if len(available) == 0 || (len(available) == 1 && d.pathway == "") {
+		return nil
+	}
+
+	// A steering manifest that can't be loaded only leaves the choice to
+	// the playlist, like it does for players. It is kept for when it is
+	// downloaded, so both see the same response.
+	var manifest *SteeringManifest
+	if steering := m3u8File.ContentSteering; steering != nil && steering.URL != "" && d.pathway == "" {
+		resp, err := d.prefetch(ctx, steering.URL)
+		if err == nil {
+			manifest, err = ParseSteeringManifest(resp.Body)
+		}
+		if err != nil {
+			d.progress.PrintWarning("failed to load steering manifest %s: %v", steering.URL, err)
+		}
+	}
+
+	pathway, err := choosePathway(available, d.pathway, manifest, m3u8File.ContentSteering)
+	if err != nil {
+		return err
+	}
+	d.progress.PrintVerbose("Using pathway %s (available: %s)", pathway, strings.Join(available, ", "))
+
+	// Groups are keyed by "TYPE/GROUP-ID", since an AUDIO and a SUBTITLES
+	// group may share an ID
+	keep := make(map[string]bool)
+	groups := make(map[string]bool)    // Rendition groups of the chosen pathway
+	allGroups := make(map[string]bool) // Rendition groups of any pathway
+	for _, v := range m3u8File.Variants {
+		chosen := variantPathway(v) == pathway
+		if chosen {
+			keep[v.URL] = true
+		}
+		for groupType, group := range map[string]string{
+			"AUDIO":           v.Audio,
+			"VIDEO":           v.Video,
+			"SUBTITLES":       v.Subtitles,
+			"CLOSED-CAPTIONS": v.ClosedCaptions,
+		} {
+			if group != "" {
+				key := groupType + "/" + group
+				allGroups[key] = true
+				groups[key] = groups[key] || chosen
+			}
+		}
+	}
+	for _, r := range m3u8File.Renditions {
+		key := r.Type + "/" + r.GroupID
+		if groups[key] || !allGroups[key] {
+			keep[r.URL] = true
+		}
+	}
+
+	unselect := func(u string) {
+		if ref, ok := refs[u]; ok && u != "" && !keep[u] {
+			ref.Unselected = true
+			refs[u] = ref
+		}
+	}
+	for _, v := range m3u8File.Variants {
+		unselect(v.URL)
+	}
+	for _, r := range m3u8File.Renditions {
+		unselect(r.URL)
+	}
+	return nil
+}
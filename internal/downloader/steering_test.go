@@ -0,0 +1,174 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestChoosePathway(t *testing.T) {
+	available := []string{"CDN-A", "CDN-B", "CDN-C"}
+	manifest := &SteeringManifest{PathwayPriority: []string{"CDN-X", "CDN-B", "CDN-A"}}
+	steering := &ContentSteering{PathwayID: "CDN-C"}
+
+	tests := []struct {
+		name      string
+		preferred string
+		manifest  *SteeringManifest
+		steering  *ContentSteering
+		expected  string
+	}{
+		{"preferred", "CDN-C", manifest, steering, "CDN-C"},
+		{"manifest priority", "", manifest, steering, "CDN-B"},
+		{"steering tag", "", nil, steering, "CDN-C"},
+		{"first pathway", "", nil, nil, "CDN-A"},
+		{"unknown steering tag pathway", "", nil, &ContentSteering{PathwayID: "CDN-X"}, "CDN-A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := choosePathway(available, tt.preferred, tt.manifest, tt.steering)
+			if err != nil || got != tt.expected {
+				t.Errorf("choosePathway() = %q, %v; expected %q", got, err, tt.expected)
+			}
+		})
+	}
+
+	if _, err := choosePathway(available, "CDN-X", manifest, steering); err == nil {
+		t.Error("Expected an error for an unknown preferred pathway")
+	}
+}
+
+func TestDownloadContentSteering(t *testing.T) {
+	files := map[string]string{
+		"/master.m3u8": "#EXTM3U\n" +
+			"#EXT-X-SESSION-DATA:DATA-ID=\"com.example.title\",URI=\"session.json\"\n" +
+			"#EXT-X-SESSION-KEY:METHOD=AES-128,URI=\"session.key\"\n" +
+			"#EXT-X-CONTENT-STEERING:SERVER-URI=\"/steering?session=1\",PATHWAY-ID=\"CDN-A\"\n" +
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud-a\",NAME=\"en\",URI=\"a/audio.m3u8\"\n" +
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud-b\",NAME=\"en\",URI=\"b/audio.m3u8\"\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO=\"aud-a\",PATHWAY-ID=\"CDN-A\"\na/video.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO=\"aud-b\",PATHWAY-ID=\"CDN-B\"\nb/video.m3u8\n",
+		"/steering":     `{"VERSION":1,"TTL":300,"PATHWAY-PRIORITY":["CDN-B","CDN-A"]}`,
+		"/session.json": `{"title":"Example"}`,
+		"/session.key":  "0123456789abcdef",
+		"/a/audio.m3u8": "#EXTM3U\n#EXTINF:10,\na0.aac\n#EXT-X-ENDLIST\n",
+		"/a/video.m3u8": "#EXTM3U\n#EXTINF:10,\nv0.ts\n#EXT-X-ENDLIST\n",
+		"/b/audio.m3u8": "#EXTM3U\n#EXTINF:10,\na0.aac\n#EXT-X-ENDLIST\n",
+		"/b/video.m3u8": "#EXTM3U\n#EXTINF:10,\nv0.ts\n#EXT-X-ENDLIST\n",
+		"/a/a0.aac":     "audio",
+		"/a/v0.ts":      "video",
+		"/b/a0.aac":     "audio",
+		"/b/v0.ts":      "video",
+	}
+
+	tests := []struct {
+		name     string
+		pathway  string
+		selected string
+		skipped  string
+	}{
+		{"steering manifest", "", "/b/", "/a/"},
+		{"preferred pathway", "CDN-A", "/a/", "/b/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			requested := make(map[string]int)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requested[r.URL.Path]++
+				mu.Unlock()
+				content, ok := files[r.URL.Path]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(content))
+			}))
+			defer srv.Close()
+
+			outputDir := t.TempDir()
+			d := New(Config{
+				OutputDir:   outputDir,
+				Concurrency: 2,
+				RewriteURLs: true,
+				Pathway:     tt.pathway,
+				Quiet:       true,
+			})
+			if err := d.Download(context.Background(), srv.URL+"/master.m3u8"); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			for p := range files {
+				switch {
+				case strings.HasPrefix(p, tt.skipped):
+					if requested[p] > 0 {
+						t.Errorf("Expected %s of the other pathway to be skipped", p)
+					}
+				case requested[p] == 0:
+					t.Errorf("Expected %s to be fetched", p)
+				}
+			}
+			// The manifest that chose the pathway is the one that is stored
+			if requested["/steering"] != 1 {
+				t.Errorf("Expected the steering manifest to be fetched once, got %d requests", requested["/steering"])
+			}
+
+			master, err := os.ReadFile(filepath.Join(outputDir, "master.m3u8"))
+			if err != nil {
+				t.Fatalf("Failed to read master playlist: %v", err)
+			}
+			for _, expected := range []string{`URI="session.json"`, `URI="session.key"`, `SERVER-URI="steering"`, srv.URL + tt.skipped + "video.m3u8"} {
+				if !strings.Contains(string(master), expected) {
+					t.Errorf("Expected %s in the rewritten master playlist:\n%s", expected, master)
+				}
+			}
+			for _, p := range []string{"session.json", "session.key", "steering"} {
+				if _, err := os.Stat(filepath.Join(outputDir, p)); err != nil {
+					t.Errorf("Expected %s to be written: %v", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectPathwayGroupTypes(t *testing.T) {
+	// An AUDIO and a SUBTITLES group share the ID "main" on different
+	// pathways
+	master := "#EXTM3U\n" +
+		"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"main\",NAME=\"en\",URI=\"a/audio.m3u8\"\n" +
+		"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"main\",NAME=\"en\",URI=\"b/subs.m3u8\"\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO=\"main\",PATHWAY-ID=\"CDN-A\"\na/video.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=1000,SUBTITLES=\"main\",PATHWAY-ID=\"CDN-B\"\nb/video.m3u8\n"
+	masterURL := "https://example.com/master.m3u8"
+	base, _ := url.Parse(masterURL)
+	m3u8, err := ParseM3U8([]byte(master), base)
+	if err != nil {
+		t.Fatalf("ParseM3U8 failed: %v", err)
+	}
+	refs := classifyReferences(m3u8, masterURL, "")
+
+	d := New(Config{OutputDir: t.TempDir(), Pathway: "CDN-A", Quiet: true})
+	if err := d.selectPathway(context.Background(), m3u8, refs); err != nil {
+		t.Fatalf("selectPathway failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"https://example.com/a/audio.m3u8": false,
+		"https://example.com/a/video.m3u8": false,
+		"https://example.com/b/subs.m3u8":  true,
+		"https://example.com/b/video.m3u8": true,
+	}
+	for u, unselected := range expected {
+		if refs[u].Unselected != unselected {
+			t.Errorf("%s: Unselected = %v; expected %v", u, refs[u].Unselected, unselected)
+		}
+	}
+}
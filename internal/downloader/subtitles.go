@@ -0,0 +1,158 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/knpwrs/m3u8dl/internal/webvtt"
+)
+
+// SubtitleExport selects the merged subtitle files written for each subtitle
+// rendition of a mirrored master playlist.
+type SubtitleExport struct {
+	// WebVTT writes the rendition's segments merged into one .vtt file
+	WebVTT bool
+	// SRT writes the merged cues as a SubRip .srt file
+	SRT bool
+}
+
+// enabled reports whether any merged subtitle file is written.
+func (e SubtitleExport) enabled() bool {
+	return e.WebVTT || e.SRT
+}
+
+// writeSubtitles merges the WebVTT segments of every subtitle rendition of a
+// mirrored master playlist into single files next to it, named after the
+// rendition's LANGUAGE and NAME (e.g. "en.English.vtt" and "en.English.srt").
+//
+// Every media playlist must have been processed (and recorded with
+// recordMedia) already, and the segments are read back from disk. Renditions
+// that can't be merged (segments that weren't downloaded, are encrypted or
+// aren't WebVTT) are skipped with a warning.
+func (d *Downloader) writeSubtitles(m3u8URL string, master *M3U8File, keep func(string) bool) error {
+	baseURL, err := url.Parse(d.fs.MappedURL(m3u8URL))
+	if err != nil {
+		return fmt.Errorf("failed to parse M3U8 URL: %w", err)
+	}
+
+	names := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, rendition := range master.Renditions {
+		if rendition.Type != "SUBTITLES" || rendition.URL == "" || seen[rendition.URL] || !keep(rendition.URL) {
+			continue
+		}
+		seen[rendition.URL] = true
+
+		source, ok := d.recordedMedia(rendition.URL)
+		if !ok {
+			continue
+		}
+		merged, err := d.mergeSubtitles(source)
+		if err != nil {
+			d.progress.PrintWarning("not merging subtitles %s: %v", rendition.URL, err)
+			continue
+		}
+
+		name := subtitleFileName(rendition, names)
+		if d.subtitles.WebVTT {
+			if err := d.writeSubtitleFile(resolveURL(baseURL, name+".vtt"), merged.Bytes()); err != nil {
+				return err
+			}
+		}
+		if d.subtitles.SRT {
+			if err := d.writeSubtitleFile(resolveURL(baseURL, name+".srt"), merged.SRT()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeSubtitles reads the downloaded segments of a subtitle media playlist
+// and merges them.
+func (d *Downloader) mergeSubtitles(source mediaSource) (*webvtt.File, error) {
+	if len(source.playlist.Segments) == 0 {
+		return nil, errors.New("no segments")
+	}
+
+	segments := make([]*webvtt.File, 0, len(source.playlist.Segments))
+	for _, segment := range source.playlist.Segments {
+		if segment.KeyMethod != "" {
+			return nil, fmt.Errorf("%s encryption is not supported", segment.KeyMethod)
+		}
+		if !source.keep(segment.URL) {
+			return nil, fmt.Errorf("%s was filtered out", segment.URL)
+		}
+
+		localPath, err := d.fs.GetLocalPath(segment.URL)
+		if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read segment: %w", err)
+		}
+		if r := segment.ByteRange; r != nil && r.Offset >= 0 && r.Offset+r.Length <= int64(len(content)) {
+			content = content[r.Offset : r.Offset+r.Length]
+		}
+
+		file, err := webvtt.Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", segment.URL, err)
+		}
+		segments = append(segments, file)
+	}
+	return webvtt.Merge(segments), nil
+}
+
+// writeSubtitleFile writes a merged subtitle file.
+func (d *Downloader) writeSubtitleFile(fileURL string, content []byte) error {
+	localPath, err := d.fs.WriteFile(fileURL, content)
+	if err != nil {
+		return fmt.Errorf("failed to write subtitles: %w", err)
+	}
+	d.progress.PrintVerbose("Wrote subtitles to %s", localPath)
+	return nil
+}
+
+// subtitleFileName returns the file name, without extension, of a
+// rendition's merged subtitles: its LANGUAGE and NAME joined with a dot, made
+// safe for file names and unique among the names already used.
+func subtitleFileName(rendition Rendition, used map[string]bool) string {
+	var parts []string
+	for _, part := range []string{rendition.Language, rendition.Name} {
+		if part = sanitizeSubtitleName(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	base := strings.Join(parts, ".")
+	if base == "" {
+		base = "subtitles"
+	}
+
+	name := base
+	for i := 2; used[name]; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	used[name] = true
+	return name
+}
+
+// sanitizeSubtitleName keeps the letters, digits, dashes and underscores of
+// a LANGUAGE or NAME, replacing spaces with underscores.
+func sanitizeSubtitleName(s string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			return r
+		case unicode.IsSpace(r):
+			return '_'
+		}
+		return -1
+	}, s), "_")
+}
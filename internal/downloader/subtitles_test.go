@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubtitleFileName(t *testing.T) {
+	used := make(map[string]bool)
+	tests := []struct {
+		rendition Rendition
+		expected  string
+	}{
+		{Rendition{Language: "en", Name: "English"}, "en.English"},
+		{Rendition{Language: "en", Name: "English"}, "en.English-2"},
+		{Rendition{Language: "en", Name: "English (SDH)"}, "en.English_SDH"},
+		{Rendition{Language: "es", Name: "Español"}, "es.Español"},
+		{Rendition{Name: "../Commentary"}, "Commentary"},
+		{Rendition{}, "subtitles"},
+	}
+	for _, tt := range tests {
+		if got := subtitleFileName(tt.rendition, used); got != tt.expected {
+			t.Errorf("subtitleFileName(%+v) = %q; expected %q", tt.rendition, got, tt.expected)
+		}
+	}
+}
+
+func TestDownloadMergedSubtitles(t *testing.T) {
+	files := map[string]string{
+		"/master.m3u8": "#EXTM3U\n" +
+			"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"English\",LANGUAGE=\"en\",URI=\"subs/en.m3u8\"\n" +
+			"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"subs\",NAME=\"Deutsch\",LANGUAGE=\"de\",URI=\"subs/de.m3u8\"\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=1000,SUBTITLES=\"subs\"\nvideo.m3u8\n",
+		"/video.m3u8":   "#EXTM3U\n#EXTINF:6,\nv0.ts\n#EXTINF:6,\nv1.ts\n#EXT-X-ENDLIST\n",
+		"/subs/en.m3u8": "#EXTM3U\n#EXTINF:6,\nen0.vtt\n#EXTINF:6,\nen1.vtt\n#EXT-X-ENDLIST\n",
+		"/subs/de.m3u8": "#EXTM3U\n#EXTINF:6,\nde0.vtt\n#EXT-X-ENDLIST\n",
+		// The second segment repeats the cue spanning the boundary, and its
+		// cue times start again from 0
+		"/subs/en0.vtt": "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\n\n00:00:01.000 --> 00:00:03.000\nHello\n\n00:00:05.000 --> 00:00:06.000\n<i>Across</i> the boundary\n",
+		"/subs/en1.vtt": "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:1440000,LOCAL:00:00:00.000\n\n00:00:00.000 --> 00:00:01.500\n<i>Across</i> the boundary\n\n00:00:02.000 --> 00:00:03.000\nGoodbye &amp; thanks\n",
+		"/subs/de0.vtt": "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nHallo\n",
+		"/v0.ts":        "video",
+		"/v1.ts":        "video",
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	outputDir := t.TempDir()
+	d := New(Config{
+		OutputDir:   outputDir,
+		Concurrency: 2,
+		RewriteURLs: true,
+		Subtitles:   SubtitleExport{WebVTT: true, SRT: true},
+		Quiet:       true,
+	})
+	if err := d.Download(context.Background(), srv.URL+"/master.m3u8"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"en.English.vtt": "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nHello\n\n00:00:05.000 --> 00:00:07.500\n<i>Across</i> the boundary\n\n00:00:08.000 --> 00:00:09.000\nGoodbye &amp; thanks\n",
+		"en.English.srt": "1\n00:00:01,000 --> 00:00:03,000\nHello\n\n2\n00:00:05,000 --> 00:00:07,500\n<i>Across</i> the boundary\n\n3\n00:00:08,000 --> 00:00:09,000\nGoodbye & thanks\n",
+		"de.Deutsch.vtt": "WEBVTT\n\n00:00:01.000 --> 00:00:03.000\nHallo\n",
+		"de.Deutsch.srt": "1\n00:00:01,000 --> 00:00:03,000\nHallo\n",
+	}
+	for name, content := range expected {
+		got, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q; expected %q", name, got, content)
+		}
+	}
+
+	// The segments are still mirrored for HLS players
+	if _, err := os.Stat(filepath.Join(outputDir, "subs", "en0.vtt")); err != nil {
+		t.Errorf("Expected the segments to be kept: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlNode is a node of an XML document kept exactly as written: prefixes,
+// namespace declarations, comments and whitespace survive a round trip, which
+// encoding/xml's Marshal can't guarantee.
+//
+// Element nodes have a Name; text, comment, processing instruction and
+// directive nodes have an empty Name and their raw token in Token.
+type xmlNode struct {
+	// Name is the qualified name as written (e.g. "MPD" or "cenc:pssh")
+	Name     string
+	Attrs    []xml.Attr
+	Children []*xmlNode
+	// Token is the CharData, Comment, ProcInst or Directive of a non-element
+	// node
+	Token xml.Token
+}
+
+// parseXMLTree parses a document into a tree rooted at a synthetic node
+// whose children are the top-level nodes (declaration, comments and the
+// document element).
+func parseXMLTree(content []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = true
+
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %w", err)
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{Name: qualifiedName(t.Name), Attrs: t.Attr}
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			if len(stack) == 1 || qualifiedName(t.Name) != parent.Name {
+				return nil, fmt.Errorf("invalid XML: unexpected </%s>", qualifiedName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			parent.Children = append(parent.Children, &xmlNode{Token: xml.CopyToken(token)})
+		}
+	}
+	if len(stack) != 1 {
+		return nil, errors.New("invalid XML: unexpected end of document")
+	}
+	return root, nil
+}
+
+// qualifiedName joins a raw name's prefix and local name.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// localName returns a qualified name without its prefix.
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i != -1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// textEscaper escapes character data.
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// bytes serializes the children of a root node returned by parseXMLTree.
+func (n *xmlNode) bytes() []byte {
+	var buf bytes.Buffer
+	for _, child := range n.Children {
+		child.write(&buf)
+	}
+	return buf.Bytes()
+}
+
+// write serializes a node and its descendants.
+func (n *xmlNode) write(buf *bytes.Buffer) {
+	switch t := n.Token.(type) {
+	case xml.CharData:
+		// Unlike xml.EscapeText, leave line breaks and tabs as they are
+		textEscaper.WriteString(buf, string(t))
+		return
+	case xml.Comment:
+		buf.WriteString("<!--")
+		buf.Write(t)
+		buf.WriteString("-->")
+		return
+	case xml.ProcInst:
+		buf.WriteString("<?" + t.Target)
+		if len(t.Inst) > 0 {
+			buf.WriteString(" ")
+			buf.Write(t.Inst)
+		}
+		buf.WriteString("?>")
+		return
+	case xml.Directive:
+		buf.WriteString("<!")
+		buf.Write(t)
+		buf.WriteString(">")
+		return
+	}
+
+	buf.WriteString("<" + n.Name)
+	for _, attr := range n.Attrs {
+		buf.WriteString(" " + qualifiedName(attr.Name) + `="`)
+		xml.EscapeText(buf, []byte(attr.Value))
+		buf.WriteString(`"`)
+	}
+	if len(n.Children) == 0 {
+		buf.WriteString("/>")
+		return
+	}
+	buf.WriteString(">")
+	for _, child := range n.Children {
+		child.write(buf)
+	}
+	buf.WriteString("</" + n.Name + ">")
+}
+
+// elements returns the child elements with the given local name, or all
+// child elements if name is empty.
+func (n *xmlNode) elements(name string) []*xmlNode {
+	var elements []*xmlNode
+	for _, child := range n.Children {
+		if child.Name != "" && (name == "" || localName(child.Name) == name) {
+			elements = append(elements, child)
+		}
+	}
+	return elements
+}
+
+// element returns the first child element with the given local name, or nil.
+func (n *xmlNode) element(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, child := range n.Children {
+		if child.Name != "" && localName(child.Name) == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// attr returns the value of the attribute with the given local name and
+// whether it is present. It is safe to call on a nil node.
+func (n *xmlNode) attr(name string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name && attr.Name.Space != "xmlns" {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// setAttr sets an unprefixed attribute, adding it if it isn't present.
+func (n *xmlNode) setAttr(name, value string) {
+	for i, attr := range n.Attrs {
+		if attr.Name.Local == name && attr.Name.Space == "" {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+// text returns the concatenated character data of a node, trimmed.
+func (n *xmlNode) text() string {
+	var text strings.Builder
+	for _, child := range n.Children {
+		if data, ok := child.Token.(xml.CharData); ok {
+			text.Write(data)
+		}
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// remove removes a child, along with the whitespace that indented it.
+func (n *xmlNode) remove(child *xmlNode) {
+	for i, c := range n.Children {
+		if c != child {
+			continue
+		}
+		start := i
+		if i > 0 && isWhitespace(n.Children[i-1]) {
+			start--
+		}
+		n.Children = append(n.Children[:start], n.Children[i+1:]...)
+		return
+	}
+}
+
+// insertBefore inserts child before the first child element with one of the
+// given local names, or at the end. The child and its descendants are
+// indented like the element it is inserted before, or one level deeper than
+// the parent's closing tag.
+func (n *xmlNode) insertBefore(child *xmlNode, names ...string) {
+	at := len(n.Children)
+find:
+	for i, c := range n.Children {
+		if c.Name == "" {
+			continue
+		}
+		for _, name := range names {
+			if localName(c.Name) == name {
+				at = i
+				break find
+			}
+		}
+	}
+
+	var indent string
+	nodes := []*xmlNode{child}
+	switch {
+	case at == 0 || !isWhitespace(n.Children[at-1]):
+		// Not indented
+	case at < len(n.Children):
+		indent = string(n.Children[at-1].Token.(xml.CharData))
+		nodes = append(nodes, &xmlNode{Token: xml.CharData(indent)})
+	default:
+		// Keep the whitespace before the closing tag last
+		at--
+		indent = string(n.Children[at].Token.(xml.CharData)) + "  "
+		nodes = []*xmlNode{{Token: xml.CharData(indent)}, child}
+	}
+	if indent != "" {
+		child.indent(indent)
+	}
+	n.Children = append(n.Children[:at], append(nodes, n.Children[at:]...)...)
+}
+
+// indent puts each child element of a new node on its own line, one level
+// deeper than indent, the whitespace before the node.
+func (n *xmlNode) indent(indent string) {
+	if len(n.elements("")) == 0 {
+		return
+	}
+	children := make([]*xmlNode, 0, 2*len(n.Children)+1)
+	for _, child := range n.Children {
+		child.indent(indent + "  ")
+		children = append(children, &xmlNode{Token: xml.CharData(indent + "  ")}, child)
+	}
+	n.Children = append(children, &xmlNode{Token: xml.CharData(indent)})
+}
+
+// isWhitespace reports whether a node is whitespace-only character data.
+func isWhitespace(n *xmlNode) bool {
+	data, ok := n.Token.(xml.CharData)
+	return ok && len(bytes.TrimSpace(data)) == 0
+}
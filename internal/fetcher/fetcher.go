@@ -2,9 +2,11 @@ package fetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	retryablehttp "github.com/hashicorp/go-retryablehttp"
@@ -20,6 +22,8 @@ import (
 type Fetcher struct {
 	client    *retryablehttp.Client
 	userAgent string
+	headers   http.Header  // Extra headers sent with every request
+	limiter   *rateLimiter // nil if requests aren't rate limited
 }
 
 // Options configures the Fetcher behavior.
@@ -32,6 +36,15 @@ type Options struct {
 	RetryWaitMin time.Duration
 	// RetryWaitMax is the maximum time to wait between retries
 	RetryWaitMax time.Duration
+	// RateLimit is the maximum number of requests started per second,
+	// including retries (0 means unlimited)
+	RateLimit float64
+	// Headers are sent with every request, overriding UserAgent if they
+	// include a User-Agent
+	Headers http.Header
+	// Proxy is the proxy to send requests through. If nil, the standard
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.
+	Proxy *url.URL
 }
 
 // DefaultOptions returns sensible default options for the Fetcher.
@@ -49,6 +62,9 @@ func DefaultOptions() Options {
 // The Fetcher uses exponential backoff for retries and will automatically
 // retry on network errors and 5xx server errors.
 //
+// A Fetcher is safe for concurrent use, and sharing one between several
+// downloads shares its connection pool and rate limit.
+//
 // See: https://context7.com/golang/go for Go documentation
 func New(opts Options) *Fetcher {
 	client := retryablehttp.NewClient()
@@ -56,10 +72,118 @@ func New(opts Options) *Fetcher {
 	client.RetryWaitMin = opts.RetryWaitMin
 	client.RetryWaitMax = opts.RetryWaitMax
 	client.Logger = nil // Disable default logging
+	if opts.Proxy != nil {
+		if transport, ok := client.HTTPClient.Transport.(*http.Transport); ok {
+			transport.Proxy = http.ProxyURL(opts.Proxy)
+		}
+	}
 
-	return &Fetcher{
+	f := &Fetcher{
 		client:    client,
 		userAgent: opts.UserAgent,
+		headers:   opts.Headers.Clone(),
+	}
+	if opts.RateLimit > 0 {
+		f.limiter = newRateLimiter(opts.RateLimit)
+	}
+	client.RequestLogHook = f.beforeAttempt
+	client.HTTPClient.CheckRedirect = checkRedirect
+
+	return f
+}
+
+// Response holds the body and metadata of a successful request.
+type Response struct {
+	// Body is the complete response body
+	Body []byte
+	// Header contains the response headers
+	Header http.Header
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// ContentLength is the length the server reported, or -1 if unknown
+	ContentLength int64
+	// Retries is the number of times the request was retried before it
+	// succeeded
+	Retries int
+	// URL is the URL the response came from, after following redirects.
+	// Relative references in the body are relative to this URL.
+	URL string
+	// Redirects are the URLs the request was redirected to, in order (so
+	// the last one is URL). It is empty if there were no redirects.
+	Redirects []string
+}
+
+// maxRedirects is the number of redirects followed before giving up, the same
+// as net/http's default policy.
+const maxRedirects = 10
+
+// attemptsKey is the context key for a request's retry counter.
+type attemptsKey struct{}
+
+// redirectsKey is the context key for a request's redirect chain.
+type redirectsKey struct{}
+
+// beforeAttempt runs before every attempt of every request. It waits for
+// the rate limiter, and records the attempt number in the counter stored in
+// the request's context so the number of retries can be reported.
+func (f *Fetcher) beforeAttempt(_ retryablehttp.Logger, req *http.Request, attempt int) {
+	if f.limiter != nil {
+		// A cancelled context fails the request right after this returns
+		f.limiter.wait(req.Context())
+	}
+	if retries, ok := req.Context().Value(attemptsKey{}).(*int); ok {
+		*retries = attempt
+	}
+	// Only the redirects of the attempt that succeeds count
+	if redirects, ok := req.Context().Value(redirectsKey{}).(*[]string); ok {
+		*redirects = (*redirects)[:0]
+	}
+}
+
+// checkRedirect records every redirect in the chain stored in the request's
+// context, and stops after maxRedirects like net/http does by default.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	if redirects, ok := req.Context().Value(redirectsKey{}).(*[]string); ok {
+		*redirects = append(*redirects, req.URL.String())
+	}
+	return nil
+}
+
+// finalURL returns the URL a response came from, after redirects.
+func finalURL(resp *http.Response, requested string) string {
+	if resp.Request != nil && resp.Request.URL != nil {
+		return resp.Request.URL.String()
+	}
+	return requested
+}
+
+// LastModified returns the parsed Last-Modified header, or the zero time if
+// the server didn't send a valid one.
+func (r *Response) LastModified() time.Time {
+	value := r.Header.Get("Last-Modified")
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// setHeaders adds the User-Agent and custom headers to a request.
+func (f *Fetcher) setHeaders(req *retryablehttp.Request) {
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	for name, values := range f.headers {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
 	}
 }
 
@@ -76,14 +200,31 @@ func New(opts Options) *Fetcher {
 //
 // See: https://context7.com/golang/go for Go context documentation
 func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	resp, err := f.FetchResponse(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// FetchResponse downloads content from the given URL along with the response
+// metadata.
+//
+// This behaves exactly like Fetch, but also exposes the response headers so
+// callers can make use of things like Last-Modified, and the URL the response
+// came from after redirects.
+func (f *Fetcher) FetchResponse(ctx context.Context, url string) (*Response, error) {
+	retries := new(int)
+	ctx = context.WithValue(ctx, attemptsKey{}, retries)
+	redirects := new([]string)
+	ctx = context.WithValue(ctx, redirectsKey{}, redirects)
+
 	req, err := retryablehttp.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
 	}
 
-	if f.userAgent != "" {
-		req.Header.Set("User-Agent", f.userAgent)
-	}
+	f.setHeaders(req)
 
 	resp, err := f.client.Do(req)
 	if err != nil {
@@ -100,7 +241,46 @@ func (f *Fetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to read response body from %s: %w", url, err)
 	}
 
-	return body, nil
+	return &Response{
+		Body:          body,
+		Header:        resp.Header,
+		StatusCode:    resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		Retries:       *retries,
+		URL:           finalURL(resp, url),
+		Redirects:     *redirects,
+	}, nil
+}
+
+// Head sends a HEAD request for the given URL and returns the response
+// metadata without a body.
+//
+// This is useful for learning the size of a file (from ContentLength)
+// without downloading it.
+func (f *Fetcher) Head(ctx context.Context, url string) (*Response, error) {
+	req, err := retryablehttp.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
+	}
+
+	f.setHeaders(req)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d for %s", resp.StatusCode, url)
+	}
+
+	return &Response{
+		Header:        resp.Header,
+		StatusCode:    resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		URL:           finalURL(resp, url),
+	}, nil
 }
 
 // FetchWithCallback downloads content and calls a callback with progress information.
@@ -120,9 +300,7 @@ func (f *Fetcher) FetchWithCallback(ctx context.Context, url string, callback fu
 		return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
 	}
 
-	if f.userAgent != "" {
-		req.Header.Set("User-Agent", f.userAgent)
-	}
+	f.setHeaders(req)
 
 	resp, err := f.client.Do(req)
 	if err != nil {
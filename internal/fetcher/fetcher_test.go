@@ -0,0 +1,169 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchResponseCountsRetries(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	f := New(Options{
+		MaxRetries:   3,
+		RetryWaitMin: time.Millisecond,
+		RetryWaitMax: time.Millisecond,
+	})
+
+	resp, err := f.FetchResponse(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("FetchResponse failed: %v", err)
+	}
+	if string(resp.Body) != "hello" || resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"abc"` {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if resp.Retries != 2 {
+		t.Errorf("Expected 2 retries, got %d", resp.Retries)
+	}
+
+	// A request that succeeds first time has no retries
+	resp, err = f.FetchResponse(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("FetchResponse failed: %v", err)
+	}
+	if resp.Retries != 0 {
+		t.Errorf("Expected 0 retries, got %d", resp.Retries)
+	}
+}
+
+func TestHead(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Expected a HEAD request, got %s", r.Method)
+		}
+		w.Header().Set("Content-Length", "1234")
+	}))
+	defer srv.Close()
+
+	resp, err := New(DefaultOptions()).Head(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Head failed: %v", err)
+	}
+	if resp.ContentLength != 1234 {
+		t.Errorf("Expected a content length of 1234, got %d", resp.ContentLength)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	opts := DefaultOptions()
+	opts.RateLimit = 20
+	f := New(opts)
+
+	// Five requests at 20 per second need at least 200ms between the first
+	// and last start
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+			t.Fatalf("Fetch failed: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("Expected rate limiting to take at least 200ms, took %v", elapsed)
+	}
+}
+
+func TestHeadersAndProxy(t *testing.T) {
+	// The proxy sees the absolute URL of the origin, which doesn't exist
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "origin.invalid" {
+			t.Errorf("Expected a proxied request for origin.invalid, got %s", r.URL)
+		}
+		if got := r.Header.Get("Referer"); got != "https://example.com/" {
+			t.Errorf("Expected Referer header, got %q", got)
+		}
+		if got := r.Header.Get("User-Agent"); got != "custom/2.0" {
+			t.Errorf("Expected the User-Agent header to override the option, got %q", got)
+		}
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	opts := DefaultOptions()
+	opts.Proxy = proxyURL
+	opts.Headers = http.Header{
+		"Referer":    {"https://example.com/"},
+		"User-Agent": {"custom/2.0"},
+	}
+
+	body, err := New(opts).Fetch(context.Background(), "http://origin.invalid/master.m3u8")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if string(body) != "proxied" {
+		t.Errorf("Expected the proxy's response, got %q", body)
+	}
+}
+
+func TestFetchResponseFollowsRedirects(t *testing.T) {
+	edge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("#EXTM3U\n"))
+	}))
+	defer edge.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/live/master.m3u8":
+			http.Redirect(w, r, "/hop/master.m3u8", http.StatusFound)
+		case "/hop/master.m3u8":
+			http.Redirect(w, r, edge.URL+"/abc/master.m3u8", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	f := New(DefaultOptions())
+	resp, err := f.FetchResponse(context.Background(), origin.URL+"/live/master.m3u8")
+	if err != nil {
+		t.Fatalf("FetchResponse failed: %v", err)
+	}
+	if resp.URL != edge.URL+"/abc/master.m3u8" {
+		t.Errorf("Expected the final URL, got %s", resp.URL)
+	}
+	expected := []string{origin.URL + "/hop/master.m3u8", edge.URL + "/abc/master.m3u8"}
+	if len(resp.Redirects) != len(expected) || resp.Redirects[0] != expected[0] || resp.Redirects[1] != expected[1] {
+		t.Errorf("Expected redirects %v, got %v", expected, resp.Redirects)
+	}
+
+	// Without redirects the final URL is the requested one
+	resp, err = f.FetchResponse(context.Background(), edge.URL+"/abc/master.m3u8")
+	if err != nil {
+		t.Fatalf("FetchResponse failed: %v", err)
+	}
+	if resp.URL != edge.URL+"/abc/master.m3u8" || len(resp.Redirects) != 0 {
+		t.Errorf("Unexpected URL %s and redirects %v", resp.URL, resp.Redirects)
+	}
+
+	if _, err := f.FetchResponse(context.Background(), origin.URL+"/loop"); err == nil {
+		t.Error("Expected a redirect loop to fail")
+	}
+}
@@ -0,0 +1,48 @@
+package fetcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces requests evenly so that no more than a fixed number
+// start per second.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration // Time between request starts
+	next     time.Time     // When the next request may start
+}
+
+// newRateLimiter creates a rate limiter allowing perSecond requests per
+// second.
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+// wait blocks until the caller may start a request, or ctx is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
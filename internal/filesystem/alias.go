@@ -0,0 +1,45 @@
+package filesystem
+
+// Alias stores the resource at urlStr at the local path of target, as if it
+// had been fetched from target.
+//
+// This is used for redirects: a playlist fetched from one URL can be stored
+// where the URL it was requested as (or redirected to) would be. Aliases are
+// followed transitively. The first mapping of a URL wins, so Alias does
+// nothing if urlStr already has an alias or a local path.
+func (fs *FileSystem) Alias(urlStr, target string) {
+	if urlStr == target {
+		return
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, exists := fs.aliases[urlStr]; exists {
+		return
+	}
+	if _, exists := fs.urlToPath[urlStr]; exists {
+		return
+	}
+	// Don't create a cycle
+	if fs.resolveAlias(target) == urlStr {
+		return
+	}
+	fs.aliases[urlStr] = target
+}
+
+// MappedURL returns the URL whose local path urlStr is stored at, following
+// aliases. It is urlStr itself if it has no alias.
+func (fs *FileSystem) MappedURL(urlStr string) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.resolveAlias(urlStr)
+}
+
+// resolveAlias follows the aliases of urlStr. The caller must hold fs.mu.
+func (fs *FileSystem) resolveAlias(urlStr string) string {
+	for target, ok := fs.aliases[urlStr]; ok; target, ok = fs.aliases[urlStr] {
+		urlStr = target
+	}
+	return urlStr
+}
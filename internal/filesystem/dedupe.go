@@ -0,0 +1,136 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// dedupeIndex tracks which local file holds each unique blob of content.
+//
+// It is only used when deduplication is enabled. Access is protected by the
+// FileSystem mutex.
+type dedupeIndex struct {
+	hashToPath map[string]string // Content hash to the canonical file
+	pathToHash map[string]string // Canonical file to its content hash
+	files      int               // Number of files stored as links
+	savedBytes int64             // Bytes not written thanks to deduplication
+}
+
+// newDedupeIndex creates an empty dedupeIndex.
+func newDedupeIndex() *dedupeIndex {
+	return &dedupeIndex{
+		hashToPath: make(map[string]string),
+		pathToHash: make(map[string]string),
+	}
+}
+
+// hashContent returns the hex-encoded SHA-256 of content.
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// DedupeStats returns how many files were stored as links to identical
+// content and how many bytes that saved.
+func (fs *FileSystem) DedupeStats() (files int, savedBytes int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.dedupe == nil {
+		return 0, 0
+	}
+	return fs.dedupe.files, fs.dedupe.savedBytes
+}
+
+// canonicalFor returns an existing file with the given content hash, if any.
+//
+// Linked paths share one modification time, which the if-newer overwrite
+// policy compares against the next run's Last-Modified. So a file with a
+// known modTime is only linked to a copy stamped with the same time; one
+// with a different Last-Modified gets its own copy instead.
+func (fs *FileSystem) canonicalFor(hash, localPath string, size int64, modTime time.Time) (string, bool) {
+	fs.mu.Lock()
+	canonical, ok := fs.dedupe.hashToPath[hash]
+	fs.mu.Unlock()
+
+	if !ok || canonical == localPath {
+		return "", false
+	}
+
+	// Make sure the canonical copy is still what we think it is
+	info, err := os.Stat(canonical)
+	if err != nil || info.Size() != size {
+		return "", false
+	}
+	if !modTime.IsZero() && !info.ModTime().Equal(modTime) {
+		return "", false
+	}
+
+	return canonical, true
+}
+
+// recordBlob registers localPath as holding content with the given hash.
+//
+// If localPath previously held different content, its old entry is dropped
+// so it's never used as a link target for the wrong data.
+func (fs *FileSystem) recordBlob(hash, localPath string, linked bool, size int64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if oldHash, ok := fs.dedupe.pathToHash[localPath]; ok && oldHash != hash {
+		delete(fs.dedupe.hashToPath, oldHash)
+		delete(fs.dedupe.pathToHash, localPath)
+	}
+
+	if linked {
+		fs.dedupe.files++
+		fs.dedupe.savedBytes += size
+		return
+	}
+
+	if _, exists := fs.dedupe.hashToPath[hash]; !exists {
+		fs.dedupe.hashToPath[hash] = localPath
+		fs.dedupe.pathToHash[localPath] = hash
+	}
+}
+
+// linkAtomic replaces localPath with a hardlink to canonical.
+//
+// The link is created under a unique temporary name and renamed into place so
+// readers never see a missing or partial file.
+func (fs *FileSystem) linkAtomic(canonical, localPath string) error {
+	dir := filepath.Dir(localPath)
+	if err := fs.prepareDir(dir); err != nil {
+		return err
+	}
+
+	// Reserve a unique name, then swap the placeholder for the link
+	tmpFile, err := os.CreateTemp(dir, tempPattern(localPath))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", localPath, err)
+	}
+	tmpPath := tmpFile.Name()
+	tmpFile.Close()
+	os.Remove(tmpPath)
+
+	if err := os.Link(canonical, tmpPath); err != nil {
+		return fmt.Errorf("failed to link %s to %s: %w", tmpPath, canonical, err)
+	}
+
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		os.Remove(tmpPath) // Clean up temp link
+		return fmt.Errorf("failed to rename %s to %s: %w", tmpPath, localPath, err)
+	}
+
+	if fs.sync {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
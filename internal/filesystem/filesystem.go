@@ -3,13 +3,16 @@ package filesystem
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 // FileSystem handles file writing and path management for downloaded files.
@@ -20,11 +23,30 @@ import (
 //
 // See: https://context7.com/golang/go for Go file I/O documentation
 type FileSystem struct {
-	outputDir   string
-	flatten     bool
-	urlToPath   map[string]string // Cache URL to file path mappings
-	pathsInUse  map[string]bool   // Track used paths to avoid collisions
-	mu          sync.Mutex        // Protects urlToPath and pathsInUse
+	outputDir    string
+	flatten      bool
+	sync         bool
+	overwrite    OverwritePolicy
+	dedupe       *dedupeIndex      // Nil unless deduplication is enabled
+	urlToPath    map[string]string // Cache URL to file path mappings
+	pathsInUse   map[string]string // Case-folded path to the path that claimed it
+	aliases      map[string]string // URL to the URL whose path it is stored at (see Alias)
+	staleRemoved int               // Stale temp files removed (see prepareDir)
+	mu           sync.Mutex        // Protects urlToPath, pathsInUse, aliases, dedupe and staleRemoved
+}
+
+// Options configures the FileSystem behavior.
+type Options struct {
+	// OutputDir is the base directory where files will be written
+	OutputDir string
+	// Flatten writes all files to OutputDir without subdirectories
+	Flatten bool
+	// Sync fsyncs each file and its parent directory after writing
+	Sync bool
+	// Overwrite decides whether existing files are replaced
+	Overwrite OverwritePolicy
+	// Dedupe stores byte-identical files once, hardlinking the duplicates
+	Dedupe bool
 }
 
 // New creates a new FileSystem handler.
@@ -35,12 +57,35 @@ type FileSystem struct {
 //
 // See: https://context7.com/golang/go for Go documentation
 func New(outputDir string, flatten bool) *FileSystem {
-	return &FileSystem{
-		outputDir:  outputDir,
-		flatten:    flatten,
+	return NewWithOptions(Options{
+		OutputDir: outputDir,
+		Flatten:   flatten,
+	})
+}
+
+// NewWithOptions creates a new FileSystem handler with the given options.
+//
+// An empty Overwrite policy behaves like OverwriteAlways.
+func NewWithOptions(opts Options) *FileSystem {
+	overwrite := opts.Overwrite
+	if overwrite == "" {
+		overwrite = OverwriteAlways
+	}
+
+	fs := &FileSystem{
+		outputDir:  opts.OutputDir,
+		flatten:    opts.Flatten,
+		sync:       opts.Sync,
+		overwrite:  overwrite,
 		urlToPath:  make(map[string]string),
-		pathsInUse: make(map[string]bool),
+		pathsInUse: make(map[string]string),
+		aliases:    make(map[string]string),
 	}
+	if opts.Dedupe {
+		fs.dedupe = newDedupeIndex()
+	}
+
+	return fs
 }
 
 // GetLocalPath returns the local file path for a given URL.
@@ -49,6 +94,11 @@ func New(outputDir string, flatten bool) *FileSystem {
 // For hierarchical mode, it preserves the URL's path structure.
 // For flat mode, it uses the filename with conflict resolution.
 //
+// Every path component is sanitized (see sanitizeComponent) and the result is
+// guaranteed to be inside the output directory. Names that differ only by
+// case are treated as conflicts so they can't overwrite each other on
+// case-insensitive filesystems.
+//
 // Parameters:
 //   - urlStr: The URL to map to a local path
 //
@@ -57,6 +107,8 @@ func (fs *FileSystem) GetLocalPath(urlStr string) (string, error) {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	urlStr = fs.resolveAlias(urlStr)
+
 	// Return cached path if available
 	if localPath, exists := fs.urlToPath[urlStr]; exists {
 		return localPath, nil
@@ -67,12 +119,18 @@ func (fs *FileSystem) GetLocalPath(urlStr string) (string, error) {
 		return "", fmt.Errorf("failed to parse URL %s: %w", urlStr, err)
 	}
 
+	components := urlPathComponents(parsedURL)
+	isDir := len(components) == 0 || strings.HasSuffix(parsedURL.Path, "/")
+
 	var localPath string
 
 	if fs.flatten {
 		// Extract filename from URL
-		filename := path.Base(parsedURL.Path)
-		if filename == "" || filename == "." || filename == "/" {
+		filename := ""
+		if !isDir {
+			filename = components[len(components)-1]
+		}
+		if filename == "" {
 			// Generate filename from URL hash if no clear filename
 			filename = generateFilenameFromURL(urlStr)
 		}
@@ -80,18 +138,30 @@ func (fs *FileSystem) GetLocalPath(urlStr string) (string, error) {
 		localPath = filepath.Join(fs.outputDir, filename)
 
 		// Handle naming conflicts
-		if fs.pathsInUse[localPath] {
+		if fs.isPathInUse(localPath) {
 			localPath = fs.resolveConflict(localPath, urlStr)
 		}
 	} else {
 		// Preserve URL path structure
-		// Remove leading slash and convert to local path
-		urlPath := strings.TrimPrefix(parsedURL.Path, "/")
-		localPath = filepath.Join(fs.outputDir, filepath.FromSlash(urlPath))
+		if isDir {
+			// Directory-style URLs get a generated name inside that directory
+			components = append(components, generateFilenameFromURL(urlStr))
+		}
+		localPath = filepath.Join(append([]string{fs.outputDir}, components...)...)
+
+		// Identical paths are shared (e.g. URLs differing only by query),
+		// but paths that differ only by case must not collide
+		if owner, used := fs.pathsInUse[foldPath(localPath)]; used && owner != localPath {
+			localPath = fs.resolveConflict(localPath, urlStr)
+		}
+	}
+
+	if err := ensureWithin(fs.outputDir, localPath); err != nil {
+		return "", err
 	}
 
 	fs.urlToPath[urlStr] = localPath
-	fs.pathsInUse[localPath] = true
+	fs.pathsInUse[foldPath(localPath)] = localPath
 
 	return localPath, nil
 }
@@ -99,7 +169,9 @@ func (fs *FileSystem) GetLocalPath(urlStr string) (string, error) {
 // WriteFile writes content to the local path for the given URL.
 //
 // This method creates any necessary parent directories and writes the file
-// atomically by writing to a temporary file first, then renaming.
+// atomically by writing to a uniquely named temporary file first, then
+// renaming. If the overwrite policy says an existing file should be kept,
+// nothing is written and the existing path is returned.
 //
 // Parameters:
 //   - urlStr: The URL whose content is being written
@@ -109,30 +181,163 @@ func (fs *FileSystem) GetLocalPath(urlStr string) (string, error) {
 //
 // See: https://context7.com/golang/go for Go file operations
 func (fs *FileSystem) WriteFile(urlStr string, content []byte) (string, error) {
+	return fs.WriteFileModTime(urlStr, content, time.Time{})
+}
+
+// WriteFileModTime writes content like WriteFile and stamps the file with the
+// given modification time (typically the server's Last-Modified).
+//
+// A zero modTime leaves the modification time at the time of writing. The
+// modification time is also what the if-newer overwrite policy compares
+// against.
+func (fs *FileSystem) WriteFileModTime(urlStr string, content []byte, modTime time.Time) (string, error) {
 	localPath, err := fs.GetLocalPath(urlStr)
 	if err != nil {
 		return "", err
 	}
 
+	write, err := fs.shouldOverwrite(localPath, int64(len(content)), modTime)
+	if err != nil {
+		return "", err
+	}
+	if !write {
+		return localPath, nil
+	}
+
+	if fs.dedupe != nil {
+		return fs.writeDeduped(localPath, content, modTime)
+	}
+
+	if err := fs.writeAtomic(localPath, content); err != nil {
+		return "", err
+	}
+
+	if !modTime.IsZero() {
+		if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+			return "", fmt.Errorf("failed to set modification time on %s: %w", localPath, err)
+		}
+	}
+
+	return localPath, nil
+}
+
+// writeDeduped writes content, hardlinking to an existing identical file
+// when one is known.
+//
+// If linking fails (e.g. the filesystem doesn't support hardlinks) the
+// content is written normally.
+func (fs *FileSystem) writeDeduped(localPath string, content []byte, modTime time.Time) (string, error) {
+	hash := hashContent(content)
+	size := int64(len(content))
+
+	if canonical, ok := fs.canonicalFor(hash, localPath, size, modTime); ok {
+		if err := fs.linkAtomic(canonical, localPath); err == nil {
+			fs.recordBlob(hash, localPath, true, size)
+			return localPath, nil
+		}
+	}
+
+	if err := fs.writeAtomic(localPath, content); err != nil {
+		return "", err
+	}
+
+	if !modTime.IsZero() {
+		if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+			return "", fmt.Errorf("failed to set modification time on %s: %w", localPath, err)
+		}
+	}
+
+	fs.recordBlob(hash, localPath, false, size)
+	return localPath, nil
+}
+
+// writeAtomic writes content to a unique temporary file next to localPath and
+// renames it into place, optionally fsyncing the file and its directory.
+//
+// Using os.CreateTemp means two URLs that map to the same path, or a playlist
+// and a segment racing each other, can never clobber each other's temp file.
+func (fs *FileSystem) writeAtomic(localPath string, content []byte) error {
 	// Create parent directories
 	dir := filepath.Dir(localPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create directory %s: %w", dir, err)
+	if err := fs.prepareDir(dir); err != nil {
+		return err
 	}
 
 	// Write to temporary file first
-	tmpPath := localPath + ".tmp"
-	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
-		return "", fmt.Errorf("failed to write file %s: %w", tmpPath, err)
+	tmpFile, err := os.CreateTemp(dir, tempPattern(localPath))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", localPath, err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if err := fs.fillTempFile(tmpFile, content); err != nil {
+		os.Remove(tmpPath) // Clean up temp file
+		return err
 	}
 
 	// Rename to final path (atomic on most systems)
 	if err := os.Rename(tmpPath, localPath); err != nil {
 		os.Remove(tmpPath) // Clean up temp file
-		return "", fmt.Errorf("failed to rename %s to %s: %w", tmpPath, localPath, err)
+		return fmt.Errorf("failed to rename %s to %s: %w", tmpPath, localPath, err)
 	}
 
-	return localPath, nil
+	fs.removeLegacyTempFile(localPath)
+
+	if fs.sync {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fillTempFile writes content to a freshly created temp file and closes it.
+func (fs *FileSystem) fillTempFile(f *os.File, content []byte) error {
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", f.Name(), err)
+	}
+
+	// CreateTemp uses 0600; match the permissions of a regular write
+	if err := f.Chmod(0644); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", f.Name(), err)
+	}
+
+	if fs.sync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync file %s: %w", f.Name(), err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", f.Name(), err)
+	}
+
+	return nil
+}
+
+// syncDir fsyncs a directory so that a rename inside it is durable.
+//
+// Windows doesn't support syncing directories, and some filesystems reject it
+// with EINVAL; in both cases there is nothing more we can do.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+
+	return nil
 }
 
 // GetRelativePath returns the relative path from one URL's local path to another.
@@ -171,6 +376,25 @@ func (fs *FileSystem) GetRelativePath(fromURL, toURL string) (string, error) {
 	return relPath, nil
 }
 
+// GetOutputRelativePath returns the local path for a URL relative to the
+// output directory, using forward slashes.
+//
+// This is used when rewriting URLs for re-hosting, where a file's location
+// inside the output directory becomes its path below the new base URL.
+func (fs *FileSystem) GetOutputRelativePath(urlStr string) (string, error) {
+	localPath, err := fs.GetLocalPath(urlStr)
+	if err != nil {
+		return "", err
+	}
+
+	relPath, err := filepath.Rel(fs.outputDir, localPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate relative path: %w", err)
+	}
+
+	return filepath.ToSlash(relPath), nil
+}
+
 // resolveConflict handles filename conflicts by appending a hash.
 func (fs *FileSystem) resolveConflict(originalPath, urlStr string) string {
 	ext := filepath.Ext(originalPath)
@@ -182,7 +406,7 @@ func (fs *FileSystem) resolveConflict(originalPath, urlStr string) string {
 
 	// If still conflicts (very unlikely), keep appending
 	counter := 1
-	for fs.pathsInUse[newPath] {
+	for fs.isPathInUse(newPath) {
 		newPath = fmt.Sprintf("%s_%s_%d%s", base, hash[:8], counter, ext)
 		counter++
 	}
@@ -190,6 +414,17 @@ func (fs *FileSystem) resolveConflict(originalPath, urlStr string) string {
 	return newPath
 }
 
+// isPathInUse reports whether a path (compared case-insensitively) is taken.
+func (fs *FileSystem) isPathInUse(p string) bool {
+	_, used := fs.pathsInUse[foldPath(p)]
+	return used
+}
+
+// foldPath returns the case-insensitive key used to detect path collisions.
+func foldPath(p string) string {
+	return strings.ToLower(p)
+}
+
 // generateFilenameFromURL creates a filename from a URL when no filename is present.
 func generateFilenameFromURL(urlStr string) string {
 	hash := generateHashFromURL(urlStr)
@@ -221,3 +456,111 @@ func (fs *FileSystem) FileExists(urlStr string) (bool, error) {
 	}
 	return false, err
 }
+
+// StaleTempFilesRemoved returns how many temp files left behind by
+// interrupted runs were removed while writing.
+func (fs *FileSystem) StaleTempFilesRemoved() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.staleRemoved
+}
+
+// sweptDirs holds a *sync.Once per absolute directory path, so each
+// directory is swept for stale temp files at most once per process, before
+// anything in the process writes to it. Concurrent downloads (e.g. batch
+// jobs) share it, so one can never remove another's in-flight temp file.
+var sweptDirs sync.Map
+
+// processStart is when this process started. Temp files modified since may
+// belong to a write that is still in progress in another process.
+var processStart = time.Now()
+
+// prepareDir creates dir if needed and, the first time this process writes
+// to it, removes the temp files interrupted runs left behind in it.
+//
+// Only directories that are written to are swept, and only their own
+// entries, so nothing outside the files this tool manages is touched.
+func (fs *FileSystem) prepareDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	key, err := filepath.Abs(dir)
+	if err != nil {
+		key = dir
+	}
+	once, _ := sweptDirs.LoadOrStore(key, new(sync.Once))
+	once.(*sync.Once).Do(func() {
+		fs.removeStaleTempFiles(dir)
+	})
+
+	return nil
+}
+
+// removeStaleTempFiles removes the temp files from writeAtomic and
+// linkAtomic in dir that were last modified before this process started.
+//
+// This is best effort: a leftover temp file is harmless, so failures are
+// ignored.
+func (fs *FileSystem) removeStaleTempFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isTempFileName(entry.Name()) {
+			continue
+		}
+		p := filepath.Join(dir, entry.Name())
+		if isStale(p) && os.Remove(p) == nil {
+			removed++
+		}
+	}
+
+	fs.mu.Lock()
+	fs.staleRemoved += removed
+	fs.mu.Unlock()
+}
+
+// removeLegacyTempFile removes the "<name>.tmp" file earlier versions used
+// as the temp file for localPath, if an interrupted run left one behind.
+//
+// The name is only removed if no URL of this run is stored at it, so a
+// mirrored file that happens to end in .tmp is left alone.
+func (fs *FileSystem) removeLegacyTempFile(localPath string) {
+	legacy := localPath + tempSuffix
+
+	fs.mu.Lock()
+	_, used := fs.pathsInUse[foldPath(legacy)]
+	fs.mu.Unlock()
+	if used || !isStale(legacy) {
+		return
+	}
+
+	if os.Remove(legacy) == nil {
+		fs.mu.Lock()
+		fs.staleRemoved++
+		fs.mu.Unlock()
+	}
+}
+
+// isStale reports whether p is a regular file last modified before this
+// process started.
+func isStale(p string) bool {
+	info, err := os.Lstat(p)
+	return err == nil && info.Mode().IsRegular() && info.ModTime().Before(processStart)
+}
+
+// tempPattern returns the os.CreateTemp pattern for in-progress writes of
+// localPath (e.g. ".m3u8dl-segment.ts.123456.tmp").
+func tempPattern(localPath string) string {
+	return tempPrefix + filepath.Base(localPath) + ".*" + tempSuffix
+}
+
+// isTempFileName reports whether name looks like a temp file from writeAtomic.
+func isTempFileName(name string) bool {
+	return strings.HasPrefix(name, tempPrefix) && strings.HasSuffix(name, tempSuffix)
+}
@@ -1,9 +1,13 @@
 package filesystem
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestGetLocalPath(t *testing.T) {
@@ -160,3 +164,393 @@ func TestConcurrentAccess(t *testing.T) {
 		<-done
 	}
 }
+
+func TestGetLocalPathContainment(t *testing.T) {
+	hostileURLs := []string{
+		"https://example.com/../../etc/passwd",
+		"https://example.com/a/..%2F..%2F..%2Fetc%2Fpasswd",
+		"https://example.com/%2E%2E/%2E%2E/secret.ts",
+		"https://example.com/C:%5CWindows%5Csystem32%5Cevil.dll",
+		"https://example.com/seg%00ment.ts",
+		"https://example.com/..\\..\\evil.ts",
+		"https://example.com/CON.ts",
+		"https://example.com/trailing.. ",
+		"https://example.com/",
+		"https://example.com",
+		"https://example.com/" + strings.Repeat("a", 300) + ".ts",
+	}
+
+	for _, flatten := range []bool{false, true} {
+		tmpDir := t.TempDir()
+		fs := New(tmpDir, flatten)
+
+		for _, u := range hostileURLs {
+			localPath, err := fs.GetLocalPath(u)
+			if err != nil {
+				t.Errorf("GetLocalPath(%q) failed: %v", u, err)
+				continue
+			}
+
+			rel, err := filepath.Rel(tmpDir, localPath)
+			if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				t.Errorf("GetLocalPath(%q) = %s escapes %s", u, localPath, tmpDir)
+			}
+
+			for _, component := range strings.Split(rel, string(filepath.Separator)) {
+				if len(component) > maxComponentLength {
+					t.Errorf("GetLocalPath(%q) component too long: %d bytes", u, len(component))
+				}
+				if strings.ContainsAny(component, "\x00:\\") {
+					t.Errorf("GetLocalPath(%q) component %q contains unsafe characters", u, component)
+				}
+			}
+
+			if _, err := fs.WriteFile(u, []byte("x")); err != nil {
+				t.Errorf("WriteFile(%q) failed: %v", u, err)
+			}
+		}
+	}
+}
+
+func TestSanitizeComponent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"segment.ts", "segment.ts"},
+		{"../../etc", ".._.._etc"},
+		{"..", "_"},
+		{"a\x00b.ts", "a_b.ts"},
+		{"C:\\evil", "C__evil"},
+		{"nul.txt", "_nul.txt"},
+		{"name. ", "name_"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeComponent(tt.input); got != tt.expected {
+			t.Errorf("sanitizeComponent(%q) = %q; want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestTruncateComponentKeepsNamesDistinct(t *testing.T) {
+	a := sanitizeComponent(strings.Repeat("x", 250) + "a.ts")
+	b := sanitizeComponent(strings.Repeat("x", 250) + "b.ts")
+
+	if len(a) > maxComponentLength || len(b) > maxComponentLength {
+		t.Fatalf("Truncated names too long: %d, %d", len(a), len(b))
+	}
+	if a == b {
+		t.Error("Truncated names should remain distinct")
+	}
+	if filepath.Ext(a) != ".ts" {
+		t.Errorf("Expected extension to be preserved, got %s", a)
+	}
+}
+
+func TestGetLocalPathCaseCollision(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := New(tmpDir, false)
+
+	upper, err := fs.GetLocalPath("https://example.com/video/Segment.ts")
+	if err != nil {
+		t.Fatalf("GetLocalPath failed: %v", err)
+	}
+	lower, err := fs.GetLocalPath("https://example.com/video/segment.ts")
+	if err != nil {
+		t.Fatalf("GetLocalPath failed: %v", err)
+	}
+
+	if strings.EqualFold(upper, lower) {
+		t.Errorf("Paths differing only by case should not collide: %s, %s", upper, lower)
+	}
+
+	// The same path requested through a different query string is shared
+	shared, err := fs.GetLocalPath("https://example.com/video/Segment.ts?token=abc")
+	if err != nil {
+		t.Fatalf("GetLocalPath failed: %v", err)
+	}
+	if shared != upper {
+		t.Errorf("Expected %s, got %s", upper, shared)
+	}
+}
+
+func TestWriteFileOverwritePolicy(t *testing.T) {
+	url := "https://example.com/segment.ts"
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := old.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		policy   OverwritePolicy
+		content  string
+		modTime  time.Time
+		expected string
+	}{
+		{"always", OverwriteAlways, "replaced", old, "replaced"},
+		{"never", OverwriteNever, "replaced", newer, "original"},
+		{"if-newer with older remote", OverwriteIfNewer, "replaced", old.Add(-time.Hour), "original"},
+		{"if-newer with newer remote", OverwriteIfNewer, "replaced", newer, "replaced"},
+		{"if-size-differs with same size", OverwriteIfSizeDiffers, "ORIGINAL", old, "original"},
+		{"if-size-differs with new size", OverwriteIfSizeDiffers, "changed!!", old, "changed!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := NewWithOptions(Options{OutputDir: t.TempDir(), Overwrite: tt.policy})
+
+			if _, err := fs.WriteFileModTime(url, []byte("original"), old); err != nil {
+				t.Fatalf("Initial WriteFile failed: %v", err)
+			}
+
+			localPath, err := fs.WriteFileModTime(url, []byte(tt.content), tt.modTime)
+			if err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+
+			content, err := os.ReadFile(localPath)
+			if err != nil {
+				t.Fatalf("Failed to read written file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, content)
+			}
+		})
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	if p, err := ParseOverwritePolicy("if-newer"); err != nil || p != OverwriteIfNewer {
+		t.Errorf("ParseOverwritePolicy(if-newer) = %q, %v", p, err)
+	}
+	if p, err := ParseOverwritePolicy(""); err != nil || p != OverwriteAlways {
+		t.Errorf("ParseOverwritePolicy(\"\") = %q, %v", p, err)
+	}
+	if _, err := ParseOverwritePolicy("sometimes"); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+}
+
+func TestWriteFileConcurrentSamePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewWithOptions(Options{OutputDir: tmpDir, Sync: true})
+
+	// URLs differing only by query share a local path
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			url := fmt.Sprintf("https://example.com/shared.ts?token=%d", n)
+			if _, err := fs.WriteFile(url, []byte("same content")); err != nil {
+				t.Errorf("Concurrent WriteFile failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "shared.ts" {
+		t.Errorf("Expected only shared.ts, got %v", entries)
+	}
+}
+
+func TestWriteFileRemovesStaleTempFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := New(tmpDir, false)
+
+	written := filepath.Join(tmpDir, "sub")
+	untouched := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{written, untouched} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+	}
+
+	stale := []string{
+		filepath.Join(written, ".m3u8dl-playlist.m3u8.123456.tmp"),
+		filepath.Join(written, "segment.ts.tmp"), // Temp name of earlier versions
+	}
+	keep := []string{
+		filepath.Join(written, ".notes.txt.tmp"),    // Not ours
+		filepath.Join(written, "other.ts.tmp"),      // Not the legacy name of a written file
+		filepath.Join(untouched, ".m3u8dl-a.1.tmp"), // Not in a directory that was written to
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, p := range append(stale, keep...) {
+		if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+
+	// Modified since the process started, so possibly still being written
+	inFlight := filepath.Join(written, ".m3u8dl-segment.ts.987654.tmp")
+	if err := os.WriteFile(inFlight, []byte("x"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	keep = append(keep, inFlight)
+
+	if _, err := fs.WriteFile("https://example.com/sub/segment.ts", []byte("data")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if removed := fs.StaleTempFilesRemoved(); removed != len(stale) {
+		t.Errorf("Expected %d files removed, got %d", len(stale), removed)
+	}
+	for _, p := range stale {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("Stale temp file %s should have been removed", p)
+		}
+	}
+	for _, p := range keep {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("File %s should have been kept: %v", p, err)
+		}
+	}
+}
+
+func TestWriteFileDedupe(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewWithOptions(Options{OutputDir: tmpDir, Dedupe: true})
+
+	content := []byte("identical ad slate")
+	first, err := fs.WriteFile("https://example.com/low/ad.ts", content)
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	second, err := fs.WriteFile("https://example.com/high/ad.ts", content)
+	if err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := fs.WriteFile("https://example.com/high/other.ts", []byte("different")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	firstInfo, err := os.Stat(first)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	secondInfo, err := os.Stat(second)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if !os.SameFile(firstInfo, secondInfo) {
+		t.Error("Identical content should be stored as one file")
+	}
+
+	files, saved := fs.DedupeStats()
+	if files != 1 || saved != int64(len(content)) {
+		t.Errorf("Expected 1 file and %d bytes saved, got %d and %d", len(content), files, saved)
+	}
+
+	// Rewriting a deduplicated file must not affect its twin
+	if _, err := fs.WriteFile("https://example.com/high/ad.ts", []byte("new content")); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	readContent, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if string(readContent) != string(content) {
+		t.Errorf("Canonical file changed to %q", readContent)
+	}
+}
+
+func TestWriteFileDedupeModTime(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := NewWithOptions(Options{OutputDir: tmpDir, Dedupe: true, Overwrite: OverwriteIfNewer})
+
+	content := []byte("identical ad slate")
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	paths := make(map[string]string)
+	for _, write := range []struct {
+		url     string
+		modTime time.Time
+	}{
+		{"https://example.com/low/ad.ts", older},
+		{"https://example.com/mid/ad.ts", older},
+		{"https://example.com/high/ad.ts", newer},
+	} {
+		localPath, err := fs.WriteFileModTime(write.url, content, write.modTime)
+		if err != nil {
+			t.Fatalf("WriteFileModTime failed: %v", err)
+		}
+		paths[write.url] = localPath
+	}
+
+	// Every path keeps its own Last-Modified for the next if-newer run
+	infos := make(map[string]os.FileInfo)
+	for u, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		infos[u] = info
+	}
+	if !os.SameFile(infos["https://example.com/low/ad.ts"], infos["https://example.com/mid/ad.ts"]) {
+		t.Error("Identical content with the same Last-Modified should be stored as one file")
+	}
+	if got := infos["https://example.com/high/ad.ts"].ModTime(); !got.Equal(newer) {
+		t.Errorf("Expected the newer copy to keep its modification time %v, got %v", newer, got)
+	}
+	if got := infos["https://example.com/low/ad.ts"].ModTime(); !got.Equal(older) {
+		t.Errorf("Expected the older copy to keep its modification time %v, got %v", older, got)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs := New(tmpDir, false)
+
+	requested := "https://origin.example.com/live/master.m3u8"
+	final := "https://edge3.cdn.example.com/abc/master.m3u8"
+	segment := "https://edge3.cdn.example.com/abc/seg1.ts"
+	fs.Alias(final, requested)
+	fs.Alias(segment, "https://origin.example.com/live/seg1.ts")
+
+	localPath, err := fs.GetLocalPath(final)
+	if err != nil {
+		t.Fatalf("GetLocalPath failed: %v", err)
+	}
+	if expected := filepath.Join(tmpDir, "live", "master.m3u8"); localPath != expected {
+		t.Errorf("Expected %s, got %s", expected, localPath)
+	}
+	if got := fs.MappedURL(final); got != requested {
+		t.Errorf("Expected MappedURL %s, got %s", requested, got)
+	}
+	if got := fs.MappedURL(requested); got != requested {
+		t.Errorf("Expected an unaliased URL to map to itself, got %s", got)
+	}
+
+	relPath, err := fs.GetRelativePath(final, segment)
+	if err != nil {
+		t.Fatalf("GetRelativePath failed: %v", err)
+	}
+	if relPath != "seg1.ts" {
+		t.Errorf("Expected seg1.ts, got %s", relPath)
+	}
+
+	// The first mapping wins, and cycles are ignored
+	fs.Alias(final, "https://other.example.com/x.m3u8")
+	fs.Alias(requested, final)
+	if got := fs.MappedURL(final); got != requested {
+		t.Errorf("Expected the alias to be kept, got %s", got)
+	}
+	if got := fs.MappedURL(requested); got != requested {
+		t.Errorf("Expected no cycle, got %s", got)
+	}
+
+	// URLs that already have a path can't be aliased
+	fs.GetLocalPath("https://example.com/a.ts")
+	fs.Alias("https://example.com/a.ts", "https://example.com/b.ts")
+	if got := fs.MappedURL("https://example.com/a.ts"); got != "https://example.com/a.ts" {
+		t.Errorf("Expected no alias for a mapped URL, got %s", got)
+	}
+}
@@ -0,0 +1,80 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// tempPrefix and tempSuffix surround the names of in-progress writes, so they
+// can't be mistaken for anybody else's files.
+const (
+	tempPrefix = ".m3u8dl-"
+	tempSuffix = ".tmp"
+)
+
+// OverwritePolicy decides whether an existing local file is replaced.
+type OverwritePolicy string
+
+const (
+	// OverwriteAlways replaces existing files unconditionally.
+	OverwriteAlways OverwritePolicy = "always"
+	// OverwriteNever keeps existing files untouched.
+	OverwriteNever OverwritePolicy = "never"
+	// OverwriteIfNewer replaces a file only if the remote copy is newer.
+	OverwriteIfNewer OverwritePolicy = "if-newer"
+	// OverwriteIfSizeDiffers replaces a file only if its size changed.
+	OverwriteIfSizeDiffers OverwritePolicy = "if-size-differs"
+)
+
+// ParseOverwritePolicy converts a CLI value into an OverwritePolicy.
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	switch p := OverwritePolicy(s); p {
+	case OverwriteAlways, OverwriteNever, OverwriteIfNewer, OverwriteIfSizeDiffers:
+		return p, nil
+	case "":
+		return OverwriteAlways, nil
+	default:
+		return "", fmt.Errorf("invalid overwrite policy %q (expected always, never, if-newer or if-size-differs)", s)
+	}
+}
+
+// Overwrite returns the configured overwrite policy.
+func (fs *FileSystem) Overwrite() OverwritePolicy {
+	return fs.overwrite
+}
+
+// shouldOverwrite applies the overwrite policy to an existing file.
+//
+// Parameters:
+//   - localPath: The path that is about to be written
+//   - size: The size of the new content
+//   - modTime: The modification time of the new content (zero if unknown)
+//
+// Returns true if the file should be written.
+func (fs *FileSystem) shouldOverwrite(localPath string, size int64, modTime time.Time) (bool, error) {
+	if fs.overwrite == OverwriteAlways {
+		return true, nil
+	}
+
+	info, err := os.Stat(localPath)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+
+	switch fs.overwrite {
+	case OverwriteNever:
+		return false, nil
+	case OverwriteIfNewer:
+		// Without a remote timestamp we can't tell, so err on the side of
+		// fetching fresh content
+		return modTime.IsZero() || modTime.After(info.ModTime()), nil
+	case OverwriteIfSizeDiffers:
+		return info.Size() != size, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package filesystem
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxComponentLength is the longest file or directory name we will create.
+//
+// Most filesystems cap a single name at 255 bytes. We stay well below that so
+// there is room for conflict suffixes and temporary file decorations.
+const maxComponentLength = 200
+
+// windowsReservedNames are device names that cannot be used as file names on
+// Windows, regardless of extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// urlPathComponents splits a URL's path into sanitized local path components.
+//
+// The path is split on its escaped form so that percent-encoded separators
+// (e.g. "..%2F..%2Fetc") stay inside a single component instead of creating
+// new directory levels. Literal "." and ".." segments are resolved the same
+// way a browser would, and can never climb above the root.
+func urlPathComponents(u *url.URL) []string {
+	components := make([]string, 0)
+
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			if len(components) > 0 {
+				components = components[:len(components)-1]
+			}
+			continue
+		}
+
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			decoded = segment
+		}
+		components = append(components, sanitizeComponent(decoded))
+	}
+
+	return components
+}
+
+// sanitizeComponent makes a single path component safe to create on disk.
+//
+// It replaces path separators, NUL and other control characters, invalid
+// UTF-8, and characters that are invalid on Windows with underscores. Names that consist
+// only of dots, Windows device names, and names with trailing dots or spaces
+// are escaped, and overlong names are truncated with a hash suffix.
+func sanitizeComponent(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			b.WriteRune('_')
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	clean := b.String()
+
+	// Trailing dots and spaces are silently stripped by Windows, which
+	// would make distinct names collide.
+	if trimmed := strings.TrimRight(clean, ". "); trimmed != clean {
+		clean = trimmed + "_"
+	}
+
+	if clean == "" || strings.Trim(clean, ".") == "" {
+		clean = "_" + clean
+	}
+
+	stem := strings.ToUpper(clean)
+	if idx := strings.Index(stem, "."); idx != -1 {
+		stem = stem[:idx]
+	}
+	if windowsReservedNames[stem] {
+		clean = "_" + clean
+	}
+
+	return truncateComponent(clean)
+}
+
+// truncateComponent shortens a name to maxComponentLength bytes.
+//
+// The extension is preserved when it is reasonably short, and a hash of the
+// full name is appended so that distinct long names remain distinct.
+func truncateComponent(name string) string {
+	if len(name) <= maxComponentLength {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+
+	suffix := "_" + generateHashFromURL(name)[:16] + ext
+	base := name[:maxComponentLength-len(suffix)]
+
+	// Don't split a multi-byte UTF-8 sequence
+	for !utf8.ValidString(base) {
+		base = base[:len(base)-1]
+	}
+
+	return base + suffix
+}
+
+// ensureWithin verifies that target is located inside root.
+//
+// This is the final safety net for path mapping: even if sanitization missed
+// something, no file may ever be written outside the output directory.
+func ensureWithin(root, target string) error {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory %s: %w", root, err)
+	}
+	targetAbs, err := filepath.Abs(target)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path %s: %w", target, err)
+	}
+
+	rel, err := filepath.Rel(rootAbs, targetAbs)
+	if err != nil {
+		return fmt.Errorf("path %s escapes output directory %s: %w", target, root, err)
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("path %s escapes output directory %s", target, root)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package inspect
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+)
+
+// Report describes the contents of a playlist without downloading any
+// segments.
+type Report struct {
+	// URL is the inspected playlist
+	URL string `json:"url"`
+	// Master is true if URL is a master playlist
+	Master bool `json:"master"`
+	// Variants lists the variant streams of a master playlist
+	Variants []Variant `json:"variants,omitempty"`
+	// Renditions lists the alternative renditions of a master playlist
+	Renditions []Rendition `json:"renditions,omitempty"`
+	// Media describes URL itself if it is a media playlist
+	Media *Media `json:"media,omitempty"`
+	// Duration is the longest duration of any media playlist in seconds
+	Duration float64 `json:"duration"`
+	// Encryption lists every encryption method used by any media playlist
+	Encryption []string `json:"encryption,omitempty"`
+	// EstimatedSize is the sum of every variant's estimated size in bytes
+	EstimatedSize int64 `json:"estimatedSize"`
+}
+
+// Variant is a variant stream and the media playlist it points at.
+type Variant struct {
+	URL              string  `json:"url"`
+	Bandwidth        int64   `json:"bandwidth"`
+	AverageBandwidth int64   `json:"averageBandwidth,omitempty"`
+	Resolution       string  `json:"resolution,omitempty"`
+	Codecs           string  `json:"codecs,omitempty"`
+	FrameRate        float64 `json:"frameRate,omitempty"`
+	Audio            string  `json:"audio,omitempty"`
+	Subtitles        string  `json:"subtitles,omitempty"`
+	IFrame           bool    `json:"iframe,omitempty"`
+	Image            bool    `json:"image,omitempty"`
+	Pathway          string  `json:"pathway,omitempty"`
+	// EstimatedSize is BANDWIDTH × duration / 8, using AVERAGE-BANDWIDTH
+	// when present since it is closer to the real size
+	EstimatedSize int64  `json:"estimatedSize"`
+	Media         *Media `json:"media,omitempty"`
+}
+
+// Rendition is an alternative rendition and the media playlist it points at.
+type Rendition struct {
+	URL      string `json:"url,omitempty"`
+	Type     string `json:"type"`
+	GroupID  string `json:"groupId"`
+	Language string `json:"language,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Media    *Media `json:"media,omitempty"`
+}
+
+// Media summarizes a media playlist.
+type Media struct {
+	// Segments is the number of media segments
+	Segments int `json:"segments"`
+	// Duration is the total duration in seconds
+	Duration float64 `json:"duration"`
+	// TargetDuration is the EXT-X-TARGETDURATION in seconds
+	TargetDuration float64 `json:"targetDuration"`
+	// Live is true if the playlist has no EXT-X-ENDLIST
+	Live bool `json:"live,omitempty"`
+	// Encryption lists the encryption methods used by the segments
+	Encryption []string `json:"encryption,omitempty"`
+	// Error is set if the playlist couldn't be fetched or parsed
+	Error string `json:"error,omitempty"`
+}
+
+// Inspect fetches a playlist and, for a master playlist, each of its child
+// playlists, and summarizes what a download would contain.
+//
+// No segments are downloaded. Failures to fetch child playlists are recorded
+// on the child rather than failing the whole inspection.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - f: The Fetcher used for all requests
+//   - playlistURL: The URL of the master or media playlist
+//
+// Returns the report, or an error if the top-level playlist can't be fetched
+// or parsed.
+//
+// See: https://context7.com/golang/go for Go documentation
+func Inspect(ctx context.Context, f *fetcher.Fetcher, playlistURL string) (*Report, error) {
+	m3u8, err := fetchPlaylist(ctx, f, playlistURL)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{URL: playlistURL, Master: m3u8.IsMaster()}
+	if !report.Master {
+		report.Media = summarize(m3u8)
+		report.Duration = report.Media.Duration
+		report.Encryption = report.Media.Encryption
+		return report, nil
+	}
+
+	// Variants and renditions often share playlists, so fetch each only once
+	media := make(map[string]*Media)
+	load := func(u string) *Media {
+		if u == "" {
+			return nil
+		}
+		if m, ok := media[u]; ok {
+			return m
+		}
+		child, err := fetchPlaylist(ctx, f, u)
+		m := &Media{}
+		if err != nil {
+			m.Error = err.Error()
+		} else {
+			m = summarize(child)
+		}
+		media[u] = m
+		return m
+	}
+
+	for _, v := range m3u8.Variants {
+		variant := Variant{
+			URL:              v.URL,
+			Bandwidth:        v.Bandwidth,
+			AverageBandwidth: v.AverageBandwidth,
+			Resolution:       v.Resolution,
+			Codecs:           v.Codecs,
+			FrameRate:        v.FrameRate,
+			Audio:            v.Audio,
+			Subtitles:        v.Subtitles,
+			IFrame:           v.IFrame,
+			Image:            v.Image,
+			Pathway:          v.PathwayID,
+			Media:            load(v.URL),
+		}
+		variant.EstimatedSize = estimateSize(variant)
+		report.EstimatedSize += variant.EstimatedSize
+		report.Variants = append(report.Variants, variant)
+	}
+
+	for _, r := range m3u8.Renditions {
+		report.Renditions = append(report.Renditions, Rendition{
+			URL:      r.URL,
+			Type:     r.Type,
+			GroupID:  r.GroupID,
+			Language: r.Language,
+			Name:     r.Name,
+			Default:  r.Default,
+			Media:    load(r.URL),
+		})
+	}
+
+	methods := make(map[string]bool)
+	for _, m := range media {
+		report.Duration = max(report.Duration, m.Duration)
+		for _, method := range m.Encryption {
+			methods[method] = true
+		}
+	}
+	report.Encryption = sortedKeys(methods)
+
+	return report, nil
+}
+
+// fetchPlaylist fetches and parses a single playlist.
+func fetchPlaylist(ctx context.Context, f *fetcher.Fetcher, playlistURL string) (*downloader.M3U8File, error) {
+	resp, err := f.FetchResponse(ctx, playlistURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// References are relative to where the playlist came from after redirects
+	baseURL, err := url.Parse(resp.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %s: %w", resp.URL, err)
+	}
+
+	m3u8, err := downloader.ParseM3U8(resp.Body, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", playlistURL, err)
+	}
+	return m3u8, nil
+}
+
+// summarize builds the Media summary of a parsed media playlist.
+func summarize(m3u8 *downloader.M3U8File) *Media {
+	methods := make(map[string]bool)
+	for _, segment := range m3u8.Segments {
+		if segment.KeyMethod != "" {
+			methods[segment.KeyMethod] = true
+		}
+	}
+
+	return &Media{
+		Segments:       len(m3u8.Segments),
+		Duration:       m3u8.Duration(),
+		TargetDuration: m3u8.TargetDuration,
+		Live:           !m3u8.EndList,
+		Encryption:     sortedKeys(methods),
+	}
+}
+
+// estimateSize estimates the size of a variant from its bandwidth and the
+// duration of its media playlist.
+func estimateSize(v Variant) int64 {
+	if v.Media == nil {
+		return 0
+	}
+	bandwidth := v.Bandwidth
+	if v.AverageBandwidth > 0 {
+		bandwidth = v.AverageBandwidth
+	}
+	return int64(float64(bandwidth) * v.Media.Duration / 8)
+}
+
+// sortedKeys returns the keys of a set in sorted order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,169 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+)
+
+func newTestServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestFetcher() *fetcher.Fetcher {
+	opts := fetcher.DefaultOptions()
+	opts.MaxRetries = 0
+	opts.RetryWaitMin = time.Millisecond
+	opts.RetryWaitMax = time.Millisecond
+	return fetcher.New(opts)
+}
+
+func TestInspectMaster(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/master.m3u8": `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",LANGUAGE="en",NAME="English",DEFAULT=YES,URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",LANGUAGE="de",NAME="Deutsch",URI="subs/missing.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2",FRAME-RATE=25.000,AUDIO="aud"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,AVERAGE-BANDWIDTH=1600000,RESOLUTION=1280x720,AUDIO="aud"
+high/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,URI="low/iframes.m3u8"
+`,
+		"/low/index.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10,
+a.ts
+#EXTINF:10,
+b.ts
+#EXT-X-ENDLIST
+`,
+		"/high/index.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+a.ts
+#EXTINF:10,
+b.ts
+#EXTINF:5,
+c.ts
+#EXT-X-ENDLIST
+`,
+		"/low/iframes.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-I-FRAMES-ONLY
+#EXT-X-BYTERANGE:1000@0
+#EXTINF:10,
+a.ts
+`,
+		"/audio/en.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+a.aac
+#EXT-X-ENDLIST
+`,
+	})
+
+	report, err := Inspect(context.Background(), newTestFetcher(), srv.URL+"/master.m3u8")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+
+	if !report.Master {
+		t.Fatal("expected a master playlist")
+	}
+	if len(report.Variants) != 3 || len(report.Renditions) != 2 {
+		t.Fatalf("got %d variants and %d renditions, want 3 and 2", len(report.Variants), len(report.Renditions))
+	}
+
+	low := report.Variants[0]
+	if low.Bandwidth != 800000 || low.Resolution != "640x360" || low.FrameRate != 25 || low.Audio != "aud" {
+		t.Errorf("low variant = %+v", low)
+	}
+	if low.Media == nil || low.Media.Segments != 2 || low.Media.Duration != 20 {
+		t.Errorf("low media = %+v", low.Media)
+	}
+	if low.EstimatedSize != 800000*20/8 {
+		t.Errorf("low estimated size = %d, want %d", low.EstimatedSize, 800000*20/8)
+	}
+
+	// AVERAGE-BANDWIDTH is preferred for estimates
+	high := report.Variants[1]
+	if high.EstimatedSize != 1600000*25/8 {
+		t.Errorf("high estimated size = %d, want %d", high.EstimatedSize, 1600000*25/8)
+	}
+
+	iframe := report.Variants[2]
+	if !iframe.IFrame || iframe.Media == nil || !iframe.Media.Live {
+		t.Errorf("iframe variant = %+v", iframe)
+	}
+
+	audio := report.Renditions[0]
+	if audio.Type != "AUDIO" || audio.Language != "en" || audio.GroupID != "aud" || !audio.Default {
+		t.Errorf("audio rendition = %+v", audio)
+	}
+	if report.Renditions[1].Media == nil || report.Renditions[1].Media.Error == "" {
+		t.Errorf("expected an error for the missing subtitle playlist, got %+v", report.Renditions[1].Media)
+	}
+
+	if report.Duration != 25 {
+		t.Errorf("duration = %v, want 25", report.Duration)
+	}
+	if len(report.Encryption) != 1 || report.Encryption[0] != "AES-128" {
+		t.Errorf("encryption = %v, want [AES-128]", report.Encryption)
+	}
+
+	var out bytes.Buffer
+	WriteTree(&out, report)
+	for _, want := range []string{"(master playlist)", "800 kbps 640x360 25fps", "AUDIO \"English\" group=aud language=en default", "2 segments, 20s, encrypted (AES-128)", "error:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("tree output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestInspectMedia(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/index.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXTINF:6,
+a.ts
+#EXTINF:4.5,
+b.ts
+#EXT-X-ENDLIST
+`,
+	})
+
+	report, err := Inspect(context.Background(), newTestFetcher(), srv.URL+"/index.m3u8")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if report.Master || report.Media == nil {
+		t.Fatalf("expected a media playlist, got %+v", report)
+	}
+	if report.Media.Segments != 2 || report.Media.Duration != 10.5 || report.Media.TargetDuration != 6 || report.Media.Live {
+		t.Errorf("media = %+v", report.Media)
+	}
+}
+
+func TestInspectFetchError(t *testing.T) {
+	srv := newTestServer(t, map[string]string{})
+	if _, err := Inspect(context.Background(), newTestFetcher(), srv.URL+"/missing.m3u8"); err == nil {
+		t.Error("expected an error for a missing playlist")
+	}
+}
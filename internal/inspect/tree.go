@@ -0,0 +1,135 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+)
+
+// WriteTree prints the report as a human-readable tree.
+func WriteTree(w io.Writer, r *Report) {
+	if !r.Master {
+		fmt.Fprintf(w, "%s (media playlist)\n", r.URL)
+		fmt.Fprintf(w, "└── %s\n", describeMedia(r.Media))
+		return
+	}
+
+	fmt.Fprintf(w, "%s (master playlist)\n", r.URL)
+
+	items := make([]string, 0, len(r.Variants)+len(r.Renditions))
+	children := make([]*Media, 0, cap(items))
+	for _, v := range r.Variants {
+		items = append(items, describeVariant(v))
+		children = append(children, v.Media)
+	}
+	for _, rendition := range r.Renditions {
+		items = append(items, describeRendition(rendition))
+		children = append(children, rendition.Media)
+	}
+
+	for i, item := range items {
+		branch, indent := "├── ", "│   "
+		if i == len(items)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s\n", branch, item)
+		if children[i] != nil {
+			fmt.Fprintf(w, "%s└── %s\n", indent, describeMedia(children[i]))
+		}
+	}
+
+	encryption := "none"
+	if len(r.Encryption) > 0 {
+		encryption = strings.Join(r.Encryption, ", ")
+	}
+	fmt.Fprintf(w, "\n%d variants, %d renditions, duration %s, encryption %s, estimated size %s\n",
+		len(r.Variants), len(r.Renditions), formatSeconds(r.Duration), encryption, downloader.FormatBytes(r.EstimatedSize))
+}
+
+// describeVariant formats the attributes of a variant on one line.
+func describeVariant(v Variant) string {
+	parts := []string{"Variant"}
+	if v.IFrame {
+		parts[0] = "I-frame variant"
+	} else if v.Image {
+		parts[0] = "Image variant"
+	}
+	parts = append(parts, formatBandwidth(v.Bandwidth))
+	if v.Resolution != "" {
+		parts = append(parts, v.Resolution)
+	}
+	if v.FrameRate > 0 {
+		parts = append(parts, fmt.Sprintf("%gfps", v.FrameRate))
+	}
+	if v.Codecs != "" {
+		parts = append(parts, v.Codecs)
+	}
+	if v.Audio != "" {
+		parts = append(parts, "audio="+v.Audio)
+	}
+	if v.Subtitles != "" {
+		parts = append(parts, "subtitles="+v.Subtitles)
+	}
+	if v.Pathway != "" {
+		parts = append(parts, "pathway="+v.Pathway)
+	}
+	if v.EstimatedSize > 0 {
+		parts = append(parts, "~"+downloader.FormatBytes(v.EstimatedSize))
+	}
+	return strings.Join(parts, " ") + " " + v.URL
+}
+
+// describeRendition formats the attributes of a rendition on one line.
+func describeRendition(r Rendition) string {
+	parts := []string{r.Type, fmt.Sprintf("%q", r.Name), "group=" + r.GroupID}
+	if r.Language != "" {
+		parts = append(parts, "language="+r.Language)
+	}
+	if r.Default {
+		parts = append(parts, "default")
+	}
+	if r.URL == "" {
+		parts = append(parts, "(muxed)")
+	} else {
+		parts = append(parts, r.URL)
+	}
+	return strings.Join(parts, " ")
+}
+
+// describeMedia formats the summary of a media playlist on one line.
+func describeMedia(m *Media) string {
+	if m.Error != "" {
+		return "error: " + m.Error
+	}
+	parts := []string{
+		fmt.Sprintf("%d segments", m.Segments),
+		formatSeconds(m.Duration),
+	}
+	if len(m.Encryption) > 0 {
+		parts = append(parts, "encrypted ("+strings.Join(m.Encryption, ", ")+")")
+	}
+	if m.Live {
+		parts = append(parts, "live")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatBandwidth formats a bit rate in human-readable form.
+func formatBandwidth(bps int64) string {
+	switch {
+	case bps >= 1000000:
+		return fmt.Sprintf("%.1f Mbps", float64(bps)/1000000)
+	case bps >= 1000:
+		return fmt.Sprintf("%.0f kbps", float64(bps)/1000)
+	default:
+		return fmt.Sprintf("%d bps", bps)
+	}
+}
+
+// formatSeconds formats a duration in seconds in human-readable form.
+func formatSeconds(seconds float64) string {
+	return downloader.FormatDuration(time.Duration(seconds * float64(time.Second)))
+}
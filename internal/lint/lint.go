@@ -0,0 +1,611 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Severity is how serious an issue is.
+type Severity string
+
+const (
+	// SeverityError means the playlist breaks a MUST of RFC 8216, and
+	// players may reject it or play it wrong.
+	SeverityError Severity = "error"
+	// SeverityWarning means the playlist breaks a SHOULD of RFC 8216, or
+	// has something that is most likely a mistake.
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single problem found in a playlist.
+type Issue struct {
+	// Playlist is the URL or path of the playlist (empty for Lint)
+	Playlist string `json:"playlist,omitempty"`
+	// Line is the 1-based line number of the problem, or 0 for problems
+	// with the playlist as a whole
+	Line int `json:"line,omitempty"`
+	// Severity is how serious the problem is
+	Severity Severity `json:"severity"`
+	// Rule names the check that failed (e.g. "target-duration")
+	Rule string `json:"rule"`
+	// Message is a human-readable explanation
+	Message string `json:"message"`
+}
+
+// String formats the issue as "playlist:line: severity: message (rule)".
+func (i Issue) String() string {
+	location := i.Playlist
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, i.Line)
+	}
+	if location != "" {
+		location += ": "
+	}
+	return fmt.Sprintf("%s%s: %s (%s)", location, i.Severity, i.Message, i.Rule)
+}
+
+// attributeListTags are the tags whose value is an attribute list.
+var attributeListTags = map[string]bool{
+	"EXT-X-KEY":                true,
+	"EXT-X-MAP":                true,
+	"EXT-X-DATERANGE":          true,
+	"EXT-X-MEDIA":              true,
+	"EXT-X-STREAM-INF":         true,
+	"EXT-X-I-FRAME-STREAM-INF": true,
+	"EXT-X-IMAGE-STREAM-INF":   true,
+	"EXT-X-SESSION-DATA":       true,
+	"EXT-X-SESSION-KEY":        true,
+	"EXT-X-CONTENT-STEERING":   true,
+	"EXT-X-START":              true,
+	"EXT-X-DEFINE":             true,
+	"EXT-X-SKIP":               true,
+	"EXT-X-PRELOAD-HINT":       true,
+	"EXT-X-RENDITION-REPORT":   true,
+	"EXT-X-PART":               true,
+	"EXT-X-PART-INF":           true,
+	"EXT-X-SERVER-CONTROL":     true,
+}
+
+// masterTags only appear in master playlists.
+var masterTags = map[string]bool{
+	"EXT-X-MEDIA":              true,
+	"EXT-X-STREAM-INF":         true,
+	"EXT-X-I-FRAME-STREAM-INF": true,
+	"EXT-X-IMAGE-STREAM-INF":   true,
+	"EXT-X-SESSION-DATA":       true,
+	"EXT-X-SESSION-KEY":        true,
+	"EXT-X-CONTENT-STEERING":   true,
+}
+
+// mediaTags only appear in media playlists.
+var mediaTags = map[string]bool{
+	"EXTINF":                       true,
+	"EXT-X-BYTERANGE":              true,
+	"EXT-X-DISCONTINUITY":          true,
+	"EXT-X-KEY":                    true,
+	"EXT-X-MAP":                    true,
+	"EXT-X-PROGRAM-DATE-TIME":      true,
+	"EXT-X-DATERANGE":              true,
+	"EXT-X-GAP":                    true,
+	"EXT-X-BITRATE":                true,
+	"EXT-X-TARGETDURATION":         true,
+	"EXT-X-MEDIA-SEQUENCE":         true,
+	"EXT-X-DISCONTINUITY-SEQUENCE": true,
+	"EXT-X-ENDLIST":                true,
+	"EXT-X-PLAYLIST-TYPE":          true,
+	"EXT-X-I-FRAMES-ONLY":          true,
+}
+
+// quotedAttributes must be quoted strings, and integerAttributes decimal
+// integers, wherever they appear.
+var (
+	quotedAttributes = map[string]bool{
+		"URI": true, "CODECS": true, "GROUP-ID": true, "NAME": true, "LANGUAGE": true,
+		"ASSOC-LANGUAGE": true, "AUDIO": true, "VIDEO": true, "SUBTITLES": true,
+		"KEYFORMAT": true, "KEYFORMATVERSIONS": true, "ID": true, "CLASS": true,
+		"START-DATE": true, "END-DATE": true, "DATA-ID": true, "VALUE": true,
+		"SERVER-URI": true, "PATHWAY-ID": true, "INSTREAM-ID": true,
+		"CHARACTERISTICS": true, "CHANNELS": true, "STABLE-VARIANT-ID": true,
+		"STABLE-RENDITION-ID": true,
+	}
+	integerAttributes = map[string]bool{"BANDWIDTH": true, "AVERAGE-BANDWIDTH": true}
+)
+
+// attributeName matches a valid AttributeName.
+var attributeName = regexp.MustCompile(`^[A-Z0-9-]+$`)
+
+// feature is something a playlist uses that needs a minimum EXT-X-VERSION.
+type feature struct {
+	version int
+	what    string
+	line    int
+}
+
+// groupRef is a rendition group referenced by a variant.
+type groupRef struct {
+	kind, id string
+	line     int
+}
+
+// duration is an EXTINF duration and its line.
+type duration struct {
+	seconds float64
+	line    int
+}
+
+// result is everything linting a single playlist found out.
+type result struct {
+	issues []Issue
+	// children are the URIs of the playlists a master playlist references
+	children []string
+	// master is true for master playlists
+	master bool
+	// live is true for media playlists that may still change
+	live bool
+	// targetDuration is the EXT-X-TARGETDURATION in seconds
+	targetDuration int
+}
+
+// linter holds the state of linting a single playlist.
+type linter struct {
+	result
+
+	version, versionLine int
+	features             []feature
+	hasTarget            bool
+	durations            []duration
+	firstMaster          int // Line of the first master playlist tag
+	firstMedia           int // Line of the first media playlist tag
+	segments             int
+	extinf               bool // EXTINF seen since the last segment URI
+	byteRange            bool // EXT-X-BYTERANGE seen since the last segment URI
+	variantLine          int  // Line of an EXT-X-STREAM-INF waiting for its URI
+	iframesOnly          bool
+	mapLine              int
+	endList              bool
+	playlistType         string
+	uris                 map[string]int // Segment URIs without byte ranges
+	variantURIs          map[string]int // URIs of variant streams
+	groups               map[string]bool
+	groupRefs            []groupRef
+}
+
+// Lint checks a playlist against the rules of RFC 8216.
+//
+// It checks the #EXTM3U header, attribute list syntax and required
+// attributes, EXTINF durations against EXT-X-TARGETDURATION, the
+// EXT-X-VERSION the features used require, the placement of
+// EXT-X-MEDIA-SEQUENCE and EXT-X-DISCONTINUITY-SEQUENCE, CODECS and
+// BANDWIDTH on variants, references to undefined rendition groups, and
+// duplicate URIs. Checks that need several versions of a playlist are done
+// by CheckReload.
+//
+// Returns the issues found, in line order.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8216
+func Lint(content []byte) []Issue {
+	return lintPlaylist(content).issues
+}
+
+// lintPlaylist lints a single playlist.
+func lintPlaylist(content []byte) *result {
+	l := &linter{
+		version:     1,
+		uris:        make(map[string]int),
+		variantURIs: make(map[string]int),
+		groups:      make(map[string]bool),
+	}
+
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNum == 1 && line != "#EXTM3U" {
+			l.add(1, SeverityError, "header", "the first line must be #EXTM3U")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT"):
+			l.tag(lineNum, line)
+		case strings.HasPrefix(line, "#"):
+			// Comment
+		default:
+			l.uri(lineNum, strings.TrimSpace(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		l.add(lineNum, SeverityError, "header", fmt.Sprintf("cannot read playlist: %v", err))
+	}
+
+	l.finish()
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		return l.issues[i].Line < l.issues[j].Line
+	})
+	return &l.result
+}
+
+// add records an issue.
+func (l *linter) add(line int, severity Severity, rule, message string) {
+	l.issues = append(l.issues, Issue{Line: line, Severity: severity, Rule: rule, Message: message})
+}
+
+// require records that the playlist uses a feature that needs at least the
+// given EXT-X-VERSION.
+func (l *linter) require(version int, what string, line int) {
+	for _, f := range l.features {
+		if f.what == what {
+			return
+		}
+	}
+	l.features = append(l.features, feature{version: version, what: what, line: line})
+}
+
+// tag checks a single tag line.
+func (l *linter) tag(lineNum int, line string) {
+	name, value, _ := strings.Cut(strings.TrimPrefix(line, "#"), ":")
+
+	switch {
+	case masterTags[name]:
+		if l.firstMaster == 0 {
+			l.firstMaster = lineNum
+		}
+		l.master = true
+	case mediaTags[name]:
+		if l.firstMedia == 0 {
+			l.firstMedia = lineNum
+		}
+	}
+
+	var attrs map[string]string
+	if attributeListTags[name] {
+		var err error
+		attrs, err = parseAttributeList(value)
+		if err != nil {
+			// The attributes can't be trusted, so skip the checks that use them
+			l.add(lineNum, SeverityError, "attribute-list", fmt.Sprintf("%s: %v", name, err))
+			if name == "EXT-X-STREAM-INF" {
+				l.variantLine = lineNum
+			}
+			return
+		}
+	}
+
+	switch name {
+	case "EXT-X-VERSION":
+		if l.versionLine != 0 {
+			l.add(lineNum, SeverityError, "version", "EXT-X-VERSION appears more than once")
+		}
+		l.versionLine = lineNum
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 {
+			l.add(lineNum, SeverityError, "version", fmt.Sprintf("invalid EXT-X-VERSION %q", value))
+			return
+		}
+		l.version = v
+
+	case "EXT-X-TARGETDURATION":
+		target, err := strconv.Atoi(value)
+		if err != nil || target < 0 {
+			l.add(lineNum, SeverityError, "target-duration", fmt.Sprintf("EXT-X-TARGETDURATION must be a decimal integer, got %q", value))
+			return
+		}
+		l.hasTarget, l.targetDuration = true, target
+
+	case "EXT-X-MEDIA-SEQUENCE", "EXT-X-DISCONTINUITY-SEQUENCE":
+		rule := "media-sequence"
+		if name == "EXT-X-DISCONTINUITY-SEQUENCE" {
+			rule = "discontinuity-sequence"
+		}
+		if l.segments > 0 || l.extinf {
+			l.add(lineNum, SeverityError, rule, name+" must appear before the first media segment")
+		}
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			l.add(lineNum, SeverityError, rule, fmt.Sprintf("%s must be a decimal integer, got %q", name, value))
+		}
+
+	case "EXTINF":
+		durationStr, _, _ := strings.Cut(value, ",")
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(durationStr), 64)
+		if err != nil || seconds < 0 {
+			l.add(lineNum, SeverityError, "extinf", fmt.Sprintf("invalid EXTINF duration %q", durationStr))
+		} else {
+			l.durations = append(l.durations, duration{seconds: seconds, line: lineNum})
+		}
+		if strings.Contains(durationStr, ".") {
+			l.require(3, "floating-point EXTINF durations", lineNum)
+		}
+		if l.extinf {
+			l.add(lineNum, SeverityError, "extinf", "EXTINF without a media segment URI")
+		}
+		l.extinf = true
+
+	case "EXT-X-BYTERANGE":
+		l.require(4, "EXT-X-BYTERANGE", lineNum)
+		l.byteRange = true
+
+	case "EXT-X-I-FRAMES-ONLY":
+		l.require(4, "EXT-X-I-FRAMES-ONLY", lineNum)
+		l.iframesOnly = true
+
+	case "EXT-X-ENDLIST":
+		l.endList = true
+
+	case "EXT-X-PLAYLIST-TYPE":
+		if value != "VOD" && value != "EVENT" {
+			l.add(lineNum, SeverityError, "playlist-type", fmt.Sprintf("EXT-X-PLAYLIST-TYPE must be VOD or EVENT, got %q", value))
+		}
+		l.playlistType = value
+
+	case "EXT-X-KEY", "EXT-X-SESSION-KEY":
+		l.checkRequired(lineNum, name, attrs, "METHOD")
+		method := attrs["METHOD"]
+		if method == "NONE" && name == "EXT-X-SESSION-KEY" {
+			l.add(lineNum, SeverityError, "required-attribute", "EXT-X-SESSION-KEY must not have METHOD=NONE")
+		}
+		if method != "NONE" && method != "" {
+			l.checkRequired(lineNum, name, attrs, "URI")
+		}
+		if _, ok := attrs["IV"]; ok {
+			l.require(2, "the IV attribute", lineNum)
+		}
+		if _, ok := attrs["KEYFORMAT"]; ok {
+			l.require(5, "the KEYFORMAT attribute", lineNum)
+		}
+		if _, ok := attrs["KEYFORMATVERSIONS"]; ok {
+			l.require(5, "the KEYFORMATVERSIONS attribute", lineNum)
+		}
+
+	case "EXT-X-MAP":
+		l.checkRequired(lineNum, name, attrs, "URI")
+		if l.mapLine == 0 {
+			l.mapLine = lineNum
+		}
+
+	case "EXT-X-DEFINE":
+		l.require(8, "EXT-X-DEFINE", lineNum)
+
+	case "EXT-X-STREAM-INF":
+		l.checkVariant(lineNum, name, attrs)
+		if l.variantLine != 0 {
+			l.add(l.variantLine, SeverityError, "required-attribute", "EXT-X-STREAM-INF without a URI")
+		}
+		l.variantLine = lineNum
+
+	case "EXT-X-I-FRAME-STREAM-INF", "EXT-X-IMAGE-STREAM-INF":
+		l.checkVariant(lineNum, name, attrs)
+		l.checkRequired(lineNum, name, attrs, "URI")
+		l.variantURI(lineNum, unquote(attrs["URI"]))
+
+	case "EXT-X-MEDIA":
+		l.checkRequired(lineNum, name, attrs, "TYPE", "GROUP-ID", "NAME")
+		mediaType := attrs["TYPE"]
+		groupID := unquote(attrs["GROUP-ID"])
+		l.groups[mediaType+"/"+groupID] = true
+		if mediaType == "CLOSED-CAPTIONS" {
+			if _, ok := attrs["URI"]; ok {
+				l.add(lineNum, SeverityError, "required-attribute", "EXT-X-MEDIA of TYPE=CLOSED-CAPTIONS must not have a URI")
+			}
+			l.checkRequired(lineNum, name, attrs, "INSTREAM-ID")
+			if strings.HasPrefix(unquote(attrs["INSTREAM-ID"]), "SERVICE") {
+				l.require(7, "INSTREAM-ID SERVICE values", lineNum)
+			}
+		}
+		if uri := unquote(attrs["URI"]); uri != "" {
+			l.children = append(l.children, uri)
+		}
+	}
+}
+
+// checkRequired reports every one of names that attrs lacks.
+func (l *linter) checkRequired(lineNum int, tag string, attrs map[string]string, names ...string) {
+	for _, name := range names {
+		if _, ok := attrs[name]; !ok {
+			l.add(lineNum, SeverityError, "required-attribute", fmt.Sprintf("%s is missing the %s attribute", tag, name))
+		}
+	}
+}
+
+// checkVariant checks the attributes common to all variant stream tags.
+func (l *linter) checkVariant(lineNum int, tag string, attrs map[string]string) {
+	l.checkRequired(lineNum, tag, attrs, "BANDWIDTH")
+	if _, ok := attrs["CODECS"]; !ok {
+		l.add(lineNum, SeverityWarning, "codecs", tag+" should have a CODECS attribute")
+	}
+	for _, kind := range []string{"AUDIO", "VIDEO", "SUBTITLES", "CLOSED-CAPTIONS"} {
+		value, ok := attrs[kind]
+		if !ok || value == "NONE" {
+			continue
+		}
+		l.groupRefs = append(l.groupRefs, groupRef{kind: kind, id: unquote(value), line: lineNum})
+	}
+}
+
+// variantURI records the URI of a variant stream.
+func (l *linter) variantURI(lineNum int, uri string) {
+	if uri == "" {
+		return
+	}
+	if first, ok := l.variantURIs[uri]; ok {
+		l.add(lineNum, SeverityWarning, "duplicate-uri", fmt.Sprintf("%s is already used by the variant on line %d", uri, first))
+	} else {
+		l.variantURIs[uri] = lineNum
+		l.children = append(l.children, uri)
+	}
+}
+
+// uri checks a URI line.
+func (l *linter) uri(lineNum int, uri string) {
+	if l.variantLine != 0 {
+		l.variantURI(lineNum, uri)
+		l.variantLine = 0
+		return
+	}
+
+	if l.master {
+		l.add(lineNum, SeverityError, "playlist-type", "URI line without EXT-X-STREAM-INF in a master playlist")
+		return
+	}
+	if !l.extinf {
+		l.add(lineNum, SeverityError, "extinf", "media segment without EXTINF")
+	}
+	if !l.byteRange {
+		if first, ok := l.uris[uri]; ok {
+			l.add(lineNum, SeverityWarning, "duplicate-uri", fmt.Sprintf("%s is already used by the segment on line %d", uri, first))
+		} else {
+			l.uris[uri] = lineNum
+		}
+	}
+	if l.firstMedia == 0 {
+		l.firstMedia = lineNum
+	}
+	l.segments++
+	l.extinf, l.byteRange = false, false
+}
+
+// finish runs the checks that need the whole playlist.
+func (l *linter) finish() {
+	if l.variantLine != 0 {
+		l.add(l.variantLine, SeverityError, "required-attribute", "EXT-X-STREAM-INF without a URI")
+	}
+
+	if l.master && l.firstMedia != 0 {
+		l.add(max(l.firstMaster, l.firstMedia), SeverityError, "playlist-type", "the playlist mixes master and media playlist tags")
+	}
+
+	if !l.master {
+		if !l.hasTarget {
+			l.add(0, SeverityError, "target-duration", "media playlist without EXT-X-TARGETDURATION")
+		} else {
+			for _, d := range l.durations {
+				if int(math.Round(d.seconds)) > l.targetDuration {
+					l.add(d.line, SeverityError, "target-duration",
+						fmt.Sprintf("EXTINF duration %g exceeds EXT-X-TARGETDURATION %d", d.seconds, l.targetDuration))
+				}
+			}
+		}
+		l.live = !l.endList && l.playlistType != "VOD"
+	}
+
+	if l.mapLine != 0 {
+		if l.iframesOnly {
+			l.require(5, "EXT-X-MAP in an I-frame playlist", l.mapLine)
+		} else {
+			l.require(6, "EXT-X-MAP", l.mapLine)
+		}
+	}
+	for _, f := range l.features {
+		if f.version > l.version {
+			l.add(f.line, SeverityError, "version",
+				fmt.Sprintf("%s requires EXT-X-VERSION:%d or later, but the playlist declares %d", f.what, f.version, l.version))
+		}
+	}
+
+	// The variant attribute names match the EXT-X-MEDIA TYPE values
+	for _, ref := range l.groupRefs {
+		if !l.groups[ref.kind+"/"+ref.id] {
+			l.add(ref.line, SeverityError, "rendition-group", fmt.Sprintf("%s group %q is not defined by any EXT-X-MEDIA", ref.kind, ref.id))
+		}
+	}
+}
+
+// parseAttributeList parses an attribute list strictly, reporting the first
+// syntax error.
+//
+// Values are returned as written, with quotes, so callers can tell quoted
+// strings from other types.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8216#section-4.2
+func parseAttributeList(list string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	rest := list
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq == -1 {
+			return attrs, fmt.Errorf("expected NAME=value, got %q", rest)
+		}
+		name := rest[:eq]
+		if !attributeName.MatchString(name) {
+			return attrs, fmt.Errorf("invalid attribute name %q", name)
+		}
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				return attrs, fmt.Errorf("unterminated quoted string in %s", name)
+			}
+			value, rest = rest[:end+2], rest[end+2:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+			if value == "" || strings.ContainsAny(value, " \t\"") {
+				return attrs, fmt.Errorf("invalid value %q for %s", value, name)
+			}
+		}
+
+		if _, ok := attrs[name]; ok {
+			return attrs, fmt.Errorf("duplicate attribute %s", name)
+		}
+		attrs[name] = value
+		if err := checkAttributeType(name, value); err != nil {
+			return attrs, err
+		}
+
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return attrs, fmt.Errorf("expected ',' after %s", name)
+		}
+		rest = rest[1:]
+		if rest == "" {
+			return attrs, fmt.Errorf("trailing ','")
+		}
+	}
+	return attrs, nil
+}
+
+// checkAttributeType checks the type of attributes whose type is the same
+// in every tag.
+func checkAttributeType(name, value string) error {
+	quoted := strings.HasPrefix(value, "\"")
+	switch {
+	case quotedAttributes[name] && !quoted:
+		return fmt.Errorf("%s must be a quoted string", name)
+	case integerAttributes[name]:
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			return fmt.Errorf("%s must be a decimal integer, got %s", name, value)
+		}
+	case name == "RESOLUTION":
+		width, height, ok := strings.Cut(value, "x")
+		if _, err := strconv.Atoi(width); err != nil || !ok {
+			return fmt.Errorf("RESOLUTION must be WIDTHxHEIGHT, got %s", value)
+		}
+		if _, err := strconv.Atoi(height); err != nil {
+			return fmt.Errorf("RESOLUTION must be WIDTHxHEIGHT, got %s", value)
+		}
+	case name == "CLOSED-CAPTIONS" && !quoted && value != "NONE":
+		return fmt.Errorf("CLOSED-CAPTIONS must be a quoted string or NONE")
+	}
+	return nil
+}
+
+// unquote removes the quotes around a quoted-string attribute value.
+func unquote(value string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(value, "\""), "\"")
+}
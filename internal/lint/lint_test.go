@@ -0,0 +1,212 @@
+package lint
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+)
+
+// rules returns "rule:line" for every issue, for compact comparisons.
+func rules(issues []Issue) []string {
+	var got []string
+	for _, issue := range issues {
+		got = append(got, fmt.Sprintf("%s:%d", issue.Rule, issue.Line))
+	}
+	return got
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		expected []string
+	}{
+		{
+			"valid media playlist",
+			"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXTINF:9.5,\nseg0.ts\n#EXTINF:10.4,\nseg1.ts\n#EXT-X-ENDLIST\n",
+			nil,
+		},
+		{
+			"valid master playlist",
+			"#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"en\",URI=\"audio.m3u8\"\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=\"avc1.4d401f,mp4a.40.2\",RESOLUTION=640x360,AUDIO=\"aud\"\nvideo.m3u8\n",
+			nil,
+		},
+		{
+			"missing header",
+			"#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n",
+			[]string{"header:1"},
+		},
+		{
+			"EXTINF longer than the target duration",
+			"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.6,\nseg0.ts\n",
+			[]string{"target-duration:4"},
+		},
+		{
+			"missing target duration",
+			"#EXTM3U\n#EXTINF:10,\nseg0.ts\n",
+			[]string{"target-duration:0"},
+		},
+		{
+			"features need a newer version",
+			"#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:9.5,\n#EXT-X-BYTERANGE:100@0\nseg.mp4\n",
+			[]string{"version:3", "version:4", "version:5"},
+		},
+		{
+			"malformed attribute lists",
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=avc1,\nvideo.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000,BANDWIDTH=2000,CODECS=\"avc1\"\nvideo2.m3u8\n" +
+				"#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=\"avc1\nvideo3.m3u8\n",
+			[]string{"attribute-list:2", "attribute-list:4", "attribute-list:6"},
+		},
+		{
+			"variants without BANDWIDTH or CODECS",
+			"#EXTM3U\n#EXT-X-STREAM-INF:RESOLUTION=640x360\nvideo.m3u8\n",
+			[]string{"required-attribute:2", "codecs:2"},
+		},
+		{
+			"undefined rendition group",
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=\"avc1\",AUDIO=\"aud\"\nvideo.m3u8\n",
+			[]string{"rendition-group:2"},
+		},
+		{
+			"duplicate URIs",
+			"#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n#EXTINF:10,\nseg0.ts\n" +
+				"#EXTINF:10,\n#EXT-X-BYTERANGE:10@0\nall.ts\n#EXTINF:10,\n#EXT-X-BYTERANGE:10@10\nall.ts\n",
+			[]string{"duplicate-uri:6", "version:8"},
+		},
+		{
+			"sequence tags after the first segment",
+			"#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg0.ts\n#EXT-X-MEDIA-SEQUENCE:5\n#EXT-X-DISCONTINUITY-SEQUENCE:x\n#EXTINF:10,\nseg1.ts\n",
+			[]string{"media-sequence:5", "discontinuity-sequence:6", "discontinuity-sequence:6"},
+		},
+		{
+			"mixed master and media tags",
+			"#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=\"avc1\"\nvideo.m3u8\n",
+			[]string{"playlist-type:3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(Lint([]byte(tt.playlist)))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Lint() = %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("Lint() = %v, expected %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReload(t *testing.T) {
+	previous := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:10\n#EXT-X-DISCONTINUITY-SEQUENCE:2\n" +
+		"#EXT-X-DISCONTINUITY\n#EXTINF:10,\ns10.ts\n#EXTINF:10,\ns11.ts\n#EXTINF:10,\ns12.ts\n"
+
+	tests := []struct {
+		name     string
+		current  string
+		expected []string
+	}{
+		{
+			"discontinuity sequence incremented",
+			"#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:11\n#EXT-X-DISCONTINUITY-SEQUENCE:3\n#EXTINF:10,\ns11.ts\n#EXTINF:10,\ns12.ts\n#EXTINF:10,\ns13.ts\n",
+			nil,
+		},
+		{
+			"discontinuity sequence not incremented",
+			"#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:11\n#EXT-X-DISCONTINUITY-SEQUENCE:2\n#EXTINF:10,\ns11.ts\n#EXTINF:10,\ns12.ts\n",
+			[]string{"discontinuity-sequence:0"},
+		},
+		{
+			"media sequence went backwards",
+			"#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:9\n#EXTINF:10,\ns09.ts\n",
+			[]string{"media-sequence:0"},
+		},
+		{
+			"segment changed URI",
+			"#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:10\n#EXT-X-DISCONTINUITY-SEQUENCE:2\n#EXTINF:10,\ns10.ts\n#EXTINF:10,\nother.ts\n#EXTINF:10,\ns12.ts\n",
+			[]string{"media-sequence:7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(CheckReload([]byte(previous), []byte(tt.current)))
+			if len(got) != len(tt.expected) {
+				t.Fatalf("CheckReload() = %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("CheckReload() = %v, expected %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRunLocalRecursive(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"master.m3u8": "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000,CODECS=\"avc1\"\nvideo/index.m3u8\n" +
+			"#EXT-X-STREAM-INF:BANDWIDTH=2000,CODECS=\"avc1\"\nmissing.m3u8\n",
+		"video/index.m3u8": "#EXTM3U\n#EXT-X-TARGETDURATION:5\n#EXTINF:10,\nseg0.ts\n#EXT-X-ENDLIST\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	report, err := Run(context.Background(), nil, filepath.Join(dir, "master.m3u8"), Options{Recursive: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Playlists != 2 || report.Errors() != 2 || report.Warnings() != 0 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if issue := report.Issues[0]; issue.Rule != "uri" || issue.Playlist != filepath.Join(dir, "master.m3u8") {
+		t.Errorf("Expected the missing child first, got %+v", issue)
+	}
+	if issue := report.Issues[1]; issue.Rule != "target-duration" || issue.Line != 3 ||
+		issue.Playlist != filepath.Join(dir, "video", "index.m3u8") {
+		t.Errorf("Unexpected issue: %+v", issue)
+	}
+}
+
+func TestRunReloads(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The second version goes back in time
+		if requests.Add(1) == 1 {
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:5\n#EXTINF:10,\ns5.ts\n"))
+		} else {
+			w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:4\n#EXTINF:10,\ns4.ts\n"))
+		}
+	}))
+	defer srv.Close()
+
+	f := fetcher.New(fetcher.DefaultOptions())
+	report, err := Run(context.Background(), f, srv.URL+"/live.m3u8", Options{Reloads: 1, ReloadInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if requests.Load() != 2 || len(report.Issues) != 1 || report.Issues[0].Rule != "media-sequence" {
+		t.Errorf("Unexpected report after %d requests: %+v", requests.Load(), report)
+	}
+}
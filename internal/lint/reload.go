@@ -0,0 +1,105 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// snapshot is what CheckReload needs to know about one version of a media
+// playlist.
+type snapshot struct {
+	mediaSequence         uint64
+	discontinuitySequence uint64
+	segments              []snapshotSegment
+}
+
+// snapshotSegment is a media segment of a snapshot.
+type snapshotSegment struct {
+	uri           string
+	discontinuity bool
+	line          int
+}
+
+// takeSnapshot scans the sequence numbers and segments of a media playlist.
+func takeSnapshot(content []byte) snapshot {
+	var s snapshot
+	discontinuity := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			s.mediaSequence, _ = strconv.ParseUint(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			s.discontinuitySequence, _ = strconv.ParseUint(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"), 10, 64)
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case strings.HasPrefix(line, "#"):
+		default:
+			s.segments = append(s.segments, snapshotSegment{uri: line, discontinuity: discontinuity, line: lineNum})
+			discontinuity = false
+		}
+	}
+	return s
+}
+
+// CheckReload compares two successive versions of a live media playlist.
+//
+// EXT-X-MEDIA-SEQUENCE must never decrease, a segment must keep its URI for
+// as long as it is in the playlist, and EXT-X-DISCONTINUITY-SEQUENCE must
+// grow by exactly the number of discontinuities that were removed from the
+// start of the playlist. Line numbers refer to current.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc8216#section-6.2.2
+func CheckReload(previous, current []byte) []Issue {
+	prev, cur := takeSnapshot(previous), takeSnapshot(current)
+	var issues []Issue
+	add := func(line int, rule, message string) {
+		issues = append(issues, Issue{Line: line, Severity: SeverityError, Rule: rule, Message: message})
+	}
+
+	if cur.mediaSequence < prev.mediaSequence {
+		add(0, "media-sequence", fmt.Sprintf("EXT-X-MEDIA-SEQUENCE went backwards from %d to %d", prev.mediaSequence, cur.mediaSequence))
+		return issues
+	}
+
+	removed := cur.mediaSequence - prev.mediaSequence
+	if removed > uint64(len(prev.segments)) {
+		// Everything was replaced, so there is nothing left to compare
+		if cur.discontinuitySequence < prev.discontinuitySequence {
+			add(0, "discontinuity-sequence", fmt.Sprintf("EXT-X-DISCONTINUITY-SEQUENCE went backwards from %d to %d",
+				prev.discontinuitySequence, cur.discontinuitySequence))
+		}
+		return issues
+	}
+
+	for i, segment := range prev.segments[removed:] {
+		if i >= len(cur.segments) {
+			add(0, "media-sequence", fmt.Sprintf("segment %d was removed from the end of the playlist", cur.mediaSequence+uint64(i)))
+			break
+		}
+		if cur.segments[i].uri != segment.uri {
+			add(cur.segments[i].line, "media-sequence", fmt.Sprintf("segment %d changed from %s to %s",
+				cur.mediaSequence+uint64(i), segment.uri, cur.segments[i].uri))
+			break
+		}
+	}
+
+	expected := prev.discontinuitySequence
+	for _, segment := range prev.segments[:removed] {
+		if segment.discontinuity {
+			expected++
+		}
+	}
+	if cur.discontinuitySequence != expected {
+		add(0, "discontinuity-sequence", fmt.Sprintf("EXT-X-DISCONTINUITY-SEQUENCE should be %d after %d segments were removed, got %d",
+			expected, removed, cur.discontinuitySequence))
+	}
+	return issues
+}
@@ -0,0 +1,188 @@
+package lint
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/fetcher"
+)
+
+// Options configures Run.
+type Options struct {
+	// Recursive lints the child playlists of master playlists too
+	Recursive bool
+	// Reloads is how many times each live media playlist is reloaded to
+	// check its sequence numbers across reloads (0 to skip the check)
+	Reloads int
+	// ReloadInterval is the time between reloads. If zero, the
+	// playlist's target duration is used.
+	ReloadInterval time.Duration
+}
+
+// Report is the result of linting a playlist and its children.
+type Report struct {
+	// Playlists is the number of playlists linted
+	Playlists int `json:"playlists"`
+	// Issues are the problems found, grouped by playlist in line order
+	Issues []Issue `json:"issues"`
+}
+
+// Errors returns the number of issues with SeverityError.
+func (r *Report) Errors() int {
+	return r.count(SeverityError)
+}
+
+// Warnings returns the number of issues with SeverityWarning.
+func (r *Report) Warnings() int {
+	return r.count(SeverityWarning)
+}
+
+// count returns the number of issues with the given severity.
+func (r *Report) count(severity Severity) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// Run lints the playlist at target, which is either a URL or a local file.
+//
+// With Options.Recursive, the variant and rendition playlists of a master
+// playlist are linted too; they are fetched, or read from disk when target
+// is a local file. Live media playlists are reloaded Options.Reloads times
+// and every reload is checked against the one before with CheckReload.
+//
+// An error is only returned if target itself cannot be loaded; child
+// playlists that cannot be loaded are reported as issues.
+func Run(ctx context.Context, f *fetcher.Fetcher, target string, opts Options) (*Report, error) {
+	base, content, err := load(ctx, f, target)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Issues: []Issue{}}
+	queue := []queued{{name: target, base: base, content: content}}
+	seen := map[string]bool{base.String(): true}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		result := lintPlaylist(current.content)
+		report.Playlists++
+		report.add(current.name, result.issues)
+
+		if result.live && opts.Reloads > 0 {
+			if err := reload(ctx, f, current, result, opts, report); err != nil {
+				return report, err
+			}
+		}
+
+		if !opts.Recursive {
+			continue
+		}
+		for _, child := range result.children {
+			ref, err := url.Parse(child)
+			if err != nil {
+				report.add(current.name, []Issue{{Severity: SeverityError, Rule: "uri", Message: fmt.Sprintf("invalid URI %q: %v", child, err)}})
+				continue
+			}
+			childURL := current.base.ResolveReference(ref)
+			if seen[childURL.String()] {
+				continue
+			}
+			seen[childURL.String()] = true
+
+			childBase, childContent, err := load(ctx, f, location(childURL))
+			if err != nil {
+				report.add(current.name, []Issue{{Severity: SeverityError, Rule: "uri", Message: err.Error()}})
+				continue
+			}
+			queue = append(queue, queued{name: location(childURL), base: childBase, content: childContent})
+		}
+	}
+	return report, nil
+}
+
+// queued is a playlist waiting to be linted.
+type queued struct {
+	name    string
+	base    *url.URL
+	content []byte
+}
+
+// add appends issues found in the named playlist.
+func (r *Report) add(name string, issues []Issue) {
+	for _, issue := range issues {
+		issue.Playlist = name
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+// reload reloads a live media playlist opts.Reloads times, checking each
+// version against the one before.
+func reload(ctx context.Context, f *fetcher.Fetcher, playlist queued, result *result, opts Options, report *Report) error {
+	interval := opts.ReloadInterval
+	if interval == 0 {
+		interval = time.Duration(max(result.targetDuration, 1)) * time.Second
+	}
+
+	previous := playlist.content
+	for i := 0; i < opts.Reloads; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+
+		_, current, err := load(ctx, f, location(playlist.base))
+		if err != nil {
+			report.add(playlist.name, []Issue{{Severity: SeverityError, Rule: "uri", Message: fmt.Sprintf("reload failed: %v", err)}})
+			return nil
+		}
+		report.add(playlist.name, CheckReload(previous, current))
+		previous = current
+	}
+	return nil
+}
+
+// load reads a playlist from a URL or a local file, returning the URL its
+// references are relative to.
+func load(ctx context.Context, f *fetcher.Fetcher, target string) (*url.URL, []byte, error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		resp, err := f.FetchResponse(ctx, target)
+		if err != nil {
+			return nil, nil, err
+		}
+		base, err := url.Parse(resp.URL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid URL %s: %w", resp.URL, err)
+		}
+		return base, resp.Body, nil
+	}
+
+	path, err := filepath.Abs(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve %s: %w", target, err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return &url.URL{Scheme: "file", Path: filepath.ToSlash(path)}, content, nil
+}
+
+// location turns a resolved URL back into something load accepts.
+func location(u *url.URL) string {
+	if u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return u.String()
+}
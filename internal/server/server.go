@@ -0,0 +1,207 @@
+package server
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+)
+
+// contentTypes maps file extensions to the MIME types HLS players expect.
+//
+// Go's built-in table doesn't know most of these, and players such as
+// hls.js and Safari are picky about playlist and segment types.
+var contentTypes = map[string]string{
+	".m3u8":   "application/vnd.apple.mpegurl",
+	".m3u":    "application/vnd.apple.mpegurl",
+	".mpd":    "application/dash+xml",
+	".ts":     "video/mp2t",
+	".mp4":    "video/mp4",
+	".m4s":    "video/mp4",
+	".m4v":    "video/mp4",
+	".cmfv":   "video/mp4",
+	".m4a":    "audio/mp4",
+	".cmfa":   "audio/mp4",
+	".aac":    "audio/aac",
+	".mp3":    "audio/mpeg",
+	".vtt":    "text/vtt",
+	".webvtt": "text/vtt",
+	".key":    "application/octet-stream",
+}
+
+// Options configures the Server.
+type Options struct {
+	// Dir is the directory to serve (typically a download's output directory)
+	Dir string
+	// LiveWindow, if greater than zero, serves VOD media playlists as a live
+	// stream with a sliding window of this many segments
+	LiveWindow int
+}
+
+// Server serves a mirrored download over HTTP for local playback.
+//
+// It adds the things a browser player needs on top of a plain file server:
+// correct HLS MIME types, CORS headers, and an index page listing the
+// playlists. Byte-range requests are handled by http.FileServer.
+//
+// See: https://context7.com/golang/go for Go net/http documentation
+type Server struct {
+	dir        string
+	liveWindow int
+	start      time.Time
+	files      http.Handler
+}
+
+// New creates a new Server with the given options.
+func New(opts Options) *Server {
+	return &Server{
+		dir:        opts.Dir,
+		liveWindow: opts.LiveWindow,
+		start:      time.Now(),
+		files:      http.FileServer(http.Dir(opts.Dir)),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w.Header())
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet, http.MethodHead:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == "/" {
+		s.serveIndex(w, r)
+		return
+	}
+
+	ext := strings.ToLower(path.Ext(r.URL.Path))
+	if contentType, ok := contentTypes[ext]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	if s.liveWindow > 0 && (ext == ".m3u8" || ext == ".m3u") {
+		if s.serveLivePlaylist(w, r) {
+			return
+		}
+	}
+
+	s.files.ServeHTTP(w, r)
+}
+
+// setCORSHeaders allows players on any origin to fetch the mirror.
+func setCORSHeaders(h http.Header) {
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "Range")
+	h.Set("Access-Control-Expose-Headers", "Content-Length, Content-Range")
+}
+
+// indexTemplate renders the list of playlists found in the served directory.
+//
+// Playlist names may contain characters such as '#', '?' or '%' that have a
+// meaning in URLs, so links are percent-encoded with href rather than left
+// to html/template, which keeps them as they are.
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"href": func(p string) string {
+		return (&url.URL{Path: "/" + p}).EscapedPath()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>m3u8dl</title>
+</head>
+<body>
+<h1>Playlists</h1>
+{{if .}}<ul>
+{{range .}}<li><a href="{{href .}}">{{.}}</a></li>
+{{end}}</ul>
+{{else}}<p>No playlists found.</p>
+{{end}}</body>
+</html>
+`))
+
+// serveIndex renders an HTML page linking to every playlist in the tree.
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	playlists, err := findPlaylists(s.dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	indexTemplate.Execute(w, playlists)
+}
+
+// findPlaylists returns the slash-separated paths of all playlists below dir.
+func findPlaylists(dir string) ([]string, error) {
+	playlists := make([]string, 0)
+
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".m3u8" && ext != ".m3u" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		playlists = append(playlists, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(playlists)
+	return playlists, nil
+}
+
+// serveLivePlaylist serves a VOD media playlist as a sliding live window.
+//
+// Returns false if the request isn't for a VOD media playlist, in which case
+// the caller should serve the file normally.
+func (s *Server) serveLivePlaylist(w http.ResponseWriter, r *http.Request) bool {
+	localPath := filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return false
+	}
+
+	window, ok := downloader.LiveWindow(content, s.liveWindow, time.Since(s.start))
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return true
+	}
+	w.Write(window)
+	return true
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const vodPlaylist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10.0,
+seg0.m4s
+#EXTINF:10.0,
+seg1.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:10.0,
+seg2.m4s
+#EXTINF:10.0,
+seg3.m4s
+#EXT-X-ENDLIST
+`
+
+func newTestServer(t *testing.T, liveWindow int) *Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"video/playlist.m3u8": vodPlaylist,
+		"video/seg0.m4s":      "0123456789",
+		"video/seg0.ts":       "ts",
+		"subs/en.vtt":         "WEBVTT\n",
+		"master.m3u8":         "#EXTM3U\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	return New(Options{Dir: dir, LiveWindow: liveWindow})
+}
+
+func TestServeContentTypes(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	tests := map[string]string{
+		"/video/playlist.m3u8": "application/vnd.apple.mpegurl",
+		"/video/seg0.m4s":      "video/mp4",
+		"/video/seg0.ts":       "video/mp2t",
+		"/subs/en.vtt":         "text/vtt",
+	}
+
+	for path, expected := range tests {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != expected {
+			t.Errorf("GET %s: expected Content-Type %s, got %s", path, expected, got)
+		}
+		if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("GET %s: missing CORS header", path)
+		}
+	}
+}
+
+func TestServeByteRange(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	req := httptest.NewRequest(http.MethodGet, "/video/seg0.m4s", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("Expected 206, got %d", rec.Code)
+	}
+	if rec.Body.String() != "2345" {
+		t.Errorf("Expected body 2345, got %q", rec.Body.String())
+	}
+}
+
+func TestServePreflight(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/video/seg0.m4s", nil))
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "Range") {
+		t.Error("Preflight should allow the Range header")
+	}
+}
+
+func TestServeIndex(t *testing.T) {
+	s := newTestServer(t, 0)
+	if err := os.WriteFile(filepath.Join(s.dir, "50% #1?.m3u8"), []byte("#EXTM3U\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+	for _, href := range []string{"/master.m3u8", "/video/playlist.m3u8", "/50%25%20%231%3F.m3u8"} {
+		if !strings.Contains(body, `href="`+href+`"`) {
+			t.Errorf("Index should link to %s, got:\n%s", href, body)
+		}
+	}
+	if strings.Contains(body, "seg0.m4s") {
+		t.Error("Index should only list playlists")
+	}
+}
+
+func TestServeLivePlaylist(t *testing.T) {
+	s := newTestServer(t, 1)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/video/playlist.m3u8", nil))
+
+	body := rec.Body.String()
+	if strings.Contains(body, "#EXT-X-ENDLIST") || strings.Contains(body, "seg1.m4s") {
+		t.Errorf("Expected a one segment live window, got:\n%s", body)
+	}
+	if rec.Header().Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Errorf("Unexpected Content-Type %s", rec.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,112 @@
+package verify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// tsPacketSize is the size of an MPEG-TS packet.
+const tsPacketSize = 188
+
+// tsSyncByte starts every MPEG-TS packet.
+const tsSyncByte = 0x47
+
+// mp4Extensions are file extensions used for (fragmented) MP4 segments.
+var mp4Extensions = map[string]bool{
+	".mp4": true, ".m4s": true, ".m4v": true, ".m4a": true,
+	".cmfv": true, ".cmfa": true, ".cmft": true, ".mp4a": true,
+}
+
+// mp4TopLevelBoxes are box types that can start an MP4 file or fragment.
+var mp4TopLevelBoxes = map[string]bool{
+	"ftyp": true, "styp": true, "moov": true, "moof": true, "sidx": true,
+	"emsg": true, "prft": true, "free": true, "skip": true, "mdat": true,
+}
+
+// checkStructure validates the container structure of a segment.
+//
+// The format is detected from the file extension, falling back to the
+// content. Formats we don't know how to check (e.g. WebVTT, AAC) pass.
+func checkStructure(p string, data []byte) error {
+	ext := strings.ToLower(filepath.Ext(p))
+
+	switch {
+	case ext == ".ts" || (ext != ".aac" && len(data) > 0 && data[0] == tsSyncByte && len(data)%tsPacketSize == 0):
+		return checkTS(data)
+	case mp4Extensions[ext] || (len(data) >= 8 && mp4TopLevelBoxes[string(data[4:8])]):
+		return checkMP4(data)
+	}
+
+	return nil
+}
+
+// checkTS verifies that data is a sequence of MPEG-TS packets, each starting
+// with the sync byte.
+func checkTS(data []byte) error {
+	if len(data)%tsPacketSize != 0 {
+		return fmt.Errorf("MPEG-TS size %d is not a multiple of %d", len(data), tsPacketSize)
+	}
+
+	for offset := 0; offset < len(data); offset += tsPacketSize {
+		if data[offset] != tsSyncByte {
+			return fmt.Errorf("missing MPEG-TS sync byte at offset %d", offset)
+		}
+	}
+
+	return nil
+}
+
+// checkMP4 verifies that data is a sequence of well-formed top-level MP4
+// boxes that exactly fill it.
+func checkMP4(data []byte) error {
+	offset := uint64(0)
+	total := uint64(len(data))
+
+	for offset < total {
+		if total-offset < 8 {
+			return fmt.Errorf("truncated MP4 box header at offset %d", offset)
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		boxType := data[offset+4 : offset+8]
+		headerSize := uint64(8)
+
+		switch size {
+		case 0:
+			// The box extends to the end of the data
+			size = total - offset
+		case 1:
+			if total-offset < 16 {
+				return fmt.Errorf("truncated MP4 box header at offset %d", offset)
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+			headerSize = 16
+		}
+
+		if !isBoxType(boxType) {
+			return fmt.Errorf("invalid MP4 box type %q at offset %d", boxType, offset)
+		}
+		if size < headerSize {
+			return fmt.Errorf("invalid MP4 box size %d for %q at offset %d", size, boxType, offset)
+		}
+		if size > total-offset {
+			return fmt.Errorf("MP4 box %q at offset %d is truncated (%d of %d bytes)", boxType, offset, total-offset, size)
+		}
+
+		offset += size
+	}
+
+	return nil
+}
+
+// isBoxType reports whether b looks like a four character box type.
+func isBoxType(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,255 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/knpwrs/m3u8dl/internal/downloader"
+)
+
+// Problem describes what is wrong with a referenced file.
+type Problem string
+
+const (
+	// ProblemMissing means the referenced file doesn't exist.
+	ProblemMissing Problem = "missing"
+	// ProblemEmpty means the referenced file has no content.
+	ProblemEmpty Problem = "empty"
+	// ProblemRange means a byte range extends past the end of the file.
+	ProblemRange Problem = "invalid-range"
+	// ProblemCorrupt means the file content isn't valid for its format.
+	ProblemCorrupt Problem = "corrupt"
+	// ProblemUnreadable means the file or playlist couldn't be read or parsed.
+	ProblemUnreadable Problem = "unreadable"
+)
+
+// Issue is a single problem found while verifying a mirror.
+type Issue struct {
+	// Path is the local file with the problem
+	Path string `json:"path"`
+	// Playlist is the playlist that references the file
+	Playlist string `json:"playlist,omitempty"`
+	// Line is the line in Playlist with the reference
+	Line int `json:"line,omitempty"`
+	// Problem is the kind of problem
+	Problem Problem `json:"problem"`
+	// Detail is a human-readable explanation
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the result of verifying a mirror.
+type Report struct {
+	// Playlists is the number of playlists parsed
+	Playlists int `json:"playlists"`
+	// Files is the number of distinct non-playlist files checked
+	Files int `json:"files"`
+	// Remote is the number of references to remote URLs, which are skipped
+	Remote int `json:"remote"`
+	// Issues lists every problem found
+	Issues []Issue `json:"issues"`
+}
+
+// OK reports whether the mirror is complete and intact.
+func (r *Report) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// verifier holds the state of a single verification run.
+type verifier struct {
+	report    *Report
+	playlists map[string]bool // Playlists already parsed
+	checked   map[string]bool // File and byte range combinations already checked
+	files     map[string]bool // Distinct files checked
+}
+
+// Verify checks that a mirrored playlist and everything it references is
+// present and intact on disk.
+//
+// Playlists are parsed recursively. Every referenced file must exist and be
+// non-empty, byte ranges must fit inside their files, and unencrypted MPEG-TS
+// and fragmented MP4 segments must be structurally valid. References to
+// remote URLs (e.g. filtered files kept on the origin) are counted but not
+// checked.
+//
+// Parameters:
+//   - playlistPath: The local path of the top-level playlist
+//
+// Returns the verification report. An error is only returned if the
+// top-level playlist can't be read at all.
+//
+// See: https://context7.com/golang/go for Go documentation
+func Verify(playlistPath string) (*Report, error) {
+	if _, err := os.Stat(playlistPath); err != nil {
+		return nil, fmt.Errorf("cannot read playlist %s: %w", playlistPath, err)
+	}
+
+	v := &verifier{
+		report:    &Report{Issues: make([]Issue, 0)},
+		playlists: make(map[string]bool),
+		checked:   make(map[string]bool),
+		files:     make(map[string]bool),
+	}
+
+	playlistURL, err := fileURL(playlistPath)
+	if err != nil {
+		return nil, err
+	}
+	v.verifyPlaylist(playlistURL, Issue{})
+
+	v.report.Files = len(v.files)
+	return v.report, nil
+}
+
+// verifyPlaylist parses a local playlist and checks all of its references.
+//
+// ref describes where the playlist was referenced from, for reporting.
+func (v *verifier) verifyPlaylist(playlistURL *url.URL, ref Issue) {
+	playlistPath, _ := localPath(playlistURL)
+	if v.playlists[playlistPath] {
+		return
+	}
+	v.playlists[playlistPath] = true
+
+	content, err := os.ReadFile(playlistPath)
+	if err != nil {
+		v.addIssue(ref, playlistPath, ProblemUnreadable, err.Error())
+		return
+	}
+
+	m3u8, err := downloader.ParseM3U8(content, playlistURL)
+	if err != nil {
+		v.addIssue(ref, playlistPath, ProblemUnreadable, err.Error())
+		return
+	}
+	v.report.Playlists++
+
+	for _, reference := range m3u8.References {
+		refURL, err := url.Parse(reference.URL)
+		if err != nil {
+			continue
+		}
+
+		issue := Issue{Playlist: playlistPath, Line: reference.Line}
+		p, ok := localPath(refURL)
+		if !ok {
+			v.report.Remote++
+			continue
+		}
+
+		if downloader.IsPlaylistFile(p) {
+			v.verifyPlaylist(refURL, issue)
+			continue
+		}
+
+		v.verifyFile(p, reference, issue)
+	}
+}
+
+// verifyFile checks a single referenced file (or byte range of one).
+func (v *verifier) verifyFile(p string, reference downloader.Reference, ref Issue) {
+	key := p
+	if reference.ByteRange != nil {
+		key = fmt.Sprintf("%s@%d+%d", p, reference.ByteRange.Offset, reference.ByteRange.Length)
+	}
+	if v.checked[key] {
+		return
+	}
+	v.checked[key] = true
+	v.files[p] = true
+
+	info, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		v.addIssue(ref, p, ProblemMissing, "")
+		return
+	}
+	if err != nil {
+		v.addIssue(ref, p, ProblemUnreadable, err.Error())
+		return
+	}
+	if info.Size() == 0 {
+		v.addIssue(ref, p, ProblemEmpty, "")
+		return
+	}
+
+	offset, length := int64(0), info.Size()
+	if r := reference.ByteRange; r != nil {
+		if r.Offset+r.Length > info.Size() {
+			v.addIssue(ref, p, ProblemRange, fmt.Sprintf("range %d@%d exceeds file size %d", r.Length, r.Offset, info.Size()))
+			return
+		}
+		offset, length = r.Offset, r.Length
+	}
+
+	// Keys are opaque, and AES-128 encrypts the whole segment, so there is
+	// no structure to check
+	if reference.Tag == "EXT-X-KEY" || reference.Tag == "EXT-X-SESSION-KEY" || reference.KeyMethod == "AES-128" {
+		return
+	}
+
+	data, err := readRange(p, offset, length)
+	if err != nil {
+		v.addIssue(ref, p, ProblemUnreadable, err.Error())
+		return
+	}
+
+	if err := checkStructure(p, data); err != nil {
+		v.addIssue(ref, p, ProblemCorrupt, err.Error())
+	}
+}
+
+// addIssue records a problem with a file.
+func (v *verifier) addIssue(ref Issue, p string, problem Problem, detail string) {
+	ref.Path = p
+	ref.Problem = problem
+	ref.Detail = detail
+	v.report.Issues = append(v.report.Issues, ref)
+}
+
+// readRange reads length bytes at offset from a file.
+func readRange(p string, offset, length int64) ([]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data, nil
+}
+
+// fileURL converts a local path to an absolute file:// URL, so playlists can
+// be parsed with the same URL resolution used for downloads.
+func fileURL(p string) (*url.URL, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", p, err)
+	}
+	slashed := filepath.ToSlash(abs)
+	if !strings.HasPrefix(slashed, "/") {
+		// Windows paths like C:/dir need a leading slash in URLs
+		slashed = "/" + slashed
+	}
+	return &url.URL{Scheme: "file", Path: slashed}, nil
+}
+
+// localPath converts a file:// URL back to a local path.
+//
+// Returns false for URLs that don't point at the local filesystem.
+func localPath(u *url.URL) (string, bool) {
+	if u.Scheme != "file" {
+		return "", false
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" && len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	return filepath.FromSlash(p), true
+}
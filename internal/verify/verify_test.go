@@ -0,0 +1,163 @@
+package verify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp4Box builds a box with the given type and payload.
+func mp4Box(boxType string, payload []byte) []byte {
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box, uint32(8+len(payload)))
+	copy(box[4:], boxType)
+	return append(box, payload...)
+}
+
+// tsPackets builds n valid MPEG-TS packets.
+func tsPackets(n int) []byte {
+	data := make([]byte, n*tsPacketSize)
+	for i := 0; i < n; i++ {
+		data[i*tsPacketSize] = tsSyncByte
+	}
+	return data
+}
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(p, content, 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+}
+
+func TestVerifyCompleteMirror(t *testing.T) {
+	dir := t.TempDir()
+	fragment := append(mp4Box("moof", []byte("xxxx")), mp4Box("mdat", []byte("data"))...)
+
+	writeFiles(t, dir, map[string][]byte{
+		"master.m3u8": []byte(`#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="en",URI="audio/index.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000,AUDIO="aud"
+video/index.m3u8
+`),
+		"video/index.m3u8": []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+seg0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="../key.bin"
+#EXTINF:10.0,
+seg1.ts
+#EXTINF:10.0,
+https://cdn.example.com/remote.ts
+#EXT-X-ENDLIST
+`),
+		"audio/index.m3u8": []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MAP:URI="media.mp4",BYTERANGE="16@0"
+#EXT-X-BYTERANGE:24@16
+#EXTINF:10.0,
+media.mp4
+#EXT-X-ENDLIST
+`),
+		"video/seg0.ts":   tsPackets(3),
+		"video/seg1.ts":   []byte("encrypted, so not checked"),
+		"key.bin":         []byte("0123456789abcdef"),
+		"audio/media.mp4": append(mp4Box("ftyp", []byte("isom0000")), fragment...),
+	})
+
+	report, err := Verify(filepath.Join(dir, "master.m3u8"))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	if !report.OK() {
+		t.Errorf("Expected no issues, got %+v", report.Issues)
+	}
+	if report.Playlists != 3 {
+		t.Errorf("Expected 3 playlists, got %d", report.Playlists)
+	}
+	if report.Files != 4 {
+		t.Errorf("Expected 4 files, got %d", report.Files)
+	}
+	if report.Remote != 1 {
+		t.Errorf("Expected 1 remote reference, got %d", report.Remote)
+	}
+}
+
+func TestVerifyBrokenMirror(t *testing.T) {
+	dir := t.TempDir()
+
+	corruptTS := tsPackets(2)
+	corruptTS[tsPacketSize] = 0x00
+
+	writeFiles(t, dir, map[string][]byte{
+		"index.m3u8": []byte(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.0,
+missing.ts
+#EXTINF:10.0,
+empty.ts
+#EXTINF:10.0,
+corrupt.ts
+#EXT-X-BYTERANGE:1000@0
+#EXTINF:10.0,
+short.ts
+#EXTINF:10.0,
+bad.m4s
+#EXT-X-ENDLIST
+`),
+		"empty.ts":   {},
+		"corrupt.ts": corruptTS,
+		"short.ts":   tsPackets(1),
+		"bad.m4s":    mp4Box("moof", bytes.Repeat([]byte{0}, 4))[:10],
+	})
+
+	report, err := Verify(filepath.Join(dir, "index.m3u8"))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	expected := map[string]Problem{
+		"missing.ts": ProblemMissing,
+		"empty.ts":   ProblemEmpty,
+		"corrupt.ts": ProblemCorrupt,
+		"short.ts":   ProblemRange,
+		"bad.m4s":    ProblemCorrupt,
+	}
+	if len(report.Issues) != len(expected) {
+		t.Fatalf("Expected %d issues, got %+v", len(expected), report.Issues)
+	}
+	for _, issue := range report.Issues {
+		name := filepath.Base(issue.Path)
+		if expected[name] != issue.Problem {
+			t.Errorf("%s: expected %s, got %s (%s)", name, expected[name], issue.Problem, issue.Detail)
+		}
+		if issue.Line == 0 {
+			t.Errorf("%s: expected a line number", name)
+		}
+	}
+}
+
+func TestCheckMP4(t *testing.T) {
+	valid := append(mp4Box("styp", []byte("msdh")), mp4Box("mdat", nil)...)
+	if err := checkMP4(valid); err != nil {
+		t.Errorf("Expected valid MP4, got %v", err)
+	}
+
+	truncated := mp4Box("mdat", []byte("payload"))
+	if err := checkMP4(truncated[:len(truncated)-1]); err == nil {
+		t.Error("Expected truncated box to fail")
+	}
+
+	if err := checkMP4([]byte{0, 0, 0, 8, 0xff, 0, 0, 0}); err == nil {
+		t.Error("Expected invalid box type to fail")
+	}
+}
@@ -0,0 +1,101 @@
+package webvtt
+
+import (
+	"sort"
+	"time"
+)
+
+// mpegtsRollover is where 33-bit MPEG-2 timestamps wrap around.
+const mpegtsRollover = 1 << 33
+
+// Offset returns how far the cue times of a segment are ahead of the MPEG-2
+// timeline: cue time t is presentation time t + Offset.
+func (m TimestampMap) Offset() time.Duration {
+	return mpegtsDuration(m.MPEGTS) - m.Local
+}
+
+// mpegtsDuration converts 90 kHz MPEG-2 ticks to a duration without
+// overflowing.
+func mpegtsDuration(ticks int64) time.Duration {
+	return time.Duration(ticks/90000)*time.Second + time.Duration(ticks%90000)*time.Second/90000
+}
+
+// Merge joins the segments of an HLS subtitle playlist, in playlist order,
+// into a single file whose timeline starts with the stream.
+//
+// Cue times are realigned with each segment's X-TIMESTAMP-MAP, relative to
+// the map of the first segment that has one, so the first segment's local
+// times are kept and later segments line up with it even if their maps
+// differ (including across an MPEG-2 timestamp rollover). Segments without a
+// map are taken as they are.
+//
+// Cues repeated in consecutive segments because they span a segment
+// boundary are kept once: identical cues are dropped, and a cue that
+// continues a cue with the same text and settings (starting where or before
+// it ends) extends it instead. Identifiers that appear more than once are
+// dropped, as they must be unique. STYLE and REGION blocks are kept once.
+func Merge(segments []*File) *File {
+	var first *TimestampMap
+	for _, segment := range segments {
+		if segment.TimestampMap != nil {
+			first = segment.TimestampMap
+			break
+		}
+	}
+
+	merged := &File{}
+	seenBlocks := make(map[string]bool)
+	var cues []Cue
+	for _, segment := range segments {
+		for _, block := range segment.Blocks {
+			if !seenBlocks[block] {
+				seenBlocks[block] = true
+				merged.Blocks = append(merged.Blocks, block)
+			}
+		}
+
+		var shift time.Duration
+		if m := segment.TimestampMap; m != nil {
+			ticks := m.MPEGTS
+			if ticks < first.MPEGTS-mpegtsRollover/2 {
+				ticks += mpegtsRollover
+			}
+			shift = TimestampMap{MPEGTS: ticks, Local: m.Local}.Offset() - first.Offset()
+		}
+		for _, cue := range segment.Cues {
+			cue.Start += shift
+			cue.End += shift
+			if cue.End <= 0 || cue.End < cue.Start {
+				continue
+			}
+			cue.Start = max(cue.Start, 0)
+			cues = append(cues, cue)
+		}
+	}
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+
+	type content struct{ settings, text string }
+	last := make(map[content]int) // Index in merged.Cues of the last cue with each content
+	ids := make(map[string]int)
+	for _, cue := range cues {
+		ids[cue.ID]++
+	}
+	for _, cue := range cues {
+		if ids[cue.ID] > 1 {
+			cue.ID = ""
+		}
+
+		key := content{cue.Settings, cue.Text}
+		if i, ok := last[key]; ok {
+			previous := &merged.Cues[i]
+			// Timestamps are rounded to the millisecond, so allow for that
+			if cue.Start <= previous.End+time.Millisecond {
+				previous.End = max(previous.End, cue.End)
+				continue
+			}
+		}
+		last[key] = len(merged.Cues)
+		merged.Cues = append(merged.Cues, cue)
+	}
+	return merged
+}
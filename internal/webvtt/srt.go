@@ -0,0 +1,51 @@
+package webvtt
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cueTag matches a WebVTT cue text tag, such as <c.yellow>, </c>, <v Bob>,
+// <i> or an inline timestamp like <00:00:01.500>.
+var cueTag = regexp.MustCompile(`<(/?)([A-Za-z]*)[^>]*>`)
+
+// srtTags are the tags SRT players understand, which are kept.
+var srtTags = map[string]bool{"b": true, "i": true, "u": true}
+
+// entities decodes the character references WebVTT allows in cue text.
+var entities = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&nbsp;", "\u00a0", "&lrm;", "\u200e", "&rlm;", "\u200f")
+
+// SRT serializes the file as SubRip (.srt) subtitles.
+//
+// Cues are numbered from 1. Cue settings, identifiers and STYLE and REGION
+// blocks have no SRT equivalent and are dropped, as are cue text tags other
+// than <b>, <i> and <u> (the text of voice and class spans is kept).
+func (f *File) SRT() []byte {
+	var buf bytes.Buffer
+	for i, cue := range f.Cues {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strconv.Itoa(i+1) + "\n")
+		buf.WriteString(formatTimestamp(cue.Start, ',') + " --> " + formatTimestamp(cue.End, ',') + "\n")
+		if text := srtText(cue.Text); text != "" {
+			buf.WriteString(text + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// srtText converts WebVTT cue text to SRT.
+func srtText(text string) string {
+	text = cueTag.ReplaceAllStringFunc(text, func(tag string) string {
+		parts := cueTag.FindStringSubmatch(tag)
+		name := strings.ToLower(parts[2])
+		if !srtTags[name] {
+			return ""
+		}
+		return "<" + parts[1] + name + ">"
+	})
+	return entities.Replace(text)
+}
@@ -0,0 +1,252 @@
+// Package webvtt parses, merges and converts the WebVTT subtitles of HLS
+// streams.
+//
+// HLS delivers subtitles as a media playlist of small WebVTT segments, each
+// with an X-TIMESTAMP-MAP header that ties its cue times to the MPEG-2
+// timeline of the audio and video. Merge stitches such segments back into a
+// single file on a timeline that starts with the stream.
+//
+// See: https://www.w3.org/TR/webvtt1/
+// See: https://datatracker.ietf.org/doc/html/rfc8216#section-3.5
+package webvtt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// utf8BOM is the byte order mark some packagers put in front of WEBVTT.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// File is a parsed WebVTT file or HLS subtitle segment.
+type File struct {
+	// TimestampMap is the X-TIMESTAMP-MAP header, if any
+	TimestampMap *TimestampMap
+	// Blocks are the STYLE and REGION blocks, as written
+	Blocks []string
+	// Cues are the cues, in the order written
+	Cues []Cue
+}
+
+// Cue is a single WebVTT cue.
+type Cue struct {
+	// ID is the optional cue identifier
+	ID string
+	// Start and End are when the cue is shown
+	Start time.Duration
+	End   time.Duration
+	// Settings are the cue settings after the end time (e.g. "line:0"), if
+	// any
+	Settings string
+	// Text is the cue payload, with lines separated by "\n"
+	Text string
+}
+
+// TimestampMap is the X-TIMESTAMP-MAP header of an HLS subtitle segment: the
+// cue time LOCAL is the MPEG-2 presentation time MPEGTS (in 90 kHz units).
+type TimestampMap struct {
+	MPEGTS int64
+	Local  time.Duration
+}
+
+// Parse parses WebVTT content.
+//
+// NOTE blocks are dropped, and cue blocks without a valid timing line are
+// skipped, like players do.
+//
+// Returns an error if the content doesn't start with the WEBVTT signature or
+// has an invalid X-TIMESTAMP-MAP.
+func Parse(content []byte) (*File, error) {
+	content = bytes.TrimPrefix(content, utf8BOM)
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	blocks := splitBlocks(text)
+	if len(blocks) == 0 || !isSignature(blocks[0][0]) {
+		return nil, errors.New("missing WEBVTT signature")
+	}
+
+	file := &File{}
+	for _, line := range blocks[0][1:] {
+		if value, ok := strings.CutPrefix(line, "X-TIMESTAMP-MAP="); ok {
+			timestampMap, err := parseTimestampMap(value)
+			if err != nil {
+				return nil, err
+			}
+			file.TimestampMap = timestampMap
+		}
+	}
+
+	for _, block := range blocks[1:] {
+		first := block[0]
+		switch {
+		case first == "NOTE" || strings.HasPrefix(first, "NOTE ") || strings.HasPrefix(first, "NOTE\t"):
+			continue
+		case (strings.TrimSpace(first) == "STYLE" || strings.TrimSpace(first) == "REGION") && !strings.Contains(first, "-->"):
+			file.Blocks = append(file.Blocks, strings.Join(block, "\n"))
+			continue
+		}
+
+		cue := Cue{}
+		timing := 0
+		if !strings.Contains(first, "-->") {
+			if len(block) < 2 || !strings.Contains(block[1], "-->") {
+				continue
+			}
+			cue.ID = first
+			timing = 1
+		}
+		if err := parseTiming(block[timing], &cue); err != nil {
+			continue
+		}
+		cue.Text = strings.Join(block[timing+1:], "\n")
+		file.Cues = append(file.Cues, cue)
+	}
+	return file, nil
+}
+
+// splitBlocks splits content into blocks of lines separated by blank lines.
+func splitBlocks(text string) [][]string {
+	var blocks [][]string
+	var block []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// isSignature reports whether a line is the WEBVTT file signature, which may
+// be followed by a space or tab and free text.
+func isSignature(line string) bool {
+	rest, ok := strings.CutPrefix(line, "WEBVTT")
+	return ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// parseTimestampMap parses the value of an X-TIMESTAMP-MAP header (e.g.
+// "MPEGTS:900000,LOCAL:00:00:00.000").
+func parseTimestampMap(value string) (*TimestampMap, error) {
+	timestampMap := &TimestampMap{}
+	for _, field := range strings.Split(value, ",") {
+		key, v, _ := strings.Cut(strings.TrimSpace(field), ":")
+		var err error
+		switch key {
+		case "MPEGTS":
+			timestampMap.MPEGTS, err = strconv.ParseInt(v, 10, 64)
+		case "LOCAL":
+			timestampMap.Local, err = ParseTimestamp(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid X-TIMESTAMP-MAP %q: %w", value, err)
+		}
+	}
+	return timestampMap, nil
+}
+
+// parseTiming parses a cue timing line ("start --> end settings").
+func parseTiming(line string, cue *Cue) error {
+	startStr, rest, _ := strings.Cut(line, "-->")
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return errors.New("missing end time")
+	}
+
+	var err error
+	if cue.Start, err = ParseTimestamp(strings.TrimSpace(startStr)); err != nil {
+		return err
+	}
+	if cue.End, err = ParseTimestamp(fields[0]); err != nil {
+		return err
+	}
+	cue.Settings = strings.Join(fields[1:], " ")
+	return nil
+}
+
+// ParseTimestamp parses a WebVTT timestamp ("mm:ss.ttt" or "hh:mm:ss.ttt").
+// A comma is accepted as the decimal separator too, as SRT uses.
+func ParseTimestamp(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	secondsStr, fraction, ok := strings.Cut(strings.Replace(parts[len(parts)-1], ",", ".", 1), ".")
+	if !ok || fraction == "" || len(fraction) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	fraction += strings.Repeat("0", 3-len(fraction))
+
+	var values []int64
+	for _, part := range append(parts[:len(parts)-1], secondsStr, fraction) {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 3 {
+		values = append([]int64{0}, values...)
+	}
+	hours, minutes, seconds, millis := values[0], values[1], values[2], values[3]
+	if minutes > 59 || seconds > 59 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond, nil
+}
+
+// FormatTimestamp formats a time as a WebVTT timestamp ("hh:mm:ss.ttt"),
+// rounded to the millisecond.
+func FormatTimestamp(d time.Duration) string {
+	return formatTimestamp(d, '.')
+}
+
+// formatTimestamp formats a time with the given decimal separator.
+func formatTimestamp(d time.Duration, separator byte) string {
+	d = max(d.Round(time.Millisecond), 0)
+	hours := d / time.Hour
+	minutes := d % time.Hour / time.Minute
+	seconds := d % time.Minute / time.Second
+	millis := d % time.Second / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", hours, minutes, seconds, separator, millis)
+}
+
+// Bytes serializes the file as WebVTT.
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+	if f.TimestampMap != nil {
+		fmt.Fprintf(&buf, "X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:%s\n", f.TimestampMap.MPEGTS, FormatTimestamp(f.TimestampMap.Local))
+	}
+	for _, block := range f.Blocks {
+		buf.WriteString("\n" + block + "\n")
+	}
+	for _, cue := range f.Cues {
+		buf.WriteString("\n")
+		if cue.ID != "" {
+			buf.WriteString(cue.ID + "\n")
+		}
+		buf.WriteString(FormatTimestamp(cue.Start) + " --> " + FormatTimestamp(cue.End))
+		if cue.Settings != "" {
+			buf.WriteString(" " + cue.Settings)
+		}
+		buf.WriteString("\n")
+		if cue.Text != "" {
+			buf.WriteString(cue.Text + "\n")
+		}
+	}
+	return buf.Bytes()
+}
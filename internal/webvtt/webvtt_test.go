@@ -0,0 +1,183 @@
+package webvtt
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	content := "\ufeffWEBVTT - segment 1\r\n" +
+		"X-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\r\n" +
+		"\r\n" +
+		"STYLE\r\n::cue { color: yellow }\r\n" +
+		"\r\n" +
+		"NOTE a comment\r\n" +
+		"\r\n" +
+		"intro\r\n" +
+		"00:01.000 --> 00:02.500 line:0 align:start\r\n" +
+		"Hello\r\n<i>world</i>\r\n" +
+		"\r\n" +
+		"01:00:03.000 --> 01:00:04.000\r\n" +
+		"\r\n" +
+		"not a timing line\r\ntext\r\n"
+
+	file, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if file.TimestampMap == nil || file.TimestampMap.MPEGTS != 900000 || file.TimestampMap.Local != 0 {
+		t.Errorf("Unexpected timestamp map: %+v", file.TimestampMap)
+	}
+	if len(file.Blocks) != 1 || file.Blocks[0] != "STYLE\n::cue { color: yellow }" {
+		t.Errorf("Unexpected blocks: %q", file.Blocks)
+	}
+	expected := []Cue{
+		{ID: "intro", Start: time.Second, End: 2500 * time.Millisecond, Settings: "line:0 align:start", Text: "Hello\n<i>world</i>"},
+		{Start: time.Hour + 3*time.Second, End: time.Hour + 4*time.Second},
+	}
+	if len(file.Cues) != len(expected) {
+		t.Fatalf("Cues = %+v; expected %+v", file.Cues, expected)
+	}
+	for i := range expected {
+		if file.Cues[i] != expected[i] {
+			t.Errorf("Cue %d = %+v; expected %+v", i, file.Cues[i], expected[i])
+		}
+	}
+
+	for _, invalid := range []string{"", "WEBVTTX\n", "1\n00:00:01,000 --> 00:00:02,000\nSRT\n", "WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:abc,LOCAL:00:00:00.000\n"} {
+		if _, err := Parse([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"00:01.000", time.Second, false},
+		{"01:02:03.456", time.Hour + 2*time.Minute + 3456*time.Millisecond, false},
+		{"100:00:00.000", 100 * time.Hour, false},
+		{"00:00:01,5", 1500 * time.Millisecond, false},
+		{"00:60.000", 0, true},
+		{"1.000", 0, true},
+		{"00:01", 0, true},
+		{"00:01.0000", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("ParseTimestamp(%q) = %v, %v; expected %v", tt.input, got, err, tt.expected)
+		}
+	}
+
+	if got := FormatTimestamp(time.Hour + 2*time.Minute + 3456*time.Millisecond); got != "01:02:03.456" {
+		t.Errorf("FormatTimestamp() = %s", got)
+	}
+}
+
+// segment builds a subtitle segment with the given timestamp map and cues.
+func segment(mpegts int64, local time.Duration, cues ...Cue) *File {
+	return &File{TimestampMap: &TimestampMap{MPEGTS: mpegts, Local: local}, Cues: cues}
+}
+
+func TestMerge(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		name     string
+		segments []*File
+		expected []Cue
+	}{
+		{
+			name: "same map everywhere",
+			segments: []*File{
+				segment(900000, 0, Cue{Start: 1 * s, End: 3 * s, Text: "one"}, Cue{Start: 5 * s, End: 7 * s, Text: "spans"}),
+				segment(900000, 0, Cue{Start: 5 * s, End: 7 * s, Text: "spans"}, Cue{Start: 8 * s, End: 9 * s, Text: "two"}),
+			},
+			expected: []Cue{{Start: 1 * s, End: 3 * s, Text: "one"}, {Start: 5 * s, End: 7 * s, Text: "spans"}, {Start: 8 * s, End: 9 * s, Text: "two"}},
+		},
+		{
+			name: "per-segment maps",
+			segments: []*File{
+				segment(900000, 0, Cue{Start: 1 * s, End: 2 * s, Text: "one"}),
+				// Starts 6s later on the MPEG-2 timeline, with local times from 0
+				segment(900000+6*90000, 0, Cue{Start: 1 * s, End: 2 * s, Text: "two"}),
+				// Local times that don't start at 0
+				segment(900000+12*90000, 100*s, Cue{Start: 101 * s, End: 102 * s, Text: "three"}),
+			},
+			expected: []Cue{{Start: 1 * s, End: 2 * s, Text: "one"}, {Start: 7 * s, End: 8 * s, Text: "two"}, {Start: 13 * s, End: 14 * s, Text: "three"}},
+		},
+		{
+			name: "rollover",
+			segments: []*File{
+				segment(mpegtsRollover-90000, 0, Cue{Start: 0, End: 1 * s, Text: "before"}),
+				segment(90000, 0, Cue{Start: 0, End: 1 * s, Text: "after"}),
+			},
+			expected: []Cue{{Start: 0, End: 1 * s, Text: "before"}, {Start: 2 * s, End: 3 * s, Text: "after"}},
+		},
+		{
+			name: "cue split at a segment boundary",
+			segments: []*File{
+				segment(0, 0, Cue{Start: 4 * s, End: 6 * s, Settings: "line:0", Text: "long"}),
+				segment(0, 0, Cue{Start: 6 * s, End: 9 * s, Settings: "line:0", Text: "long"}, Cue{Start: 10 * s, End: 11 * s, Text: "long"}),
+			},
+			expected: []Cue{{Start: 4 * s, End: 9 * s, Settings: "line:0", Text: "long"}, {Start: 10 * s, End: 11 * s, Text: "long"}},
+		},
+		{
+			name: "duplicate identifiers",
+			segments: []*File{
+				segment(0, 0, Cue{ID: "1", Start: 0, End: 1 * s, Text: "a"}, Cue{ID: "x", Start: 1 * s, End: 2 * s, Text: "b"}),
+				segment(0, 0, Cue{ID: "1", Start: 2 * s, End: 3 * s, Text: "c"}),
+			},
+			expected: []Cue{{Start: 0, End: 1 * s, Text: "a"}, {ID: "x", Start: 1 * s, End: 2 * s, Text: "b"}, {Start: 2 * s, End: 3 * s, Text: "c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := Merge(tt.segments)
+			if merged.TimestampMap != nil {
+				t.Error("Expected no timestamp map in the merged file")
+			}
+			if len(merged.Cues) != len(tt.expected) {
+				t.Fatalf("Cues = %+v; expected %+v", merged.Cues, tt.expected)
+			}
+			for i := range tt.expected {
+				if merged.Cues[i] != tt.expected[i] {
+					t.Errorf("Cue %d = %+v; expected %+v", i, merged.Cues[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBytesAndSRT(t *testing.T) {
+	file := &File{
+		Blocks: []string{"STYLE\n::cue { color: yellow }"},
+		Cues: []Cue{
+			{ID: "intro", Start: time.Second, End: 2500 * time.Millisecond, Settings: "line:0", Text: "<v Bob><c.loud>Hello</c></v>\n<i>world</i> &amp; <00:00:02.000>more"},
+			{Start: time.Hour, End: time.Hour + time.Second, Text: "&lt;b&gt; is bold"},
+		},
+	}
+
+	vtt := string(file.Bytes())
+	expectedVTT := "WEBVTT\n\nSTYLE\n::cue { color: yellow }\n\nintro\n00:00:01.000 --> 00:00:02.500 line:0\n<v Bob><c.loud>Hello</c></v>\n<i>world</i> &amp; <00:00:02.000>more\n\n01:00:00.000 --> 01:00:01.000\n&lt;b&gt; is bold\n"
+	if vtt != expectedVTT {
+		t.Errorf("Bytes() = %q; expected %q", vtt, expectedVTT)
+	}
+	if reparsed, err := Parse([]byte(vtt)); err != nil || len(reparsed.Cues) != 2 || reparsed.Cues[0] != file.Cues[0] {
+		t.Errorf("Expected the output to parse back to the same cues, got %+v, %v", reparsed, err)
+	}
+
+	srt := string(file.SRT())
+	expectedSRT := "1\n00:00:01,000 --> 00:00:02,500\nHello\n<i>world</i> & more\n\n2\n01:00:00,000 --> 01:00:01,000\n<b> is bold\n"
+	if srt != expectedSRT {
+		t.Errorf("SRT() = %q; expected %q", srt, expectedSRT)
+	}
+	if !strings.HasPrefix(string((&File{}).Bytes()), "WEBVTT\n") {
+		t.Error("Expected an empty file to have the WEBVTT signature")
+	}
+}